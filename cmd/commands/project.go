@@ -0,0 +1,229 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"go.uber.org/zap"
+)
+
+type projectCommandOptions struct {
+	Yes  bool
+	All  bool
+	Args conf.Args
+}
+
+func runProjectCommand(command func(storage *project.DiskStorage, opts projectCommandOptions) error) error {
+	cfg := struct {
+		Gisquick struct {
+			ProjectsRoot string `conf:"default:/publish"`
+		}
+		Yes  bool `conf:"help:Skip confirmation"`
+		All  bool `conf:"help:Process all projects"`
+		Args conf.Args
+	}{}
+
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	log, err := createLogger(zap.WarnLevel)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	defer log.Sync()
+
+	storage := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	defer storage.Close()
+	opts := projectCommandOptions{Yes: cfg.Yes, All: cfg.All, Args: cfg.Args}
+	// flags placed after positional arguments are not processed by conf package
+	var found bool
+	if opts.Args, found = popFlag(opts.Args, "--yes", "-y"); found {
+		opts.Yes = true
+	}
+	if opts.Args, found = popFlag(opts.Args, "--all"); found {
+		opts.All = true
+	}
+	return command(storage, opts)
+}
+
+// popFlag removes boolean flag from the list of positional arguments
+func popFlag(args conf.Args, names ...string) (conf.Args, bool) {
+	found := false
+	rest := make(conf.Args, 0, len(args))
+	for _, arg := range args {
+		if contains(names, arg) {
+			found = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return rest, found
+}
+
+func contains(items []string, value string) bool {
+	for _, i := range items {
+		if i == value {
+			return true
+		}
+	}
+	return false
+}
+
+func formatByteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+func listProjects(storage *project.DiskStorage, opts projectCommandOptions) error {
+	var projects []string
+	var err error
+	if username := opts.Args.Num(0); username != "" {
+		projects, err = storage.UserProjects(username)
+	} else {
+		projects, err = storage.AllProjects(true)
+	}
+	if err != nil {
+		return fmt.Errorf("listing projects: %w", err)
+	}
+	for _, name := range projects {
+		info, err := storage.GetProjectInfo(name)
+		if err != nil {
+			fmt.Printf("%-50s (failed to read project info: %s)\n", name, err)
+			continue
+		}
+		fmt.Printf("%-50s %10s  %-10s %s\n", name, formatByteSize(info.Size), info.State, info.Title)
+	}
+	return nil
+}
+
+func deleteProject(storage *project.DiskStorage, opts projectCommandOptions) error {
+	if len(opts.Args) != 1 {
+		return fmt.Errorf("Invalid number of arguments")
+	}
+	name := opts.Args.Num(0)
+	if !storage.CheckProjectExists(name) {
+		return domain.ErrProjectNotExists
+	}
+	fmt.Printf("Project: %s\n", name)
+	if info, err := storage.GetProjectInfo(name); err != nil {
+		fmt.Printf("Size: unknown (failed to read project info: %s)\n", err)
+	} else {
+		fmt.Printf("Size: %s\n", formatByteSize(info.Size))
+	}
+	if !opts.Yes && !confirm("Delete project?") {
+		fmt.Println("Aborted")
+		return nil
+	}
+	return storage.Delete(name)
+}
+
+func reindexProject(storage *project.DiskStorage, name string) error {
+	index, err := storage.RebuildFilesIndex(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-50s %6d files %10s\n", name, len(index.Index), formatByteSize(index.TotalSize()))
+	return nil
+}
+
+func reindex(storage *project.DiskStorage, opts projectCommandOptions) error {
+	if opts.All {
+		if len(opts.Args) != 0 {
+			return fmt.Errorf("Invalid number of arguments")
+		}
+		projects, err := storage.AllProjects(true)
+		if err != nil {
+			return fmt.Errorf("listing projects: %w", err)
+		}
+		failed := 0
+		for _, name := range projects {
+			if err := reindexProject(storage, name); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to reindex %d of %d projects", failed, len(projects))
+		}
+		return nil
+	}
+	if len(opts.Args) != 1 {
+		return fmt.Errorf("Invalid number of arguments")
+	}
+	return reindexProject(storage, opts.Args.Num(0))
+}
+
+func fixSizes(storage *project.DiskStorage, opts projectCommandOptions) error {
+	var projects []string
+	var err error
+	if username := opts.Args.Num(0); username != "" {
+		projects, err = storage.UserProjects(username)
+	} else {
+		projects, err = storage.AllProjects(true)
+	}
+	if err != nil {
+		return fmt.Errorf("listing projects: %w", err)
+	}
+	fixed := 0
+	failed := 0
+	for _, name := range projects {
+		before, after, err := storage.FixProjectSize(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			failed++
+			continue
+		}
+		if before != after {
+			fmt.Printf("%-50s %10s -> %s\n", name, formatByteSize(before), formatByteSize(after))
+			fixed++
+		}
+	}
+	fmt.Printf("Fixed %d of %d projects\n", fixed, len(projects))
+	if failed > 0 {
+		return fmt.Errorf("failed to fix size of %d of %d projects", failed, len(projects))
+	}
+	return nil
+}
+
+func ListProjects() error {
+	return runProjectCommand(listProjects)
+}
+
+func DeleteProject() error {
+	return runProjectCommand(deleteProject)
+}
+
+func Reindex() error {
+	return runProjectCommand(reindex)
+}
+
+func FixSizes() error {
+	return runProjectCommand(fixSizes)
+}
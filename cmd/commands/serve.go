@@ -27,6 +27,7 @@ import (
 	mail "github.com/xhit/go-simple-mail/v2"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func parseByteSize(value string) (int64, error) {
@@ -63,46 +64,100 @@ func (b *ByteSize) UnmarshalText(text []byte) error {
 
 type AppConfig struct {
 	Gisquick struct {
-		Debug                bool   `conf:"default:false"`
-		Language             string `conf:"default:en-us"`
-		ProjectsRoot         string `conf:"default:/publish"`
-		MapCacheRoot         string
-		ThumbnailsRoot       string `conf:"default:/tmp/cache"`
-		TemplatesRoot        string `conf:"default:./templates"`
-		MapserverURL         string
-		PluginsURL           string
-		SignupAPI            bool
-		ProjectSizeLimit     ByteSize `conf:"default:-1"`
-		AccountStorageLimit  ByteSize `conf:"default:-1"`
-		AccountProjectsLimit int      `conf:"default:-1"`
-		AccountLimiterConfig string
-		LandingProject       string
-		ProjectCustomization bool
-		Extensions           string
+		Debug                       bool   `conf:"default:false"`
+		Language                    string `conf:"default:en-us"`
+		ProjectsRoot                string `conf:"default:/publish"`
+		MapCacheRoot                string
+		MapCacheImageFormat         string   `conf:"default:png,help:Image format of cached tiles when not specified in the request (png|jpeg)"`
+		ThumbnailsRoot              string   `conf:"default:/tmp/cache"`
+		ThumbnailsCacheSize         ByteSize `conf:"default:-1,help:Max size of thumbnails cache, least recently used thumbnails are removed when exceeded (-1 = unlimited)"`
+		TemplatesRoot               string   `conf:"default:./templates,help:Directory with email templates"`
+		AdminConfigPath             string   `conf:"default:/etc/gisquick/admin.json,help:Path to the admin web app config (JSON)"`
+		WebAppRoot                  string   `conf:"help:Directory with web client files (served with fallback to index.html when set)"`
+		MapserverURL                string
+		MapserverTimeout            time.Duration `conf:"default:30s"`
+		MapserverRetries            int           `conf:"default:2"`
+		MapserverProjectConcurrency int           `conf:"default:0,help:Max concurrent OWS requests per project (0 = unlimited)"`
+		MapserverQueueTimeout       time.Duration `conf:"default:10s"`
+		MapserverMaxIdleConns       int           `conf:"default:64,help:Max idle (keep-alive) connections to the mapserver"`
+		MapserverMaxConns           int           `conf:"default:0,help:Max connections to the mapserver (0 = unlimited)"`
+		MapserverIdleConnTimeout    time.Duration `conf:"default:90s"`
+		MapserverDialTimeout        time.Duration `conf:"default:10s"`
+		MapserverResponseTimeout    time.Duration `conf:"default:0s,help:Max time to wait for mapserver response headers (0 = no limit)"`
+		MapserverErrorDetails       bool          `conf:"default:false,help:Include upstream error message in mapserver proxy error responses"`
+		PublishRoot                 string        `conf:"default:/publish,help:Projects directory as mounted on the mapserver"`
+		PluginsURL                  string
+		SignupAPI                   bool
+		ProjectSizeLimit            ByteSize      `conf:"default:-1"`
+		UploadWorkers               int           `conf:"default:1,help:Number of workers writing uploaded files (1 = sequential writing)"`
+		UploadBufferSize            ByteSize      `conf:"default:1M,help:Max size of uploaded file buffered in memory for concurrent writing"`
+		DeduplicateFiles            bool          `conf:"default:false,help:Store identical media files (web/ directory) only once (as hard links)"`
+		PartialFilesMaxAge          time.Duration `conf:"default:24h,help:Age after which partial files of interrupted uploads are removed (0 = disabled)"`
+		WfsTransactionMaxSize       ByteSize      `conf:"default:10M,help:Max body size of WFS transaction (-1 = unlimited)"`
+		WfsTransactionMaxFeatures   int           `conf:"default:1000,help:Max number of features in WFS transaction (-1 = unlimited)"`
+		AccountStorageLimit         ByteSize      `conf:"default:-1"`
+		AccountProjectsLimit        int           `conf:"default:-1"`
+		UploadAllowedExtensions     []string      `conf:"help:File extensions allowed in project uploads (separated by ;), all extensions are allowed when empty"`
+		UploadDeniedExtensions      []string      `conf:"help:File extensions denied in project uploads (separated by ;)"`
+		AccountLimiter              string        `conf:"help:Accounts limiter type (simple|file|db)"`
+		AccountLimiterConfig        string
+		LandingProject              string
+		DefaultProjection           string `conf:"default:EPSG:3857,help:Map projection used when missing in project metadata"`
+		DefaultUnits                string `conf:"default:meters,help:Map units used when missing in project metadata (meters|degrees)"`
+		ProjectCustomization        bool
+		Extensions                  string
 	}
 	Auth struct {
-		SessionExpiration    time.Duration `conf:"default:24h"`
-		EmailTokenExpiration time.Duration `conf:"default:72h"`
-		SecretKey            string        `conf:"default:secret-key,mask"`
+		SessionExpiration       time.Duration `conf:"default:24h"`
+		EmailTokenExpiration    time.Duration `conf:"default:72h"`
+		ActivationEmailInterval time.Duration `conf:"default:2m,help:Min interval between activation emails sent to the same address"`
+		SecretKey               string        `conf:"default:secret-key,mask"`
+		PasswordHashCost        int           `conf:"default:10,help:Bcrypt cost of password hashes"`
+		GuestUsername           string        `conf:"default:anonymous,help:Name of unauthenticated users in logs and default values"`
 	}
 	Web struct {
-		ReadTimeout     time.Duration `conf:"default:5s"`
-		WriteTimeout    time.Duration `conf:"default:10s"`
-		IdleTimeout     time.Duration `conf:"default:120s"`
-		ShutdownTimeout time.Duration `conf:"default:20s"`
-		SiteURL         string        `conf:"default:http://localhost"`
-		APIHost         string        `conf:"default:0.0.0.0:3000"`
+		ReadTimeout             time.Duration `conf:"default:5s"`
+		WriteTimeout            time.Duration `conf:"default:10s"`
+		RequestTimeout          time.Duration `conf:"default:30s,help:Max duration of API requests, except uploads, downloads, OWS and websockets (0 = no limit)"`
+		MapConfigCacheTTL       time.Duration `conf:"default:1m,help:Cache duration of map config of public projects without roles (0 = disabled)"`
+		IdleTimeout             time.Duration `conf:"default:120s"`
+		ShutdownTimeout         time.Duration `conf:"default:20s"`
+		SiteURL                 string        `conf:"default:http://localhost"`
+		ContentSecurityPolicy   string
+		ReferrerPolicy          string        `conf:"default:strict-origin-when-cross-origin"`
+		FrameOptions            string        `conf:"default:SAMEORIGIN,help:X-Frame-Options header value (DENY|SAMEORIGIN), empty to disable"`
+		FrameAllowedOrigins     []string      `conf:"help:Origins allowed to embed pages in iframes (separated by ;)"`
+		WebsocketOrigins        []string      `conf:"help:Origins allowed to open websocket connections (separated by ;), defaults to SiteURL origin"`
+		WebsocketAnyOrigin      bool          `conf:"default:false,help:Accept websocket connections from any origin (for development only)"`
+		WebsocketMaxMessageSize ByteSize      `conf:"default:4M,help:Max size of received websocket messages (0 = unlimited)"`
+		WebsocketBufferSize     int           `conf:"default:0,help:Number of messages buffered for disconnected websocket peer (0 = disabled)"`
+		WebsocketBufferTTL      time.Duration `conf:"default:1m,help:Expiration of buffered websocket messages"`
+		APIHost                 string        `conf:"default:0.0.0.0:3000"`
+	}
+	Webhooks struct {
+		Workers              int           `conf:"default:2,help:Number of workers delivering project webhooks"`
+		QueueSize            int           `conf:"default:100,help:Max number of pending webhook deliveries"`
+		Attempts             int           `conf:"default:3,help:Max delivery attempts of a webhook event"`
+		Timeout              time.Duration `conf:"default:10s"`
+		RetryDelay           time.Duration `conf:"default:1s,help:Delay before the first retry (doubled with every next attempt)"`
+		AllowPrivateNetworks bool          `conf:"default:false,help:Allow webhooks to loopback, private and link-local addresses"`
+	}
+	Log struct {
+		Format string `conf:"default:json,help:Log format (json|console)"`
+		Level  string `conf:"help:Log level (debug|info|warn|error), defaults to debug in debug mode and info otherwise"`
+		Output string `conf:"default:stderr,help:Log output (stderr|stdout or file path)"`
 	}
 	Postgres struct {
-		User               string `conf:"default:postgres"`
-		Password           string `conf:"default:postgres,mask"`
-		Host               string `conf:"default:postgres"`
-		Name               string `conf:"default:postgres,env:POSTGRES_DB"`
-		Port               int    `conf:"default:5432"`
-		MaxIdleConns       int    `conf:"default:3"`
-		MaxOpenConns       int    `conf:"default:3"`
-		SSLMode            string `conf:"default:disable"`
-		StatementCacheMode string `conf:"default:prepare"`
+		User               string        `conf:"default:postgres"`
+		Password           string        `conf:"default:postgres,mask"`
+		Host               string        `conf:"default:postgres"`
+		Name               string        `conf:"default:postgres,env:POSTGRES_DB"`
+		Port               int           `conf:"default:5432"`
+		MaxIdleConns       int           `conf:"default:3"`
+		MaxOpenConns       int           `conf:"default:3"`
+		SSLMode            string        `conf:"default:disable"`
+		StatementCacheMode string        `conf:"default:prepare"`
+		ConnectMaxWait     time.Duration `conf:"default:30s,help:Max time to wait for the database to become available on startup"`
 	}
 	Redis struct {
 		Addr     string `conf:"default:redis:6379"` // "/var/run/redis/redis.sock"
@@ -151,15 +206,15 @@ func CreateServer() (ServerHandle, error) {
 		}
 		return handle, fmt.Errorf("parsing config: %w", err)
 	}
-	logLevel := zap.InfoLevel
-	if cfg.Gisquick.Debug {
-		logLevel = zap.DebugLevel
+	logLevel, err := parseLogLevel(cfg.Log.Level, cfg.Gisquick.Debug)
+	if err != nil {
+		return handle, fmt.Errorf("parsing config: %w", err)
 	}
-	log, err := createLogger(logLevel)
-	handle.Logger = log
+	log, err := createLoggerWithConfig(logLevel, cfg.Log.Format, cfg.Log.Output)
 	if err != nil {
 		return handle, fmt.Errorf("failed to create logger: %w", err)
 	}
+	handle.Logger = log
 
 	out, err := conf.String(&cfg)
 	if err != nil {
@@ -169,7 +224,7 @@ func CreateServer() (ServerHandle, error) {
 	log.Infow("startup", "config", out)
 
 	// Database
-	dbConn, err := server.OpenDB(server.DBConfig{
+	dbConn, err := server.OpenDBWithRetry(log, server.DBConfig{
 		User:               cfg.Postgres.User,
 		Password:           cfg.Postgres.Password,
 		Host:               cfg.Postgres.Host,
@@ -179,7 +234,7 @@ func CreateServer() (ServerHandle, error) {
 		MaxOpenConns:       cfg.Postgres.MaxOpenConns,
 		SSLMode:            cfg.Postgres.SSLMode,
 		StatementCacheMode: cfg.Postgres.StatementCacheMode,
-	})
+	}, cfg.Postgres.ConnectMaxWait)
 	handle.DB = dbConn
 	if err != nil {
 		return handle, fmt.Errorf("connecting to db: %w", err)
@@ -217,53 +272,148 @@ func CreateServer() (ServerHandle, error) {
 	}
 
 	notifications := project.NewRedisNotificationStore(log, rdb)
+	projectLocks := project.NewRedisProjectLocks(rdb)
+	emailThrottle := security.NewRedisThrottle(rdb, "activation_email")
 
 	conf := server.Config{
-		Language:             cfg.Gisquick.Language,
-		LandingProject:       cfg.Gisquick.LandingProject,
-		MapserverURL:         cfg.Gisquick.MapserverURL,
-		MapCacheRoot:         cfg.Gisquick.MapCacheRoot,
-		ThumbnailsRoot:       cfg.Gisquick.ThumbnailsRoot,
-		ProjectsRoot:         cfg.Gisquick.ProjectsRoot,
-		PluginsURL:           cfg.Gisquick.PluginsURL,
-		SignupAPI:            cfg.Gisquick.SignupAPI,
-		SiteURL:              cfg.Web.SiteURL,
-		MaxProjectSize:       int64(cfg.Gisquick.ProjectSizeLimit),
-		ProjectCustomization: cfg.Gisquick.ProjectCustomization,
+		Language:                    cfg.Gisquick.Language,
+		LandingProject:              cfg.Gisquick.LandingProject,
+		MapserverURL:                cfg.Gisquick.MapserverURL,
+		MapserverTimeout:            cfg.Gisquick.MapserverTimeout,
+		MapserverRetries:            cfg.Gisquick.MapserverRetries,
+		MapserverProjectConcurrency: cfg.Gisquick.MapserverProjectConcurrency,
+		MapserverQueueTimeout:       cfg.Gisquick.MapserverQueueTimeout,
+		MapserverMaxIdleConns:       cfg.Gisquick.MapserverMaxIdleConns,
+		MapserverMaxConns:           cfg.Gisquick.MapserverMaxConns,
+		MapserverIdleConnTimeout:    cfg.Gisquick.MapserverIdleConnTimeout,
+		MapserverDialTimeout:        cfg.Gisquick.MapserverDialTimeout,
+		MapserverResponseTimeout:    cfg.Gisquick.MapserverResponseTimeout,
+		MapserverErrorDetails:       cfg.Gisquick.MapserverErrorDetails,
+		PublishRoot:                 cfg.Gisquick.PublishRoot,
+		MapCacheRoot:                cfg.Gisquick.MapCacheRoot,
+		MapCacheImageFormat:         cfg.Gisquick.MapCacheImageFormat,
+		ThumbnailsRoot:              cfg.Gisquick.ThumbnailsRoot,
+		ThumbnailsCacheSize:         int64(cfg.Gisquick.ThumbnailsCacheSize),
+		ProjectsRoot:                cfg.Gisquick.ProjectsRoot,
+		WebAppRoot:                  cfg.Gisquick.WebAppRoot,
+		TemplatesRoot:               cfg.Gisquick.TemplatesRoot,
+		AdminConfigPath:             cfg.Gisquick.AdminConfigPath,
+		PluginsURL:                  cfg.Gisquick.PluginsURL,
+		SignupAPI:                   cfg.Gisquick.SignupAPI,
+		SiteURL:                     cfg.Web.SiteURL,
+		ContentSecurityPolicy:       cfg.Web.ContentSecurityPolicy,
+		ReferrerPolicy:              cfg.Web.ReferrerPolicy,
+		FrameOptions:                cfg.Web.FrameOptions,
+		FrameAllowedOrigins:         cfg.Web.FrameAllowedOrigins,
+		RequestTimeout:              cfg.Web.RequestTimeout,
+		MapConfigMaxAge:             cfg.Web.MapConfigCacheTTL,
+		MaxProjectSize:              int64(cfg.Gisquick.ProjectSizeLimit),
+		WfsTransactionMaxSize:       int64(cfg.Gisquick.WfsTransactionMaxSize),
+		WfsTransactionMaxFeatures:   cfg.Gisquick.WfsTransactionMaxFeatures,
+		ActivationEmailInterval:     cfg.Auth.ActivationEmailInterval,
+		ProjectCustomization:        cfg.Gisquick.ProjectCustomization,
 	}
 
 	// Services
 	accountsRepo := postgres.NewAccountsRepository(dbConn)
 	tokenGenerator := security.NewTokenGenerator(cfg.Auth.SecretKey, "signup", cfg.Auth.EmailTokenExpiration)
-	emailSender := email.NewAccountsEmailSender(
-		es,
-		cfg.Gisquick.TemplatesRoot,
-		cfg.Email.Sender,
-		cfg.Web.SiteURL,
-		cfg.Email.ActivationSubject,
-		cfg.Email.PasswordResetSubject,
-	)
-	accountsService := application.NewAccountsService(emailSender, accountsRepo, tokenGenerator)
+	// email features are disabled when email service is not configured or templates are not available
+	var emailSender application.EmailService
+	if es != nil {
+		sender, err := email.NewAccountsEmailSender(
+			es,
+			cfg.Gisquick.TemplatesRoot,
+			cfg.Email.Sender,
+			cfg.Web.SiteURL,
+			cfg.Email.ActivationSubject,
+			cfg.Email.PasswordResetSubject,
+		)
+		if err != nil {
+			log.Errorw("email features are disabled", "templates", cfg.Gisquick.TemplatesRoot, zap.Error(err))
+		} else {
+			emailSender = sender
+		}
+	}
+	accountsService := application.NewAccountsService(emailSender, accountsRepo, tokenGenerator, security.NewRedisInvitationsStore(rdb))
 
+	accountsService.GuestUsername = cfg.Auth.GuestUsername
+	if err := application.ValidateUnits(cfg.Gisquick.DefaultUnits); err != nil {
+		return handle, fmt.Errorf("invalid default units: %w", err)
+	}
+	if cfg.Auth.PasswordHashCost < bcrypt.MinCost || cfg.Auth.PasswordHashCost > bcrypt.MaxCost {
+		return handle, fmt.Errorf("invalid password hash cost: %d", cfg.Auth.PasswordHashCost)
+	}
+	accountsService.PasswordHashCost = cfg.Auth.PasswordHashCost
 	sessionStore := auth.NewRedisStore(rdb)
 	authServ := auth.NewAuthService(log, cfg.Auth.SessionExpiration, accountsRepo, sessionStore)
+	authServ.PasswordHashCost = cfg.Auth.PasswordHashCost
+	authServ.GuestUsername = cfg.Auth.GuestUsername
 
 	projectsRepo := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	projectsRepo.UploadWorkers = cfg.Gisquick.UploadWorkers
+	projectsRepo.UploadBufferSize = int64(cfg.Gisquick.UploadBufferSize)
+	projectsRepo.Deduplicate = cfg.Gisquick.DeduplicateFiles
+	if cfg.Gisquick.PartialFilesMaxAge > 0 {
+		interval := time.Hour
+		if cfg.Gisquick.PartialFilesMaxAge < interval {
+			interval = cfg.Gisquick.PartialFilesMaxAge
+		}
+		projectsRepo.StartPartialFilesCleanup(interval, cfg.Gisquick.PartialFilesMaxAge)
+	}
 	defaultAccountConfig := domain.AccountConfig{
 		ProjectsCountLimit: cfg.Gisquick.AccountProjectsLimit,
 		ProjectSizeLimit:   domain.ByteSize(cfg.Gisquick.ProjectSizeLimit),
 		StorageLimit:       domain.ByteSize(cfg.Gisquick.AccountStorageLimit),
+		AllowedExtensions:  cfg.Gisquick.UploadAllowedExtensions,
+		DeniedExtensions:   cfg.Gisquick.UploadDeniedExtensions,
+	}
+	limiterType := cfg.Gisquick.AccountLimiter
+	if limiterType == "" {
+		limiterType = "simple"
+		if cfg.Gisquick.AccountLimiterConfig != "" {
+			limiterType = "file"
+		}
 	}
 	var limiter application.AccountsLimiter
-	if cfg.Gisquick.AccountLimiterConfig != "" {
-		limiter = project.NewConfigurableProjectsLimiter(log, cfg.Gisquick.AccountLimiterConfig, defaultAccountConfig)
-	} else {
+	switch limiterType {
+	case "simple":
 		limiter = project.NewSimpleProjectsLimiter(defaultAccountConfig)
+	case "file":
+		limiter = project.NewConfigurableProjectsLimiter(log, cfg.Gisquick.AccountLimiterConfig, defaultAccountConfig)
+	case "db":
+		limiter = postgres.NewAccountsLimiter(dbConn, defaultAccountConfig)
+	default:
+		return handle, fmt.Errorf("unknown account limiter: %s", limiterType)
 	}
-	projectsServ := application.NewProjectsService(log, projectsRepo, limiter)
+	projectsServ := application.NewProjectsService(log, projectsRepo, limiter, application.ProjectsServiceConfig{
+		Webhooks: application.WebhooksConfig{
+			Workers:              cfg.Webhooks.Workers,
+			QueueSize:            cfg.Webhooks.QueueSize,
+			Attempts:             cfg.Webhooks.Attempts,
+			Timeout:              cfg.Webhooks.Timeout,
+			RetryDelay:           cfg.Webhooks.RetryDelay,
+			AllowPrivateNetworks: cfg.Webhooks.AllowPrivateNetworks,
+		},
+		DeduplicateFiles:  cfg.Gisquick.DeduplicateFiles,
+		MapConfigCacheTTL: cfg.Web.MapConfigCacheTTL,
+		DefaultProjection: cfg.Gisquick.DefaultProjection,
+		DefaultUnits:      cfg.Gisquick.DefaultUnits,
+	})
 
-	sws := ws.NewSettingsWS(log)
-	s := server.NewServer(log, conf, authServ, accountsService, projectsServ, sws, limiter, notifications)
+	wsOrigins := cfg.Web.WebsocketOrigins
+	if cfg.Web.WebsocketAnyOrigin {
+		log.Warnw("websocket connections are accepted from any origin")
+		wsOrigins = []string{"*"}
+	} else if len(wsOrigins) == 0 {
+		wsOrigins = []string{cfg.Web.SiteURL}
+	}
+	sws := ws.NewSettingsWS(log, wsOrigins)
+	sws.MaxMessageSize = int64(cfg.Web.WebsocketMaxMessageSize)
+	if cfg.Web.WebsocketBufferSize > 0 {
+		sws.Buffer = ws.NewRedisMessageBuffer(rdb, "ws_buffer", cfg.Web.WebsocketBufferSize, cfg.Web.WebsocketBufferTTL)
+	}
+	maintenance := security.NewRedisMaintenanceStore(rdb)
+	s := server.NewServer(log, conf, authServ, accountsService, projectsServ, sws, limiter, notifications, projectLocks, emailThrottle, maintenance)
 	handle.Server = s
 
 	extensionsList := strings.Split(cfg.Gisquick.Extensions, ",")
@@ -307,11 +457,43 @@ func Serve() error {
 	return nil
 }
 
+// parseLogLevel returns configured log level, when not set, debug level is used in debug mode
+// and info level otherwise
+func parseLogLevel(value string, debug bool) (zapcore.Level, error) {
+	if value == "" {
+		if debug {
+			return zap.DebugLevel, nil
+		}
+		return zap.InfoLevel, nil
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(strings.ToLower(value))); err != nil {
+		return level, fmt.Errorf("invalid log level: %s", value)
+	}
+	return level, nil
+}
+
 func createLogger(level zapcore.Level) (*zap.SugaredLogger, error) {
+	return createLoggerWithConfig(level, "json", "stderr")
+}
+
+// createLoggerWithConfig creates logger with given encoding (json|console) writing into
+// the output (stderr, stdout or file path)
+func createLoggerWithConfig(level zapcore.Level, format, output string) (*zap.SugaredLogger, error) {
 	config := zap.NewProductionConfig()
 	// config := zap.NewDevelopmentConfig()
 
-	// config.OutputPaths = []string{"stdout"}
+	switch format {
+	case "", "json":
+	case "console":
+		config.Encoding = "console"
+		config.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", format)
+	}
+	if output != "" {
+		config.OutputPaths = []string{output}
+	}
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	config.DisableStacktrace = true
 	config.Level.SetLevel(level)
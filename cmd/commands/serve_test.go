@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value    string
+		debug    bool
+		expected zapcore.Level
+	}{
+		{"", false, zap.InfoLevel},
+		{"", true, zap.DebugLevel},
+		{"debug", false, zap.DebugLevel},
+		{"warn", true, zap.WarnLevel},
+		{"ERROR", false, zap.ErrorLevel},
+		{"Info", true, zap.InfoLevel},
+	}
+	for _, tt := range tests {
+		level, err := parseLogLevel(tt.value, tt.debug)
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.expected, level, tt.value)
+	}
+
+	_, err := parseLogLevel("verbose", false)
+	assert.Error(t, err)
+}
+
+func TestCreateLoggerInvalidFormat(t *testing.T) {
+	_, err := createLoggerWithConfig(zap.InfoLevel, "xml", "stderr")
+	assert.Error(t, err)
+
+	log, err := createLoggerWithConfig(zap.InfoLevel, "console", "stdout")
+	assert.NoError(t, err)
+	assert.NotNil(t, log)
+}
@@ -103,7 +103,8 @@ func createAccount() (domain.Account, error) {
 		return domain.Account{}, ErrPasswordsMismatch
 	}
 	// fmt.Println("you entered", username, email, firstName, lastName, string(password))
-	account, err := domain.NewAccount(username, email, firstName, lastName, string(password))
+	// hashed with the default cost, it's upgraded on login when the server uses higher cost
+	account, err := domain.NewAccount(username, email, firstName, lastName, string(password), 0)
 	if err != nil {
 		return domain.Account{}, err
 	}
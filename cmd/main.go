@@ -17,6 +17,10 @@ func printCommandsList() {
 	fmt.Println("  loadusers")
 	fmt.Println("  deleteuser")
 	fmt.Println("  migrate")
+	fmt.Println("  listprojects [user]")
+	fmt.Println("  deleteproject <user/name> [--yes]")
+	fmt.Println("  reindex <user/name> | --all")
+	fmt.Println("  fixsizes [user]")
 }
 
 func main() {
@@ -43,6 +47,14 @@ func main() {
 		runCommand(commands.Serve)
 	case "migrate":
 		runCommand(commands.Migrate)
+	case "listprojects":
+		runCommand(commands.ListProjects)
+	case "deleteproject":
+		runCommand(commands.DeleteProject)
+	case "reindex":
+		runCommand(commands.Reindex)
+	case "fixsizes":
+		runCommand(commands.FixSizes)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n", cmd)
 		printCommandsList()
@@ -25,6 +25,7 @@ require (
 	github.com/xhit/go-simple-mail/v2 v2.11.0
 	go.uber.org/zap v1.19.1
 	golang.org/x/crypto v0.14.0
+	golang.org/x/image v0.3.0
 	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4
 	golang.org/x/term v0.13.0
 )
@@ -71,7 +72,6 @@ require (
 	github.com/valyala/fasttemplate v1.2.1 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.7.0 // indirect
-	golang.org/x/image v0.3.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
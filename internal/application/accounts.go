@@ -5,21 +5,25 @@ import (
 	"errors"
 	"fmt"
 	htmltemplate "html/template"
+	"strings"
 	texttemplate "text/template"
+	"time"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
 )
 
 var (
-	ErrInvalidToken     = errors.New("Invalid token")
-	ErrNotActiveAccount = errors.New("Account is not active")
-	ErrEmailNotSet      = errors.New("Account does not have email address")
-	ErrPasswordNotSet   = errors.New("Password is not set")
+	ErrInvalidToken      = errors.New("Invalid token")
+	ErrNotActiveAccount  = errors.New("Account is not active")
+	ErrEmailNotSet       = errors.New("Account does not have email address")
+	ErrPasswordNotSet    = errors.New("Password is not set")
+	ErrEmailNotSupported = errors.New("Email service not supported")
 )
 
 type TokenGenerator interface {
 	GenerateToken(claims string) (string, error)
 	CheckToken(token, claims string) error
+	Expiration() time.Duration
 }
 
 type EmailService interface {
@@ -29,16 +33,22 @@ type EmailService interface {
 }
 
 type AccountsService struct {
-	Repository domain.AccountsRepository
-	Email      EmailService
-	tokenGen   TokenGenerator
+	Repository  domain.AccountsRepository
+	Email       EmailService
+	Invitations InvitationsStore
+	// bcrypt cost of newly hashed passwords (default cost when zero)
+	PasswordHashCost int
+	// GuestUsername is identity of unauthenticated users, it can't be used by accounts
+	GuestUsername string
+	tokenGen      TokenGenerator
 }
 
-func NewAccountsService(email EmailService, accountsRepo domain.AccountsRepository, tokenGen TokenGenerator) *AccountsService {
+func NewAccountsService(email EmailService, accountsRepo domain.AccountsRepository, tokenGen TokenGenerator, invitations InvitationsStore) *AccountsService {
 	return &AccountsService{
-		Repository: accountsRepo,
-		Email:      email,
-		tokenGen:   tokenGen,
+		Repository:  accountsRepo,
+		Email:       email,
+		Invitations: invitations,
+		tokenGen:    tokenGen,
 	}
 }
 
@@ -55,11 +65,25 @@ func accountClaims(account domain.Account) string {
 	return fmt.Sprintf("%s:%s:%s:%s", account.Username, account.Email, string(account.Password), account.LastLogin)
 }
 
+// CheckUsername rejects usernames reserved for unauthenticated users
+func (s *AccountsService) CheckUsername(username string) error {
+	if s.GuestUsername != "" && strings.EqualFold(strings.TrimSpace(username), s.GuestUsername) {
+		return fmt.Errorf("invalid username: '%s'", username)
+	}
+	return nil
+}
+
 func (s *AccountsService) NewAccount(username, email, firstName, lastName, password string) error {
-	account, err := domain.NewAccount(username, email, firstName, lastName, password)
+	if err := s.CheckUsername(username); err != nil {
+		return err
+	}
+	account, err := domain.NewAccount(username, email, firstName, lastName, password, s.PasswordHashCost)
 	if err != nil {
 		return err
 	}
+	if account.Email != "" && !account.Active && !s.SupportEmails() {
+		return ErrEmailNotSupported
+	}
 	if err := s.Repository.Create(account); err != nil {
 		return err
 	}
@@ -81,6 +105,9 @@ func (s *AccountsService) SendActivationEmail(account domain.Account, data map[s
 	if account.Email == "" {
 		return ErrEmailNotSet
 	}
+	if !s.SupportEmails() {
+		return ErrEmailNotSupported
+	}
 	uid := base64.URLEncoding.EncodeToString([]byte(account.Username))
 	token, err := s.tokenGen.GenerateToken(accountClaims(account))
 
@@ -93,6 +120,11 @@ func (s *AccountsService) SendActivationEmail(account domain.Account, data map[s
 	return nil
 }
 
+// TokenExpiration returns validity duration of activation and password reset tokens
+func (s *AccountsService) TokenExpiration() time.Duration {
+	return s.tokenGen.Expiration()
+}
+
 func (s *AccountsService) Activate(uid, token string) error {
 	username, err := base64.URLEncoding.DecodeString(uid)
 	if err != nil {
@@ -116,6 +148,9 @@ func (s *AccountsService) Activate(uid, token string) error {
 }
 
 func (s *AccountsService) RequestPasswordReset(email string) error {
+	if !s.SupportEmails() {
+		return ErrEmailNotSupported
+	}
 	account, err := s.Repository.GetByEmail(email)
 	if err != nil {
 		return err
@@ -147,7 +182,7 @@ func (s *AccountsService) SetNewPassword(uid, token, newPassword string) error {
 	if err := s.tokenGen.CheckToken(token, accountClaims(account)); err != nil {
 		return ErrInvalidToken
 	}
-	if err := account.SetPassword(newPassword); err != nil {
+	if err := account.SetPassword(newPassword, s.PasswordHashCost); err != nil {
 		return fmt.Errorf("set new password: %w", err)
 	}
 	if !account.Active {
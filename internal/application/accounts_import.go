@@ -0,0 +1,75 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// AccountImportResult is a result of importing a single account
+type AccountImportResult struct {
+	Row      int    `json:"row"`
+	Username string `json:"username"`
+	Status   string `json:"status"` // created, valid (dry run) or error
+	Error    string `json:"error,omitempty"`
+}
+
+func (s *AccountsService) validateImportedAccount(account domain.Account, usernames, emails map[string]bool) error {
+	if err := domain.ValidateAccountFields(account.Username, account.Email); err != nil {
+		return err
+	}
+	if usernames[account.Username] {
+		return fmt.Errorf("duplicate username: '%s'", account.Username)
+	}
+	if account.Email != "" && emails[account.Email] {
+		return fmt.Errorf("duplicate email: '%s'", account.Email)
+	}
+	exists, err := s.Repository.UsernameExists(account.Username)
+	if err != nil {
+		return fmt.Errorf("checking username: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("username already exists: '%s'", account.Username)
+	}
+	if account.Email != "" {
+		exists, err := s.Repository.EmailExists(account.Email)
+		if err != nil {
+			return fmt.Errorf("checking email: %w", err)
+		}
+		if exists {
+			return fmt.Errorf("email already exists: '%s'", account.Email)
+		}
+	}
+	return nil
+}
+
+// ImportAccounts validates and creates given accounts, invalid accounts are skipped and reported
+// in the results. With dryRun, accounts are only validated.
+func (s *AccountsService) ImportAccounts(accounts []domain.Account, dryRun bool) []AccountImportResult {
+	results := make([]AccountImportResult, len(accounts))
+	usernames := make(map[string]bool, len(accounts))
+	emails := make(map[string]bool, len(accounts))
+	for i, account := range accounts {
+		account.Username = strings.TrimSpace(account.Username)
+		account.Email = strings.ToLower(strings.TrimSpace(account.Email))
+		result := AccountImportResult{Row: i, Username: account.Username, Status: "valid"}
+
+		err := s.validateImportedAccount(account, usernames, emails)
+		if err == nil && !dryRun {
+			err = s.Repository.Create(account)
+			result.Status = "created"
+		}
+		if err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+		} else {
+			usernames[account.Username] = true
+			if account.Email != "" {
+				emails[account.Email] = true
+			}
+		}
+		results[i] = result
+	}
+	return results
+}
@@ -0,0 +1,137 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// BookmarksSettings is the bookmarks related part of project settings
+type BookmarksSettings struct {
+	Bookmarks map[string]map[string]domain.Bookmark `json:"bookmarks"`
+	Groups    []domain.BookmarkGroup                `json:"groups"`
+}
+
+// validateBookmarksSettings checks that all referenced groups and bookmarks exist in project metadata
+func validateBookmarksSettings(meta domain.QgisMeta, data BookmarksSettings) error {
+	for groupName, group := range data.Bookmarks {
+		metaGroup, ok := meta.Bookmarks[groupName]
+		if !ok {
+			return fmt.Errorf("%w: unknown bookmarks group: %s", ErrInvalidSettings, groupName)
+		}
+		for id := range group {
+			if _, ok := metaGroup[id]; !ok {
+				return fmt.Errorf("%w: unknown bookmark: %s/%s", ErrInvalidSettings, groupName, id)
+			}
+		}
+	}
+	groups := make(map[string]bool, len(data.Groups))
+	for _, g := range data.Groups {
+		metaGroup, ok := meta.Bookmarks[g.Name]
+		if !ok {
+			return fmt.Errorf("%w: unknown bookmarks group: %s", ErrInvalidSettings, g.Name)
+		}
+		if groups[g.Name] {
+			return fmt.Errorf("%w: duplicate bookmarks group: %s", ErrInvalidSettings, g.Name)
+		}
+		groups[g.Name] = true
+		ids := make(map[string]bool, len(g.Order))
+		for _, id := range g.Order {
+			if _, ok := metaGroup[id]; !ok {
+				return fmt.Errorf("%w: unknown bookmark: %s/%s", ErrInvalidSettings, g.Name, id)
+			}
+			if ids[id] {
+				return fmt.Errorf("%w: duplicate bookmark in order: %s/%s", ErrInvalidSettings, g.Name, id)
+			}
+			ids[id] = true
+		}
+	}
+	return nil
+}
+
+func (s *projectService) GetBookmarksSettings(projectName string) (BookmarksSettings, error) {
+	settings, err := s.repo.GetSettings(projectName)
+	if err != nil {
+		return BookmarksSettings{}, err
+	}
+	data := BookmarksSettings{
+		Bookmarks: settings.Bookmarks,
+		Groups:    settings.BookmarkGroups,
+	}
+	if data.Bookmarks == nil {
+		data.Bookmarks = make(map[string]map[string]domain.Bookmark)
+	}
+	if data.Groups == nil {
+		data.Groups = []domain.BookmarkGroup{}
+	}
+	return data, nil
+}
+
+// UpdateBookmarksSettings replaces bookmarks settings (content, groups titles and ordering),
+// other parts of the project settings are preserved.
+func (s *projectService) UpdateBookmarksSettings(projectName string, data BookmarksSettings) error {
+	defer s.InvalidateMapConfig(projectName)
+	var meta domain.QgisMeta
+	if err := s.repo.ParseQgisMetadata(projectName, &meta); err != nil {
+		return fmt.Errorf("reading project metadata: %w", err)
+	}
+	if err := validateBookmarksSettings(meta, data); err != nil {
+		return err
+	}
+	unlock := s.settingsLocks.Lock(projectName)
+	defer unlock()
+	current, err := s.repo.GetRawSettings(projectName)
+	if err != nil {
+		return err
+	}
+	settings := make(map[string]interface{})
+	if len(current) > 0 {
+		if err := json.Unmarshal(current, &settings); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+		}
+	}
+	settings["bookmarks"] = data.Bookmarks
+	if len(data.Groups) > 0 {
+		settings["bookmark_groups"] = data.Groups
+	} else {
+		delete(settings, "bookmark_groups")
+	}
+	content, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := validateSettings(content); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateSettings(projectName, content); err != nil {
+		return err
+	}
+	s.notifyWebhooks(projectName, WebhookEventSettingsUpdated)
+	return nil
+}
+
+// bookmarkGroups returns ordered list of bookmark groups from project metadata with
+// configured titles. Groups without settings follows in alphabetical order.
+func bookmarkGroups(meta domain.QgisMeta, settings domain.ProjectSettings) []domain.BookmarkGroup {
+	groups := make([]domain.BookmarkGroup, 0, len(meta.Bookmarks))
+	used := make(map[string]bool, len(settings.BookmarkGroups))
+	for _, g := range settings.BookmarkGroups {
+		if _, ok := meta.Bookmarks[g.Name]; ok && !used[g.Name] {
+			used[g.Name] = true
+			groups = append(groups, g)
+		}
+	}
+	var rest []string
+	for name := range meta.Bookmarks {
+		if !used[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		groups = append(groups, domain.BookmarkGroup{Name: name})
+	}
+	return groups
+}
@@ -0,0 +1,59 @@
+package application
+
+import (
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// deduplicatedSize returns expected size of the project files with unique content after
+// applying the changes
+func (s *projectService) deduplicatedSize(projectName string, changes domain.FilesChanges) (int64, error) {
+	current, _, err := s.repo.ListProjectFiles(projectName, false)
+	if err != nil {
+		return 0, err
+	}
+	changed := make(map[string]bool, len(changes.Updates)+len(changes.Removes))
+	for _, p := range changes.Removes {
+		changed[p] = true
+	}
+	for _, f := range changes.Updates {
+		changed[f.Path] = true
+	}
+	paths := make([]string, 0, len(current))
+	for _, f := range current {
+		if !changed[f.Path] && !isRemovedDir(f.Path, changes.Removes) {
+			paths = append(paths, f.Path)
+		}
+	}
+	filesInfo, err := s.repo.GetFilesInfo(projectName, paths...)
+	if err != nil {
+		return 0, err
+	}
+	files := make([]domain.ProjectFile, 0, len(paths)+len(changes.Updates))
+	for _, p := range paths {
+		files = append(files, domain.ProjectFile{Path: p, Hash: filesInfo[p].Hash, Size: filesInfo[p].Size})
+	}
+	files = append(files, changes.Updates...)
+	var size int64
+	hashes := make(map[string]bool, len(files))
+	for _, f := range files {
+		if f.Hash != "" && domain.IsDeduplicableFile(f.Path) {
+			if hashes[f.Hash] {
+				continue
+			}
+			hashes[f.Hash] = true
+		}
+		size += f.Size
+	}
+	return size, nil
+}
+
+func isRemovedDir(path string, removes []string) bool {
+	for _, r := range removes {
+		if strings.HasPrefix(path, strings.TrimSuffix(r, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package application
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+var ErrInvitationNotFound = errors.New("invitation not found")
+
+// Invitation is a pending invitation of a new user (account without password)
+type Invitation struct {
+	ID       string    `json:"id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+type InvitationsStore interface {
+	Save(invitation Invitation) error
+	Get(id string) (Invitation, error)
+	List() ([]Invitation, error)
+	Delete(id string) error
+}
+
+func newInvitationID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Invite creates a new account without password and sends invitation email
+func (s *AccountsService) Invite(username, email, firstName, lastName string, params map[string]interface{}) (Invitation, error) {
+	if err := s.CheckUsername(username); err != nil {
+		return Invitation{}, err
+	}
+	account, err := domain.NewAccount(username, email, firstName, lastName, "", s.PasswordHashCost)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if account.Email == "" {
+		return Invitation{}, ErrEmailNotSet
+	}
+	if !s.SupportEmails() {
+		return Invitation{}, ErrEmailNotSupported
+	}
+	// accepted invitations are removed here rather than when listing them
+	if err := s.CleanupInvitations(); err != nil {
+		return Invitation{}, fmt.Errorf("removing accepted invitations: %w", err)
+	}
+	id, err := newInvitationID()
+	if err != nil {
+		return Invitation{}, fmt.Errorf("generating invitation id: %w", err)
+	}
+	if err := s.Repository.Create(account); err != nil {
+		return Invitation{}, err
+	}
+	now := time.Now().UTC()
+	invitation := Invitation{
+		ID:       id,
+		Username: account.Username,
+		Email:    account.Email,
+		Created:  now,
+		Expires:  now.Add(s.TokenExpiration()),
+	}
+	// saved before sending email, so it can be resent on failure
+	if err := s.Invitations.Save(invitation); err != nil {
+		// account without invitation couldn't be revoked nor resent
+		if derr := s.Repository.Delete(account.Username); derr != nil {
+			return Invitation{}, fmt.Errorf("saving invitation: %w (account not removed: %v)", err, derr)
+		}
+		return Invitation{}, fmt.Errorf("saving invitation: %w", err)
+	}
+	if err := s.SendActivationEmail(account, params); err != nil {
+		return Invitation{}, err
+	}
+	return invitation, nil
+}
+
+// PendingInvitations returns invitations which were not accepted yet (accounts which
+// are not active)
+func (s *AccountsService) PendingInvitations() ([]Invitation, error) {
+	invitations, err := s.Invitations.List()
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]Invitation, 0, len(invitations))
+	for _, inv := range invitations {
+		closed, err := s.invitationClosed(inv)
+		if err != nil {
+			return nil, err
+		}
+		if !closed {
+			pending = append(pending, inv)
+		}
+	}
+	return pending, nil
+}
+
+// CleanupInvitations removes accepted invitations (active accounts) and invitations
+// of deleted accounts from the store
+func (s *AccountsService) CleanupInvitations() error {
+	invitations, err := s.Invitations.List()
+	if err != nil {
+		return err
+	}
+	for _, inv := range invitations {
+		closed, err := s.invitationClosed(inv)
+		if err != nil {
+			return err
+		}
+		if closed {
+			if err := s.Invitations.Delete(inv.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// invitationClosed reports whether the invitation is not pending anymore (the account
+// was activated or deleted)
+func (s *AccountsService) invitationClosed(inv Invitation) (bool, error) {
+	account, err := s.Repository.GetByUsername(inv.Username)
+	if err != nil {
+		if errors.Is(err, domain.ErrAccountNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+	return account.Active, nil
+}
+
+// ResendInvitation sends invitation email again with a new activation link
+func (s *AccountsService) ResendInvitation(id string) (Invitation, error) {
+	invitation, err := s.Invitations.Get(id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	account, err := s.Repository.GetByUsername(invitation.Username)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if account.Active {
+		return Invitation{}, domain.ErrAccountActive
+	}
+	if err := s.SendActivationEmail(account, nil); err != nil {
+		return Invitation{}, err
+	}
+	invitation.Expires = time.Now().UTC().Add(s.TokenExpiration())
+	if err := s.Invitations.Save(invitation); err != nil {
+		return Invitation{}, fmt.Errorf("saving invitation: %w", err)
+	}
+	return invitation, nil
+}
+
+// RevokeInvitation deletes the invitation together with the (not yet activated) account
+func (s *AccountsService) RevokeInvitation(id string) error {
+	invitation, err := s.Invitations.Get(id)
+	if err != nil {
+		return err
+	}
+	account, err := s.Repository.GetByUsername(invitation.Username)
+	if err != nil && !errors.Is(err, domain.ErrAccountNotFound) {
+		return err
+	}
+	if err == nil {
+		if account.Active {
+			return domain.ErrAccountActive
+		}
+		if err := s.Repository.Delete(account.Username); err != nil {
+			return fmt.Errorf("deleting invited account: %w", err)
+		}
+	}
+	return s.Invitations.Delete(id)
+}
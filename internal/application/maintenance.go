@@ -0,0 +1,33 @@
+package application
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	MaintenanceOff      = ""
+	MaintenanceReadOnly = "read_only"
+	MaintenanceBlocked  = "blocked"
+)
+
+// MaintenanceState describes the maintenance mode of the whole server. In read-only mode
+// only reading requests are allowed, blocked mode rejects all API requests (except
+// superusers in both cases).
+type MaintenanceState struct {
+	Mode    string    `json:"mode"`
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+	User    string    `json:"user,omitempty"`
+}
+
+func (m MaintenanceState) Active() bool {
+	return m.Mode != MaintenanceOff
+}
+
+type MaintenanceStore interface {
+	// Get returns current maintenance state (zero value when maintenance mode is off)
+	Get(ctx context.Context) (MaintenanceState, error)
+	// Set stores the maintenance state, state with MaintenanceOff mode turns maintenance off
+	Set(ctx context.Context, state MaintenanceState) error
+}
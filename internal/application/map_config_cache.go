@@ -0,0 +1,45 @@
+package application
+
+import (
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// hasUserDefaults checks whether default value of any layer attribute depends on the user
+// (uses session variables)
+func hasUserDefaults(meta domain.QgisMeta, settings domain.ProjectSettings) bool {
+	variables := sessionVariables(domain.User{})
+	for id, lmeta := range meta.Layers {
+		for _, a := range lmeta.Attributes {
+			expr := MergeAttributeConfig(a, settings.Layers[id].Attributes[a.Name]).DefaultExpression
+			for name := range variables {
+				if strings.Contains(expr, name) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// IsMapConfigShared reports whether the map config of the project is identical for all users
+// (and is cached). It's known after the map config was created by GetMapConfig.
+func (s *projectService) IsMapConfigShared(projectName string) bool {
+	return s.mapConfigs.Get(projectName) != nil
+}
+
+// InvalidateMapConfig removes cached map config of the project
+func (s *projectService) InvalidateMapConfig(projectName string) {
+	s.mapConfigs.Delete(projectName)
+}
+
+// copyMapConfig returns shallow copy of the cached map config, so that callers can add
+// or override top level values
+func copyMapConfig(data map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		res[k] = v
+	}
+	return res
+}
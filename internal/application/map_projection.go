@@ -0,0 +1,125 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// Fallback values used when project metadata lacks projection or units and they are not
+// configured (ProjectsServiceConfig)
+const (
+	defaultProjection = "EPSG:3857"
+	defaultUnits      = "meters"
+)
+
+// projections supported by the web client without proj4 definition
+var builtinProjections = map[string]bool{
+	"EPSG:3857": true,
+	"EPSG:4326": true,
+}
+
+var unitsPresets = map[string]map[string]interface{}{
+	"meters": {
+		"map":                "meters",
+		"area":               "m2",
+		"distance":           "meters",
+		"factor":             39.37007874,
+		"position_precision": 2,
+	},
+	"degrees": {
+		"map":                "degrees",
+		"area":               "m2",
+		"distance":           "meters",
+		"factor":             4374754.0,
+		"position_precision": 6,
+	},
+}
+
+// ValidateUnits checks whether there are default units settings of the given units name
+func ValidateUnits(units string) error {
+	if _, ok := unitsPresets[units]; !ok {
+		return fmt.Errorf("unknown units: %s", units)
+	}
+	return nil
+}
+
+func isKnownProjection(code string, projections map[string]*domain.Projection) bool {
+	if _, ok := projections[code]; ok {
+		return true
+	}
+	return builtinProjections[code]
+}
+
+// mapProjection returns projection code of the map, when the projection in metadata is
+// missing or unknown, projection from the settings or server default is used
+func (s *projectService) mapProjection(projectName string, meta domain.QgisMeta, settings domain.ProjectSettings) string {
+	if meta.Projection != "" && isKnownProjection(meta.Projection, meta.Projections) {
+		return meta.Projection
+	}
+	for _, code := range []string{settings.Projection, s.defaultProjection} {
+		if code != "" && isKnownProjection(code, meta.Projections) {
+			s.log.Warnw("invalid map projection in project metadata, using fallback", "project", projectName, "projection", meta.Projection, "fallback", code)
+			return code
+		}
+	}
+	s.log.Warnw("invalid map projection in project metadata", "project", projectName, "projection", meta.Projection)
+	return meta.Projection
+}
+
+// mapUnits returns units settings of the map, when units in metadata are missing, default
+// units from the settings or server configuration are used (degrees for geographic projections)
+func (s *projectService) mapUnits(projectName, projection string, meta domain.QgisMeta, settings domain.ProjectSettings) map[string]interface{} {
+	if _, ok := meta.Units["map"]; ok {
+		return meta.Units
+	}
+	units := s.defaultUnits
+	if settings.Units != "" {
+		units = settings.Units
+	} else if proj, ok := meta.Projections[projection]; ok && proj.IsGeografic {
+		units = "degrees"
+	} else if projection == "EPSG:4326" {
+		units = "degrees"
+	}
+	preset, ok := unitsPresets[units]
+	if !ok {
+		preset = unitsPresets["meters"]
+	}
+	s.log.Warnw("missing map units in project metadata, using fallback", "project", projectName, "units", units)
+	result := make(map[string]interface{}, len(preset))
+	for k, v := range preset {
+		result[k] = v
+	}
+	// keep partial units settings from metadata
+	for k, v := range meta.Units {
+		result[k] = v
+	}
+	return result
+}
+
+var proj4ParamRegex = regexp.MustCompile(`^\+[a-zA-Z_][a-zA-Z0-9_]*(=\S+)?$`)
+
+// ValidateProj4 performs basic syntax check of proj4 definition (list of +param[=value]
+// tokens including +proj parameter)
+func ValidateProj4(def string) error {
+	tokens := strings.Fields(def)
+	if len(tokens) == 0 {
+		return errors.New("empty definition")
+	}
+	hasProj := false
+	for _, token := range tokens {
+		if !proj4ParamRegex.MatchString(token) {
+			return fmt.Errorf("invalid parameter: %s", token)
+		}
+		if strings.HasPrefix(token, "+proj=") {
+			hasProj = true
+		}
+	}
+	if !hasProj {
+		return errors.New("missing +proj parameter")
+	}
+	return nil
+}
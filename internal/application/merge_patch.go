@@ -0,0 +1,39 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// mergePatch applies JSON merge patch (RFC 7386) to the target document
+func mergePatch(target, patch json.RawMessage) (json.RawMessage, error) {
+	var targetData, patchData interface{}
+	if len(target) > 0 {
+		if err := json.Unmarshal(target, &targetData); err != nil {
+			return nil, fmt.Errorf("parsing target document: %w", err)
+		}
+	}
+	if err := json.Unmarshal(patch, &patchData); err != nil {
+		return nil, fmt.Errorf("parsing patch document: %w", err)
+	}
+	return json.Marshal(mergeValue(targetData, patchData))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergeValue(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jellydator/ttlcache/v3"
 	"go.uber.org/zap"
 )
 
@@ -16,24 +20,85 @@ var (
 	ErrAccountProjectsLimit = errors.New("account projects count limit reached")
 	ErrAccountStorageLimit  = errors.New("account storage limit reached")
 	ErrProjectSizeLimit     = errors.New("project size limit reached")
+	ErrInvalidSettings      = errors.New("invalid project settings")
+	ErrLayerNotExists       = errors.New("layer does not exists")
+	ErrFileTypeNotAllowed   = errors.New("file type is not allowed")
 )
 
+// FileTypeError wraps ErrFileTypeNotAllowed with the path of the rejected file
+type FileTypeError struct {
+	Path string `json:"path"`
+}
+
+func (e *FileTypeError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrFileTypeNotAllowed, e.Path)
+}
+
+func (e *FileTypeError) Unwrap() error {
+	return ErrFileTypeNotAllowed
+}
+
+// ErrorDetails returns data which can be sent to the client
+func (e *FileTypeError) ErrorDetails() interface{} {
+	return e
+}
+
+// LimitError wraps ErrAccountStorageLimit/ErrProjectSizeLimit errors with details
+// about the reached limit
+type LimitError struct {
+	Err       error `json:"-"`
+	Limit     int64 `json:"limit"`
+	Usage     int64 `json:"usage"`
+	Attempted int64 `json:"attempted"`
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s (limit: %d, usage: %d, attempted: %d)", e.Err, e.Limit, e.Usage, e.Attempted)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorDetails returns data which can be sent to the client
+func (e *LimitError) ErrorDetails() interface{} {
+	return e
+}
+
 type ProjectService interface {
 	Create(projectName string, meta json.RawMessage) (*domain.ProjectInfo, error)
 	Delete(projectName string) error
+	Move(projectName, newName string) error
+	Transfer(projectName, username string) (string, error)
 	GetProjectInfo(projectName string) (domain.ProjectInfo, error)
 	GetUserProjects(username string) ([]domain.ProjectInfo, error)
+	UserProjects(username string) ([]string, error)
 	AccessibleProjects(username string, skipErrors bool) ([]domain.ProjectInfo, error)
+	SearchProjects(username, query string, searchMeta bool, limit int) ([]domain.ProjectInfo, error)
+	RecentProjects(limit int) ([]domain.ProjectInfo, error)
 	// SaveFile(projectName, filename string, r io.Reader) (string, error)
 	SaveFile(projectName, dir, pattern string, r io.Reader, size int64) (domain.ProjectFile, error)
 	DeleteFile(projectName, path string) error
 	ListProjectFiles(projectName string, checksum bool) ([]domain.ProjectFile, []domain.ProjectFile, error)
-
+	RemoveTemporaryFiles(projectName string) ([]domain.ProjectFile, error)
+	ListDirectory(projectName, path string) (domain.DirectoryListing, error)
+	CreateDirectory(projectName, path string) error
+	SizeBreakdown(projectName string, depth, largest int) (domain.SizeBreakdown, error)
+	GetFileInfo(projectName, path string) (domain.FileInfo, error)
+	GetFilesInfo(projectName string, paths ...string) (map[string]domain.FileInfo, error)
+	UploadPlan(projectName string, files []domain.ProjectFile) (UploadPlan, error)
+
+	GetQgisMetaPath(projectName string) string
 	GetQgisMetadata(projectName string, data interface{}) error
 	UpdateMeta(projectName string, meta json.RawMessage) error
 
 	GetSettings(projectName string) (domain.ProjectSettings, error)
 	UpdateSettings(projectName string, data json.RawMessage) error
+	PatchSettings(projectName string, patch json.RawMessage) error
+	GetBookmarksSettings(projectName string) (BookmarksSettings, error)
+	UpdateBookmarksSettings(projectName string, data BookmarksSettings) error
+	ChangeState(projectName string, state string) (domain.ProjectInfo, error)
+	ValidateSettings(projectName string, data json.RawMessage) (SettingsValidationReport, error)
 
 	GetThumbnailPath(projectName string) string
 	SaveThumbnail(projectName string, r io.Reader) error
@@ -42,6 +107,9 @@ type ProjectService interface {
 
 	GetLayersData(projectName string) (LayersData, error)
 	GetMapConfig(projectName string, user domain.User) (map[string]interface{}, error)
+	IsMapConfigShared(projectName string) bool
+	InvalidateMapConfig(projectName string)
+	GetLayerConfig(projectName, layerId string, user domain.User) (OverlayLayer, error)
 
 	GetScripts(projectName string) (domain.Scripts, error)
 	UpdateScripts(projectName string, scripts domain.Scripts) error
@@ -55,22 +123,72 @@ type AccountsLimiter interface {
 	GetAccountLimits(username string) (domain.AccountConfig, error)
 }
 
+// AccountsLimitsStore is implemented by limiters which support per-account limits overrides
+type AccountsLimitsStore interface {
+	AccountsLimiter
+	GetAccountLimitsOverrides(username string) (domain.AccountLimits, error)
+	SetAccountLimitsOverrides(username string, limits domain.AccountLimits) error
+}
+
 type projectService struct {
 	log     *zap.SugaredLogger
 	repo    domain.ProjectsRepository
 	limiter AccountsLimiter
-	// cache *ttlcache.Cache
+	// serializes read-modify-write updates of project's settings
+	settingsLocks *domain.KeyedMutex
+	// cached map configs of projects without user dependent content
+	mapConfigs        *ttlcache.Cache[string, map[string]interface{}]
+	mapConfigCacheTTL time.Duration
+	webhooks          *webhookDispatcher
+	// only unique content of deduplicable files is counted towards the size limits
+	deduplicateFiles  bool
+	defaultProjection string
+	defaultUnits      string
+}
+
+// ProjectsServiceConfig holds optional settings of the projects service
+type ProjectsServiceConfig struct {
+	Webhooks WebhooksConfig
+	// DeduplicateFiles should be enabled when the projects storage stores files with
+	// identical content only once
+	DeduplicateFiles bool
+	// MapConfigCacheTTL is the max age of cached map configs of projects without user
+	// dependent content (0 disables the cache). Cached configs are invalidated when
+	// the project is changed.
+	MapConfigCacheTTL time.Duration
+	// DefaultProjection and DefaultUnits are used when project metadata lacks map projection
+	// or units (EPSG:3857 and meters when empty)
+	DefaultProjection string
+	DefaultUnits      string
 }
 
-func NewProjectsService(log *zap.SugaredLogger, repo domain.ProjectsRepository, limiter AccountsLimiter) *projectService {
+func NewProjectsService(log *zap.SugaredLogger, repo domain.ProjectsRepository, limiter AccountsLimiter, cfg ProjectsServiceConfig) *projectService {
+	if cfg.DefaultProjection == "" {
+		cfg.DefaultProjection = defaultProjection
+	}
+	if cfg.DefaultUnits == "" {
+		cfg.DefaultUnits = defaultUnits
+	}
+	mapConfigs := ttlcache.New[string, map[string]interface{}]()
+	go mapConfigs.Start()
 	return &projectService{
-		log:     log,
-		repo:    repo,
-		limiter: limiter,
+		log:               log,
+		repo:              repo,
+		limiter:           limiter,
+		mapConfigs:        mapConfigs,
+		webhooks:          newWebhookDispatcher(log, cfg.Webhooks),
+		deduplicateFiles:  cfg.DeduplicateFiles,
+		settingsLocks:     domain.NewKeyedMutex(),
+		mapConfigCacheTTL: cfg.MapConfigCacheTTL,
+		defaultProjection: cfg.DefaultProjection,
+		defaultUnits:      cfg.DefaultUnits,
 	}
 }
 
 func (s *projectService) Create(name string, meta json.RawMessage) (*domain.ProjectInfo, error) {
+	if err := domain.ValidateProjectName(name); err != nil {
+		return nil, err
+	}
 	username := strings.Split(name, "/")[0]
 	projects, err := s.repo.UserProjects(username)
 	if err != nil {
@@ -92,13 +210,79 @@ func (s *projectService) GetProjectInfo(name string) (domain.ProjectInfo, error)
 }
 
 func (s *projectService) Delete(name string) error {
+	defer s.InvalidateMapConfig(name)
 	return s.repo.Delete(name)
 }
 
+func (s *projectService) Move(name, newName string) error {
+	if err := domain.ValidateProjectName(newName); err != nil {
+		return err
+	}
+	defer s.InvalidateMapConfig(name)
+	return s.repo.Move(name, newName)
+}
+
 func (s *projectService) ListProjectFiles(project string, checksum bool) ([]domain.ProjectFile, []domain.ProjectFile, error) {
 	return s.repo.ListProjectFiles(project, checksum)
 }
 
+func (s *projectService) RemoveTemporaryFiles(projectName string) ([]domain.ProjectFile, error) {
+	return s.repo.RemoveTemporaryFiles(projectName)
+}
+
+func (s *projectService) ListDirectory(projectName, path string) (domain.DirectoryListing, error) {
+	return s.repo.ListDirectory(projectName, path)
+}
+
+func (s *projectService) CreateDirectory(projectName, path string) error {
+	return s.repo.CreateDirectory(projectName, path)
+}
+
+func (s *projectService) SizeBreakdown(projectName string, depth, largest int) (domain.SizeBreakdown, error) {
+	return s.repo.SizeBreakdown(projectName, depth, largest)
+}
+
+// ChangeState switches project into the given state (publish/hide), only allowed transitions are accepted
+func (s *projectService) ChangeState(projectName string, state string) (domain.ProjectInfo, error) {
+	defer s.InvalidateMapConfig(projectName)
+	info, err := s.repo.GetProjectInfo(projectName)
+	if err != nil {
+		return info, err
+	}
+	if info.State == state {
+		return info, nil
+	}
+	if !info.CanChangeState(state) {
+		return info, fmt.Errorf("%w: %s -> %s", domain.ErrInvalidStateChange, info.State, state)
+	}
+	if state == domain.ProjectStatePublished {
+		if _, err := s.repo.GetSettings(projectName); err != nil {
+			return info, fmt.Errorf("%w: project settings not found", domain.ErrInvalidStateChange)
+		}
+	}
+	if err := s.repo.UpdateState(projectName, state); err != nil {
+		return info, err
+	}
+	info.State = state
+	if state == domain.ProjectStatePublished {
+		s.notifyWebhooks(projectName, WebhookEventPublished)
+	}
+	return info, nil
+}
+
+func (s *projectService) GetFileInfo(projectName, path string) (domain.FileInfo, error) {
+	return s.repo.GetFileInfo(projectName, path)
+}
+
+func (s *projectService) GetFilesInfo(projectName string, paths ...string) (map[string]domain.FileInfo, error) {
+	return s.repo.GetFilesInfo(projectName, paths...)
+}
+
+// UserProjects returns names of user's projects (including projects with invalid project info)
+func (s *projectService) UserProjects(username string) ([]string, error) {
+	return s.repo.UserProjects(username)
+}
+
 func (s *projectService) GetUserProjects(username string) ([]domain.ProjectInfo, error) {
 	projects, err := s.repo.UserProjects(username)
 	if err != nil {
@@ -139,7 +323,7 @@ func (s *projectService) SaveFile(projectName, directory, pattern string, r io.R
 		}
 		canSave := accountConfig.CheckStorageLimit(totalSize + size)
 		if !canSave {
-			return finfo, ErrAccountStorageLimit
+			return finfo, &LimitError{Err: ErrAccountStorageLimit, Limit: int64(accountConfig.StorageLimit), Usage: totalSize, Attempted: totalSize + size}
 		}
 	}
 	if checkProjectSizeLimit {
@@ -153,7 +337,7 @@ func (s *projectService) SaveFile(projectName, directory, pattern string, r io.R
 		}
 		canSave := accountConfig.CheckProjectSizeLimit(projectSize + size)
 		if !canSave {
-			return finfo, ErrProjectSizeLimit
+			return finfo, &LimitError{Err: ErrProjectSizeLimit, Limit: int64(accountConfig.ProjectSizeLimit), Usage: projectSize, Attempted: projectSize + size}
 		}
 	}
 
@@ -173,11 +357,16 @@ func (s *projectService) DeleteFile(projectName, path string) error {
 	return nil
 }
 
+func (s *projectService) GetQgisMetaPath(projectName string) string {
+	return s.repo.GetQgisMetaPath(projectName)
+}
+
 func (s *projectService) GetQgisMetadata(projectName string, data interface{}) error {
 	return s.repo.ParseQgisMetadata(projectName, data)
 }
 
 func (s *projectService) UpdateMeta(projectName string, meta json.RawMessage) error {
+	defer s.InvalidateMapConfig(projectName)
 	return s.repo.UpdateMeta(projectName, meta)
 }
 
@@ -185,8 +374,120 @@ func (s *projectService) GetSettings(projectName string) (domain.ProjectSettings
 	return s.repo.GetSettings(projectName)
 }
 
+func validateSettings(data json.RawMessage) error {
+	var settings domain.ProjectSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+	}
+	for code, proj4 := range settings.Proj4 {
+		if err := ValidateProj4(proj4); err != nil {
+			return fmt.Errorf("%w: invalid proj4 definition of %s: %s", ErrInvalidSettings, code, err)
+		}
+	}
+	if settings.Units != "" {
+		if err := ValidateUnits(settings.Units); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+		}
+	}
+	for _, tag := range settings.Tags {
+		// comma is used as a separator in the projects filter
+		if tag = strings.TrimSpace(tag); tag == "" || len(tag) > 50 || strings.ContainsAny(tag, ",\r\n") {
+			return fmt.Errorf("%w: invalid tag: %q", ErrInvalidSettings, tag)
+		}
+	}
+	for _, hook := range settings.Webhooks {
+		if err := validateWebhook(hook); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+		}
+	}
+	switch strings.TrimPrefix(strings.ToLower(settings.TileFormat), "image/") {
+	case "", "png", "jpeg", "jpg":
+	default:
+		return fmt.Errorf("%w: unsupported tile format: %q", ErrInvalidSettings, settings.TileFormat)
+	}
+	if settings.TileDPI != 0 && !domain.IsValidTileDPI(settings.TileDPI) {
+		return fmt.Errorf("%w: unsupported tile DPI: %d", ErrInvalidSettings, settings.TileDPI)
+	}
+	for _, origin := range settings.EmbedAllowedOrigins {
+		// used as a source in Content-Security-Policy header
+		if origin == "" || strings.ContainsAny(origin, " \t\r\n;,'") {
+			return fmt.Errorf("%w: invalid embed origin: %q", ErrInvalidSettings, origin)
+		}
+	}
+	return nil
+}
+
+// validateLayerAliases rejects layer aliases which are ambiguous in OWS requests (alias
+// equal to a name of a project layer), other problems are reported by ValidateSettings
+func (s *projectService) validateLayerAliases(projectName string, data json.RawMessage) error {
+	var settings struct {
+		LayerAliases map[string]string `json:"layer_aliases"`
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+	}
+	if len(settings.LayerAliases) == 0 {
+		return nil
+	}
+	var meta domain.QgisMeta
+	if err := s.repo.ParseQgisMetadata(projectName, &meta); err != nil {
+		return fmt.Errorf("reading project metadata: %w", err)
+	}
+	layerNames := make(map[string]bool, len(meta.Layers))
+	for _, lmeta := range meta.Layers {
+		layerNames[lmeta.Name] = true
+	}
+	for alias := range settings.LayerAliases {
+		if alias == "" || strings.ContainsAny(alias, ",:") {
+			return fmt.Errorf("%w: invalid layer alias: %q", ErrInvalidSettings, alias)
+		}
+		if layerNames[alias] {
+			return fmt.Errorf("%w: layer alias '%s' conflicts with the layer name", ErrInvalidSettings, alias)
+		}
+	}
+	return nil
+}
+
 func (s *projectService) UpdateSettings(projectName string, data json.RawMessage) error {
-	return s.repo.UpdateSettings(projectName, data)
+	if err := validateSettings(data); err != nil {
+		return err
+	}
+	if err := s.validateLayerAliases(projectName, data); err != nil {
+		return err
+	}
+	unlock := s.settingsLocks.Lock(projectName)
+	defer unlock()
+	defer s.InvalidateMapConfig(projectName)
+	if err := s.repo.UpdateSettings(projectName, data); err != nil {
+		return err
+	}
+	s.notifyWebhooks(projectName, WebhookEventSettingsUpdated)
+	return nil
+}
+
+func (s *projectService) PatchSettings(projectName string, patch json.RawMessage) error {
+	unlock := s.settingsLocks.Lock(projectName)
+	defer unlock()
+	defer s.InvalidateMapConfig(projectName)
+	current, err := s.repo.GetRawSettings(projectName)
+	if err != nil {
+		return err
+	}
+	data, err := mergePatch(current, patch)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+	}
+	if err := validateSettings(data); err != nil {
+		return err
+	}
+	if err := s.validateLayerAliases(projectName, data); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateSettings(projectName, data); err != nil {
+		return err
+	}
+	s.notifyWebhooks(projectName, WebhookEventSettingsUpdated)
+	return nil
 }
 
 func (s *projectService) SaveThumbnail(projectName string, r io.Reader) error {
@@ -214,11 +515,17 @@ func (s *projectService) getProjectsSize(username string) (map[string]int64, err
 }
 
 func (s *projectService) UpdateFiles(projectName string, info domain.FilesChanges, next func() (string, io.ReadCloser, error)) ([]domain.ProjectFile, error) {
+	defer s.InvalidateMapConfig(projectName)
 	username := strings.Split(projectName, "/")[0]
 	accountConfig, err := s.limiter.GetAccountLimits(username)
 	if err != nil {
 		return nil, fmt.Errorf("getting user account limits config: %w", err)
 	}
+	for _, f := range info.Updates {
+		if !accountConfig.CheckFileExtension(f.Path) {
+			return nil, &FileTypeError{Path: f.Path}
+		}
+	}
 	checkProjectSizeLimit := accountConfig.HasProjectSizeLimit()
 	checkStorageLimit := accountConfig.HasStorageLimit()
 	if len(info.Updates) > 0 && (checkProjectSizeLimit || checkStorageLimit) {
@@ -249,29 +556,36 @@ func (s *projectService) UpdateFiles(projectName string, info domain.FilesChange
 		*/
 		// v2
 		size := p.Size
-		files := make([]string, 0, len(info.Updates)+len(info.Removes))
-		files = append(files, info.Removes...)
-		for _, f := range info.Updates {
-			files = append(files, f.Path)
-		}
-		filesInfo, err := s.repo.GetFilesInfo(projectName, files...)
-		for _, p := range info.Removes {
-			fi, ok := filesInfo[p]
-			if ok {
-				size -= fi.Size
+		if s.deduplicateFiles {
+			size, err = s.deduplicatedSize(projectName, info)
+			if err != nil {
+				return nil, fmt.Errorf("calculating project size: %w", err)
 			}
-		}
-		for _, f := range info.Updates {
-			fi, ok := filesInfo[f.Path]
-			if ok {
-				size -= fi.Size
+		} else {
+			files := make([]string, 0, len(info.Updates)+len(info.Removes))
+			files = append(files, info.Removes...)
+			for _, f := range info.Updates {
+				files = append(files, f.Path)
+			}
+			filesInfo, _ := s.repo.GetFilesInfo(projectName, files...)
+			for _, p := range info.Removes {
+				fi, ok := filesInfo[p]
+				if ok {
+					size -= fi.Size
+				}
+			}
+			for _, f := range info.Updates {
+				fi, ok := filesInfo[f.Path]
+				if ok {
+					size -= fi.Size
+				}
+				size += f.Size
 			}
-			size += f.Size
 		}
 
 		// s.log.Infow("UpdateFiles", "currentSize", p.Size, "expected size", size)
 		if !accountConfig.CheckProjectSizeLimit(size) {
-			return nil, ErrProjectSizeLimit
+			return nil, &LimitError{Err: ErrProjectSizeLimit, Limit: int64(accountConfig.ProjectSizeLimit), Usage: p.Size, Attempted: size}
 		}
 		if checkStorageLimit {
 			sizes, err := s.getProjectsSize(username)
@@ -282,13 +596,18 @@ func (s *projectService) UpdateFiles(projectName string, info domain.FilesChange
 			for _, pSize := range sizes {
 				totalSize += pSize
 			}
-			totalSize += (-p.Size + size)
-			if !accountConfig.CheckStorageLimit(totalSize) {
-				return nil, ErrAccountStorageLimit
+			newTotalSize := totalSize - p.Size + size
+			if !accountConfig.CheckStorageLimit(newTotalSize) {
+				return nil, &LimitError{Err: ErrAccountStorageLimit, Limit: int64(accountConfig.StorageLimit), Usage: totalSize, Attempted: newTotalSize}
 			}
 		}
 	}
-	return s.repo.UpdateFiles(projectName, info, next)
+	files, err := s.repo.UpdateFiles(projectName, info, next)
+	if err != nil {
+		return nil, err
+	}
+	s.notifyWebhooks(projectName, WebhookEventFilesUpdated)
+	return files, nil
 }
 
 func (s *projectService) GetScripts(projectName string) (domain.Scripts, error) {
@@ -296,6 +615,7 @@ func (s *projectService) GetScripts(projectName string) (domain.Scripts, error)
 }
 
 func (s *projectService) UpdateScripts(projectName string, scripts domain.Scripts) error {
+	defer s.InvalidateMapConfig(projectName)
 	return s.repo.UpdateScripts(projectName, scripts)
 }
 
@@ -427,6 +747,46 @@ func MergeAttributeConfig(meta domain.LayerAttribute, settings domain.AttributeS
 	if settings.Formatter != "" {
 		attr.Format = settings.Formatter
 	}
+	attr.DefaultValue = settings.DefaultValue
+	attr.DefaultExpression = settings.DefaultExpression
+	return attr
+}
+
+// sessionVariables returns values of user's session variables usable in default value expressions
+func sessionVariables(user domain.User) map[string]string {
+	return map[string]string{
+		"@username":       user.Identity(),
+		"@user_email":     user.Email,
+		"@user_full_name": strings.TrimSpace(user.FirstName + " " + user.LastName),
+	}
+}
+
+// ResolveAttributeDefault resolves session variables in the attribute's default value expression.
+// Expression consisting of a single variable is converted into default value, other expressions
+// (e.g. now()) are left for evaluation on the client with variables replaced by string literals.
+func ResolveAttributeDefault(attr domain.LayerAttribute, user domain.User) domain.LayerAttribute {
+	expr := strings.TrimSpace(attr.DefaultExpression)
+	if expr == "" {
+		return attr
+	}
+	variables := sessionVariables(user)
+	if value, ok := variables[expr]; ok {
+		attr.DefaultValue = value
+		attr.DefaultExpression = ""
+		return attr
+	}
+	// longer names first, so @username is not replaced inside of @username_xyz like variables
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	replacements := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		literal := "'" + strings.ReplaceAll(variables[name], "'", "''") + "'"
+		replacements = append(replacements, name, literal)
+	}
+	attr.DefaultExpression = strings.NewReplacer(replacements...).Replace(expr)
 	return attr
 }
 
@@ -531,11 +891,20 @@ func GetTableFields(lm domain.LayerMeta, ls domain.LayerSettings) domain.StringA
 	return fields
 }
 
-func GetBookmarks(meta domain.QgisMeta, settings domain.ProjectSettings) (map[string]map[string]interface{}) {
+func GetBookmarks(meta domain.QgisMeta, settings domain.ProjectSettings) map[string]map[string]interface{} {
 	bookmarks := make(map[string]map[string]interface{})
 	for groupName, group := range meta.Bookmarks {
 		bookmarks[groupName] = make(map[string]interface{})
 		groupSettings, groupHasSettings := settings.Bookmarks[groupName]
+		order := make(map[string]int)
+		for _, g := range settings.BookmarkGroups {
+			if g.Name == groupName {
+				for i, id := range g.Order {
+					order[id] = i
+				}
+				break
+			}
+		}
 		for id, bookmark := range group {
 			transformedBookmark := make(map[string]interface{})
 			transformedBookmark["id"] = bookmark.Id
@@ -543,6 +912,9 @@ func GetBookmarks(meta domain.QgisMeta, settings domain.ProjectSettings) (map[st
 			transformedBookmark["extent"] = bookmark.Extent
 			transformedBookmark["rotation"] = bookmark.Rotation
 			transformedBookmark["group"] = bookmark.Group
+			if i, ok := order[id]; ok {
+				transformedBookmark["order"] = i
+			}
 
 			if groupHasSettings {
 				bookmarkSettings, bookmarkHasSettings := groupSettings[id]
@@ -560,18 +932,248 @@ func (s *projectService) GetProjectCustomizations(projectName string) (json.RawM
 	return s.repo.GetProjectCustomizations(projectName)
 }
 
+// isOverlayLayerVisible returns whether the overlay layer is included in the map config
+func isOverlayLayerVisible(id string, settings domain.ProjectSettings, rolesPerms *domain.UserRolesPermissions) bool {
+	// drawingOrder := indexOf(meta.LayersOrder, id)
+	// return !settings.Layers[id].Flags.Has("excluded") && rolesPerms.LayerFlags(id).Has("view")
+	// return drawingOrder != -1 && !settings.Layers[id].Flags.Has("excluded") && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view"))
+	return !settings.Layers[id].Flags.Has("excluded") && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view") || rolesPerms.LayerFlags(id).Has("query"))
+}
+
+// ComposerTemplateName returns name of the print composer template from qgis metadata
+func ComposerTemplateName(template interface{}) string {
+	if t, ok := template.(map[string]interface{}); ok {
+		if name, ok := t["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// UserComposerTemplates filters print composer templates by user's roles permissions
+func UserComposerTemplates(templates []interface{}, rolesPerms *domain.UserRolesPermissions) []interface{} {
+	if rolesPerms == nil {
+		return templates
+	}
+	allowed := domain.Flags(rolesPerms.UserPrintTemplates())
+	filtered := make([]interface{}, 0)
+	for _, t := range templates {
+		if allowed.Has(ComposerTemplateName(t)) {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+// legendURL returns URL of the layer's legend image served through the API (with permissions check
+// and caching), legends of external WMS layers are left untouched
+func legendURL(projectName, id string, lmeta domain.LayerMeta) string {
+	if lmeta.LegendURL == "" || lmeta.Provider == "wms" {
+		return lmeta.LegendURL
+	}
+	return fmt.Sprintf("/api/map/legend/%s/%s", projectName, url.PathEscape(id))
+}
+
+// layer reference fields of the relation items in layer's metadata
+var relationLayerKeys = []string{"referencing_layer", "referenced_layer"}
+
+// resolveRelations filters out relations to the layers which are not visible to the user
+// and replaces internal layer IDs by the layer names used by the client
+func resolveRelations(relations json.RawMessage, meta domain.QgisMeta, settings domain.ProjectSettings, rolesPerms *domain.UserRolesPermissions) json.RawMessage {
+	if len(relations) == 0 {
+		return nil
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal(relations, &items); err != nil {
+		return nil
+	}
+	isVisible := func(id string) bool {
+		return !settings.Layers[id].Flags.Has("excluded") && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view"))
+	}
+	resolved := make([]map[string]interface{}, 0, len(items))
+	for _, rel := range items {
+		valid := true
+		for _, key := range relationLayerKeys {
+			v, ok := rel[key]
+			if !ok {
+				continue
+			}
+			id, _ := v.(string)
+			lmeta, exists := meta.Layers[id]
+			if !exists || !isVisible(id) {
+				valid = false
+				break
+			}
+			rel[key] = lmeta.Name
+		}
+		if valid {
+			resolved = append(resolved, rel)
+		}
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(resolved)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// overlayLayerConfig creates map config of a single overlay layer with applied user's permissions
+func overlayLayerConfig(projectName, id string, meta domain.QgisMeta, settings domain.ProjectSettings, user domain.User, rolesPerms *domain.UserRolesPermissions) OverlayLayer {
+	lmeta := meta.Layers[id]
+	lset := settings.Layers[id]
+	lflags := lset.Flags
+	if rolesPerms != nil {
+		lflags = lflags.Intersection(rolesPerms.LayerFlags(id))
+	}
+
+	queryable := lmeta.Flags.Has("query") && lflags.Has("query")
+
+	ldata := OverlayLayer{
+		Bands:            lmeta.Bands,
+		Name:             lmeta.Name,
+		Title:            lmeta.Title,
+		Projection:       lmeta.Projection,
+		Type:             lmeta.Type,
+		Metadata:         lmeta.Metadata,
+		Relations:        resolveRelations(lmeta.Relations, meta, settings, rolesPerms),
+		Hidden:           lset.Flags.Has("hidden"),
+		Queryable:        queryable,
+		InfoPanel:        lset.InfoPanelComponent,
+		LegendURL:        legendURL(projectName, id, lmeta),
+		Attribution:      lmeta.Attribution,
+		Visible:          lmeta.Visible,
+		CustomProperties: lset.CustomProperties,
+		LegendDisabled:   lset.LegendDisabled,
+	}
+
+	if lmeta.Type == "RasterLayer" && lmeta.Provider == "wms" {
+		ldata.Provider = lmeta.Provider
+		ldata.SourceParams = lmeta.SourceParams
+	}
+
+	// if !lset.Flags.Has("render_off") {
+	// 	drawingOrder := indexOf(meta.LayersOrder, id)
+	// 	ldata.DrawingOrder = &drawingOrder
+	// } else {
+	// 	ldata.Visible = false
+	// }
+	drawingOrder := -1
+	if !lset.Flags.Has("render_off") {
+		drawingOrder = indexOf(meta.LayersOrder, id)
+	}
+	if drawingOrder != -1 {
+		ldata.DrawingOrder = &drawingOrder
+	} else {
+		ldata.Visible = false
+	}
+
+	if lmeta.Type == "VectorLayer" {
+		json.Unmarshal(lmeta.Options["wkb_type"], &ldata.GeomType)
+		var wfsFlags domain.Flags
+		json.Unmarshal(lmeta.Options["wfs"], &wfsFlags)
+
+		editable := queryable && lmeta.Flags.Has("edit") && lset.Flags.Has("edit")
+		ldata.Permissions = domain.LayerPermission{
+			View:         queryable,
+			Insert:       editable && wfsFlags.Has("insert"),
+			Delete:       editable && wfsFlags.Has("delete"),
+			Update:       editable && wfsFlags.Has("update"),
+			EditGeometry: editable,
+		}
+		if rolesPerms != nil {
+			lperms := rolesPerms.LayerFlags(id)
+			ldata.Permissions.Insert = ldata.Permissions.Insert && lperms.Has("insert")
+			ldata.Permissions.Delete = ldata.Permissions.Delete && lperms.Has("delete")
+			ldata.Permissions.Update = ldata.Permissions.Update && lperms.Has("update")
+		}
+
+		// ldata.Attributes[0].Constrains
+		if queryable && len(lmeta.Attributes) > 0 {
+
+			// if len(lset.Attributes) > 0 {
+			// 	for _, a := range lmeta.Attributes {
+			// 		as, ok := lset.Attributes[a.Name]
+			// 		if ok {
+			// 			s.log.Infow("attribute", "layer", lmeta.Title, "name", a.Name, "settings", as, "config nill", as.Config == nil)
+			// 		}
+			// 	}
+			// }
+
+			if lset.Flags.Has("export") {
+				ldata.ExportFields = lset.ExportFields
+			}
+
+			if rolesPerms != nil {
+				attrsPerms := rolesPerms.AttributesFlags(id)
+				geomPerms, hasGeomPerms := attrsPerms["geometry"]
+				ldata.Permissions.EditGeometry = ldata.Permissions.EditGeometry && (!hasGeomPerms || geomPerms.Has("edit"))
+				isAttributeVisible := func(item string) bool { return attrsPerms[item].Has("view") }
+
+				ldata.AttributeTableFields = GetTableFields(lmeta, lset).Filter(isAttributeVisible)
+				ldata.InfoPanelFields = GetInfoPanelFields(lmeta, lset).Filter(isAttributeVisible)
+
+				if len(ldata.ExportFields) > 0 {
+					ldata.ExportFields = filterList(
+						ldata.ExportFields,
+						func(item string) bool { return attrsPerms[item].Has("export") },
+					)
+				}
+				ldata.Attributes = make([]domain.LayerAttribute, 0, len(lmeta.Attributes))
+				for _, a := range lmeta.Attributes {
+					if isAttributeVisible(a.Name) {
+						attr := ResolveAttributeDefault(MergeAttributeConfig(a, lset.Attributes[a.Name]), user)
+						if !attrsPerms[a.Name].Has("edit") && !attr.Constrains.Has("readonly") {
+							attr.Constrains = attr.Constrains.Union(domain.Flags{"readonly"})
+						}
+						ldata.Attributes = append(ldata.Attributes, attr)
+					}
+				}
+			} else {
+				ldata.AttributeTableFields = GetTableFields(lmeta, lset)
+				ldata.InfoPanelFields = GetInfoPanelFields(lmeta, lset)
+
+				ldata.Attributes = make([]domain.LayerAttribute, len(lmeta.Attributes))
+				for i, a := range lmeta.Attributes {
+					ldata.Attributes[i] = ResolveAttributeDefault(MergeAttributeConfig(a, lset.Attributes[a.Name]), user)
+				}
+			}
+		}
+	}
+	return ldata
+}
+
 func (s *projectService) GetMapConfig(projectName string, user domain.User) (map[string]interface{}, error) {
+	if item := s.mapConfigs.Get(projectName); item != nil {
+		return copyMapConfig(item.Value()), nil
+	}
+	data, shared, err := s.createMapConfig(projectName, user)
+	if err != nil {
+		return nil, err
+	}
+	if shared && s.mapConfigCacheTTL > 0 {
+		s.mapConfigs.Set(projectName, data, s.mapConfigCacheTTL)
+		return copyMapConfig(data), nil
+	}
+	return data, nil
+}
+
+// createMapConfig creates map config of the project for the given user and reports whether
+// the config is identical for all users (no roles and no user dependent attribute defaults)
+func (s *projectService) createMapConfig(projectName string, user domain.User) (map[string]interface{}, bool, error) {
 	var meta domain.QgisMeta
 	if err := s.repo.ParseQgisMetadata(projectName, &meta); err != nil {
-		return nil, fmt.Errorf("parsing qgis meta: %w", err)
+		return nil, false, fmt.Errorf("parsing qgis meta: %w", err)
 	}
 	settings, err := s.repo.GetSettings(projectName)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	layersTree, err := domain.CreateTree2(meta.LayersTree)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// override proj4 definitions if set in the settings
@@ -615,7 +1217,7 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 				Type:             lmeta.Type,
 				Projection:       lmeta.Projection,
 				Metadata:         lmeta.Metadata,
-				LegendURL:        lmeta.LegendURL,
+				LegendURL:        legendURL(projectName, id, lmeta),
 				Attribution:      lmeta.Attribution,
 				Extent:           lmeta.Extent,
 				Provider:         lmeta.Provider,
@@ -637,134 +1239,10 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 	layers, err := TransformLayersTree(
 		overlays,
 		func(id string) bool {
-			// drawingOrder := indexOf(meta.LayersOrder, id)
-			// return !settings.Layers[id].Flags.Has("excluded") && rolesPerms.LayerFlags(id).Has("view")
-			// return drawingOrder != -1 && !settings.Layers[id].Flags.Has("excluded") && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view"))
-			return !settings.Layers[id].Flags.Has("excluded") && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view") || rolesPerms.LayerFlags(id).Has("query"))
+			return isOverlayLayerVisible(id, settings, rolesPerms)
 		},
 		func(id string) interface{} {
-			lmeta := meta.Layers[id]
-			lset := settings.Layers[id]
-			lflags := lset.Flags
-			if rolesPerms != nil {
-				lflags = lflags.Intersection(rolesPerms.LayerFlags(id))
-			}
-
-			queryable := lmeta.Flags.Has("query") && lflags.Has("query")
-
-			ldata := OverlayLayer{
-				Bands:            lmeta.Bands,
-				Name:             lmeta.Name,
-				Title:            lmeta.Title,
-				Projection:       lmeta.Projection,
-				Type:             lmeta.Type,
-				Metadata:         lmeta.Metadata,
-				Relations:        lmeta.Relations,
-				Hidden:           lset.Flags.Has("hidden"),
-				Queryable:        queryable,
-				InfoPanel:        lset.InfoPanelComponent,
-				LegendURL:        lmeta.LegendURL,
-				Attribution:      lmeta.Attribution,
-				Visible:          lmeta.Visible,
-				CustomProperties: lset.CustomProperties,
-				LegendDisabled:   lset.LegendDisabled,
-			}
-
-			if lmeta.Type == "RasterLayer" && lmeta.Provider == "wms" {
-				ldata.Provider = lmeta.Provider
-				ldata.SourceParams = lmeta.SourceParams
-			}
-
-
-			// if !lset.Flags.Has("render_off") {
-			// 	drawingOrder := indexOf(meta.LayersOrder, id)
-			// 	ldata.DrawingOrder = &drawingOrder
-			// } else {
-			// 	ldata.Visible = false
-			// }
-			drawingOrder := -1
-			if !lset.Flags.Has("render_off") {
-				drawingOrder = indexOf(meta.LayersOrder, id)
-			}
-			if drawingOrder != -1 {
-				ldata.DrawingOrder = &drawingOrder
-			} else {
-				ldata.Visible = false
-			}
-
-			if lmeta.Type == "VectorLayer" {
-				json.Unmarshal(lmeta.Options["wkb_type"], &ldata.GeomType)
-				var wfsFlags domain.Flags
-				json.Unmarshal(lmeta.Options["wfs"], &wfsFlags)
-
-				editable := queryable && lmeta.Flags.Has("edit") && lset.Flags.Has("edit")
-				ldata.Permissions = domain.LayerPermission{
-					View:         queryable,
-					Insert:       editable && wfsFlags.Has("insert"),
-					Delete:       editable && wfsFlags.Has("delete"),
-					Update:       editable && wfsFlags.Has("update"),
-					EditGeometry: editable,
-				}
-				if rolesPerms != nil {
-					lperms := rolesPerms.LayerFlags(id)
-					ldata.Permissions.Insert = ldata.Permissions.Insert && lperms.Has("insert")
-					ldata.Permissions.Delete = ldata.Permissions.Delete && lperms.Has("delete")
-					ldata.Permissions.Update = ldata.Permissions.Update && lperms.Has("update")
-				}
-
-				// ldata.Attributes[0].Constrains
-				if queryable && len(lmeta.Attributes) > 0 {
-
-					// if len(lset.Attributes) > 0 {
-					// 	for _, a := range lmeta.Attributes {
-					// 		as, ok := lset.Attributes[a.Name]
-					// 		if ok {
-					// 			s.log.Infow("attribute", "layer", lmeta.Title, "name", a.Name, "settings", as, "config nill", as.Config == nil)
-					// 		}
-					// 	}
-					// }
-
-					if lset.Flags.Has("export") {
-						ldata.ExportFields = lset.ExportFields
-					}
-
-					if rolesPerms != nil {
-						attrsPerms := rolesPerms.AttributesFlags(id)
-						geomPerms, hasGeomPerms := attrsPerms["geometry"]
-						ldata.Permissions.EditGeometry = ldata.Permissions.EditGeometry && (!hasGeomPerms || geomPerms.Has("edit"))
-						isAttributeVisible := func(item string) bool { return attrsPerms[item].Has("view") }
-
-						ldata.AttributeTableFields = GetTableFields(lmeta, lset).Filter(isAttributeVisible)
-						ldata.InfoPanelFields = GetInfoPanelFields(lmeta, lset).Filter(isAttributeVisible)
-
-						if len(ldata.ExportFields) > 0 {
-							ldata.ExportFields = filterList(
-								ldata.ExportFields,
-								func(item string) bool { return attrsPerms[item].Has("export") },
-							)
-						}
-						ldata.Attributes = make([]domain.LayerAttribute, 0, len(lmeta.Attributes))
-						for _, a := range lmeta.Attributes {
-							if isAttributeVisible(a.Name) {
-								attr := MergeAttributeConfig(a, lset.Attributes[a.Name])
-								if !attrsPerms[a.Name].Has("edit") && !attr.Constrains.Has("readonly") {
-									attr.Constrains = attr.Constrains.Union(domain.Flags{"readonly"})
-								}
-								ldata.Attributes = append(ldata.Attributes, attr)
-							}
-						}
-					} else {
-						ldata.AttributeTableFields = GetTableFields(lmeta, lset)
-						ldata.InfoPanelFields = GetInfoPanelFields(lmeta, lset)
-
-						ldata.Attributes = make([]domain.LayerAttribute, len(lmeta.Attributes))
-						for i, a := range lmeta.Attributes {
-							ldata.Attributes[i] = MergeAttributeConfig(a, lset.Attributes[a.Name])
-						}
-					}
-				}
-			}
-			return ldata
+			return overlayLayerConfig(projectName, id, meta, settings, user, rolesPerms)
 		},
 	)
 
@@ -777,12 +1255,14 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 	data["scales"] = settings.Scales
 	data["tile_resolutions"] = settings.TileResolutions
 	data["map_tiling"] = settings.MapTiling
+	data["read_only"] = settings.ReadOnly
 	data["layers"] = layers
 	data["base_layers"] = baseLayersData
-	data["projection"] = meta.Projection
+	projection := s.mapProjection(projectName, meta, settings)
+	data["projection"] = projection
 	data["projections"] = meta.Projections
-	data["units"] = meta.Units
-	data["print_composers"] = meta.ComposerTemplates // TODO: filter by permissions
+	data["units"] = s.mapUnits(projectName, projection, meta, settings)
+	data["print_composers"] = UserComposerTemplates(meta.ComposerTemplates, rolesPerms)
 	if len(settings.Formatters) > 0 {
 		data["formatters"] = settings.Formatters
 	}
@@ -810,6 +1290,7 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 	data["ows_project"] = projectName
 	data["lang"] = settings.Language
 	data["bookmarks"] = GetBookmarks(meta, settings)
+	data["bookmark_groups"] = bookmarkGroups(meta, settings)
 
 	var storage []map[string]interface{}
 	for _, service := range settings.Storage {
@@ -849,7 +1330,27 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 		}
 	}
 	data["topics"] = topics
-	return data, nil
+	shared := rolesPerms == nil && !hasUserDefaults(meta, settings)
+	return data, shared, nil
+}
+
+func (s *projectService) GetLayerConfig(projectName, layerId string, user domain.User) (OverlayLayer, error) {
+	var meta domain.QgisMeta
+	if err := s.repo.ParseQgisMetadata(projectName, &meta); err != nil {
+		return OverlayLayer{}, fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	settings, err := s.repo.GetSettings(projectName)
+	if err != nil {
+		return OverlayLayer{}, err
+	}
+	if _, ok := meta.Layers[layerId]; !ok || contains(settings.BaseLayers, layerId) {
+		return OverlayLayer{}, ErrLayerNotExists
+	}
+	rolesPerms := domain.NewUserRolesPermissions(user, settings.Auth)
+	if !isOverlayLayerVisible(layerId, settings, rolesPerms) {
+		return OverlayLayer{}, ErrLayerNotExists
+	}
+	return overlayLayerConfig(projectName, layerId, meta, settings, user, rolesPerms), nil
 }
 
 func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([]domain.ProjectInfo, error) {
@@ -865,7 +1366,7 @@ func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([
 			if !skipErrors {
 				return nil, err
 			}
-		} else {
+		} else if pi.State != domain.ProjectStateHidden {
 			if pi.Authentication == "public" || pi.Authentication == "authenticated" {
 				projects = append(projects, pi)
 			} else if pi.Authentication == "users" {
@@ -886,5 +1387,7 @@ func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([
 }
 
 func (s *projectService) Close() {
+	s.mapConfigs.Stop()
+	s.webhooks.Close()
 	s.repo.Close()
 }
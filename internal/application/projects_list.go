@@ -0,0 +1,192 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidPage = errors.New("invalid sorting or pagination parameters")
+
+// ProjectsFilter filters projects listings, every field can contain comma separated
+// list of allowed values, empty value matches all projects.
+type ProjectsFilter struct {
+	State          string `query:"state"`
+	Authentication string `query:"auth"`
+	Tag            string `query:"tag"` // projects with any of the tags (separated by comma)
+}
+
+func matchValue(allowed, value string) bool {
+	if allowed == "" {
+		return true
+	}
+	for _, v := range strings.Split(allowed, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTags(allowed string, tags []string) bool {
+	if allowed == "" {
+		return true
+	}
+	for _, tag := range tags {
+		if matchValue(allowed, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f ProjectsFilter) Match(p domain.ProjectInfo) bool {
+	return matchValue(f.State, p.State) && matchValue(f.Authentication, p.Authentication) && matchTags(f.Tag, p.Tags)
+}
+
+// Apply returns projects matching the filter
+func (f ProjectsFilter) Apply(projects []domain.ProjectInfo) []domain.ProjectInfo {
+	if f.State == "" && f.Authentication == "" && f.Tag == "" {
+		return projects
+	}
+	filtered := make([]domain.ProjectInfo, 0, len(projects))
+	for _, p := range projects {
+		if f.Match(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+var projectsSortFunctions = map[string]func(a, b domain.ProjectInfo) bool{
+	"title": func(a, b domain.ProjectInfo) bool {
+		return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+	},
+	"last_update": func(a, b domain.ProjectInfo) bool {
+		return a.LastUpdate.Before(b.LastUpdate)
+	},
+	"created": func(a, b domain.ProjectInfo) bool {
+		return a.Created.Before(b.Created)
+	},
+	"size": func(a, b domain.ProjectInfo) bool {
+		return a.Size < b.Size
+	},
+}
+
+// ProjectsPage describes sorting and pagination of projects listings
+type ProjectsPage struct {
+	Sort   string `query:"sort"`
+	Order  string `query:"order"` // asc or desc
+	Limit  int    `query:"limit"`
+	Offset int    `query:"offset"`
+}
+
+func (p ProjectsPage) Validate() error {
+	if _, ok := projectsSortFunctions[p.Sort]; p.Sort != "" && !ok {
+		return fmt.Errorf("%w: unknown sort field %s", ErrInvalidPage, p.Sort)
+	}
+	if p.Order != "" && p.Order != "asc" && p.Order != "desc" {
+		return fmt.Errorf("%w: unknown order %s", ErrInvalidPage, p.Order)
+	}
+	if p.Limit < 0 || p.Offset < 0 {
+		return fmt.Errorf("%w: negative limit or offset", ErrInvalidPage)
+	}
+	return nil
+}
+
+// Apply sorts projects (in place) and returns the requested page
+func (p ProjectsPage) Apply(projects []domain.ProjectInfo) []domain.ProjectInfo {
+	if less, ok := projectsSortFunctions[p.Sort]; ok {
+		sort.SliceStable(projects, func(i, j int) bool {
+			if p.Order == "desc" {
+				return less(projects[j], projects[i])
+			}
+			return less(projects[i], projects[j])
+		})
+	}
+	if p.Offset >= len(projects) {
+		return projects[:0]
+	}
+	projects = projects[p.Offset:]
+	if p.Limit > 0 && p.Limit < len(projects) {
+		projects = projects[:p.Limit]
+	}
+	return projects
+}
+
+type projectSearchMeta struct {
+	Title    string `json:"title"`
+	Abstract string `json:"abstract"`
+}
+
+func matchTerms(text string, terms []string) bool {
+	text = strings.ToLower(text)
+	for _, t := range terms {
+		if !strings.Contains(text, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchProjects finds accessible projects with all query terms in the title (or name),
+// optionally also in the QGIS project title and abstract. At most limit projects is returned.
+func (s *projectService) SearchProjects(username, query string, searchMeta bool, limit int) ([]domain.ProjectInfo, error) {
+	results := make([]domain.ProjectInfo, 0)
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return results, nil
+	}
+	projects, err := s.AccessibleProjects(username, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+		text := p.Title + " " + p.Name
+		matched := matchTerms(text, terms)
+		if !matched && searchMeta {
+			var meta projectSearchMeta
+			if err := s.repo.ParseQgisMetadata(p.Name, &meta); err != nil {
+				s.log.Warnw("search projects: reading qgis meta", "project", p.Name, zap.Error(err))
+				continue
+			}
+			matched = matchTerms(text+" "+meta.Title+" "+meta.Abstract, terms)
+		}
+		if matched {
+			results = append(results, p)
+		}
+	}
+	return results, nil
+}
+
+// RecentProjects returns projects of all users ordered by the time of the last update
+// (most recent first), at most limit projects when limit > 0
+func (s *projectService) RecentProjects(limit int) ([]domain.ProjectInfo, error) {
+	names, err := s.repo.AllProjects(true)
+	if err != nil {
+		return nil, err
+	}
+	projects := make([]domain.ProjectInfo, 0, len(names))
+	for _, name := range names {
+		pi, err := s.repo.GetProjectInfo(name)
+		if err != nil {
+			s.log.Warnw("recent projects: getting project info", "project", name, zap.Error(err))
+			continue
+		}
+		projects = append(projects, pi)
+	}
+	sort.SliceStable(projects, func(i, j int) bool {
+		return projects[i].LastUpdate.After(projects[j].LastUpdate)
+	})
+	if limit > 0 && len(projects) > limit {
+		projects = projects[:limit]
+	}
+	return projects, nil
+}
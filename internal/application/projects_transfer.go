@@ -0,0 +1,141 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// replaceUser replaces username in the list of users, returns true if list was changed
+func replaceUser(users []interface{}, from, to string) ([]interface{}, bool) {
+	changed := false
+	hasTarget := false
+	for _, u := range users {
+		if u == to {
+			hasTarget = true
+		}
+	}
+	result := make([]interface{}, 0, len(users))
+	for _, u := range users {
+		if u == from {
+			changed = true
+			if hasTarget {
+				continue
+			}
+			hasTarget = true
+			u = to
+		}
+		result = append(result, u)
+	}
+	return result, changed
+}
+
+// replaceSettingsUser replaces references to the user in project's authentication settings
+// (users list and users of roles). Settings are processed as a generic JSON document,
+// so unknown fields are preserved.
+func replaceSettingsUser(data json.RawMessage, from, to string) (json.RawMessage, bool, error) {
+	if len(data) == 0 {
+		return data, false, nil
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, false, err
+	}
+	auth, ok := settings["auth"].(map[string]interface{})
+	if !ok {
+		return data, false, nil
+	}
+	changed := false
+	if users, ok := auth["users"].([]interface{}); ok {
+		var c bool
+		auth["users"], c = replaceUser(users, from, to)
+		changed = changed || c
+	}
+	if roles, ok := auth["roles"].([]interface{}); ok {
+		for _, r := range roles {
+			role, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if users, ok := role["users"].([]interface{}); ok {
+				var c bool
+				role["users"], c = replaceUser(users, from, to)
+				changed = changed || c
+			}
+		}
+	}
+	if !changed {
+		return data, false, nil
+	}
+	result, err := json.Marshal(settings)
+	return result, true, err
+}
+
+// Transfer moves project to another user account (target user's limits are checked)
+// and returns the new project name. References to the previous owner in project's
+// authentication settings are replaced by the new owner.
+func (s *projectService) Transfer(projectName, username string) (string, error) {
+	defer s.InvalidateMapConfig(projectName)
+	parts := strings.SplitN(projectName, "/", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid project name: %s", projectName)
+	}
+	owner := parts[0]
+	newName := username + "/" + parts[1]
+	if owner == username {
+		return projectName, nil
+	}
+	pInfo, err := s.repo.GetProjectInfo(projectName)
+	if err != nil {
+		return "", err
+	}
+	accountConfig, err := s.limiter.GetAccountLimits(username)
+	if err != nil {
+		return "", fmt.Errorf("getting user account limits config: %w", err)
+	}
+	projectsSizes, err := s.getProjectsSize(username)
+	if err != nil {
+		return "", fmt.Errorf("checking user storage limit: %w", err)
+	}
+	if !accountConfig.CheckProjectsLimit(len(projectsSizes) + 1) {
+		return "", ErrAccountProjectsLimit
+	}
+	if !accountConfig.CheckProjectSizeLimit(pInfo.Size) {
+		return "", &LimitError{Err: ErrProjectSizeLimit, Limit: int64(accountConfig.ProjectSizeLimit), Usage: 0, Attempted: pInfo.Size}
+	}
+	var totalSize int64 = 0
+	for _, pSize := range projectsSizes {
+		totalSize += pSize
+	}
+	if !accountConfig.CheckStorageLimit(totalSize + pInfo.Size) {
+		return "", &LimitError{Err: ErrAccountStorageLimit, Limit: int64(accountConfig.StorageLimit), Usage: totalSize, Attempted: totalSize + pInfo.Size}
+	}
+
+	// settings of both projects are locked (in fixed order) until the owner is replaced
+	first, second := projectName, newName
+	if second < first {
+		first, second = second, first
+	}
+	unlockFirst := s.settingsLocks.Lock(first)
+	defer unlockFirst()
+	unlockSecond := s.settingsLocks.Lock(second)
+	defer unlockSecond()
+	if err := s.repo.Move(projectName, newName); err != nil {
+		return "", err
+	}
+	current, err := s.repo.GetRawSettings(newName)
+	if err != nil {
+		return newName, fmt.Errorf("reading project settings: %w", err)
+	}
+	data, changed, err := replaceSettingsUser(current, owner, username)
+	if err != nil {
+		return newName, fmt.Errorf("updating owner in project settings: %w", err)
+	}
+	// transfer is not a settings change of the project (state and last update are kept)
+	if changed {
+		if err := s.repo.ReplaceSettings(newName, data); err != nil {
+			return newName, fmt.Errorf("updating owner in project settings: %w", err)
+		}
+	}
+	return newName, nil
+}
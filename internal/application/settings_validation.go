@@ -0,0 +1,118 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// SettingsValidationReport describes problems which would prevent project from being
+// published correctly
+type SettingsValidationReport struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+func (r *SettingsValidationReport) addError(format string, a ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, a...))
+}
+
+func (r *SettingsValidationReport) addWarning(format string, a ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, a...))
+}
+
+func collectGroupNames(nodes []domain.TreeNode, names map[string]bool) {
+	for _, n := range nodes {
+		if n.IsGroup() {
+			names[n.GroupName()] = true
+			collectGroupNames(n.Children(), names)
+		}
+	}
+}
+
+// ValidateSettings checks whether the project can be published with given settings
+// without saving them
+func (s *projectService) ValidateSettings(projectName string, data json.RawMessage) (SettingsValidationReport, error) {
+	report := SettingsValidationReport{Errors: []string{}, Warnings: []string{}}
+
+	var settings domain.ProjectSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		report.addError("Invalid settings data: %s", err)
+		return report, nil
+	}
+	pInfo, err := s.repo.GetProjectInfo(projectName)
+	if err != nil {
+		return report, err
+	}
+	if pInfo.QgisFile == "" {
+		report.addError("QGIS project file is not set")
+	} else if _, err := s.repo.GetFileInfo(projectName, pInfo.QgisFile); err != nil {
+		report.addError("QGIS project file is missing: %s", pInfo.QgisFile)
+	}
+
+	var meta domain.QgisMeta
+	if err := s.repo.ParseQgisMetadata(projectName, &meta); err != nil {
+		report.addError("Failed to read QGIS project metadata: %s", err)
+		return report, nil
+	}
+
+	if meta.Projection == "" {
+		report.addError("Project projection is not set")
+	} else {
+		proj4 := settings.Proj4[meta.Projection]
+		if proj, ok := meta.Projections[meta.Projection]; ok && proj != nil && proj4 == "" {
+			proj4 = proj.Proj4
+		}
+		if proj4 == "" {
+			report.addError("Missing definition of project projection: %s", meta.Projection)
+		}
+	}
+
+	layersTree, err := domain.CreateTree2(meta.LayersTree)
+	if err != nil {
+		report.addError("Invalid layers tree: %s", err)
+	}
+	groups := make(map[string]bool)
+	collectGroupNames(layersTree, groups)
+
+	for _, id := range settings.BaseLayers {
+		if _, ok := meta.Layers[id]; !ok && !groups[id] {
+			report.addError("Base layer does not exist: %s", id)
+		}
+	}
+	for id := range settings.Layers {
+		if _, ok := meta.Layers[id]; !ok {
+			report.addWarning("Settings of unknown layer: %s", id)
+		}
+	}
+	for _, topic := range settings.Topics {
+		for _, id := range topic.Layers {
+			if _, ok := meta.Layers[id]; !ok {
+				report.addError("Topic '%s' references unknown layer: %s", topic.Title, id)
+			}
+		}
+		if topic.BaseLayer != "" {
+			if _, ok := meta.Layers[topic.BaseLayer]; !ok && !groups[topic.BaseLayer] {
+				report.addError("Topic '%s' references unknown base layer: %s", topic.Title, topic.BaseLayer)
+			}
+		}
+	}
+	layerNames := make(map[string]bool, len(meta.Layers))
+	for _, lmeta := range meta.Layers {
+		layerNames[lmeta.Name] = true
+	}
+	for alias, name := range settings.LayerAliases {
+		if alias == "" || strings.ContainsAny(alias, ",:") {
+			report.addError("Invalid layer alias: %q", alias)
+		} else if layerNames[alias] {
+			report.addError("Layer alias '%s' conflicts with the layer name", alias)
+		} else if !layerNames[name] {
+			report.addError("Layer alias '%s' references unknown layer: %s", alias, name)
+		}
+	}
+	report.Valid = len(report.Errors) == 0
+	return report, nil
+}
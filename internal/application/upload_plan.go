@@ -0,0 +1,58 @@
+package application
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// UploadPlan describes changes needed to synchronize project files with the client
+type UploadPlan struct {
+	Upload []domain.ProjectFile `json:"upload"`
+	Remove []string             `json:"remove"`
+}
+
+// files managed by the server (media files uploaded from the web app, scripts), never
+// included in the list of removed files
+func isServerManagedFile(path string) bool {
+	return strings.HasPrefix(path, "web/")
+}
+
+// UploadPlan compares the client's list of project files with the server's files index and
+// returns files which are new or changed (and have to be uploaded) and files which are
+// not present on the client side anymore.
+func (s *projectService) UploadPlan(projectName string, files []domain.ProjectFile) (UploadPlan, error) {
+	plan := UploadPlan{
+		Upload: make([]domain.ProjectFile, 0),
+		Remove: make([]string, 0),
+	}
+	paths := make([]string, len(files))
+	clientFiles := make(map[string]bool, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+		clientFiles[f.Path] = true
+	}
+	// files not present in the index are omitted
+	indexed, err := s.repo.GetFilesInfo(projectName, paths...)
+	if err != nil {
+		return plan, err
+	}
+	for _, f := range files {
+		info, ok := indexed[f.Path]
+		if !ok || info.Size != f.Size || (f.Hash != "" && info.Hash != f.Hash) {
+			plan.Upload = append(plan.Upload, f)
+		}
+	}
+	serverFiles, _, err := s.repo.ListProjectFiles(projectName, false)
+	if err != nil {
+		return plan, err
+	}
+	for _, f := range serverFiles {
+		if !clientFiles[f.Path] && !isServerManagedFile(f.Path) {
+			plan.Remove = append(plan.Remove, f.Path)
+		}
+	}
+	sort.Strings(plan.Remove)
+	return plan, nil
+}
@@ -0,0 +1,239 @@
+package application
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	WebhookEventSettingsUpdated = "settings_updated"
+	WebhookEventFilesUpdated    = "files_updated"
+	WebhookEventPublished       = "published"
+)
+
+var ErrWebhookAddressNotAllowed = errors.New("webhook address is not allowed")
+
+// WebhooksConfig configures delivery of webhooks, zero values are replaced by defaults
+type WebhooksConfig struct {
+	Workers   int
+	QueueSize int
+	Attempts  int
+	Timeout   time.Duration
+	// delay before the first retry, doubled with every next attempt
+	RetryDelay time.Duration
+	// allows delivery to loopback, private and link-local addresses (only for trusted deployments)
+	AllowPrivateNetworks bool
+}
+
+func (c WebhooksConfig) withDefaults() WebhooksConfig {
+	if c.Workers <= 0 {
+		c.Workers = 2
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 100
+	}
+	if c.Attempts <= 0 {
+		c.Attempts = 3
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = time.Second
+	}
+	return c
+}
+
+// WebhookEvent is the JSON payload sent to project webhooks
+type WebhookEvent struct {
+	Event     string    `json:"event"`
+	Project   string    `json:"project"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type webhookDelivery struct {
+	hook    domain.Webhook
+	payload []byte
+}
+
+// WebhookSignature returns HMAC-SHA256 signature of the payload, sent in 'X-Gisquick-Signature'
+// header in the form 'sha256=<hex digest>'
+func WebhookSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func validateWebhook(hook domain.Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url: %q", hook.URL)
+	}
+	return nil
+}
+
+// isPublicIP checks whether the address is globally routable (not loopback, private,
+// link-local, multicast or unspecified)
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// NewWebhookClient creates HTTP client for webhooks delivery. Redirects are not followed and
+// connections to internal addresses are refused (checked at dial time, after DNS resolution),
+// unless private networks are allowed.
+func NewWebhookClient(cfg WebhooksConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		// no proxy, addresses are checked on direct connections
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookDispatcher delivers webhook events asynchronously by a small pool of workers
+type webhookDispatcher struct {
+	log    *zap.SugaredLogger
+	cfg    WebhooksConfig
+	client *http.Client
+	queue  chan webhookDelivery
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newWebhookDispatcher(log *zap.SugaredLogger, cfg WebhooksConfig) *webhookDispatcher {
+	cfg = cfg.withDefaults()
+	d := &webhookDispatcher{
+		log:    log,
+		cfg:    cfg,
+		client: NewWebhookClient(cfg),
+		queue:  make(chan webhookDelivery, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		d.wg.Add(1)
+		go d.run()
+	}
+	return d
+}
+
+func (d *webhookDispatcher) run() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case delivery := <-d.queue:
+			d.deliver(delivery)
+		}
+	}
+}
+
+func (d *webhookDispatcher) deliver(delivery webhookDelivery) {
+	delay := d.cfg.RetryDelay
+	var err error
+	for attempt := 1; attempt <= d.cfg.Attempts; attempt++ {
+		if err = d.post(delivery); err == nil {
+			return
+		}
+		// refused addresses won't become valid by retrying
+		if errors.Is(err, ErrWebhookAddressNotAllowed) {
+			break
+		}
+		if attempt < d.cfg.Attempts {
+			select {
+			case <-d.done:
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+	d.log.Errorw("webhook delivery failed", "url", delivery.hook.URL, zap.Error(err))
+}
+
+func (d *webhookDispatcher) post(delivery webhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.hook.URL, bytes.NewReader(delivery.payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if delivery.hook.Secret != "" {
+		req.Header.Set("X-Gisquick-Signature", WebhookSignature(delivery.hook.Secret, delivery.payload))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
+
+// dispatch enqueues the event for all webhooks subscribed to it (or to all events)
+func (d *webhookDispatcher) dispatch(projectName string, hooks []domain.Webhook, event string) {
+	var payload []byte
+	for _, hook := range hooks {
+		if len(hook.Events) > 0 && !domain.StringArray(hook.Events).Has(event) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(WebhookEvent{Event: event, Project: projectName, Timestamp: time.Now().UTC()})
+			if err != nil {
+				d.log.Errorw("encoding webhook event", zap.Error(err))
+				return
+			}
+		}
+		select {
+		case d.queue <- webhookDelivery{hook: hook, payload: payload}:
+		default:
+			d.log.Errorw("webhooks queue is full, event dropped", "project", projectName, "event", event, "url", hook.URL)
+		}
+	}
+}
+
+func (d *webhookDispatcher) Close() {
+	close(d.done)
+	d.wg.Wait()
+}
+
+// notifyWebhooks sends the event to webhooks configured in the project settings
+func (s *projectService) notifyWebhooks(projectName, event string) {
+	settings, err := s.repo.GetSettings(projectName)
+	if err != nil || len(settings.Webhooks) == 0 {
+		return
+	}
+	s.webhooks.dispatch(projectName, settings.Webhooks, event)
+}
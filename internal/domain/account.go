@@ -81,8 +81,9 @@ func (a *Account) Activate() error {
 	return nil
 }
 
-func (a *Account) SetPassword(password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// SetPassword hashes the password with the given bcrypt cost (default cost when zero)
+func (a *Account) SetPassword(password string, cost int) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return err
 	}
@@ -100,6 +101,19 @@ func (a *Account) CheckPassword(password string) bool {
 	return bcrypt.CompareHashAndPassword(a.Password, []byte(password)) == nil
 }
 
+// NeedsRehash reports whether the password hash is a legacy (Django) hash, or bcrypt
+// hash with lower cost than the given cost (default cost when zero)
+func (a *Account) NeedsRehash(cost int) bool {
+	if strings.HasPrefix(string(a.Password), "pbkdf2_sha256$") {
+		return true
+	}
+	if cost < bcrypt.MinCost {
+		cost = bcrypt.DefaultCost
+	}
+	hashCost, err := bcrypt.Cost(a.Password)
+	return err == nil && hashCost < cost
+}
+
 func (a *Account) FullName() string {
 	name := strings.TrimSpace(fmt.Sprintf("%s %s", a.FirstName, a.LastName))
 	if name == "" {
@@ -112,14 +126,24 @@ func (a *Account) FullName() string {
 // 	IsSuperuser bool
 // }
 
-func NewAccount(username, email, firstName, lastName, password string) (Account, error) {
-	username = strings.TrimSpace(username)
+// ValidateAccountFields checks format of the username and email (optional)
+func ValidateAccountFields(username, email string) error {
 	if !validateUsername(username) {
-		return Account{}, fmt.Errorf("invalid username: '%s'", username)
+		return fmt.Errorf("invalid username: '%s'", username)
 	}
-	email = strings.ToLower(strings.TrimSpace(email))
 	if email != "" && !validateEmail(email) {
-		return Account{}, fmt.Errorf("invalid email: '%s'", email)
+		return fmt.Errorf("invalid email: '%s'", email)
+	}
+	return nil
+}
+
+// NewAccount creates account with password hashed with the given bcrypt cost (default cost
+// when zero), account without password is created when the password is empty
+func NewAccount(username, email, firstName, lastName, password string, passwordCost int) (Account, error) {
+	username = strings.TrimSpace(username)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := ValidateAccountFields(username, email); err != nil {
+		return Account{}, err
 	}
 	now := time.Now() //.UTC()
 	account := Account{
@@ -130,7 +154,7 @@ func NewAccount(username, email, firstName, lastName, password string) (Account,
 		Created:   &now,
 	}
 	if password != "" {
-		if err := account.SetPassword(password); err != nil {
+		if err := account.SetPassword(password, passwordCost); err != nil {
 			return account, err
 		}
 	} else {
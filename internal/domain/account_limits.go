@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -12,6 +13,9 @@ type AccountConfig struct {
 	ProjectsCountLimit int      `json:"projects_limit"`
 	ProjectSizeLimit   ByteSize `json:"project_size_limit"`
 	StorageLimit       ByteSize `json:"storage_limit"`
+	// file extensions (e.g. ".shp") allowed/denied in project uploads, empty allowlist allows all
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+	DeniedExtensions  []string `json:"denied_extensions,omitempty"`
 }
 
 func parseByteSize(value string) (int64, error) {
@@ -75,3 +79,48 @@ func (c *AccountConfig) CheckProjectSizeLimit(size int64) bool {
 func (c *AccountConfig) CheckProjectsLimit(count int) bool {
 	return c.ProjectsCountLimit == -1 || count <= c.ProjectsCountLimit
 }
+
+func matchExtension(ext string, extensions []string) bool {
+	for _, e := range extensions {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e != "" && !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFileExtension checks whether the file can be uploaded according to allowed and denied
+// extensions (extensions are compared case-insensitively)
+func (c *AccountConfig) CheckFileExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if matchExtension(ext, c.DeniedExtensions) {
+		return false
+	}
+	return len(c.AllowedExtensions) == 0 || matchExtension(ext, c.AllowedExtensions)
+}
+
+// AccountLimits holds per-account overrides of the default limits,
+// nil values are not overridden.
+type AccountLimits struct {
+	ProjectsCountLimit *int      `json:"projects_limit"`
+	ProjectSizeLimit   *ByteSize `json:"project_size_limit"`
+	StorageLimit       *ByteSize `json:"storage_limit"`
+}
+
+// Apply returns account config with applied overrides
+func (l AccountLimits) Apply(config AccountConfig) AccountConfig {
+	if l.ProjectsCountLimit != nil {
+		config.ProjectsCountLimit = *l.ProjectsCountLimit
+	}
+	if l.ProjectSizeLimit != nil {
+		config.ProjectSizeLimit = *l.ProjectSizeLimit
+	}
+	if l.StorageLimit != nil {
+		config.StorageLimit = *l.StorageLimit
+	}
+	return config
+}
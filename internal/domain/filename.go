@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FilenameHashLength is the number of hash characters used for <hash> placeholder
+const FilenameHashLength = 10
+
+// FormatFilename resolves <timestamp> and <random> placeholders in the filename pattern
+// of uploaded files. <hash> placeholder is resolved later by FormatFilenameHash,
+// when the content of the file is known.
+func FormatFilename(pattern string) string {
+	if strings.Contains(pattern, "<timestamp>") {
+		pattern = strings.Replace(pattern, "<timestamp>", fmt.Sprint(time.Now().Unix()), 1)
+	}
+	if strings.Contains(pattern, "<random>") {
+		randBytes := make([]byte, 16)
+		rand.Read(randBytes)
+		pattern = strings.Replace(pattern, "<random>", hex.EncodeToString(randBytes), 1)
+	}
+	return pattern
+}
+
+// FormatFilenameHash resolves <hash> placeholder with the (shortened) hash of the file content
+func FormatFilenameHash(pattern, hash string) string {
+	if len(hash) > FilenameHashLength {
+		hash = hash[:FilenameHashLength]
+	}
+	return strings.Replace(pattern, "<hash>", hash, 1)
+}
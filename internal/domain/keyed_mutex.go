@@ -0,0 +1,42 @@
+package domain
+
+import "sync"
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// KeyedMutex provides mutual exclusion per key (e.g. project name), locks
+// are created on demand and released when there are no more holders.
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+func NewKeyedMutex() *KeyedMutex {
+	return &KeyedMutex{locks: make(map[string]*keyedLock)}
+}
+
+// Lock locks the given key and returns function to unlock it
+func (km *KeyedMutex) Lock(key string) func() {
+	km.mu.Lock()
+	l, exists := km.locks[key]
+	if !exists {
+		l = &keyedLock{}
+		km.locks[key] = l
+	}
+	l.refs++
+	km.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		km.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
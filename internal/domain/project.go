@@ -3,15 +3,62 @@ package domain
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 var (
 	ErrProjectNotExists     = errors.New("project does not exists")
 	ErrFileNotExists        = errors.New("project file does not exists")
 	ErrProjectAlreadyExists = errors.New("project already exists")
+	ErrProjectLocked        = errors.New("project is locked by another operation")
+	ErrFileMismatch         = errors.New("uploaded file doesn't match declared info")
+	ErrInvalidStateChange   = errors.New("invalid project state change")
+	ErrFileExists           = errors.New("project file already exists")
+	ErrInvalidProjectName   = errors.New("invalid project name")
 )
 
+var isValidProjectName = regexp.MustCompile(`^[0-9A-Za-z_\-][0-9A-Za-z_\-\.]*$`).MatchString
+
+// ValidateProjectName checks full project name in the form 'username/name'. Name can contain
+// only letters, digits, '_', '-' and '.' (not at the beginning), so it can't contain path
+// separators or create hidden/reserved directories.
+func ValidateProjectName(projectName string) error {
+	parts := strings.Split(projectName, "/")
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidProjectName, projectName)
+	}
+	name := parts[1]
+	if len(name) > 100 || !isValidProjectName(name) {
+		return fmt.Errorf("%w: %s", ErrInvalidProjectName, name)
+	}
+	return nil
+}
+
+// FileMismatchError wraps ErrFileMismatch with details about the uploaded file
+type FileMismatchError struct {
+	Path     string `json:"path"`
+	Property string `json:"property"` // path, size or hash
+	Declared string `json:"declared"`
+	Actual   string `json:"actual"`
+}
+
+func (e *FileMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s (%s declared: %s, actual: %s)", ErrFileMismatch, e.Path, e.Property, e.Declared, e.Actual)
+}
+
+func (e *FileMismatchError) Unwrap() error {
+	return ErrFileMismatch
+}
+
+// ErrorDetails provides data for the API error response
+func (e *FileMismatchError) ErrorDetails() interface{} {
+	return e
+}
+
 // Old code, currently used in mapcache package
 type ProjectFileInfo struct {
 	User     string
@@ -54,6 +101,7 @@ type UserRolesPermissions struct {
 	layers     map[string]Flags
 	attributes map[string]map[string]Flags
 	topics     []string
+	templates  []string
 }
 
 func NewUserRolesPermissions(user User, auth Authentication) *UserRolesPermissions {
@@ -108,6 +156,17 @@ func (p *UserRolesPermissions) UserTopics() []string {
 	return p.topics
 }
 
+func (p *UserRolesPermissions) UserPrintTemplates() []string {
+	if p.templates == nil {
+		templates := Flags{}
+		for _, r := range p.roles {
+			templates = templates.Union(r.Permissions.PrintTemplates)
+		}
+		p.templates = templates
+	}
+	return p.templates
+}
+
 func (s ProjectSettings) UserLayerPermissionsFlags(u User, layerId string) Flags {
 	lset, ok := s.Layers[layerId]
 	if !ok || lset.Flags.Has("excluded") {
@@ -146,6 +205,26 @@ type FileInfo struct {
 	Mtime int64  `json:"mtime"`
 }
 
+// sqlite based formats are modified in place (e.g. by the mapserver), so they must not
+// share the content with other files
+var sqliteExtensions = []string{".gpkg", ".sqlite", ".sqlite3", ".db", ".mbtiles", ".gpkg-wal", ".gpkg-shm"}
+
+// IsDeduplicableFile reports whether the project file can share its content with other
+// files with the same hash. Only media files uploaded from the web app (web/ directory)
+// are never modified in place.
+func IsDeduplicableFile(path string) bool {
+	if !strings.HasPrefix(path, "web/") {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range sqliteExtensions {
+		if ext == e {
+			return false
+		}
+	}
+	return true
+}
+
 type ProjectFile struct {
 	Path  string `json:"path"`
 	Hash  string `json:"hash,omitempty"`
@@ -153,6 +232,21 @@ type ProjectFile struct {
 	Mtime int64  `json:"mtime"`
 }
 
+// SizeBreakdown describes how project files (from the files index) contribute to the project size
+type SizeBreakdown struct {
+	Total        int64            `json:"total"`
+	Directories  map[string]int64 `json:"directories"`
+	Extensions   map[string]int64 `json:"extensions"`
+	LargestFiles []ProjectFile    `json:"largest_files"`
+}
+
+// DirectoryListing holds content of a single project directory (not recursive)
+type DirectoryListing struct {
+	Path        string        `json:"path"`
+	Directories []string      `json:"directories"`
+	Files       []ProjectFile `json:"files"`
+}
+
 func checkUserRole(u User, role ProjectRole) bool {
 	if role.Auth == "all" {
 		return true
@@ -190,6 +284,8 @@ func FilterUserRoles(u User, roles []ProjectRole) []ProjectRole {
 	return userRoles
 }
 
+// FilesChanges describes changes of project files. Declared size and hash of the updated
+// files always refer to the original (decompressed) file, even when it's transferred compressed.
 type FilesChanges struct {
 	Removes []string
 	Updates []ProjectFile
@@ -202,6 +298,7 @@ type ScriptModule struct {
 
 type Scripts map[string]ScriptModule
 
+// FilesReader returns path and content (already decompressed) of the next uploaded file
 type FilesReader func() (string, io.ReadCloser, error)
 
 type ProjectsRepository interface {
@@ -211,6 +308,7 @@ type ProjectsRepository interface {
 	UserProjects(user string) ([]string, error) // or should it require User object?
 	GetProjectInfo(name string) (ProjectInfo, error)
 	Delete(name string) error
+	Move(name, newName string) error
 	// SaveFile(projectName, filename string, r io.Reader) error
 	CreateFile(projectName, directory, pattern string, r io.Reader) (ProjectFile, error)
 	SaveFile(project string, finfo ProjectFile, path string) error
@@ -218,12 +316,20 @@ type ProjectsRepository interface {
 	GetFileInfo(project, path string) (FileInfo, error)
 	GetFilesInfo(project string, paths ...string) (map[string]FileInfo, error)
 	ListProjectFiles(project string, checksum bool) ([]ProjectFile, []ProjectFile, error)
+	RemoveTemporaryFiles(project string) ([]ProjectFile, error)
+	ListDirectory(project, path string) (DirectoryListing, error)
+	CreateDirectory(project, path string) error
+	SizeBreakdown(project string, depth, largest int) (SizeBreakdown, error)
 
+	GetQgisMetaPath(projectName string) string
 	ParseQgisMetadata(projectName string, data interface{}) error
 	UpdateMeta(projectName string, meta json.RawMessage) error
 
 	GetSettings(projectName string) (ProjectSettings, error)
+	GetRawSettings(projectName string) (json.RawMessage, error)
 	UpdateSettings(projectName string, data json.RawMessage) error
+	ReplaceSettings(projectName string, data json.RawMessage) error
+	UpdateState(projectName string, state string) error
 
 	GetThumbnailPath(projectName string) string
 	SaveThumbnail(projectName string, r io.Reader) error
@@ -19,10 +19,36 @@ type ProjectInfo struct {
 	Projection     string    `json:"projection"` // projection code
 	Mapcache       bool      `json:"mapcache"`
 	Authentication string    `json:"authentication"`
-	// empty, pending update, hidden
-	State     string `json:"state"`
-	Size      int64  `json:"size"` // size in bytes
-	Thumbnail bool   `json:"thumbnail"`
+	// empty, staged, published, hidden
+	State     string   `json:"state"`
+	Size      int64    `json:"size"` // size in bytes
+	Thumbnail bool     `json:"thumbnail"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+const (
+	ProjectStateEmpty     = "empty"
+	ProjectStateStaged    = "staged"
+	ProjectStatePublished = "published"
+	ProjectStateHidden    = "hidden"
+)
+
+// projectStateTransitions lists states which can be set explicitly (by user) from the given state
+var projectStateTransitions = map[string][]string{
+	ProjectStateStaged:    {ProjectStatePublished},
+	ProjectStatePublished: {ProjectStateHidden},
+	ProjectStateHidden:    {ProjectStatePublished},
+}
+
+// CanChangeState checks whether the project can be switched into the given state
+func (p ProjectInfo) CanChangeState(state string) bool {
+	return StringArray(projectStateTransitions[p.State]).Has(state)
+}
+
+// IsMapAvailable returns true when project is configured to be displayed in the map
+// application (hidden projects are available only for the owner)
+func (p ProjectInfo) IsMapAvailable() bool {
+	return p.State == ProjectStatePublished || p.State == ProjectStateHidden
 }
 
 type LayerNode struct {
@@ -59,6 +85,9 @@ type LayerAttribute struct {
 	Widget     string                 `json:"widget,omitempty"`
 	Config     map[string]interface{} `json:"config,omitempty"`
 	Format     string                 `json:"format,omitempty"`
+
+	DefaultValue      interface{} `json:"default_value,omitempty"`
+	DefaultExpression string      `json:"default_expression,omitempty"`
 }
 
 type BookmarkMeta struct {
@@ -2,12 +2,17 @@ package domain
 
 import (
 	"encoding/json"
+	"strings"
 )
 
 type AttributeSettings struct {
 	Widget    string                 `json:"widget,omitempty"`
 	Config    map[string]interface{} `json:"config,omitempty"`
 	Formatter string                 `json:"format,omitempty"`
+	// default value of new features
+	DefaultValue interface{} `json:"default_value,omitempty"`
+	// QGIS expression of the default value, can reference session variables (e.g. @username)
+	DefaultExpression string `json:"default_expression,omitempty"`
 }
 
 type FieldsConfig struct {
@@ -52,6 +57,8 @@ type RolePermissions struct {
 	Attributes map[string]map[string]Flags `json:"attributes"`
 	Layers     map[string]Flags            `json:"layers"`
 	Topics     []string                    `json:"topics"`
+	// names of accessible print composer templates
+	PrintTemplates []string `json:"print_templates"`
 
 	// @TODO: replace when file upload permissions is implemented
 	Media bool `json:"custom_media_upload"`
@@ -69,8 +76,10 @@ type StorageProvider struct {
 	Type  string `json:"type"`
 
 	StoreUrl  string `json:"store_url,omitempty"`
+	ReadUrl   string `json:"read_url,omitempty"` // public URL for reading objects (defaults to StoreUrl)
 	Bucket    string `json:"bucket,omitempty"`
 	Region    string `json:"region,omitempty"`
+	PathStyle bool   `json:"path_style,omitempty"` // path-style bucket addressing (MinIO, S3 compatible services)
 	AccessKey string `json:"access_key,omitempty"`
 	SecretKey string `json:"secret_key,omitempty"`
 }
@@ -100,6 +109,14 @@ type Bookmark struct {
 	Content string `json:"content"`
 }
 
+// BookmarkGroup holds client side settings of bookmarks group from QGIS project
+type BookmarkGroup struct {
+	Name  string `json:"name"`            // group name in QGIS project
+	Title string `json:"title,omitempty"` // displayed name
+	// order of bookmarks (IDs), bookmarks which are not listed follows in original order
+	Order []string `json:"order,omitempty"`
+}
+
 type ProjectSettings struct {
 	MapTiling        bool                           `json:"map_tiling"`
 	Auth             Authentication                 `json:"auth"` // or access?
@@ -121,4 +138,58 @@ type ProjectSettings struct {
 	Language         string                         `json:"lang"`
 	CustomProperties json.RawMessage                `json:"custom"`
 	Bookmarks        map[string]map[string]Bookmark `json:"bookmarks"`
+	// order and names of bookmark groups
+	BookmarkGroups []BookmarkGroup `json:"bookmark_groups,omitempty"`
+	// ReadOnly disables all edits (WFS transactions, media files)
+	ReadOnly bool `json:"read_only,omitempty"`
+	// CRS codes allowed in OWS requests (all when empty)
+	AllowedCRS []string `json:"allowed_crs,omitempty"`
+	// origins allowed to embed the map in iframes (framing is denied when empty)
+	EmbedAllowedOrigins []string `json:"embed_allowed_origins,omitempty"`
+	// fallback projection and units (name), used when project metadata lacks them
+	Projection string `json:"projection,omitempty"`
+	Units      string `json:"units,omitempty"`
+	// alternative layer names (alias -> layer name) accepted in OWS requests
+	LayerAliases map[string]string `json:"layer_aliases,omitempty"`
+	// tags for organizing/filtering of projects
+	Tags []string `json:"tags,omitempty"`
+	// webhooks notified about project changes
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+	// defaults of cached tiles (WMS cache) when not specified in the request
+	TileFormat string `json:"tile_format,omitempty"`
+	TileDPI    int    `json:"tile_dpi,omitempty"`
+}
+
+// TileDPIs lists resolutions allowed for cached tiles (1x, 1.5x, 2x and 3x of the standard
+// 96 DPI), other values are rejected to keep the number of cached variants bounded
+var TileDPIs = []int{96, 144, 192, 288}
+
+func IsValidTileDPI(dpi int) bool {
+	for _, v := range TileDPIs {
+		if v == dpi {
+			return true
+		}
+	}
+	return false
+}
+
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // key for HMAC signature of the payload
+	// subscribed events (all events when empty)
+	Events []string `json:"events,omitempty"`
+}
+
+// NormalizeTags returns trimmed, lowercase tags without empty values and duplicates
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
 }
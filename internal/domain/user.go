@@ -8,4 +8,21 @@ type User struct {
 	IsSuperuser     bool   `json:"is_superuser"`
 	IsAuthenticated bool   `json:"-"`
 	IsGuest         bool   `json:"is_guest"`
+	// GuestName identifies unauthenticated user in logs and default values. It's not used
+	// for permissions checks, guest users always have an empty Username.
+	GuestName string `json:"-"`
+}
+
+// DefaultGuestUsername is identity of unauthenticated users without GuestName
+const DefaultGuestUsername = "anonymous"
+
+// Identity returns username of the user, or guest name for unauthenticated users
+func (u User) Identity() string {
+	if !u.IsAuthenticated || u.Username == "" {
+		if u.GuestName != "" {
+			return u.GuestName
+		}
+		return DefaultGuestUsername
+	}
+	return u.Username
 }
@@ -25,10 +25,25 @@ type FilesConfigReader[V any] struct {
 	DefaultConfig V
 }
 
+// copyConfig returns deep copy of the config (through JSON), unmarshalling into a shallow copy
+// would reuse slices of the original value
+func copyConfig[V any](config V) (V, error) {
+	var c V
+	data, err := json.Marshal(config)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
 func NewFilesConfigReader[V any](log *zap.SugaredLogger, configPath string, defaultConfig V) *FilesConfigReader[V] {
 	cache := NewDataCache(func(filename string) (V, error) {
-
-		config := defaultConfig
+		// values from the file override the default config
+		config, err := copyConfig(defaultConfig)
+		if err != nil {
+			return defaultConfig, fmt.Errorf("copying default config: %w", err)
+		}
 		// filename := filepath.Join(configPath, fmt.Sprintf("%s.json", id))
 		content, err := ioutil.ReadFile(filename)
 		log.Infow("NewFilesConfigReader: parsing file", "path", filename)
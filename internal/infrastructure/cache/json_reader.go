@@ -62,7 +62,7 @@ func (r *JSONFileReader[V]) Get(filename string) (V, error) {
 		return v, err
 	}
 	updated := fStat.ModTime()
-	timestamp := updated.Unix()
+	timestamp := updated.UnixNano()
 
 	item := r.cache.Get(filename)
 	if item == nil {
@@ -27,22 +27,39 @@ type EmailTemplate struct {
 	Text *texttemplate.Template
 }
 
-func parseEmailTemplate(templatesRoot string, name string) EmailTemplate {
+func parseEmailTemplate(templatesRoot string, name string) (EmailTemplate, error) {
 	funcs := map[string]any{
 		"query_escape": url.QueryEscape,
 	}
 	htmlFuncs := htmltemplate.FuncMap(funcs)
 	textFuncs := texttemplate.FuncMap(funcs)
-	html := htmltemplate.Must(htmltemplate.New("email").Funcs(htmlFuncs).ParseFiles(path.Join(templatesRoot, "/email_base.html"), fmt.Sprintf("%s.html", name)))
-	text := texttemplate.Must(texttemplate.New("email").Funcs(textFuncs).ParseFiles(path.Join(templatesRoot, "/email_base.txt"), fmt.Sprintf("%s.txt", name)))
-	return EmailTemplate{HTML: html, Text: text}
+	html, err := htmltemplate.New("email").Funcs(htmlFuncs).ParseFiles(path.Join(templatesRoot, "/email_base.html"), fmt.Sprintf("%s.html", name))
+	if err != nil {
+		return EmailTemplate{}, err
+	}
+	text, err := texttemplate.New("email").Funcs(textFuncs).ParseFiles(path.Join(templatesRoot, "/email_base.txt"), fmt.Sprintf("%s.txt", name))
+	if err != nil {
+		return EmailTemplate{}, err
+	}
+	return EmailTemplate{HTML: html, Text: text}, nil
 }
 
-func NewAccountsEmailSender(client EmailService, templatesRoot string, sender, siteURL, activationSubject, passwordResetSubject string) *AccountsEmailSender {
-	templates := make(map[string]EmailTemplate, 3)
-	templates["activation_email"] = parseEmailTemplate(templatesRoot, path.Join(templatesRoot, "/activation_email"))
-	templates["invitation_email"] = parseEmailTemplate(templatesRoot, path.Join(templatesRoot, "/invitation_email"))
-	templates["password_reset_email"] = parseEmailTemplate(templatesRoot, path.Join(templatesRoot, "/reset_password_email"))
+// NewAccountsEmailSender creates email sender of accounts related emails, returns error
+// when email templates cannot be loaded from the templates directory
+func NewAccountsEmailSender(client EmailService, templatesRoot string, sender, siteURL, activationSubject, passwordResetSubject string) (*AccountsEmailSender, error) {
+	files := map[string]string{
+		"activation_email":     "activation_email",
+		"invitation_email":     "invitation_email",
+		"password_reset_email": "reset_password_email",
+	}
+	templates := make(map[string]EmailTemplate, len(files))
+	for name, file := range files {
+		t, err := parseEmailTemplate(templatesRoot, path.Join(templatesRoot, file))
+		if err != nil {
+			return nil, fmt.Errorf("loading email template %s: %w", name, err)
+		}
+		templates[name] = t
+	}
 	return &AccountsEmailSender{
 		client:               client,
 		sender:               sender,
@@ -50,7 +67,7 @@ func NewAccountsEmailSender(client EmailService, templatesRoot string, sender, s
 		activationSubject:    activationSubject,
 		passwordResetSubject: passwordResetSubject,
 		templates:            templates,
-	}
+	}, nil
 }
 
 func (s *AccountsEmailSender) SendActivationEmail(account domain.Account, uid, token string, data map[string]interface{}) error {
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// AccountsLimiter provides account limits with per-user overrides stored in
+// the account_limits table
+type AccountsLimiter struct {
+	db     *sqlx.DB
+	config domain.AccountConfig
+}
+
+func NewAccountsLimiter(db *sqlx.DB, defaultConfig domain.AccountConfig) *AccountsLimiter {
+	return &AccountsLimiter{db: db, config: defaultConfig}
+}
+
+func (l *AccountsLimiter) GetAccountLimits(username string) (domain.AccountConfig, error) {
+	limits, err := l.GetAccountLimitsOverrides(username)
+	if err != nil {
+		return domain.AccountConfig{}, err
+	}
+	return limits.Apply(l.config), nil
+}
+
+func (l *AccountsLimiter) GetAccountLimitsOverrides(username string) (domain.AccountLimits, error) {
+	var row AccountLimits
+	err := l.db.Get(&row, "SELECT * FROM account_limits WHERE username=$1", username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.AccountLimits{}, nil
+		}
+		return domain.AccountLimits{}, err
+	}
+	return toDomainAccountLimits(row), nil
+}
+
+func (l *AccountsLimiter) SetAccountLimitsOverrides(username string, limits domain.AccountLimits) error {
+	row := toAccountLimits(username, limits)
+	_, err := l.db.NamedExec(
+		`INSERT INTO account_limits (username, projects_limit, project_size_limit, storage_limit)
+		VALUES (:username, :projects_limit, :project_size_limit, :storage_limit)
+		ON CONFLICT (username) DO UPDATE SET
+			projects_limit = EXCLUDED.projects_limit,
+			project_size_limit = EXCLUDED.project_size_limit,
+			storage_limit = EXCLUDED.storage_limit`,
+		&row,
+	)
+	return err
+}
+
+func toDomainAccountLimits(row AccountLimits) domain.AccountLimits {
+	limits := domain.AccountLimits{}
+	if row.ProjectsLimit.Valid {
+		v := int(row.ProjectsLimit.Int32)
+		limits.ProjectsCountLimit = &v
+	}
+	if row.ProjectSizeLimit.Valid {
+		v := domain.ByteSize(row.ProjectSizeLimit.Int64)
+		limits.ProjectSizeLimit = &v
+	}
+	if row.StorageLimit.Valid {
+		v := domain.ByteSize(row.StorageLimit.Int64)
+		limits.StorageLimit = &v
+	}
+	return limits
+}
+
+func toAccountLimits(username string, limits domain.AccountLimits) AccountLimits {
+	row := AccountLimits{Username: username}
+	if limits.ProjectsCountLimit != nil {
+		row.ProjectsLimit = sql.NullInt32{Int32: int32(*limits.ProjectsCountLimit), Valid: true}
+	}
+	if limits.ProjectSizeLimit != nil {
+		row.ProjectSizeLimit = sql.NullInt64{Int64: int64(*limits.ProjectSizeLimit), Valid: true}
+	}
+	if limits.StorageLimit != nil {
+		row.StorageLimit = sql.NullInt64{Int64: int64(*limits.StorageLimit), Valid: true}
+	}
+	return row
+}
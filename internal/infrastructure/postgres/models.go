@@ -1,6 +1,9 @@
 package postgres
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
 type User struct {
 	Username    string     `db:"username"`
@@ -14,3 +17,10 @@ type User struct {
 	Confirmed   *time.Time `db:"confirmed_at"`
 	LastLogin   *time.Time `db:"last_login_at"`
 }
+
+type AccountLimits struct {
+	Username         string        `db:"username"`
+	ProjectsLimit    sql.NullInt32 `db:"projects_limit"`
+	ProjectSizeLimit sql.NullInt64 `db:"project_size_limit"`
+	StorageLimit     sql.NullInt64 `db:"storage_limit"`
+}
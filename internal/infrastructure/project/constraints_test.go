@@ -0,0 +1,41 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestConfigurableProjectsLimiterOverrides(t *testing.T) {
+	configPath := t.TempDir()
+	defaultConfig := domain.AccountConfig{
+		ProjectsCountLimit: 5,
+		ProjectSizeLimit:   -1,
+		StorageLimit:       -1,
+		AllowedExtensions:  []string{".qgs", ".gpkg", ".png"},
+		DeniedExtensions:   []string{".exe", ".gpkg"},
+	}
+	config := `{"projects_limit": 10, "allowed_extensions": [".qgs"], "denied_extensions": [".bat"]}`
+	assert.NoError(t, os.WriteFile(filepath.Join(configPath, "user1.json"), []byte(config), 0644))
+
+	limiter := NewConfigurableProjectsLimiter(zap.NewNop().Sugar(), configPath, defaultConfig)
+	c, err := limiter.GetAccountLimits("user1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 10, c.ProjectsCountLimit)
+		assert.Equal(t, domain.ByteSize(-1), c.StorageLimit)
+		assert.Equal(t, []string{".qgs"}, c.AllowedExtensions)
+		assert.Equal(t, []string{".bat"}, c.DeniedExtensions)
+	}
+	// account overrides must not modify the default config
+	c, err = limiter.GetAccountLimits("user2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, c.ProjectsCountLimit)
+		assert.Equal(t, []string{".qgs", ".gpkg", ".png"}, c.AllowedExtensions)
+		assert.Equal(t, []string{".exe", ".gpkg"}, c.DeniedExtensions)
+	}
+	assert.Equal(t, []string{".exe", ".gpkg"}, defaultConfig.DeniedExtensions)
+}
@@ -1,6 +1,7 @@
 package project
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha1"
 	"encoding/json"
@@ -13,6 +14,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -73,6 +76,13 @@ func (fi *FilesIndex) DeleteDir(dirPath string) {
 	}
 }
 
+// Save writes the index into the file
+func (fi *FilesIndex) Save(path string) error {
+	fi.RLock()
+	defer fi.RUnlock()
+	return saveJsonFile(path, fi.Index)
+}
+
 func (fi *FilesIndex) TotalSize() int64 {
 	fi.RLock()
 	defer fi.RUnlock()
@@ -83,6 +93,58 @@ func (fi *FilesIndex) TotalSize() int64 {
 	return size
 }
 
+// UniqueSize returns total size of files with unique content (deduplicable files with
+// the same hash are counted once)
+func (fi *FilesIndex) UniqueSize() int64 {
+	fi.RLock()
+	defer fi.RUnlock()
+	size := int64(0)
+	hashes := make(map[string]bool, len(fi.Index))
+	for path, info := range fi.Index {
+		if info.Hash != "" && domain.IsDeduplicableFile(path) {
+			if hashes[info.Hash] {
+				continue
+			}
+			hashes[info.Hash] = true
+		}
+		size += info.Size
+	}
+	return size
+}
+
+// SizeBreakdown computes size of files per directory (up to the given depth), per file
+// extension and returns the largest files
+func (fi *FilesIndex) SizeBreakdown(depth, largest int) domain.SizeBreakdown {
+	fi.RLock()
+	defer fi.RUnlock()
+	b := domain.SizeBreakdown{
+		Directories: make(map[string]int64),
+		Extensions:  make(map[string]int64),
+	}
+	files := make([]domain.ProjectFile, 0, len(fi.Index))
+	for path, info := range fi.Index {
+		b.Total += info.Size
+		parts := strings.Split(filepath.ToSlash(filepath.Dir(path)), "/")
+		if len(parts) > depth {
+			parts = parts[:depth]
+		}
+		b.Directories[strings.Join(parts, "/")] += info.Size
+		b.Extensions[strings.ToLower(filepath.Ext(path))] += info.Size
+		files = append(files, domain.ProjectFile{Path: path, Hash: info.Hash, Size: info.Size, Mtime: info.Mtime})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size == files[j].Size {
+			return files[i].Path < files[j].Path
+		}
+		return files[i].Size > files[j].Size
+	})
+	if len(files) > largest {
+		files = files[:largest]
+	}
+	b.LargestFiles = files
+	return b
+}
+
 type DiskStorage struct {
 	ProjectsRoot      string
 	log               *zap.SugaredLogger
@@ -90,6 +152,14 @@ type DiskStorage struct {
 	configCache       *cache.DataCache[string, json.RawMessage]
 	projectInfoReader JsonFilesReader[domain.ProjectInfo]
 	settingsReader    JsonFilesReader[domain.ProjectSettings]
+	projectLocks      *domain.KeyedMutex
+	// number of workers writing uploaded files, files are written sequentially when <= 1
+	UploadWorkers int
+	// max size of uploaded files buffered in memory for concurrent writing
+	UploadBufferSize int64
+	// store files with identical content as hard links, so that the content is stored only once
+	Deduplicate bool
+	stopCleanup chan struct{}
 }
 
 type Info struct {
@@ -171,6 +241,7 @@ func NewDiskStorage(log *zap.SugaredLogger, projectsRoot string) *DiskStorage {
 		ProjectsRoot: projectsRoot,
 		log:          log,
 		configCache:  cfgCache,
+		projectLocks: domain.NewKeyedMutex(),
 	}
 	loader := ttlcache.LoaderFunc[string, *FilesIndex](
 		func(c *ttlcache.Cache[string, *FilesIndex], project string) *ttlcache.Item[string, *FilesIndex] {
@@ -214,9 +285,14 @@ func NewDiskStorage(log *zap.SugaredLogger, projectsRoot string) *DiskStorage {
 	ds.indexCache = indexCache
 	indexCache.OnEviction(func(ctx context.Context, er ttlcache.EvictionReason, i *ttlcache.Item[string, *FilesIndex]) {
 		project := i.Key()
-		index := i.Value()
 		log.Infow("ttlcache.OnEviction.indexCache", "project", project)
-		if err := saveJsonFile(filepath.Join(projectsRoot, project, ".gisquick", "filesmap.json"), index.Index); err != nil {
+		unlock := ds.projectLocks.Lock(project)
+		defer unlock()
+		// project was deleted or moved in the meantime
+		if !ds.CheckProjectExists(project) {
+			return
+		}
+		if err := ds.saveFilesIndex(project, i.Value()); err != nil {
 			log.Errorw("saving files index", "project", project, zap.Error(err))
 		}
 	})
@@ -250,6 +326,10 @@ func (s *DiskStorage) saveConfigFile(projectName, filename string, data interfac
 func (s *DiskStorage) Create(fullName string, meta json.RawMessage) (*domain.ProjectInfo, error) {
 	projDir := filepath.Join(s.ProjectsRoot, fullName)
 	internalDir := filepath.Join(projDir, ".gisquick")
+
+	// guards against concurrent creation of the same project
+	unlock := s.projectLocks.Lock(fullName)
+	defer unlock()
 	if s.CheckProjectExists(fullName) {
 		return nil, domain.ErrProjectAlreadyExists
 	}
@@ -271,7 +351,7 @@ func (s *DiskStorage) Create(fullName string, meta json.RawMessage) (*domain.Pro
 		QgisFile:   i.File,
 		Projection: i.Projection,
 		Title:      i.Title,
-		State:      "empty",
+		State:      domain.ProjectStateEmpty,
 		Created:    time.Now().UTC(),
 	}
 	return &info, s.saveConfigFile(fullName, "project.json", info)
@@ -361,7 +441,9 @@ func (s *DiskStorage) createFilesMap(project string) (map[string]domain.FileInfo
 			}
 			return err
 		}
-		if !entry.IsDir() {
+		// symlinks are skipped (WalkDir doesn't follow symlinked directories either),
+		// they could point outside of the project directory
+		if entry.Type().IsRegular() {
 			relPath := path[len(root)+1:]
 			if !strings.HasPrefix(relPath, ".gisquick/") && !strings.HasSuffix(relPath, "~") {
 				fInfo, err := entry.Info()
@@ -494,7 +576,7 @@ func (s *DiskStorage) ListProjectFiles(project string, checksum bool) ([]domain.
 		if err != nil {
 			s.log.Errorw("updating project size", "project", project, zap.Error(err))
 		}
-		projectInfo.Size = index.TotalSize()
+		projectInfo.Size = s.indexSize(index)
 		if err := s.saveConfigFile(project, "project.json", projectInfo); err != nil {
 			s.log.Errorw("updating project size", "project", project, zap.Error(err))
 		}
@@ -513,6 +595,45 @@ func (s *DiskStorage) ListProjectFiles(project string, checksum bool) ([]domain.
 	return files, tempFiles, nil
 }
 
+// RemoveTemporaryFiles removes temporary files (e.g. GeoPackage's WAL and shared memory files),
+// which are excluded from the project files. Files tracked in the files index are never removed.
+// WAL file can contain changes not yet written into the database file while the database is
+// open (e.g. by mapserver), so only leftovers of databases which no longer exist are removed.
+func (s *DiskStorage) RemoveTemporaryFiles(project string) ([]domain.ProjectFile, error) {
+	if !s.CheckProjectExists(project) {
+		return nil, domain.ErrProjectNotExists
+	}
+	unlock := s.projectLocks.Lock(project)
+	defer unlock()
+	_, temporaryFiles, err := s.createFilesMap(project)
+	if err != nil {
+		return nil, fmt.Errorf("listing project files: %w", err)
+	}
+	index, err := s.filesIndex(project)
+	if err != nil {
+		return nil, fmt.Errorf("reading project files index: %w", err)
+	}
+	removed := []domain.ProjectFile{}
+	for path, info := range temporaryFiles {
+		if _, tracked := index.Get(path); tracked {
+			continue
+		}
+		// strip '-wal' or '-shm' suffix
+		dbPath := filepath.Join(s.ProjectsRoot, project, path[:len(path)-4])
+		if _, err := os.Stat(dbPath); err == nil || !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.ProjectsRoot, project, path)); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return removed, fmt.Errorf("removing temporary file %s: %w", path, err)
+		}
+		removed = append(removed, domain.ProjectFile{Path: path, Size: info.Size, Mtime: info.Mtime})
+	}
+	return removed, nil
+}
+
 // func (s *DiskStorage) GetFileInfo(project, path string, checksum bool) (domain.FileInfo, error) {
 // 	absPath, err := filepath.Abs(filepath.Join(s.ProjectsRoot, project, path))
 // 	if err != nil {
@@ -544,11 +665,127 @@ func (s *DiskStorage) GetFileInfo(project, path string) (domain.FileInfo, error)
 	}
 	fi, exists := index.Get(path)
 	if !exists {
+		return s.indexFile(project, index, path)
+	}
+	return fi, nil
+}
+
+// isProjectPath checks whether the (cleaned) relative path points inside of the project
+// directory and outside of the internal .gisquick directory
+func isProjectPath(path string) bool {
+	return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, "../") && path != ".gisquick" && !strings.HasPrefix(path, ".gisquick/")
+}
+
+// indexFile computes info of the project file missing in the files index and adds it into the index
+func (s *DiskStorage) indexFile(project string, index *FilesIndex, path string) (domain.FileInfo, error) {
+	path = filepath.Clean(path)
+	if !isProjectPath(path) || excludeExtRegex.MatchString(path) {
 		return domain.FileInfo{}, domain.ErrFileNotExists
 	}
+	unlock := s.projectLocks.Lock(project)
+	defer unlock()
+	if fi, exists := index.Get(path); exists {
+		return fi, nil
+	}
+	absPath := filepath.Join(s.ProjectsRoot, project, path)
+	// symlinks are not followed
+	fStat, err := os.Lstat(absPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return domain.FileInfo{}, domain.ErrFileNotExists
+		}
+		return domain.FileInfo{}, fmt.Errorf("getting file info: %w", err)
+	}
+	if !fStat.Mode().IsRegular() {
+		return domain.FileInfo{}, domain.ErrFileNotExists
+	}
+	hash, err := Checksum(absPath)
+	if err != nil {
+		return domain.FileInfo{}, fmt.Errorf("computing checksum [%s]: %w", path, err)
+	}
+	fi := domain.FileInfo{Hash: hash, Size: fStat.Size(), Mtime: fStat.ModTime().Unix()}
+	index.Set(path, fi)
 	return fi, nil
 }
 
+// ListDirectory returns files and subdirectories of the project directory. Information
+// about files is taken from the files index when it's up to date, checksum is not computed.
+func (s *DiskStorage) ListDirectory(project, path string) (domain.DirectoryListing, error) {
+	path = filepath.Clean(path)
+	if !isProjectPath(path) {
+		return domain.DirectoryListing{}, domain.ErrFileNotExists
+	}
+	if !s.CheckProjectExists(project) {
+		return domain.DirectoryListing{}, domain.ErrProjectNotExists
+	}
+	entries, err := os.ReadDir(filepath.Join(s.ProjectsRoot, project, path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+			return domain.DirectoryListing{}, domain.ErrFileNotExists
+		}
+		return domain.DirectoryListing{}, fmt.Errorf("listing project directory: %w", err)
+	}
+	index, err := s.filesIndex(project)
+	if err != nil {
+		return domain.DirectoryListing{}, fmt.Errorf("reading project files index: %w", err)
+	}
+	listing := domain.DirectoryListing{
+		Path:        filepath.ToSlash(path),
+		Directories: []string{},
+		Files:       []domain.ProjectFile{},
+	}
+	for _, entry := range entries {
+		relPath := filepath.Join(path, entry.Name())
+		if !isProjectPath(relPath) || strings.HasSuffix(relPath, "~") {
+			continue
+		}
+		if entry.IsDir() {
+			listing.Directories = append(listing.Directories, entry.Name())
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || excludeExtRegex.MatchString(relPath) {
+			continue
+		}
+		f := domain.ProjectFile{Path: filepath.ToSlash(relPath), Size: info.Size(), Mtime: info.ModTime().Unix()}
+		if fi, ok := index.Get(relPath); ok && fi.Mtime == f.Mtime {
+			f.Hash = fi.Hash
+		}
+		listing.Files = append(listing.Files, f)
+	}
+	return listing, nil
+}
+
+// CreateDirectory creates (empty) project directory including missing parent directories.
+// Directories are not tracked in the files index, empty directory is kept on the disk until
+// it's explicitly removed (removing files never removes their parent directories).
+func (s *DiskStorage) CreateDirectory(project, path string) error {
+	path = filepath.Clean(path)
+	if path == "." || !isProjectPath(path) {
+		return fmt.Errorf("invalid directory path: %s", path)
+	}
+	if !s.CheckProjectExists(project) {
+		return domain.ErrProjectNotExists
+	}
+	absPath := filepath.Join(s.ProjectsRoot, project, path)
+	if err := os.MkdirAll(absPath, 0775); err != nil {
+		if errors.Is(err, syscall.ENOTDIR) {
+			return domain.ErrFileExists
+		}
+		return fmt.Errorf("creating project directory: %w", err)
+	}
+	return nil
+}
+
+// SizeBreakdown returns breakdown of the project size computed from the files index
+func (s *DiskStorage) SizeBreakdown(project string, depth, largest int) (domain.SizeBreakdown, error) {
+	index, err := s.filesIndex(project)
+	if err != nil {
+		return domain.SizeBreakdown{}, err
+	}
+	return index.SizeBreakdown(depth, largest), nil
+}
+
 func (s *DiskStorage) GetFilesInfo(project string, paths ...string) (map[string]domain.FileInfo, error) {
 	index, err := s.filesIndex(project)
 	if err != nil {
@@ -571,6 +808,39 @@ func (s *DiskStorage) Delete(name string) error {
 	return nil
 }
 
+// Move renames project (e.g. to transfer it to another user), cached files index
+// is moved together with the project directory
+func (s *DiskStorage) Move(name, newName string) error {
+	// lock both projects in the same order to avoid deadlocks
+	names := []string{name, newName}
+	sort.Strings(names)
+	for _, n := range names {
+		unlock := s.projectLocks.Lock(n)
+		defer unlock()
+	}
+	if !s.CheckProjectExists(name) {
+		return domain.ErrProjectNotExists
+	}
+	if s.CheckProjectExists(newName) {
+		return domain.ErrProjectAlreadyExists
+	}
+	dest := filepath.Join(s.ProjectsRoot, newName)
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return fmt.Errorf("creating project directory: %w", err)
+	}
+	if err := os.Rename(filepath.Join(s.ProjectsRoot, name), dest); err != nil {
+		return fmt.Errorf("moving project directory: %w", err)
+	}
+	item := s.indexCache.Get(name, ttlcache.WithLoader[string, *FilesIndex](nil))
+	if item != nil {
+		s.indexCache.Delete(name)
+		s.indexCache.Set(newName, item.Value(), ttlcache.DefaultTTL)
+	} else {
+		s.indexCache.Delete(newName)
+	}
+	return nil
+}
+
 func saveToFile(src io.Reader, filename string) (err error) {
 	err = os.MkdirAll(filepath.Dir(filename), 0775)
 	if err != nil {
@@ -594,12 +864,17 @@ func saveToFile(src io.Reader, filename string) (err error) {
 	return nil
 }
 
+// partialFileSuffix marks files being written, they are renamed to the final name when completed.
+// Files with '~' suffix are not listed as project files, so partial files left by interrupted
+// uploads never appear in the project and are removed by CleanPartialFiles.
+const partialFileSuffix = ".partial~"
+
 func saveToFile2(src io.Reader, filename string) (h string, err error) {
 	err = os.MkdirAll(filepath.Dir(filename), 0775)
 	if err != nil {
 		return
 	}
-	file, err := os.Create(filename)
+	file, err := os.Create(filename + partialFileSuffix)
 	if err != nil {
 		return
 	}
@@ -620,11 +895,18 @@ func saveToFile2(src io.Reader, filename string) (h string, err error) {
 	if err = file.Close(); err != nil {
 		return
 	}
+	// file can be a hard link to the content shared with other files (deduplication),
+	// so it's replaced by a new file instead of being overwritten
+	if err = os.Rename(file.Name(), filename); err != nil {
+		return
+	}
 	hash := fmt.Sprintf("%x", sha.Sum(nil))
 	return hash, nil
 }
 
 func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Reader) (finfo domain.ProjectFile, err error) {
+	unlock := s.projectLocks.Lock(projectName)
+	defer unlock()
 	finfo = domain.ProjectFile{}
 	if !s.CheckProjectExists(projectName) {
 		err = domain.ErrProjectNotExists
@@ -636,27 +918,13 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 		err = fmt.Errorf("creating directory: %w", err)
 		return
 	}
-	var f *os.File
 	// pre-formatting: timestamp, random
 	// post-formatting: hash
-	if strings.Contains(pattern, "<timestamp>") {
-		pattern = strings.Replace(pattern, "<timestamp>", fmt.Sprint(time.Now().Unix()), 1)
-	}
-	if strings.Contains(pattern, "<random>") {
-		pattern = strings.Replace(pattern, "<random>", "*", 1)
-		f, err = os.CreateTemp(destDir, pattern)
-		if err != nil {
-			err = fmt.Errorf("creating temp file: %w", err)
-			return
-		}
-		pattern = filepath.Base(f.Name())
-	}
-	if f == nil {
-		f, err = os.Create(filepath.Join(destDir, pattern))
-		if err != nil {
-			err = fmt.Errorf("creating new file: %w", err)
-			return
-		}
+	pattern = domain.FormatFilename(pattern)
+	f, err := os.Create(filepath.Join(destDir, pattern+partialFileSuffix))
+	if err != nil {
+		err = fmt.Errorf("creating new file: %w", err)
+		return
 	}
 	defer func() {
 		// Clean up in case we are returning with an error
@@ -679,14 +947,12 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 	}
 	finfo.Size = fStat.Size()
 	finfo.Mtime = fStat.ModTime().Unix()
-	finfo.Path = f.Name()
 	finfo.Hash = fmt.Sprintf("%x", sha.Sum(nil))
 
-	if strings.Contains(pattern, "<hash>") {
-		pattern = strings.Replace(pattern, "<hash>", finfo.Hash[:10], 1)
-		if err = os.Rename(f.Name(), filepath.Join(destDir, pattern)); err != nil {
-			return
-		}
+	pattern = domain.FormatFilenameHash(pattern, finfo.Hash)
+	// existing file (possibly a hard link to the shared content) is replaced by the new file
+	if err = os.Rename(f.Name(), filepath.Join(destDir, pattern)); err != nil {
+		return
 	}
 	finfo.Path = filepath.Join(directory, pattern)
 	f = nil
@@ -695,12 +961,20 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 		s.log.Errorw("reading files index", "project", projectName, zap.Error(err))
 		return
 	}
-	index.Set(finfo.Path, domain.FileInfo{Hash: finfo.Hash, Size: finfo.Size, Mtime: finfo.Mtime})
+	fileInfo := domain.FileInfo{Hash: finfo.Hash, Size: finfo.Size, Mtime: finfo.Mtime}
+	linked := false
+	if s.Deduplicate {
+		fileInfo, linked = s.linkDuplicate(projectName, index, finfo.Path, fileInfo)
+		finfo.Mtime = fileInfo.Mtime
+	}
+	index.Set(finfo.Path, fileInfo)
 	pInfo, err := s.GetProjectInfo(projectName)
 	if err != nil {
 		s.log.Errorw("getting project info", zap.Error(err))
 	}
-	pInfo.Size += finfo.Size
+	if !linked {
+		pInfo.Size += finfo.Size
+	}
 	if err := s.saveConfigFile(projectName, "project.json", pInfo); err != nil {
 		s.log.Errorw("updating project file", zap.Error(err))
 	}
@@ -708,6 +982,8 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 }
 
 func (s *DiskStorage) SaveFile(project string, finfo domain.ProjectFile, path string) error {
+	unlock := s.projectLocks.Lock(project)
+	defer unlock()
 	absPath := filepath.Join(s.ProjectsRoot, project, path)
 	if err := os.MkdirAll(filepath.Dir(absPath), 0775); err != nil {
 		return err
@@ -720,12 +996,19 @@ func (s *DiskStorage) SaveFile(project string, finfo domain.ProjectFile, path st
 		s.log.Errorw("reading files index", "project", project, zap.Error(err))
 		return nil
 	}
-	index.Set(path, domain.FileInfo{Hash: finfo.Hash, Size: finfo.Size, Mtime: finfo.Mtime})
+	fileInfo := domain.FileInfo{Hash: finfo.Hash, Size: finfo.Size, Mtime: finfo.Mtime}
+	linked := false
+	if s.Deduplicate {
+		fileInfo, linked = s.linkDuplicate(project, index, path, fileInfo)
+	}
+	index.Set(path, fileInfo)
 	pInfo, err := s.GetProjectInfo(project)
 	if err != nil {
 		s.log.Errorw("getting project info", zap.Error(err))
 	}
-	pInfo.Size += finfo.Size
+	if !linked {
+		pInfo.Size += finfo.Size
+	}
 	if err := s.saveConfigFile(project, "project.json", pInfo); err != nil {
 		s.log.Errorw("updating project file", zap.Error(err))
 	}
@@ -782,6 +1065,10 @@ func (s *DiskStorage) SaveThumbnail(projectName string, r io.Reader) error {
 // 	return files, nil
 // }
 
+func (s *DiskStorage) saveFilesIndex(projectName string, index *FilesIndex) error {
+	return index.Save(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"))
+}
+
 func (s *DiskStorage) loadFilesIndex(projectName string) (map[string]domain.FileInfo, error) {
 	s.log.Infow("loading filesIndex", "project", projectName)
 	var index map[string]domain.FileInfo
@@ -816,6 +1103,66 @@ func (s *DiskStorage) filesIndex(projectName string) (*FilesIndex, error) {
 	return fi.Value(), nil
 }
 
+// RebuildFilesIndex recreates project's files index from the files on disk (ignoring
+// existing filesmap.json) and updates the project size.
+func (s *DiskStorage) RebuildFilesIndex(projectName string) (*FilesIndex, error) {
+	unlock := s.projectLocks.Lock(projectName)
+	defer unlock()
+	if !s.CheckProjectExists(projectName) {
+		return nil, domain.ErrProjectNotExists
+	}
+	files, _, err := s.createFilesMap(projectName)
+	if err != nil {
+		return nil, err
+	}
+	for path, info := range files {
+		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+		hash, err := Checksum(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("computing checksum [%s]: %w", path, err)
+		}
+		info.Hash = hash
+		files[path] = info
+	}
+	index := &FilesIndex{Index: files}
+	s.indexCache.Set(projectName, index, ttlcache.DefaultTTL)
+	if err := s.saveFilesIndex(projectName, index); err != nil {
+		return nil, fmt.Errorf("saving files index: %w", err)
+	}
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return nil, err
+	}
+	pInfo.Size = s.indexSize(index)
+	if err := s.saveConfigFile(projectName, "project.json", pInfo); err != nil {
+		return nil, fmt.Errorf("updating project file: %w", err)
+	}
+	return index, nil
+}
+
+// FixProjectSize recomputes project size from the files index and updates project
+// file when stored value differs. Returns previous and current size.
+func (s *DiskStorage) FixProjectSize(projectName string) (int64, int64, error) {
+	unlock := s.projectLocks.Lock(projectName)
+	defer unlock()
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return 0, 0, err
+	}
+	index, err := s.filesIndex(projectName)
+	if err != nil {
+		return 0, 0, err
+	}
+	prevSize := pInfo.Size
+	pInfo.Size = s.indexSize(index)
+	if pInfo.Size != prevSize {
+		if err := s.saveConfigFile(projectName, "project.json", pInfo); err != nil {
+			return prevSize, prevSize, fmt.Errorf("updating project file: %w", err)
+		}
+	}
+	return prevSize, pInfo.Size, nil
+}
+
 // func createFilesIndex(files []domain.ProjectFile) map[string]domain.FileInfo {
 // 	index := make(map[string]domain.FileInfo, len(files))
 // 	for _, f := range files {
@@ -836,7 +1183,166 @@ func indexProjectFilesList(index *FilesIndex) []domain.ProjectFile {
 	return listIndex
 }
 
+// nextUploadedFile reads next file from the upload stream and checks it's declared in expected order
+func nextUploadedFile(next domain.FilesReader, declaredInfo domain.ProjectFile) (io.ReadCloser, error) {
+	path, reader, err := next()
+	if err != nil {
+		return nil, fmt.Errorf("reading upload files stream: %w", err)
+	}
+	if declaredInfo.Path != path {
+		reader.Close()
+		return nil, &domain.FileMismatchError{Path: declaredInfo.Path, Property: "path", Declared: declaredInfo.Path, Actual: path}
+	}
+	return reader, nil
+}
+
+// saveUploadedFile writes content of the uploaded file and verifies its declared size and hash
+func (s *DiskStorage) saveUploadedFile(projectName string, declaredInfo domain.ProjectFile, reader io.Reader) (domain.FileInfo, error) {
+	path := declaredInfo.Path
+	absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+	calcHash, err := saveToFile2(reader, absPath)
+	if err != nil {
+		return domain.FileInfo{}, err
+	}
+	lmtime := time.Unix(declaredInfo.Mtime, 0)
+	if err := os.Chtimes(absPath, lmtime, lmtime); err != nil {
+		s.log.Errorw("updating file's modification time", zap.Error(err))
+	}
+
+	fStat, err := os.Stat(absPath)
+	if err != nil {
+		s.log.Errorw("getting file's stat info", zap.Error(err))
+	} else if declaredInfo.Size != fStat.Size() {
+		return domain.FileInfo{}, &domain.FileMismatchError{
+			Path:     path,
+			Property: "size",
+			Declared: strconv.FormatInt(declaredInfo.Size, 10),
+			Actual:   strconv.FormatInt(fStat.Size(), 10),
+		}
+	}
+	finfo := domain.FileInfo{Hash: calcHash, Size: declaredInfo.Size, Mtime: declaredInfo.Mtime}
+	if declaredInfo.Hash != "" {
+		if strings.HasPrefix(declaredInfo.Hash, "dbhash:") {
+			finfo.Hash = declaredInfo.Hash
+		} else if declaredInfo.Hash != calcHash {
+			return domain.FileInfo{}, &domain.FileMismatchError{Path: path, Property: "hash", Declared: declaredInfo.Hash, Actual: calcHash}
+		}
+	}
+	return finfo, nil
+}
+
+// writeFiles reads and writes uploaded files one by one. Returned list contains info of
+// successfully written files (also in case of error).
+func (s *DiskStorage) writeFiles(projectName string, files []domain.ProjectFile, next domain.FilesReader) ([]domain.FileInfo, error) {
+	result := make([]domain.FileInfo, len(files))
+	for i, declaredInfo := range files {
+		reader, err := nextUploadedFile(next, declaredInfo)
+		if err != nil {
+			return result, err
+		}
+		finfo, err := s.saveUploadedFile(projectName, declaredInfo, reader)
+		reader.Close()
+		if err != nil {
+			return result, err
+		}
+		result[i] = finfo
+	}
+	return result, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type uploadJob struct {
+	index int
+	info  domain.ProjectFile
+	data  []byte
+}
+
+// writeFilesConcurrently reads the upload stream sequentially (in declared order), small files
+// are buffered in memory and written to the disk by the pool of workers, larger files
+// are written directly while reading.
+func (s *DiskStorage) writeFilesConcurrently(projectName string, files []domain.ProjectFile, next domain.FilesReader) ([]domain.FileInfo, error) {
+	result := make([]domain.FileInfo, len(files))
+	jobs := make(chan uploadJob, s.UploadWorkers)
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var writeErr error
+	fail := func(err error) {
+		failOnce.Do(func() {
+			writeErr = err
+			close(failed)
+		})
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < s.UploadWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				select {
+				case <-failed:
+					continue
+				default:
+				}
+				finfo, err := s.saveUploadedFile(projectName, job.info, bytes.NewReader(job.data))
+				if err != nil {
+					fail(err)
+					continue
+				}
+				result[job.index] = finfo
+			}
+		}()
+	}
+
+	readFiles := func() error {
+		for i, declaredInfo := range files {
+			select {
+			case <-failed:
+				return nil
+			default:
+			}
+			reader, err := nextUploadedFile(next, declaredInfo)
+			if err != nil {
+				return err
+			}
+			if declaredInfo.Size <= s.UploadBufferSize {
+				data, err := io.ReadAll(io.LimitReader(reader, s.UploadBufferSize+1))
+				if err != nil {
+					reader.Close()
+					return err
+				}
+				if int64(len(data)) <= s.UploadBufferSize {
+					reader.Close()
+					jobs <- uploadJob{index: i, info: declaredInfo, data: data}
+					continue
+				}
+				// content is larger than declared, write it directly to report size mismatch
+				reader = readCloser{io.MultiReader(bytes.NewReader(data), reader), reader}
+			}
+			finfo, err := s.saveUploadedFile(projectName, declaredInfo, reader)
+			reader.Close()
+			if err != nil {
+				return err
+			}
+			result[i] = finfo
+		}
+		return nil
+	}
+	readErr := readFiles()
+	close(jobs)
+	wg.Wait()
+	if readErr != nil {
+		return result, readErr
+	}
+	return result, writeErr
+}
+
 func (s *DiskStorage) UpdateFiles(projectName string, info domain.FilesChanges, next domain.FilesReader) ([]domain.ProjectFile, error) {
+	unlock := s.projectLocks.Lock(projectName)
+	defer unlock()
 	project, err := s.GetProjectInfo(projectName)
 	if err != nil {
 		return nil, err
@@ -864,47 +1370,24 @@ func (s *DiskStorage) UpdateFiles(projectName string, info domain.FilesChanges,
 	if len(updateFiles) > 0 && next == nil {
 		return nil, fmt.Errorf("required function for reading files")
 	}
-	for i := 0; i < len(updateFiles); i++ {
-		path, reader, err := next()
-		if err != nil {
-			return nil, fmt.Errorf("reading upload files stream: %w", err)
-		}
-		declaredInfo := updateFiles[i]
-		if declaredInfo.Path != path {
-			return nil, err // TODO: more graceful error handling
-		}
-		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
-		// if err := saveToFile(reader, absPath); err != nil {
-		// 	return err
-		// }
-		calcHash, err := saveToFile2(reader, absPath)
-		if err != nil {
-			reader.Close() // or move to saveToFile?
-			return nil, err
-		}
-		// lmtime := declaredInfo.Mtime
-		lmtime := time.Unix(declaredInfo.Mtime, 0)
-		if err := os.Chtimes(absPath, lmtime, lmtime); err != nil {
-			s.log.Errorw("updating file's modification time", zap.Error(err))
-		}
-		reader.Close()
-
-		fStat, err := os.Stat(absPath)
-		if err != nil {
-			s.log.Errorw("getting file's stat info", zap.Error(err))
-		} else if declaredInfo.Size != fStat.Size() {
-			return nil, fmt.Errorf("declared file info doesn't match: %s", path)
-		}
-		finfo := domain.FileInfo{Hash: calcHash, Size: declaredInfo.Size, Mtime: declaredInfo.Mtime}
-		if declaredInfo.Hash != "" {
-			if strings.HasPrefix(declaredInfo.Hash, "dbhash:") {
-				finfo.Hash = declaredInfo.Hash
-			} else if declaredInfo.Hash != calcHash {
-				return nil, fmt.Errorf("calculated file hash doesn't match: %s", path)
+	var filesInfo []domain.FileInfo
+	if s.UploadWorkers > 1 {
+		filesInfo, err = s.writeFilesConcurrently(projectName, updateFiles, next)
+	} else {
+		filesInfo, err = s.writeFiles(projectName, updateFiles, next)
+	}
+	// index also files written before an error
+	for i, f := range updateFiles {
+		if filesInfo[i].Hash != "" {
+			finfo := filesInfo[i]
+			if s.Deduplicate {
+				finfo, _ = s.linkDuplicate(projectName, index, f.Path, finfo)
 			}
+			index.Set(f.Path, finfo)
 		}
-		// s.log.Infow("saving file", "path", absPath, "hash", calcHash, "hashMatch", declaredInfo.Hash == calcHash, "cmtime", declaredInfo.Mtime.Local(), "smtime", fStat.ModTime())
-		index.Set(path, finfo)
+	}
+	if err != nil {
+		return nil, err
 	}
 	for _, path := range info.Removes {
 		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
@@ -928,13 +1411,13 @@ func (s *DiskStorage) UpdateFiles(projectName string, info domain.FilesChanges,
 			index.Delete(path)
 		}
 	}
-	if err := saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index); err != nil {
+	if err := s.saveFilesIndex(projectName, index); err != nil {
 		return nil, fmt.Errorf("saving files index: %w", err)
 	}
-	size := index.TotalSize()
+	size := s.indexSize(index)
 	project.Size = size
-	if project.State == "empty" && size > 0 {
-		project.State = "staged"
+	if project.State == domain.ProjectStateEmpty && size > 0 {
+		project.State = domain.ProjectStateStaged
 		project.LastUpdate = time.Now().UTC()
 	}
 	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
@@ -948,6 +1431,7 @@ type SettingsInfo struct {
 	Auth  struct {
 		Type string `json:"type"`
 	} `json:"auth"`
+	Tags []string `json:"tags"`
 }
 
 func (s *DiskStorage) UpdateSettings(projectName string, data json.RawMessage) error {
@@ -959,15 +1443,72 @@ func (s *DiskStorage) UpdateSettings(projectName string, data json.RawMessage) e
 	if err := json.Unmarshal(data, &sInfo); err != nil {
 		return fmt.Errorf("extracting authentication settings: %w", err)
 	}
+	tags := domain.NormalizeTags(sInfo.Tags)
+	if sInfo.Tags != nil {
+		// store normalized tags also in the settings file
+		settingsTags := tags
+		if settingsTags == nil {
+			settingsTags = []string{}
+		}
+		data, err = setJSONField(data, "tags", settingsTags)
+		if err != nil {
+			return fmt.Errorf("normalizing tags: %w", err)
+		}
+	}
 
 	// TODO: check AllowedFileServices
 	if err := s.saveConfigFile(projectName, "settings.json", data); err != nil {
 		return fmt.Errorf("saving settings file: %w", err)
 	}
-	project.State = "published"
+	// keep hidden project hidden
+	if project.State != domain.ProjectStateHidden {
+		project.State = domain.ProjectStatePublished
+	}
 	project.LastUpdate = time.Now().UTC()
 	project.Authentication = sInfo.Auth.Type
 	project.Title = sInfo.Title
+	project.Tags = tags
+	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
+		return fmt.Errorf("updating project file: %w", err)
+	}
+	return nil
+}
+
+// setJSONField returns JSON object data with the field set to the given value
+func setJSONField(data json.RawMessage, field string, value interface{}) (json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	obj[field] = v
+	return json.Marshal(obj)
+}
+
+// ReplaceSettings saves settings file without any changes of the project info (state,
+// last update time), used for internal modifications which don't change authentication
+// type, title nor tags.
+func (s *DiskStorage) ReplaceSettings(projectName string, data json.RawMessage) error {
+	if !s.CheckProjectExists(projectName) {
+		return domain.ErrProjectNotExists
+	}
+	if err := s.saveConfigFile(projectName, "settings.json", data); err != nil {
+		return fmt.Errorf("saving settings file: %w", err)
+	}
+	return nil
+}
+
+func (s *DiskStorage) UpdateState(projectName string, state string) error {
+	unlock := s.projectLocks.Lock(projectName)
+	defer unlock()
+	project, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	project.State = state
 	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
 		return fmt.Errorf("updating project file: %w", err)
 	}
@@ -983,6 +1524,20 @@ func (s *DiskStorage) GetSettings(projectName string) (domain.ProjectSettings, e
 	return data, nil
 }
 
+func (s *DiskStorage) GetRawSettings(projectName string) (json.RawMessage, error) {
+	if !s.CheckProjectExists(projectName) {
+		return nil, domain.ErrProjectNotExists
+	}
+	content, err := os.ReadFile(s.GetSettingsPath(projectName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return content, nil
+}
+
 func (s *DiskStorage) ParseQgisMetadata(projectName string, data interface{}) error {
 	content, err := os.ReadFile(s.GetQgisMetaPath(projectName))
 	if err != nil {
@@ -1034,7 +1589,67 @@ func (s *DiskStorage) UpdateScripts(projectName string, scripts domain.Scripts)
 	return s.saveConfigFile(projectName, "scripts.json", scripts)
 }
 
+// CleanPartialFiles removes partial files of interrupted uploads (e.g. after client disconnect
+// or server crash) older than maxAge. Returns paths of removed files relative to the projects root.
+func (s *DiskStorage) CleanPartialFiles(maxAge time.Duration) ([]string, error) {
+	var removed []string
+	threshold := time.Now().Add(-maxAge)
+	err := filepath.WalkDir(s.ProjectsRoot, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), partialFileSuffix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(threshold) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.log.Errorw("removing partial file", "path", path, zap.Error(err))
+			return nil
+		}
+		relPath, _ := filepath.Rel(s.ProjectsRoot, path)
+		removed = append(removed, relPath)
+		return nil
+	})
+	return removed, err
+}
+
+// StartPartialFilesCleanup periodically removes partial files older than maxAge
+func (s *DiskStorage) StartPartialFilesCleanup(interval, maxAge time.Duration) {
+	if s.stopCleanup != nil {
+		return
+	}
+	s.stopCleanup = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCleanup:
+				return
+			case <-ticker.C:
+				removed, err := s.CleanPartialFiles(maxAge)
+				if err != nil {
+					s.log.Errorw("cleaning partial files", zap.Error(err))
+				}
+				for _, path := range removed {
+					s.log.Infow("removed stale partial file", "path", path)
+				}
+			}
+		}
+	}()
+}
+
 func (s *DiskStorage) Close() {
+	if s.stopCleanup != nil {
+		close(s.stopCleanup)
+		s.stopCleanup = nil
+	}
 	s.settingsReader.Close()
 	s.projectInfoReader.Close()
 	s.indexCache.Stop()
@@ -1060,3 +1675,68 @@ func (s *DiskStorage) GetProjectCustomizations(projectName string) (json.RawMess
 	}
 	return config, nil
 }
+
+func removeFile(filename string) error {
+	if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// indexSize returns size of the project files, only unique content is counted when
+// deduplication is enabled
+func (s *DiskStorage) indexSize(index *FilesIndex) int64 {
+	if s.Deduplicate {
+		return index.UniqueSize()
+	}
+	return index.TotalSize()
+}
+
+// linkDuplicate replaces the project file by a hard link to another project file with
+// the same content (found by the hash in the files index). Shared content is kept on
+// the disk until the last link is removed (reference counting of the filesystem).
+// Only files which are never modified in place are linked (see domain.IsDeduplicableFile).
+// Returns updated file info and true when the file is linked.
+func (s *DiskStorage) linkDuplicate(projectName string, index *FilesIndex, path string, finfo domain.FileInfo) (domain.FileInfo, bool) {
+	if finfo.Hash == "" || !domain.IsDeduplicableFile(path) {
+		return finfo, false
+	}
+	var source string
+	index.RLock()
+	for p, info := range index.Index {
+		if p != path && domain.IsDeduplicableFile(p) && info.Hash == finfo.Hash && info.Size == finfo.Size {
+			source = p
+			break
+		}
+	}
+	index.RUnlock()
+	if source == "" {
+		return finfo, false
+	}
+	srcPath := filepath.Join(s.ProjectsRoot, projectName, source)
+	absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+	srcStat, err := os.Stat(srcPath)
+	if err != nil || srcStat.Size() != finfo.Size {
+		return finfo, false
+	}
+	if dstStat, err := os.Stat(absPath); err == nil && os.SameFile(srcStat, dstStat) {
+		return finfo, true
+	}
+	// temporary name with '~' suffix is excluded from project files
+	tmpPath := absPath + ".link~"
+	if err := removeFile(tmpPath); err != nil {
+		return finfo, false
+	}
+	if err := os.Link(srcPath, tmpPath); err != nil {
+		s.log.Warnw("creating link to duplicate file", "project", projectName, "path", path, zap.Error(err))
+		return finfo, false
+	}
+	if err := os.Rename(tmpPath, absPath); err != nil {
+		os.Remove(tmpPath)
+		s.log.Warnw("creating link to duplicate file", "project", projectName, "path", path, zap.Error(err))
+		return finfo, false
+	}
+	// linked files share modification time
+	finfo.Mtime = srcStat.ModTime().Unix()
+	return finfo, true
+}
@@ -0,0 +1,521 @@
+package project
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestConcurrentCreate(t *testing.T) {
+	storage := NewDiskStorage(zap.NewNop().Sugar(), t.TempDir())
+	defer storage.Close()
+
+	meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857"}`)
+	const count = 10
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = storage.Create("test/project", meta)
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.ErrorIs(t, err, domain.ErrProjectAlreadyExists)
+		}
+	}
+	assert.Equal(t, 1, created)
+	assert.True(t, storage.CheckProjectExists("test/project"))
+}
+
+func TestConcurrentCreateFile(t *testing.T) {
+	storage := NewDiskStorage(zap.NewNop().Sugar(), t.TempDir())
+	defer storage.Close()
+
+	meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857"}`)
+	_, err := storage.Create("test/project", meta)
+	if !assert.NoError(t, err) {
+		return
+	}
+	const count = 20
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := storage.CreateFile("test/project", "media", "file_<random>.txt", strings.NewReader("data"))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	pInfo, err := storage.GetProjectInfo("test/project")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(count*4), pInfo.Size)
+	}
+}
+
+type uploadFile struct {
+	path    string
+	content string
+}
+
+func filesReader(files ...uploadFile) domain.FilesReader {
+	i := 0
+	return func() (string, io.ReadCloser, error) {
+		if i >= len(files) {
+			return "", nil, io.EOF
+		}
+		f := files[i]
+		i++
+		return f.path, io.NopCloser(strings.NewReader(f.content)), nil
+	}
+}
+
+func createTestProject(t *testing.T) *DiskStorage {
+	storage := NewDiskStorage(zap.NewNop().Sugar(), t.TempDir())
+	meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857"}`)
+	_, err := storage.Create("test/project", meta)
+	assert.NoError(t, err)
+	return storage
+}
+
+func TestUpdateFiles(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{
+		{Path: "data/a.txt", Size: 5, Hash: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+	}}
+	files, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"data/a.txt", "hello"}))
+	if assert.NoError(t, err) {
+		assert.Len(t, files, 1)
+		assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", files[0].Hash)
+	}
+}
+
+func TestUpdateFilesSizeMismatch(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{{Path: "a.txt", Size: 10}}}
+	_, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"a.txt", "hello"}))
+	var mismatch *domain.FileMismatchError
+	if assert.ErrorAs(t, err, &mismatch) {
+		assert.ErrorIs(t, err, domain.ErrFileMismatch)
+		assert.Equal(t, domain.FileMismatchError{Path: "a.txt", Property: "size", Declared: "10", Actual: "5"}, *mismatch)
+	}
+}
+
+func TestUpdateFilesHashMismatch(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{{Path: "a.txt", Size: 5, Hash: "invalid"}}}
+	_, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"a.txt", "hello"}))
+	var mismatch *domain.FileMismatchError
+	if assert.ErrorAs(t, err, &mismatch) {
+		assert.Equal(t, "hash", mismatch.Property)
+		assert.Equal(t, "invalid", mismatch.Declared)
+		assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", mismatch.Actual)
+	}
+}
+
+func TestUpdateFilesOutOfOrder(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{
+		{Path: "a.txt", Size: 1},
+		{Path: "b.txt", Size: 1},
+	}}
+	next := filesReader(uploadFile{"b.txt", "b"}, uploadFile{"a.txt", "a"})
+	_, err := storage.UpdateFiles("test/project", changes, next)
+	var mismatch *domain.FileMismatchError
+	if assert.ErrorAs(t, err, &mismatch) {
+		assert.Equal(t, domain.FileMismatchError{Path: "a.txt", Property: "path", Declared: "a.txt", Actual: "b.txt"}, *mismatch)
+	}
+}
+
+func TestUpdateFilesConcurrently(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+	storage.UploadWorkers = 4
+	storage.UploadBufferSize = 8
+
+	var files []uploadFile
+	var declared []domain.ProjectFile
+	for i := 0; i < 20; i++ {
+		content := strings.Repeat("x", i)
+		files = append(files, uploadFile{filepath.Join("data", strconv.Itoa(i)+".txt"), content})
+		declared = append(declared, domain.ProjectFile{Path: files[i].path, Size: int64(i)})
+	}
+	result, err := storage.UpdateFiles("test/project", domain.FilesChanges{Updates: declared}, filesReader(files...))
+	if assert.NoError(t, err) {
+		assert.Len(t, result, len(files))
+	}
+	for _, f := range files {
+		content, err := os.ReadFile(filepath.Join(storage.ProjectsRoot, "test/project", f.path))
+		if assert.NoError(t, err) {
+			assert.Equal(t, f.content, string(content))
+		}
+	}
+
+	// size mismatch of buffered and directly written files
+	for _, content := range []string{"abc", "0123456789"} {
+		changes := domain.FilesChanges{Updates: []domain.ProjectFile{{Path: "a.txt", Size: 2}}}
+		_, err = storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"a.txt", content}))
+		var mismatch *domain.FileMismatchError
+		if assert.ErrorAs(t, err, &mismatch) {
+			assert.Equal(t, domain.FileMismatchError{Path: "a.txt", Property: "size", Declared: "2", Actual: strconv.Itoa(len(content))}, *mismatch)
+		}
+	}
+}
+
+func TestUpdateFilesDeduplicate(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+	storage.Deduplicate = true
+
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{
+		{Path: "web/a.txt", Size: 5},
+		{Path: "web/images/b.txt", Size: 5},
+	}}
+	_, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"web/a.txt", "hello"}, uploadFile{"web/images/b.txt", "hello"}))
+	assert.NoError(t, err)
+
+	root := filepath.Join(storage.ProjectsRoot, "test/project")
+	a, err := os.Stat(filepath.Join(root, "web/a.txt"))
+	assert.NoError(t, err)
+	b, err := os.Stat(filepath.Join(root, "web/images/b.txt"))
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(a, b))
+
+	pInfo, err := storage.GetProjectInfo("test/project")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(5), pInfo.Size)
+	}
+
+	// overwriting of one file must not change content of the linked file
+	changes = domain.FilesChanges{Updates: []domain.ProjectFile{{Path: "web/a.txt", Size: 5}}}
+	_, err = storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"web/a.txt", "world"}))
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(root, "web/images/b.txt"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello", string(content))
+	}
+	pInfo, err = storage.GetProjectInfo("test/project")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(10), pInfo.Size)
+	}
+}
+
+func TestUpdateFilesDeduplicateDataFiles(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+	storage.Deduplicate = true
+
+	// data files can be modified in place by the mapserver, so they are never linked
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{
+		{Path: "a.txt", Size: 5},
+		{Path: "data/b.txt", Size: 5},
+		{Path: "web/c.sqlite", Size: 5},
+		{Path: "web/d.sqlite", Size: 5},
+	}}
+	files := filesReader(
+		uploadFile{"a.txt", "hello"},
+		uploadFile{"data/b.txt", "hello"},
+		uploadFile{"web/c.sqlite", "hello"},
+		uploadFile{"web/d.sqlite", "hello"},
+	)
+	_, err := storage.UpdateFiles("test/project", changes, files)
+	assert.NoError(t, err)
+
+	root := filepath.Join(storage.ProjectsRoot, "test/project")
+	for _, pair := range [][2]string{{"a.txt", "data/b.txt"}, {"web/c.sqlite", "web/d.sqlite"}} {
+		a, err := os.Stat(filepath.Join(root, pair[0]))
+		assert.NoError(t, err)
+		b, err := os.Stat(filepath.Join(root, pair[1]))
+		assert.NoError(t, err)
+		assert.False(t, os.SameFile(a, b), pair[0])
+	}
+	pInfo, err := storage.GetProjectInfo("test/project")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(20), pInfo.Size)
+	}
+}
+
+func gzipReader(t *testing.T, content string) io.ReadCloser {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(content))
+	w.Close()
+	r, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+	return r
+}
+
+func TestUpdateFilesCompressed(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	// declared hash and size refers to the decompressed file
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{
+		{Path: "a.txt", Size: 5, Hash: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+	}}
+	next := func() (string, io.ReadCloser, error) {
+		return "a.txt", gzipReader(t, "hello"), nil
+	}
+	files, err := storage.UpdateFiles("test/project", changes, next)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []domain.ProjectFile{{Path: "a.txt", Size: 5, Hash: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"}}, files)
+	}
+	content, err := os.ReadFile(filepath.Join(storage.ProjectsRoot, "test/project/a.txt"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello", string(content))
+	}
+}
+
+func TestGetFileInfoNotIndexed(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	absPath := filepath.Join(storage.ProjectsRoot, "test/project/a.txt")
+	if !assert.NoError(t, os.WriteFile(absPath, []byte("hello"), 0644)) {
+		return
+	}
+	info, err := storage.GetFileInfo("test/project", "a.txt")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", info.Hash)
+		assert.Equal(t, int64(5), info.Size)
+	}
+	_, err = storage.GetFileInfo("test/project", "missing.txt")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+	_, err = storage.GetFileInfo("test/project", ".gisquick/project.json")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+}
+
+func TestMove(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{
+		{Path: "data/a.txt", Size: 5, Hash: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+	}}
+	_, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"data/a.txt", "hello"}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, storage.Move("test/project", "other/project")) {
+		return
+	}
+	assert.False(t, storage.CheckProjectExists("test/project"))
+	assert.True(t, storage.CheckProjectExists("other/project"))
+
+	info, err := storage.GetFileInfo("other/project", "data/a.txt")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", info.Hash)
+	}
+	assert.ErrorIs(t, storage.Move("test/project", "other/project2"), domain.ErrProjectNotExists)
+
+	meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857"}`)
+	_, err = storage.Create("test/project", meta)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, storage.Move("test/project", "other/project"), domain.ErrProjectAlreadyExists)
+}
+
+func TestDirectories(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	assert.NoError(t, storage.CreateDirectory("test/project", "web/photos/2022"))
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{{Path: "web/photos/a.txt", Size: 5}}}
+	_, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"web/photos/a.txt", "hello"}))
+	assert.NoError(t, err)
+
+	listing, err := storage.ListDirectory("test/project", "web/photos")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"2022"}, listing.Directories)
+		if assert.Len(t, listing.Files, 1) {
+			assert.Equal(t, "web/photos/a.txt", listing.Files[0].Path)
+			assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", listing.Files[0].Hash)
+		}
+	}
+	// empty directory is not listed as a project file
+	files, _, err := storage.ListProjectFiles("test/project", false)
+	if assert.NoError(t, err) {
+		for _, f := range files {
+			assert.NotContains(t, f.Path, "2022")
+		}
+	}
+
+	assert.ErrorIs(t, storage.CreateDirectory("test/project", "web/photos/a.txt"), domain.ErrFileExists)
+	assert.Error(t, storage.CreateDirectory("test/project", "../outside"))
+	_, err = storage.ListDirectory("test/project", "web/missing")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+	_, err = storage.ListDirectory("test/project", ".gisquick")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+}
+
+func TestSymlinksSkipped(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	outside := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{{Path: "web/a.txt", Size: 5}}}
+	_, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"web/a.txt", "hello"}))
+	assert.NoError(t, err)
+
+	projDir := filepath.Join(storage.ProjectsRoot, "test/project")
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(projDir, "web", "secret.txt")))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(projDir, "outside")))
+
+	files, _, err := storage.ListProjectFiles("test/project", true)
+	if assert.NoError(t, err) {
+		paths := make([]string, len(files))
+		for i, f := range files {
+			paths[i] = f.Path
+		}
+		assert.ElementsMatch(t, []string{"web/a.txt"}, paths)
+	}
+	listing, err := storage.ListDirectory("test/project", "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, listing.Directories, "outside")
+	}
+	listing, err = storage.ListDirectory("test/project", "web")
+	if assert.NoError(t, err) && assert.Len(t, listing.Files, 1) {
+		assert.Equal(t, "web/a.txt", listing.Files[0].Path)
+	}
+	_, err = storage.GetFileInfo("test/project", "web/secret.txt")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+}
+
+func TestSizeBreakdown(t *testing.T) {
+	index := &FilesIndex{Index: map[string]domain.FileInfo{
+		"project.qgs":           {Size: 10},
+		"data/roads.gpkg":       {Size: 100},
+		"web/photos/a.JPG":      {Size: 30},
+		"web/photos/2022/b.jpg": {Size: 40},
+		"web/docs/c.pdf":        {Size: 5},
+	}}
+	b := index.SizeBreakdown(2, 2)
+	assert.Equal(t, int64(185), b.Total)
+	assert.Equal(t, map[string]int64{".": 10, "data": 100, "web/photos": 70, "web/docs": 5}, b.Directories)
+	assert.Equal(t, map[string]int64{".qgs": 10, ".gpkg": 100, ".jpg": 70, ".pdf": 5}, b.Extensions)
+	if assert.Len(t, b.LargestFiles, 2) {
+		assert.Equal(t, "data/roads.gpkg", b.LargestFiles[0].Path)
+		assert.Equal(t, "web/photos/2022/b.jpg", b.LargestFiles[1].Path)
+	}
+}
+
+func TestCleanPartialFiles(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{{Path: "web/a.txt", Size: 5}}}
+	_, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"web/a.txt", "hello"}))
+	assert.NoError(t, err)
+	_, err = storage.CreateFile("test/project", "web", "img_<random>.txt", strings.NewReader("data"))
+	assert.NoError(t, err)
+
+	projDir := filepath.Join(storage.ProjectsRoot, "test/project")
+	// completed writes don't leave partial files
+	partial, _ := filepath.Glob(filepath.Join(projDir, "web", "*"+partialFileSuffix))
+	assert.Empty(t, partial)
+
+	stale := filepath.Join(projDir, "web", "b.txt"+partialFileSuffix)
+	fresh := filepath.Join(projDir, "web", "c.txt"+partialFileSuffix)
+	assert.NoError(t, os.WriteFile(stale, []byte("par"), 0644))
+	assert.NoError(t, os.WriteFile(fresh, []byte("par"), 0644))
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(stale, old, old))
+
+	files, _, err := storage.ListProjectFiles("test/project", false)
+	if assert.NoError(t, err) {
+		assert.Len(t, files, 2)
+	}
+
+	removed, err := storage.CleanPartialFiles(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("test/project/web", "b.txt"+partialFileSuffix)}, removed)
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, fresh)
+	assert.FileExists(t, filepath.Join(projDir, "web", "a.txt"))
+}
+
+func TestRemoveTemporaryFiles(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{{Path: "data.gpkg", Size: 4}}}
+	_, err := storage.UpdateFiles("test/project", changes, filesReader(uploadFile{"data.gpkg", "gpkg"}))
+	assert.NoError(t, err)
+
+	projDir := filepath.Join(storage.ProjectsRoot, "test/project")
+	assert.NoError(t, os.WriteFile(filepath.Join(projDir, "data.gpkg-wal"), []byte("wal data"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(projDir, "data.gpkg-shm"), []byte("shm"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(projDir, "old.gpkg-wal"), []byte("wal data"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(projDir, "old.gpkg-shm"), []byte("shm"), 0644))
+
+	removed, err := storage.RemoveTemporaryFiles("test/project")
+	if assert.NoError(t, err) {
+		paths := make([]string, len(removed))
+		var size int64
+		for i, f := range removed {
+			paths[i] = f.Path
+			size += f.Size
+		}
+		assert.ElementsMatch(t, []string{"old.gpkg-wal", "old.gpkg-shm"}, paths)
+		assert.Equal(t, int64(11), size)
+	}
+	// files of existing database are kept (can contain uncommitted changes)
+	assert.FileExists(t, filepath.Join(projDir, "data.gpkg"))
+	assert.FileExists(t, filepath.Join(projDir, "data.gpkg-wal"))
+	assert.FileExists(t, filepath.Join(projDir, "data.gpkg-shm"))
+	assert.NoFileExists(t, filepath.Join(projDir, "old.gpkg-wal"))
+
+	_, err = storage.RemoveTemporaryFiles("test/missing")
+	assert.ErrorIs(t, err, domain.ErrProjectNotExists)
+}
+
+func TestUpdateSettingsTags(t *testing.T) {
+	storage := createTestProject(t)
+	defer storage.Close()
+
+	err := storage.UpdateSettings("test/project", []byte(`{"title": "Test", "auth": {"type": "public"}, "tags": [" Roads", "water", "roads"]}`))
+	assert.NoError(t, err)
+	info, err := storage.GetProjectInfo("test/project")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"roads", "water"}, info.Tags)
+	}
+	data, err := os.ReadFile(storage.GetSettingsPath("test/project"))
+	if assert.NoError(t, err) {
+		var settings struct {
+			Title string   `json:"title"`
+			Tags  []string `json:"tags"`
+		}
+		assert.NoError(t, json.Unmarshal(data, &settings))
+		assert.Equal(t, "Test", settings.Title)
+		assert.Equal(t, []string{"roads", "water"}, settings.Tags)
+	}
+}
@@ -0,0 +1,139 @@
+package project
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/go-redis/redis/v8"
+)
+
+// ProjectLock is an advisory lock of the project, held during long running
+// operations (e.g. files upload)
+type ProjectLock struct {
+	Token     string    `json:"-"`
+	Owner     string    `json:"owner"`
+	Operation string    `json:"operation"`
+	Since     time.Time `json:"since"`
+}
+
+// LockedError is returned when the project is locked, it holds the active lock
+type LockedError struct {
+	Lock *ProjectLock
+}
+
+func (e *LockedError) Error() string {
+	return domain.ErrProjectLocked.Error()
+}
+
+func (e *LockedError) Unwrap() error {
+	return domain.ErrProjectLocked
+}
+
+func (e *LockedError) ErrorDetails() interface{} {
+	return e.Lock
+}
+
+type RedisProjectLocks struct {
+	rdb *redis.Client
+}
+
+// deletes/extends the lock only when it's still held by the given token
+var releaseLockScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if value and cjson.decode(value).token == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+var extendLockScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if value and cjson.decode(value).token == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+func NewRedisProjectLocks(rdb *redis.Client) *RedisProjectLocks {
+	return &RedisProjectLocks{rdb: rdb}
+}
+
+func lockKey(projectName string) string {
+	return fmt.Sprintf("project_lock:%s", projectName)
+}
+
+type lockRecord struct {
+	ProjectLock
+	Token string `json:"token"`
+}
+
+// Acquire locks the project for the given duration, returns LockedError when
+// the project is already locked.
+func (l *RedisProjectLocks) Acquire(ctx context.Context, projectName, owner, operation string, ttl time.Duration) (*ProjectLock, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generating lock token: %w", err)
+	}
+	lock := ProjectLock{
+		Token:     hex.EncodeToString(b),
+		Owner:     owner,
+		Operation: operation,
+		Since:     time.Now().UTC(),
+	}
+	value, err := json.Marshal(lockRecord{lock, lock.Token})
+	if err != nil {
+		return nil, err
+	}
+	ok, err := l.rdb.SetNX(ctx, lockKey(projectName), string(value), ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis acquire project lock: %w", err)
+	}
+	if !ok {
+		active, err := l.Get(ctx, projectName)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &LockedError{Lock: active}
+	}
+	return &lock, nil
+}
+
+// Extend prolongs expiration of the held lock
+func (l *RedisProjectLocks) Extend(ctx context.Context, projectName string, lock *ProjectLock, ttl time.Duration) error {
+	res, err := extendLockScript.Run(ctx, l.rdb, []string{lockKey(projectName)}, lock.Token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("redis extend project lock: %w", err)
+	}
+	if res == 0 {
+		return fmt.Errorf("project lock was lost")
+	}
+	return nil
+}
+
+func (l *RedisProjectLocks) Release(ctx context.Context, projectName string, lock *ProjectLock) error {
+	if err := releaseLockScript.Run(ctx, l.rdb, []string{lockKey(projectName)}, lock.Token).Err(); err != nil {
+		return fmt.Errorf("redis release project lock: %w", err)
+	}
+	return nil
+}
+
+// Get returns active lock of the project or nil when the project is not locked
+func (l *RedisProjectLocks) Get(ctx context.Context, projectName string) (*ProjectLock, error) {
+	value, err := l.rdb.Get(ctx, lockKey(projectName)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("redis get project lock: %w", err)
+	}
+	var rec lockRecord
+	if err := json.Unmarshal([]byte(value), &rec); err != nil {
+		return nil, fmt.Errorf("parsing project lock: %w", err)
+	}
+	return &rec.ProjectLock, nil
+}
@@ -21,6 +21,61 @@ type Notification struct {
 	Expiration time.Time `json:"expiration"`
 	Projects   string    `json:"projects"`
 	Message    string    `json:"msg"`
+	// optional time window in which the notification is shown
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	Severity string     `json:"severity,omitempty"`
+}
+
+// Notifications severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Notifications statuses (relative to the time window)
+const (
+	NotificationScheduled = "scheduled"
+	NotificationActive    = "active"
+	NotificationExpired   = "expired"
+)
+
+func (n Notification) Status(now time.Time) string {
+	if n.Start != nil && now.Before(*n.Start) {
+		return NotificationScheduled
+	}
+	if n.End != nil && !now.Before(*n.End) {
+		return NotificationExpired
+	}
+	return NotificationActive
+}
+
+func (n Notification) IsActive(now time.Time) bool {
+	return n.Status(now) == NotificationActive
+}
+
+func (n Notification) Validate() error {
+	switch n.Severity {
+	case "", SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("%w: unknown severity %q", ErrInvalidNotification, n.Severity)
+	}
+	if n.Start != nil && n.End != nil && !n.End.After(*n.Start) {
+		return fmt.Errorf("%w: end time must be after start time", ErrInvalidNotification)
+	}
+	return nil
+}
+
+func activeNotifications(notifications []Notification) []Notification {
+	now := time.Now()
+	active := []Notification{}
+	for _, n := range notifications {
+		if n.IsActive(now) {
+			active = append(active, n)
+		}
+	}
+	return active
 }
 
 type RedisNotificationStore struct {
@@ -32,7 +87,8 @@ type RedisNotificationStore struct {
 // 	Day = 24 * time.Hour
 // )
 var (
-	ErrInvalidDuration = errors.New("invalid duration value")
+	ErrInvalidDuration     = errors.New("invalid duration value")
+	ErrInvalidNotification = errors.New("invalid notification")
 )
 
 func NewRedisNotificationStore(log *zap.SugaredLogger, rdb *redis.Client) *RedisNotificationStore {
@@ -40,10 +96,21 @@ func NewRedisNotificationStore(log *zap.SugaredLogger, rdb *redis.Client) *Redis
 }
 
 func (s *RedisNotificationStore) SaveNotification(ctx context.Context, notification Notification) error {
+	if notification.Severity == "" {
+		notification.Severity = SeverityInfo
+	}
+	if err := notification.Validate(); err != nil {
+		return err
+	}
 	key := fmt.Sprintf("notification:%s", notification.ID)
+	expiration := notification.Expiration
+	// notification is not needed after the end of its time window
+	if notification.End != nil && (expiration.IsZero() || notification.End.Before(expiration)) {
+		expiration = *notification.End
+	}
 	duration := time.Duration(0)
-	if !notification.Expiration.IsZero() {
-		duration = notification.Expiration.Sub(time.Now())
+	if !expiration.IsZero() {
+		duration = expiration.Sub(time.Now())
 	}
 	if duration < 0 {
 		return ErrInvalidDuration
@@ -91,11 +158,66 @@ func (s *RedisNotificationStore) GetNotifications() ([]Notification, error) {
 	return notifications, nil
 }
 
+// Per-user notification states
+const (
+	NotificationRead      = "read"
+	NotificationDismissed = "dismissed"
+)
+
+// users' notifications states are kept for limited time after the last change
+const notificationStateTTL = 90 * 24 * time.Hour
+
+func notificationStateKey(username string) string {
+	return fmt.Sprintf("notification_state:%s", username)
+}
+
+func (s *RedisNotificationStore) NotificationExists(ctx context.Context, id string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, fmt.Sprintf("notification:%s", id)).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis check notification: %v", err)
+	}
+	return n > 0, nil
+}
+
+// MarkRead marks notification as read by the user (dismissed notification stays dismissed)
+func (s *RedisNotificationStore) MarkRead(ctx context.Context, username, id string) error {
+	key := notificationStateKey(username)
+	pipe := s.rdb.TxPipeline()
+	pipe.HSetNX(ctx, key, id, NotificationRead)
+	pipe.Expire(ctx, key, notificationStateTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis save notification state: %v", err)
+	}
+	return nil
+}
+
+// Dismiss hides notification for the user
+func (s *RedisNotificationStore) Dismiss(ctx context.Context, username, id string) error {
+	key := notificationStateKey(username)
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, key, id, NotificationDismissed)
+	pipe.Expire(ctx, key, notificationStateTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis save notification state: %v", err)
+	}
+	return nil
+}
+
+// GetUserStates returns states of notifications (by notification ID) of the user
+func (s *RedisNotificationStore) GetUserStates(ctx context.Context, username string) (map[string]string, error) {
+	states, err := s.rdb.HGetAll(ctx, notificationStateKey(username)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis get notifications state: %v", err)
+	}
+	return states, nil
+}
+
 func (s *RedisNotificationStore) GetMapProjectNotifications(projectName string, user domain.User) ([]Notification, error) {
 	allNotifications, err := s.GetNotifications()
 	if err != nil {
 		return nil, err
 	}
+	allNotifications = activeNotifications(allNotifications)
 	notifications := []Notification{}
 	for _, n := range allNotifications {
 		if n.App != "map" ||
@@ -119,6 +241,7 @@ func (s *RedisNotificationStore) GetSettingsNotifications(projectName string, us
 	if err != nil {
 		return nil, err
 	}
+	allNotifications = activeNotifications(allNotifications)
 	notifications := []Notification{}
 	for _, n := range allNotifications {
 		if n.App == "settings" {
@@ -0,0 +1,24 @@
+package project
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationStatus(t *testing.T) {
+	now := time.Now()
+	start := now.Add(time.Hour)
+	end := now.Add(2 * time.Hour)
+	n := Notification{Start: &start, End: &end}
+
+	assert.Equal(t, NotificationScheduled, n.Status(now))
+	assert.Equal(t, NotificationActive, n.Status(start))
+	assert.Equal(t, NotificationExpired, n.Status(end))
+	assert.True(t, Notification{}.IsActive(now))
+
+	assert.NoError(t, n.Validate())
+	assert.ErrorIs(t, Notification{Start: &end, End: &start}.Validate(), ErrInvalidNotification)
+	assert.ErrorIs(t, Notification{Severity: "fatal"}.Validate(), ErrInvalidNotification)
+}
@@ -0,0 +1,74 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/go-redis/redis/v8"
+)
+
+const invitationsKey = "invitations"
+
+// RedisInvitationsStore stores pending invitations in redis hash
+type RedisInvitationsStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisInvitationsStore(rdb *redis.Client) *RedisInvitationsStore {
+	return &RedisInvitationsStore{rdb: rdb}
+}
+
+func (s *RedisInvitationsStore) Save(invitation application.Invitation) error {
+	value, err := json.Marshal(invitation)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.HSet(context.Background(), invitationsKey, invitation.ID, string(value)).Err(); err != nil {
+		return fmt.Errorf("redis save invitation: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisInvitationsStore) Get(id string) (application.Invitation, error) {
+	var invitation application.Invitation
+	value, err := s.rdb.HGet(context.Background(), invitationsKey, id).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return invitation, application.ErrInvitationNotFound
+		}
+		return invitation, fmt.Errorf("redis get invitation: %w", err)
+	}
+	if err := json.Unmarshal([]byte(value), &invitation); err != nil {
+		return invitation, fmt.Errorf("parsing invitation: %w", err)
+	}
+	return invitation, nil
+}
+
+func (s *RedisInvitationsStore) List() ([]application.Invitation, error) {
+	values, err := s.rdb.HGetAll(context.Background(), invitationsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis list invitations: %w", err)
+	}
+	invitations := make([]application.Invitation, 0, len(values))
+	for _, value := range values {
+		var invitation application.Invitation
+		if err := json.Unmarshal([]byte(value), &invitation); err != nil {
+			return nil, fmt.Errorf("parsing invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, nil
+}
+
+func (s *RedisInvitationsStore) Delete(id string) error {
+	n, err := s.rdb.HDel(context.Background(), invitationsKey, id).Result()
+	if err != nil {
+		return fmt.Errorf("redis delete invitation: %w", err)
+	}
+	if n == 0 {
+		return application.ErrInvitationNotFound
+	}
+	return nil
+}
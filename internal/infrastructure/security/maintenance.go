@@ -0,0 +1,54 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/go-redis/redis/v8"
+)
+
+const maintenanceKey = "maintenance"
+
+// RedisMaintenanceStore keeps maintenance state in redis, so that it's shared by all
+// server instances and survives restarts
+type RedisMaintenanceStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisMaintenanceStore(rdb *redis.Client) *RedisMaintenanceStore {
+	return &RedisMaintenanceStore{rdb: rdb}
+}
+
+func (s *RedisMaintenanceStore) Get(ctx context.Context) (application.MaintenanceState, error) {
+	var state application.MaintenanceState
+	value, err := s.rdb.Get(ctx, maintenanceKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return state, nil
+		}
+		return state, fmt.Errorf("redis get maintenance state: %w", err)
+	}
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		return state, fmt.Errorf("parsing maintenance state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *RedisMaintenanceStore) Set(ctx context.Context, state application.MaintenanceState) error {
+	if !state.Active() {
+		if err := s.rdb.Del(ctx, maintenanceKey).Err(); err != nil {
+			return fmt.Errorf("redis delete maintenance state: %w", err)
+		}
+		return nil
+	}
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.Set(ctx, maintenanceKey, string(value), 0).Err(); err != nil {
+		return fmt.Errorf("redis save maintenance state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisThrottle allows a single action per key (e.g. email address) within the given interval
+type RedisThrottle struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+func NewRedisThrottle(rdb *redis.Client, prefix string) *RedisThrottle {
+	return &RedisThrottle{rdb: rdb, prefix: prefix}
+}
+
+// Wait returns remaining time until the next action with the key is allowed (zero when
+// it's allowed now)
+func (t *RedisThrottle) Wait(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := t.rdb.PTTL(ctx, t.redisKey(key)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis throttle: %w", err)
+	}
+	// negative values are returned for missing key or key without expiration
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Record records the action, next action with the key will be allowed after the interval.
+// Should be called only when the action was successful, so failed attempts can be retried.
+func (t *RedisThrottle) Record(ctx context.Context, key string, interval time.Duration) error {
+	if err := t.rdb.Set(ctx, t.redisKey(key), time.Now().UTC().Unix(), interval).Err(); err != nil {
+		return fmt.Errorf("redis throttle: %w", err)
+	}
+	return nil
+}
+
+func (t *RedisThrottle) redisKey(key string) string {
+	return fmt.Sprintf("%s:%s", t.prefix, key)
+}
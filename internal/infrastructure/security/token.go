@@ -76,7 +76,7 @@ func (t *TokenGenerator) CheckToken(token, claims string) error {
 		return err
 	}
 	currentTimestamp := time.Now().UTC().Unix() - refTime
-	if currentTimestamp-timestamp > int64(t.expiration) {
+	if currentTimestamp-timestamp > int64(t.expiration.Seconds()) {
 		return ErrTokenExpired
 	}
 	genToken, err := t.tokenWithTimestamp(claims, timestamp)
@@ -89,6 +89,11 @@ func (t *TokenGenerator) CheckToken(token, claims string) error {
 	return nil
 }
 
+// Expiration returns validity duration of generated tokens
+func (t *TokenGenerator) Expiration() time.Duration {
+	return t.expiration
+}
+
 func NewTokenGenerator(key, salt string, expiration time.Duration) *TokenGenerator {
 	return &TokenGenerator{key, salt, expiration}
 }
@@ -0,0 +1,62 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MessageBuffer stores messages for temporarily disconnected peers
+type MessageBuffer interface {
+	// Push stores the message under the given key
+	Push(ctx context.Context, key string, msg []byte) error
+	// Pop returns all stored messages of the key (in the original order) and removes them
+	Pop(ctx context.Context, key string) ([][]byte, error)
+}
+
+// RedisMessageBuffer keeps the last Size messages per key in redis list, messages expire
+// after TTL since the last stored message
+type RedisMessageBuffer struct {
+	rdb    *redis.Client
+	prefix string
+	size   int
+	ttl    time.Duration
+}
+
+func NewRedisMessageBuffer(rdb *redis.Client, prefix string, size int, ttl time.Duration) *RedisMessageBuffer {
+	return &RedisMessageBuffer{rdb: rdb, prefix: prefix, size: size, ttl: ttl}
+}
+
+func (b *RedisMessageBuffer) Push(ctx context.Context, key string, msg []byte) error {
+	redisKey := fmt.Sprintf("%s:%s", b.prefix, key)
+	_, err := b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, redisKey, msg)
+		pipe.LTrim(ctx, redisKey, int64(-b.size), -1)
+		pipe.Expire(ctx, redisKey, b.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis message buffer: %w", err)
+	}
+	return nil
+}
+
+func (b *RedisMessageBuffer) Pop(ctx context.Context, key string) ([][]byte, error) {
+	redisKey := fmt.Sprintf("%s:%s", b.prefix, key)
+	var items *redis.StringSliceCmd
+	_, err := b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		items = pipe.LRange(ctx, redisKey, 0, -1)
+		pipe.Del(ctx, redisKey)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis message buffer: %w", err)
+	}
+	messages := make([][]byte, len(items.Val()))
+	for i, item := range items.Val() {
+		messages[i] = []byte(item)
+	}
+	return messages, nil
+}
@@ -2,9 +2,15 @@ package ws
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
@@ -14,20 +20,92 @@ var (
 	ErrConnectionNotFound = errors.New("connection not found")
 )
 
+// Message types created by the server
+const (
+	MessageTypePluginStatus = "PluginStatus"
+	MessageTypeError        = "Error"
+	// confirms that the message was buffered and will be delivered when the peer connects
+	MessageTypeBuffered = "MessageBuffered"
+)
+
 type message struct {
-	Type   string      `json:"type"`
-	Status int         `json:"status,omitempty"`
-	Data   interface{} `json:"data"`
+	Type string `json:"type"`
+	// correlation ID of request/response messages (set by the sender, responses use the same ID)
+	ID     string        `json:"id,omitempty"`
+	Status int           `json:"status,omitempty"`
+	Data   interface{}   `json:"data"`
+	Error  *messageError `json:"error,omitempty"`
+}
+
+type messageError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// messageHeader is used to read type and correlation ID of forwarded messages
+type messageHeader struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// errorReply creates error message as a response to the given (raw) message, so that
+// the sender can pair it with the request
+func errorReply(msg []byte, status int, code, text string) message {
+	var header messageHeader
+	// messages are forwarded as they are, not all of them have to be JSON
+	_ = json.Unmarshal(msg, &header)
+	return message{
+		Type:   MessageTypeError,
+		ID:     header.ID,
+		Status: status,
+		Data:   map[string]string{"request_type": header.Type},
+		Error:  &messageError{Code: code, Message: text},
+	}
+}
+
+// bufferedReply confirms that the (raw) message was buffered for the disconnected peer
+func bufferedReply(msg []byte) message {
+	var header messageHeader
+	_ = json.Unmarshal(msg, &header)
+	return message{
+		Type:   MessageTypeBuffered,
+		ID:     header.ID,
+		Status: 202,
+		Data:   map[string]string{"request_type": header.Type},
+	}
+}
+
+// connection serializes writes into the websocket connection, which supports only one
+// concurrent writer (messages are sent by connection handlers of both peers and by the server)
+type connection struct {
+	*websocket.Conn
+	writeLock sync.Mutex
+}
+
+func newConnection(conn *websocket.Conn) *connection {
+	return &connection{Conn: conn}
+}
+
+func (c *connection) WriteJSON(v interface{}) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+func (c *connection) WriteMessage(messageType int, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
 }
 
 /* Structure for managing websocket connections for concurrent access */
 type websocketsMap struct {
 	sync.RWMutex
 	name        string
-	connections map[string]*websocket.Conn
+	connections map[string]*connection
 }
 
-func (w *websocketsMap) Set(key string, conn *websocket.Conn) {
+func (w *websocketsMap) Set(key string, conn *connection) {
 	w.Lock()
 	defer w.Unlock()
 	// TODO: is it better to replace connection or return error?
@@ -38,12 +116,22 @@ func (w *websocketsMap) Set(key string, conn *websocket.Conn) {
 	}
 }
 
-func (w *websocketsMap) Get(key string) *websocket.Conn {
+func (w *websocketsMap) Get(key string) *connection {
 	w.RLock()
 	defer w.RUnlock()
 	return w.connections[key]
 }
 
+func (w *websocketsMap) All() []*connection {
+	w.RLock()
+	defer w.RUnlock()
+	conns := make([]*connection, 0, len(w.connections))
+	for _, conn := range w.connections {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
 // func (w *websocketsMap) Send(key string, msg message) error {
 // 	dest := w.Get(key)
 // 	if dest != nil {
@@ -61,23 +149,71 @@ func (w *websocketsMap) Send(key string, msgType string, data interface{}) error
 	return nil
 }
 
+// Broadcast sends message to all connections of the channel
+func (w *websocketsMap) Broadcast(msgType string, data interface{}) {
+	for _, conn := range w.All() {
+		conn.WriteJSON(message{Type: msgType, Data: data})
+	}
+}
+
 type SettingsWS struct {
+	// MaxMessageSize limits size of the received messages (0 = unlimited)
+	MaxMessageSize int64
+	// Buffer stores messages for disconnected peers (disabled when nil)
+	Buffer   MessageBuffer
 	log      *zap.SugaredLogger
 	upgrader websocket.Upgrader
 	plugin   *websocketsMap
 	webapp   *websocketsMap
+	handlers sync.WaitGroup
 }
 
-func NewSettingsWS(log *zap.SugaredLogger) *SettingsWS {
+// NewSettingsWS creates websockets bridge accepting connections only from the allowed
+// origins ("*" allows any origin)
+func NewSettingsWS(log *zap.SugaredLogger, allowedOrigins []string) *SettingsWS {
 	return &SettingsWS{
 		log: log,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
-			CheckOrigin:     func(r *http.Request) bool { return true },
+			CheckOrigin:     originChecker(log, allowedOrigins),
 		},
-		plugin: &websocketsMap{name: "plugin", connections: make(map[string]*websocket.Conn)},
-		webapp: &websocketsMap{name: "webapp", connections: make(map[string]*websocket.Conn)},
+		plugin: &websocketsMap{name: "plugin", connections: make(map[string]*connection)},
+		webapp: &websocketsMap{name: "webapp", connections: make(map[string]*connection)},
+	}
+}
+
+// originChecker creates CheckOrigin function of the websocket upgrader. Allowed origins can
+// be full origins (scheme://host[:port]) or just hosts (any scheme). Requests without Origin
+// header are accepted, they don't come from browsers (e.g. QGIS plugin).
+func originChecker(log *zap.SugaredLogger, allowedOrigins []string) func(r *http.Request) bool {
+	origins := make(map[string]bool, len(allowedOrigins))
+	hosts := make(map[string]bool, len(allowedOrigins))
+	for _, o := range allowedOrigins {
+		o = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(o), "/"))
+		if o == "*" {
+			return func(r *http.Request) bool { return true }
+		}
+		if strings.Contains(o, "://") {
+			// URL (e.g. site URL with path) can be used as well
+			if u, err := url.Parse(o); err == nil {
+				origins[u.Scheme+"://"+u.Host] = true
+			}
+		} else if o != "" {
+			hosts[o] = true
+		}
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(strings.ToLower(origin))
+		if err == nil && (origins[u.Scheme+"://"+u.Host] || hosts[u.Host]) {
+			return true
+		}
+		log.Warnw("websocket connection from not allowed origin", "origin", origin, "path", r.URL.Path)
+		return false
 	}
 }
 
@@ -85,6 +221,29 @@ func (s *SettingsWS) AppChannel() *websocketsMap {
 	return s.webapp
 }
 
+func (s *SettingsWS) PluginChannel() *websocketsMap {
+	return s.plugin
+}
+
+// Channels selectors
+const (
+	ChannelApp    = "app"
+	ChannelPlugin = "plugin"
+	ChannelAll    = "all"
+)
+
+// Channels returns channels of the given selector (app, plugin or all), app channel
+// is used for unknown or empty selector
+func (s *SettingsWS) Channels(selector string) []*websocketsMap {
+	switch selector {
+	case ChannelPlugin:
+		return []*websocketsMap{s.plugin}
+	case ChannelAll:
+		return []*websocketsMap{s.webapp, s.plugin}
+	}
+	return []*websocketsMap{s.webapp}
+}
+
 // func (s *SettingsWS) SendToPlugin(id string, msgType string, data interface{}) error {
 // 	dest := s.plugin.Get(id)
 // 	if dest != nil {
@@ -95,20 +254,32 @@ func (s *SettingsWS) AppChannel() *websocketsMap {
 // }
 
 func (s *SettingsWS) bridgeHandler(id string, src *websocketsMap, dest *websocketsMap, w http.ResponseWriter, r *http.Request) (err error) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	wsconn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
+	conn := newConnection(wsconn)
+	s.handlers.Add(1)
+	defer s.handlers.Done()
+	defer conn.Close()
+	if s.MaxMessageSize > 0 {
+		conn.SetReadLimit(s.MaxMessageSize)
+	}
 	src.Set(id, conn)
 	s.log.Infow("websocket connection started", "user", id, "channel", src.name)
 	if destConn := dest.Get(id); destConn != nil {
 		info := map[string]string{"client": r.Header.Get("User-Agent")}
-		destConn.WriteJSON(message{Type: "PluginStatus", Status: 200, Data: info})
+		destConn.WriteJSON(message{Type: MessageTypePluginStatus, Status: 200, Data: info})
 	}
+	s.replayMessages(r.Context(), id, src, conn)
 	for {
 		msgType, msg, rerr := conn.ReadMessage()
 		if rerr != nil {
-			// log.Println(err)
+			if errors.Is(rerr, websocket.ErrReadLimit) {
+				// close frame with CloseMessageTooBig (1009) code is already sent by the websocket library
+				s.log.Warnw("websocket message size limit exceeded", "user", id, "channel", src.name, "limit", s.MaxMessageSize)
+				break
+			}
 			if !websocket.IsCloseError(rerr, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 				err = rerr
 				s.log.Errorw("websocket error", "user", id, "channel", src.name, zap.Error(rerr))
@@ -122,11 +293,17 @@ func (s *SettingsWS) bridgeHandler(id string, src *websocketsMap, dest *websocke
 
 		if msgType == websocket.TextMessage {
 			if destConn := dest.Get(id); destConn != nil {
-				if err = destConn.WriteMessage(msgType, msg); err != nil {
-					break // or better reply with error message?
+				if werr := destConn.WriteMessage(msgType, msg); werr != nil {
+					s.log.Warnw("forwarding websocket message", "user", id, "channel", dest.name, zap.Error(werr))
+					conn.WriteJSON(errorReply(msg, 502, "peer_error", fmt.Sprintf("%s connection error", dest.name)))
 				}
 			} else {
-				conn.WriteJSON(message{Type: "PluginStatus", Status: 503}) // rename to TargetStatus or ReceiverStatus
+				conn.WriteJSON(message{Type: MessageTypePluginStatus, Status: 503}) // rename to TargetStatus or ReceiverStatus
+				if s.bufferMessage(r.Context(), id, dest, msg) {
+					conn.WriteJSON(bufferedReply(msg))
+				} else {
+					conn.WriteJSON(errorReply(msg, 503, "peer_unavailable", fmt.Sprintf("%s is not connected", dest.name)))
+				}
 			}
 		} else if msgType == websocket.CloseMessage {
 			s.log.Infow("websocket CloseMessage", "user", id, "channel", src.name)
@@ -136,11 +313,77 @@ func (s *SettingsWS) bridgeHandler(id string, src *websocketsMap, dest *websocke
 	src.Set(id, nil)
 	s.log.Infow("websocket connection closed", "user", id, "channel", src.name)
 	if destConn := dest.Get(id); destConn != nil {
-		destConn.WriteJSON(message{Type: "PluginStatus", Status: 503})
+		destConn.WriteJSON(message{Type: MessageTypePluginStatus, Status: 503})
 	}
 	return
 }
 
+func bufferKey(id string, channel *websocketsMap) string {
+	return fmt.Sprintf("%s:%s", channel.name, id)
+}
+
+// bufferMessage stores message for the disconnected peer, returns false when buffering
+// is disabled or failed
+func (s *SettingsWS) bufferMessage(ctx context.Context, id string, dest *websocketsMap, msg []byte) bool {
+	if s.Buffer == nil {
+		return false
+	}
+	if err := s.Buffer.Push(ctx, bufferKey(id, dest), msg); err != nil {
+		s.log.Errorw("buffering websocket message", "user", id, "channel", dest.name, zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// replayMessages sends messages buffered while the peer was disconnected
+func (s *SettingsWS) replayMessages(ctx context.Context, id string, src *websocketsMap, conn *connection) {
+	if s.Buffer == nil {
+		return
+	}
+	messages, err := s.Buffer.Pop(ctx, bufferKey(id, src))
+	if err != nil {
+		s.log.Errorw("reading buffered websocket messages", "user", id, "channel", src.name, zap.Error(err))
+		return
+	}
+	for _, msg := range messages {
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			s.log.Warnw("replaying buffered websocket message", "user", id, "channel", src.name, zap.Error(err))
+			return
+		}
+	}
+	if len(messages) > 0 {
+		s.log.Infow("replayed buffered websocket messages", "user", id, "channel", src.name, "count", len(messages))
+	}
+}
+
+// Shutdown sends close frame to all active connections and waits until all
+// connection handlers are finished. Connections which are still open when the
+// context expires are closed forcibly.
+func (s *SettingsWS) Shutdown(ctx context.Context) error {
+	conns := append(s.plugin.All(), s.webapp.All()...)
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	deadline := time.Now().Add(time.Second)
+	for _, conn := range conns {
+		if err := conn.WriteControl(websocket.CloseMessage, closeMsg, deadline); err != nil {
+			s.log.Warnw("sending websocket close message", zap.Error(err))
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, conn := range append(s.plugin.All(), s.webapp.All()...) {
+			conn.Close()
+		}
+		return ctx.Err()
+	}
+}
+
 func (s *SettingsWS) WebAppHandler(id string, w http.ResponseWriter, r *http.Request) error {
 	return s.bridgeHandler(id, s.webapp, s.plugin, w, r)
 }
@@ -0,0 +1,169 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestOriginChecker(t *testing.T) {
+	check := originChecker(zap.NewNop().Sugar(), []string{"https://gisquick.example.com/app/", "localhost:8080"})
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", true},
+		{"https://gisquick.example.com", true},
+		{"HTTPS://Gisquick.Example.com", true},
+		{"http://gisquick.example.com", false},
+		{"https://evil.example.com", false},
+		{"http://localhost:8080", true},
+		{"http://localhost", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/ws/app", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		assert.Equal(t, tt.allowed, check(r), tt.origin)
+	}
+
+	any := originChecker(zap.NewNop().Sugar(), []string{"*"})
+	r := httptest.NewRequest("GET", "/ws/app", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	assert.True(t, any(r))
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	sws := NewSettingsWS(zap.NewNop().Sugar(), nil)
+	sws.MaxMessageSize = 16
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sws.PluginHandler("user", w, r)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("Ping")))
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 32))))
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), err)
+}
+
+type memoryBuffer struct {
+	mu       sync.Mutex
+	messages map[string][][]byte
+}
+
+func (b *memoryBuffer) Push(ctx context.Context, key string, msg []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages[key] = append(b.messages[key], msg)
+	return nil
+}
+
+func (b *memoryBuffer) Pop(ctx context.Context, key string) ([][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	messages := b.messages[key]
+	delete(b.messages, key)
+	return messages, nil
+}
+
+func TestBufferedMessages(t *testing.T) {
+	sws := NewSettingsWS(zap.NewNop().Sugar(), nil)
+	sws.Buffer = &memoryBuffer{messages: make(map[string][][]byte)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plugin" {
+			sws.PluginHandler("user", w, r)
+		} else {
+			sws.WebAppHandler("user", w, r)
+		}
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	plugin, _, err := websocket.DefaultDialer.Dial(wsURL+"/plugin", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer plugin.Close()
+	msg := `{"type":"ProjectInfo","id":"1","data":{}}`
+	assert.NoError(t, plugin.WriteMessage(websocket.TextMessage, []byte(msg)))
+
+	var status, reply message
+	assert.NoError(t, plugin.ReadJSON(&status))
+	assert.Equal(t, 503, status.Status)
+	assert.NoError(t, plugin.ReadJSON(&reply))
+	assert.Equal(t, MessageTypeBuffered, reply.Type)
+	assert.Equal(t, "1", reply.ID)
+
+	app, _, err := websocket.DefaultDialer.Dial(wsURL+"/app", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer app.Close()
+	_, data, err := app.ReadMessage()
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, msg, string(data))
+	}
+	// buffer is emptied after replay
+	messages, _ := sws.Buffer.Pop(context.Background(), "webapp:user")
+	assert.Empty(t, messages)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	sws := NewSettingsWS(zap.NewNop().Sugar(), nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sws.WebAppHandler("user", w, r)
+	}))
+	defer server.Close()
+
+	app, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer app.Close()
+	for sws.AppChannel().Get("user") == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	const senders, count = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				sws.AppChannel().Broadcast("Notification", j)
+			}
+		}()
+	}
+	received := 0
+	for received < senders*count {
+		var msg message
+		if !assert.NoError(t, app.ReadJSON(&msg)) {
+			break
+		}
+		assert.Equal(t, "Notification", msg.Type)
+		received++
+	}
+	wg.Wait()
+}
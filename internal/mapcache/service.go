@@ -47,22 +47,24 @@ func cacheMetrics() *metrics {
 }
 
 type Cache struct {
-	Root      string
-	ServerURL string
-	log       *zap.SugaredLogger
-	client    *http.Client
-	tileLock  singleflight.Group
-	metrics   *metrics
+	Root        string
+	ServerURL   string
+	PublishRoot string
+	log         *zap.SugaredLogger
+	client      *http.Client
+	tileLock    singleflight.Group
+	metrics     *metrics
 }
 
-func NewMapcache(log *zap.SugaredLogger, root string, mapserverURL string) *Cache {
+func NewMapcache(log *zap.SugaredLogger, root, mapserverURL, publishRoot string) *Cache {
 	return &Cache{
-		Root:      root,
-		ServerURL: mapserverURL,
-		log:       log,
-		client:    &http.Client{},
-		tileLock:  singleflight.Group{},
-		metrics:   cacheMetrics(),
+		Root:        root,
+		ServerURL:   mapserverURL,
+		PublishRoot: publishRoot,
+		log:         log,
+		client:      &http.Client{},
+		tileLock:    singleflight.Group{},
+		metrics:     cacheMetrics(),
 	}
 }
 
@@ -78,7 +80,7 @@ func (c *Cache) GetLayer(p *domain.Project, layers string) Layer {
 	layersHash := fmt.Sprintf("%x", md5.Sum([]byte(layers)))
 
 	return Layer{
-		Map:         filepath.Join("/publish", p.Info.Map),
+		Map:         filepath.Join(c.PublishRoot, p.Info.Map),
 		Project:     projectHash,
 		Publish:     "",
 		Name:        layersHash,
@@ -160,7 +162,7 @@ func (c *Cache) GetTileFile(p *domain.Project, tile Tile) (string, error) {
 		c.metrics.counter.Inc()
 		metatileUrl = layer.GetMetaTileURL(metatile)
 		q := metatileUrl.Query()
-		q.Set("MAP", filepath.Join("/publish", p.Info.Map))
+		q.Set("MAP", filepath.Join(c.PublishRoot, p.Info.Map))
 		metatileUrl.RawQuery = q.Encode()
 		c.log.Infow("fetching metatile", "service", "mapcache", "url", metatileUrl.String())
 
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
@@ -37,7 +38,7 @@ func (s *Server) handleSignUp() func(echo.Context) error {
 		err := s.accountsService.NewAccount(form.Username, form.Email, form.FirstName, form.LastName, form.Password)
 		if err != nil {
 			if errors.Is(err, domain.ErrAccountExists) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Account already exists")
+				return echo.NewHTTPError(http.StatusBadRequest, "Account already exists").SetInternal(err)
 			}
 			s.log.Errorw("creating a new account", zap.Error(err))
 			return err
@@ -64,18 +65,41 @@ func (s *Server) handleInvitation() func(echo.Context) error {
 		if err := validate.Struct(form); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
-		err := s.accountsService.NewAccount(form.Username, form.Email, form.FirstName, form.LastName, "")
+		invitation, err := s.accountsService.Invite(form.Username, form.Email, form.FirstName, form.LastName, form.Parameters)
 		if err != nil {
 			if errors.Is(err, domain.ErrAccountExists) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Account already exists")
+				return echo.NewHTTPError(http.StatusBadRequest, "Account already exists").SetInternal(err)
 			}
 			s.log.Errorw("creating a new account", zap.Error(err))
 			return err
 		}
-		return c.NoContent(http.StatusOK)
+		return c.JSON(http.StatusOK, invitation)
 	}
 }
 
+func (s *Server) handleGetInvitations(c echo.Context) error {
+	invitations, err := s.accountsService.PendingInvitations()
+	if err != nil {
+		return fmt.Errorf("listing invitations: %w", err)
+	}
+	sort.Slice(invitations, func(i, j int) bool {
+		return invitations[i].Created.After(invitations[j].Created)
+	})
+	return c.JSON(http.StatusOK, invitations)
+}
+
+func (s *Server) handleResendInvitation(c echo.Context) error {
+	invitation, err := s.accountsService.ResendInvitation(c.Param("id"))
+	if err != nil {
+		return fmt.Errorf("resending invitation: %w", err)
+	}
+	return c.JSON(http.StatusOK, invitation)
+}
+
+func (s *Server) handleRevokeInvitation(c echo.Context) error {
+	return s.accountsService.RevokeInvitation(c.Param("id"))
+}
+
 func (s *Server) handleActivateAccount() func(echo.Context) error {
 	return func(c echo.Context) error {
 		uid := c.QueryParam("uid")
@@ -85,13 +109,13 @@ func (s *Server) handleActivateAccount() func(echo.Context) error {
 		if err != nil {
 			if errors.Is(err, application.ErrPasswordNotSet) {
 				// return echo.NewHTTPError(http.StatusNotAcceptable, "Password not set")
-				return echo.NewHTTPError(http.StatusPreconditionFailed, "Password not set")
+				return echo.NewHTTPError(http.StatusPreconditionFailed, "Password not set").SetInternal(err)
 			}
 			if errors.Is(err, application.ErrInvalidToken) || errors.Is(err, domain.ErrAccountNotFound) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Invalid activation link")
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid activation link").SetInternal(err)
 			}
 			if errors.Is(err, domain.ErrAccountActive) {
-				return echo.NewHTTPError(http.StatusConflict, "Account already active")
+				return echo.NewHTTPError(http.StatusConflict, "Account already active").SetInternal(err)
 			}
 			s.log.Errorw("activating account", "uid", uid, zap.Error(err))
 			return echo.NewHTTPError(http.StatusInternalServerError, "Activation error")
@@ -143,9 +167,9 @@ func (s *Server) handlePasswordReset() func(echo.Context) error {
 		}
 		if err := s.accountsService.RequestPasswordReset(form.Email); err != nil {
 			if errors.Is(err, domain.ErrAccountNotFound) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Account with given email doesn't exist")
+				return echo.NewHTTPError(http.StatusBadRequest, "Account with given email doesn't exist").SetInternal(err)
 			} else if errors.Is(err, application.ErrNotActiveAccount) {
-				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
 			}
 			return err
 		}
@@ -178,7 +202,7 @@ func (s *Server) handleNewPassword() func(echo.Context) error {
 		err := s.accountsService.SetNewPassword(form.UID, form.Token, form.Password)
 		if err != nil {
 			if errors.Is(err, application.ErrInvalidToken) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Invalid link")
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid link").SetInternal(err)
 			}
 		}
 		return err
@@ -213,14 +237,14 @@ func (s *Server) handleChangePassword() func(echo.Context) error {
 		account, err := s.accountsService.Repository.GetByUsername(sessionInfo.Username)
 		if err != nil {
 			if errors.Is(err, domain.ErrAccountNotFound) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Invalid account")
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid account").SetInternal(err)
 			}
 			return err
 		}
 		if !account.CheckPassword(form.OldPassword) {
 			return echo.NewHTTPError(http.StatusBadRequest, "Old password doesn't match")
 		}
-		if err := account.SetPassword(form.NewPassword); err != nil {
+		if err := account.SetPassword(form.NewPassword, s.accountsService.PasswordHashCost); err != nil {
 			return err
 		}
 		return s.accountsService.Repository.Update(account)
@@ -238,7 +262,7 @@ func (s *Server) handleGetAccountInfo() func(echo.Context) error {
 		}
 		limits, err := s.limiter.GetAccountLimits(user.Username)
 		if err != nil {
-			s.log.Errorw("getting user account limits", "user", user.Username, zap.Error(err))
+			s.log.Errorw("getting user account limits", "user", user.Identity(), zap.Error(err))
 			return fmt.Errorf("Failed to load user account limits")
 		}
 		return c.JSON(http.StatusOK, Payload{AccountLimits: limits})
@@ -2,16 +2,25 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	htmltemplate "html/template"
+	"math"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	texttemplate "text/template"
 	"time"
 
+	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/email"
+	"github.com/go-playground/validator/v10"
+	"github.com/jellydator/ttlcache/v3"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
@@ -43,7 +52,22 @@ func toAccountInfo(a domain.Account) Account {
 }
 
 func (s *Server) handleAdminConfig(c echo.Context) error {
-	return c.File("/etc/gisquick/admin.json")
+	if s.Config.AdminConfigPath == "" {
+		return echo.NewHTTPError(http.StatusNotFound, "Admin config not available")
+	}
+	data, err := os.ReadFile(s.Config.AdminConfigPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return echo.NewHTTPError(http.StatusNotFound, "Admin config not available").SetInternal(err)
+		}
+		s.log.Errorw("reading admin config", "path", s.Config.AdminConfigPath, zap.Error(err))
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Admin config not available").SetInternal(err)
+	}
+	if !json.Valid(data) {
+		s.log.Errorw("invalid admin config", "path", s.Config.AdminConfigPath)
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Invalid admin config")
+	}
+	return c.JSONBlob(http.StatusOK, data)
 }
 
 func (s *Server) handleGetAllUsers(c echo.Context) error {
@@ -117,12 +141,16 @@ func (s *Server) handleCreateUser() func(echo.Context) error {
 		if form.SendEmail && !s.accountsService.SupportEmails() {
 			return echo.NewHTTPError(http.StatusPreconditionFailed, "Email service not supported")
 		}
+		if err := s.accountsService.CheckUsername(form.Username); err != nil {
+			return err
+		}
 		account, err := domain.NewAccount(
 			form.Username,
 			form.Email,
 			form.FirstName,
 			form.LastName,
 			form.Password,
+			s.accountsService.PasswordHashCost,
 		)
 		if err != nil {
 			return err
@@ -145,9 +173,324 @@ func (s *Server) handleCreateUser() func(echo.Context) error {
 	}
 }
 
+// handleImportUsers creates accounts from the same JSON format as used by 'loadusers' command
+// (passwords are already hashed), returns report with result of every account
+func (s *Server) handleImportUsers() func(echo.Context) error {
+	type ImportAccount struct {
+		Username  string     `json:"username"`
+		Email     string     `json:"email"`
+		Password  string     `json:"password"`
+		FirstName string     `json:"first_name"`
+		LastName  string     `json:"last_name"`
+		Active    bool       `json:"is_active"`
+		Superuser bool       `json:"is_superuser"`
+		Created   *time.Time `json:"created_at"`
+		Confirmed *time.Time `json:"confirmed_at"`
+		LastLogin *time.Time `json:"last_login_at"`
+	}
+	type Params struct {
+		DryRun bool `query:"dry_run"`
+	}
+	type Response struct {
+		Created int                               `json:"created"`
+		Failed  int                               `json:"failed"`
+		Results []application.AccountImportResult `json:"results"`
+	}
+	return func(c echo.Context) error {
+		var params Params
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, &params); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameters")
+		}
+		var users []ImportAccount
+		if err := (&echo.DefaultBinder{}).BindBody(c, &users); err != nil {
+			return err
+		}
+		now := time.Now()
+		accounts := make([]domain.Account, len(users))
+		for i, u := range users {
+			created := u.Created
+			if created == nil {
+				created = &now
+			}
+			accounts[i] = domain.Account{
+				Username:  u.Username,
+				Email:     u.Email,
+				Password:  []byte(u.Password),
+				FirstName: u.FirstName,
+				LastName:  u.LastName,
+				Superuser: u.Superuser,
+				Active:    u.Active,
+				Created:   created,
+				Confirmed: u.Confirmed,
+				LastLogin: u.LastLogin,
+			}
+		}
+		resp := Response{Results: s.accountsService.ImportAccounts(accounts, params.DryRun)}
+		for _, r := range resp.Results {
+			if r.Status == "error" {
+				resp.Failed++
+			} else if r.Status == "created" {
+				resp.Created++
+			}
+		}
+		s.logger(c).Infow("users import", "dry_run", params.DryRun, "created", resp.Created, "failed", resp.Failed)
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+func (s *Server) handleDeactivateUser(c echo.Context) error {
+	username := c.Param("user")
+	account, err := s.accountsService.Repository.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	if account.Active {
+		account.Active = false
+		if err := s.accountsService.Repository.Update(account); err != nil {
+			return fmt.Errorf("deactivating account [%s]: %w", username, err)
+		}
+	}
+	s.auth.InvalidateUser(username)
+	return c.JSON(http.StatusOK, toAccountInfo(account))
+}
+
+// handleGetRecentProjects returns recently updated projects of all users. Sorted list of
+// projects is cached for a short time (shared by all limit values), since all projects
+// have to be scanned.
+func (s *Server) handleGetRecentProjects() func(echo.Context) error {
+	type RecentProject struct {
+		domain.ProjectInfo
+		Owner string `json:"owner"`
+	}
+	const defaultLimit = 20
+	const maxLimit = 200
+	const cacheKey = "recent"
+	cache := ttlcache.New(
+		ttlcache.WithTTL[string, []RecentProject](30*time.Second),
+		ttlcache.WithCapacity[string, []RecentProject](1),
+	)
+	go cache.Start()
+	s.onShutdown(cache.Stop)
+
+	return func(c echo.Context) error {
+		limit := defaultLimit
+		if v := c.QueryParam("limit"); v != "" {
+			l, err := strconv.Atoi(v)
+			if err != nil || l < 1 || l > maxLimit {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid limit value (1-%d)", maxLimit))
+			}
+			limit = l
+		}
+		var data []RecentProject
+		if item := cache.Get(cacheKey); item != nil {
+			data = item.Value()
+		} else {
+			projects, err := s.projects.RecentProjects(maxLimit)
+			if err != nil {
+				return fmt.Errorf("getting recent projects: %w", err)
+			}
+			data = make([]RecentProject, len(projects))
+			for i, p := range projects {
+				data[i] = RecentProject{ProjectInfo: p, Owner: strings.SplitN(p.Name, "/", 2)[0]}
+			}
+			cache.Set(cacheKey, data, ttlcache.DefaultTTL)
+		}
+		if len(data) > limit {
+			data = data[:limit]
+		}
+		return c.JSON(http.StatusOK, data)
+	}
+}
+
+func (s *Server) handleTransferProject() func(echo.Context) error {
+	type TransferForm struct {
+		To string `json:"to" form:"to" validate:"required"`
+	}
+	type Resp struct {
+		Name string `json:"name"`
+	}
+	var validate = validator.New()
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		form := new(TransferForm)
+		if err := c.Bind(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := validate.Struct(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if form.To == c.Param("user") {
+			return echo.NewHTTPError(http.StatusBadRequest, "Project is already owned by the target user")
+		}
+		if _, err := s.accountsService.Repository.GetByUsername(form.To); err != nil {
+			if errors.Is(err, domain.ErrAccountNotFound) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Target user doesn't exist").SetInternal(err)
+			}
+			return err
+		}
+		newName, err := s.projects.Transfer(projectName, form.To)
+		if err != nil {
+			return fmt.Errorf("transferring project: %w", err)
+		}
+		s.invalidateProjectMapCache(projectName)
+		s.invalidateProjectMapCache(newName)
+		s.log.Infow("project transferred", "project", projectName, "to", newName)
+		return c.JSON(http.StatusOK, Resp{Name: newName})
+	}
+}
+
+// handleDeleteUserProjects deletes all projects of the user. Username must be repeated
+// in 'confirm' query parameter. Locked projects are skipped, failures of individual projects
+// don't stop the deletion and are reported in the results (with 207 status).
+func (s *Server) handleDeleteUserProjects() func(echo.Context) error {
+	type Result struct {
+		Project string `json:"project"`
+		Deleted bool   `json:"deleted"`
+		Error   string `json:"error,omitempty"`
+	}
+	return func(c echo.Context) error {
+		username := c.Param("user")
+		if c.QueryParam("confirm") != username {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing or invalid confirmation ('confirm' parameter must match the username)")
+		}
+		projects, err := s.projects.UserProjects(username)
+		if err != nil {
+			return fmt.Errorf("getting user's projects: %w", err)
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		status := http.StatusOK
+		results := make([]Result, len(projects))
+		for i, projectName := range projects {
+			results[i].Project = projectName
+			// project is locked during the deletion, so it can't be modified concurrently
+			lock, err := acquireProjectLock(ctx, s.projectLocks, projectName, user.Username, "delete project")
+			if err == nil {
+				err = s.projects.Delete(projectName)
+				if rerr := lock.Release(); rerr != nil {
+					s.log.Errorw("releasing project lock", "project", projectName, zap.Error(rerr))
+				}
+			}
+			if err != nil {
+				s.log.Errorw("deleting user's project", "project", projectName, zap.Error(err))
+				results[i].Error = err.Error()
+				status = http.StatusMultiStatus
+				continue
+			}
+			s.invalidateProjectMapCache(projectName)
+			s.log.Infow("project deleted", "project", projectName)
+			results[i].Deleted = true
+		}
+		return c.JSON(status, results)
+	}
+}
+
+// handleDeleteUser deletes user account, user's projects are kept (default), deleted
+// or transferred to another user, depending on 'projects' query parameter
 func (s *Server) handleDeleteUser(c echo.Context) error {
 	username := c.Param("user")
-	return s.accountsService.Repository.Delete(username)
+	mode := c.QueryParam("projects")
+	target := c.QueryParam("to")
+	if mode == "" {
+		mode = "keep"
+	}
+	if mode != "keep" && mode != "delete" && mode != "transfer" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid value of 'projects' parameter")
+	}
+	if _, err := s.accountsService.Repository.GetByUsername(username); err != nil {
+		return err
+	}
+	projects, err := s.projects.GetUserProjects(username)
+	if err != nil {
+		return fmt.Errorf("getting user's projects: %w", err)
+	}
+
+	switch mode {
+	case "transfer":
+		if target == "" || target == username {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid value of 'to' parameter")
+		}
+		if _, err := s.accountsService.Repository.GetByUsername(target); err != nil {
+			if errors.Is(err, domain.ErrAccountNotFound) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Target user doesn't exist").SetInternal(err)
+			}
+			return err
+		}
+		targetProjects, err := s.projects.GetUserProjects(target)
+		if err != nil {
+			return fmt.Errorf("getting target user's projects: %w", err)
+		}
+		existing := make(map[string]bool, len(targetProjects))
+		for _, p := range targetProjects {
+			existing[p.Name] = true
+		}
+		// check all conflicts before moving anything
+		for _, p := range projects {
+			newName := path.Join(target, path.Base(p.Name))
+			if existing[newName] {
+				return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Project %s already exists", newName))
+			}
+		}
+	}
+	if mode != "keep" {
+		// all projects are locked before any change, so the account isn't deleted only
+		// partially because of a project which is being modified
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		for _, p := range projects {
+			lock, err := acquireProjectLock(ctx, s.projectLocks, p.Name, user.Username, "delete user")
+			if err != nil {
+				return fmt.Errorf("locking project [%s]: %w", p.Name, err)
+			}
+			defer lock.Release()
+		}
+	}
+
+	// the account is kept when some of the projects can't be processed
+	failed := make(map[string]string)
+	switch mode {
+	case "transfer":
+		for _, p := range projects {
+			newName, err := s.projects.Transfer(p.Name, target)
+			if err != nil {
+				s.log.Errorw("transferring user's project", "project", p.Name, zap.Error(err))
+				failed[p.Name] = err.Error()
+				continue
+			}
+			s.invalidateProjectMapCache(p.Name)
+			s.invalidateProjectMapCache(newName)
+			s.log.Infow("project transferred", "project", p.Name, "to", newName)
+		}
+	case "delete":
+		for _, p := range projects {
+			if err := s.projects.Delete(p.Name); err != nil {
+				s.log.Errorw("deleting user's project", "project", p.Name, zap.Error(err))
+				failed[p.Name] = err.Error()
+				continue
+			}
+			s.invalidateProjectMapCache(p.Name)
+			s.log.Infow("project deleted", "project", p.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return &APIError{
+			Status:  http.StatusInternalServerError,
+			Code:    "user_projects_failed",
+			Message: "Failed to process some of the user's projects, account was not deleted",
+			Details: failed,
+		}
+	}
+	if err := s.accountsService.Repository.Delete(username); err != nil {
+		return err
+	}
+	s.auth.InvalidateUser(username)
+	return c.NoContent(http.StatusOK)
 }
 
 func (s *Server) handleGetEmailPreview() func(echo.Context) error {
@@ -187,7 +530,7 @@ func (s *Server) handleGetEmailPreview() func(echo.Context) error {
 		if params.TextTemplate != "" {
 			t := texttemplate.New("preview")
 			if strings.HasPrefix(params.TextTemplate, `{{template "email" .}}`) {
-				t.ParseFiles("./templates/email_base.txt")
+				t.ParseFiles(filepath.Join(s.Config.TemplatesRoot, "email_base.txt"))
 			}
 			t.Parse(params.TextTemplate)
 			if err := t.Execute(&buffer, data); err != nil {
@@ -201,7 +544,7 @@ func (s *Server) handleGetEmailPreview() func(echo.Context) error {
 			buffer.Reset()
 			data["Style"] = htmltemplate.CSS(params.Style)
 			if strings.HasPrefix(params.HtmlTemplate, `{{template "email" .}}`) {
-				t.ParseFiles("./templates/email_base.html")
+				t.ParseFiles(filepath.Join(s.Config.TemplatesRoot, "email_base.html"))
 			}
 			t.Parse(params.HtmlTemplate)
 			// if err := t.ExecuteTemplate(&buffer, "email", data); err != nil {
@@ -236,6 +579,9 @@ func (s *Server) handleSendEmail() func(echo.Context) error {
 		if err := (&echo.DefaultBinder{}).BindBody(c, &params); err != nil {
 			return err
 		}
+		if !s.accountsService.SupportEmails() {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "Email service not supported")
+		}
 		if params.HtmlTemplate == "" && params.TextTemplate == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "Email template not specified")
 		}
@@ -244,14 +590,14 @@ func (s *Server) handleSendEmail() func(echo.Context) error {
 		if params.TextTemplate != "" {
 			textTemplate = texttemplate.New("new_text_email")
 			if strings.HasPrefix(params.TextTemplate, `{{template "email" .}}`) {
-				textTemplate.ParseFiles("./templates/email_base.txt")
+				textTemplate.ParseFiles(filepath.Join(s.Config.TemplatesRoot, "email_base.txt"))
 			}
 			textTemplate.Parse(params.TextTemplate)
 		}
 		if params.HtmlTemplate != "" {
 			htmlTemplate = htmltemplate.New("new_html_email")
 			if strings.HasPrefix(params.HtmlTemplate, `{{template "email" .}}`) {
-				htmlTemplate.ParseFiles("./templates/email_base.html")
+				htmlTemplate.ParseFiles(filepath.Join(s.Config.TemplatesRoot, "email_base.html"))
 			}
 			htmlTemplate.Parse(params.HtmlTemplate)
 		}
@@ -307,6 +653,10 @@ func (s *Server) handleSendActivationEmail() func(echo.Context) error {
 	type Form struct {
 		Email string `json:"email"`
 	}
+	type Response struct {
+		// validity of the activation link in seconds
+		Expiration int `json:"expiration"`
+	}
 	return func(c echo.Context) error {
 		form := new(Form)
 		if err := (&echo.DefaultBinder{}).BindBody(c, &form); err != nil {
@@ -320,10 +670,71 @@ func (s *Server) handleSendActivationEmail() func(echo.Context) error {
 		if account.Active {
 			return echo.NewHTTPError(http.StatusBadRequest, "Account already activated")
 		}
+		if s.Config.ActivationEmailInterval > 0 {
+			retryAfter, err := s.emailThrottle.Wait(c.Request().Context(), account.Email)
+			if err != nil {
+				return err
+			}
+			if retryAfter > 0 {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Activation email was sent recently, try again later")
+			}
+		}
 		if err := s.accountsService.SendActivationEmail(account, nil); err != nil {
 			s.log.Errorw("sending activation email", "username", account.Username, "email", account.Email, zap.Error(err))
 			return fmt.Errorf("Failed to send activation email")
 		}
-		return nil
+		// only sent emails are throttled, failed attempts can be retried immediately
+		if s.Config.ActivationEmailInterval > 0 {
+			if err := s.emailThrottle.Record(c.Request().Context(), account.Email, s.Config.ActivationEmailInterval); err != nil {
+				s.log.Errorw("recording sent activation email", "email", account.Email, zap.Error(err))
+			}
+		}
+		return c.JSON(http.StatusOK, Response{
+			Expiration: int(s.accountsService.TokenExpiration().Seconds()),
+		})
+	}
+}
+
+func (s *Server) handleGetUserLimits(c echo.Context) error {
+	type Payload struct {
+		Limits    domain.AccountConfig  `json:"limits"`
+		Overrides *domain.AccountLimits `json:"overrides,omitempty"`
+	}
+	username := c.Param("user")
+	if _, err := s.accountsService.Repository.GetByUsername(username); err != nil {
+		return err
+	}
+	limits, err := s.limiter.GetAccountLimits(username)
+	if err != nil {
+		return fmt.Errorf("getting account limits [%s]: %w", username, err)
+	}
+	data := Payload{Limits: limits}
+	if store, ok := s.limiter.(application.AccountsLimitsStore); ok {
+		overrides, err := store.GetAccountLimitsOverrides(username)
+		if err != nil {
+			return fmt.Errorf("getting account limits [%s]: %w", username, err)
+		}
+		data.Overrides = &overrides
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+func (s *Server) handleUpdateUserLimits(c echo.Context) error {
+	store, ok := s.limiter.(application.AccountsLimitsStore)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotImplemented, "Account limits are not configurable")
+	}
+	username := c.Param("user")
+	var form domain.AccountLimits
+	if err := (&echo.DefaultBinder{}).BindBody(c, &form); err != nil {
+		return err
+	}
+	if _, err := s.accountsService.Repository.GetByUsername(username); err != nil {
+		return err
+	}
+	if err := store.SetAccountLimitsOverrides(username, form); err != nil {
+		return fmt.Errorf("updating account limits [%s]: %w", username, err)
 	}
+	return s.handleGetUserLimits(c)
 }
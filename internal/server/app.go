@@ -8,16 +8,18 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
 
 type AppData struct {
-	Language         string `json:"lang"`
-	LandingProject   string `json:"landing_project,omitempty"`
-	PasswordResetUrl string `json:"reset_password_url,omitempty"`
-	SignupUrl        string `json:"signup_url,omitempty"`
+	Language         string                        `json:"lang"`
+	LandingProject   string                        `json:"landing_project,omitempty"`
+	PasswordResetUrl string                        `json:"reset_password_url,omitempty"`
+	SignupUrl        string                        `json:"signup_url,omitempty"`
+	Maintenance      *application.MaintenanceState `json:"maintenance,omitempty"`
 }
 
 type UserInfo struct {
@@ -69,11 +71,14 @@ func (s *Server) handleAppInit(c echo.Context) error {
 	}
 	userProfile, err := s.getUserProfile(user)
 	if err != nil {
-		s.log.Warnw("handleAppInit", "user", user.Username, zap.Error(err))
+		s.log.Warnw("handleAppInit", "user", user.Identity(), zap.Error(err))
 	}
 	if s.Config.SignupAPI {
 		app.SignupUrl = "/api/accounts/signup"
 	}
+	if ms := s.maintenance.Get(c.Request().Context()); ms.Active() {
+		app.Maintenance = &ms
+	}
 	data := AppPayload{App: app, User: UserData{User: user, Profile: userProfile}}
 	return c.JSON(http.StatusOK, data)
 }
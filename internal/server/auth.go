@@ -33,7 +33,7 @@ func (s *Server) handleLogin() func(echo.Context) error {
 		user := auth.AccountToUser(account)
 		profile, err := s.getUserProfile(user)
 		if err != nil {
-			s.log.Warnw("handleLogin", "user", user.Username, zap.Error(err))
+			s.log.Warnw("handleLogin", "user", user.Identity(), zap.Error(err))
 		}
 		userData := UserData{User: user, Profile: profile}
 		return c.JSON(http.StatusOK, userData)
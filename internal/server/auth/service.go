@@ -14,6 +14,8 @@ import (
 	"github.com/gofrs/uuid"
 	"github.com/jellydator/ttlcache/v3"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.uber.org/zap"
 )
 
@@ -21,13 +23,22 @@ var (
 	ErrUserNotFound    = errors.New("User not found")
 	ErrInvalidPassword = errors.New("Password doesn't match")
 	ErrInvalidSession  = errors.New("Invalid session")
-	AnonymousUser      = domain.User{IsGuest: true}
+	// ErrSessionStoreUnavailable is returned by session store on connection errors
+	ErrSessionStoreUnavailable = errors.New("Session store unavailable")
+	AnonymousUser              = domain.User{IsGuest: true}
 )
 
 const (
 	basic = "basic"
+	// how long validated sessions are cached in memory to ride out short session store outages
+	sessionCacheTTL = 30 * time.Second
 )
 
+var sessionStoreErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "auth_session_store_errors_total",
+	Help: "Number of session store (redis) connection errors.",
+})
+
 type SessionInfo struct {
 	ID       string
 	Username string
@@ -60,7 +71,7 @@ func (s *RedisSessionStore) Get(ctx context.Context, sessionID string) (string,
 		if err == redis.Nil {
 			return "", ErrInvalidSession
 		}
-		return "", fmt.Errorf("redis get session: %v", err)
+		return "", fmt.Errorf("redis get session: %w: %v", ErrSessionStoreUnavailable, err)
 	}
 	return val, nil
 }
@@ -79,6 +90,18 @@ type AuthService struct {
 	store          SessionStore
 	cache          *ttlcache.Cache[string, domain.User]
 	basicAuthCache *ttlcache.Cache[string, domain.User]
+	sessionsCache  *ttlcache.Cache[string, string]
+	// bcrypt cost of password hashes, weaker hashes are upgraded on login (default cost when zero)
+	PasswordHashCost int
+	// GuestUsername is identity of unauthenticated users in logs and default values
+	GuestUsername string
+}
+
+// anonymousUser returns unauthenticated user with configured guest name
+func (s *AuthService) anonymousUser() domain.User {
+	user := AnonymousUser
+	user.GuestName = s.GuestUsername
+	return user
 }
 
 func NewAuthService(logger *zap.SugaredLogger, expiration time.Duration, accounts domain.AccountsRepository, store SessionStore) *AuthService {
@@ -89,6 +112,10 @@ func NewAuthService(logger *zap.SugaredLogger, expiration time.Duration, account
 				logger.Errorw("getting account", "username", username, zap.Error(err))
 				return nil
 			}
+			// sessions of deactivated accounts are treated as anonymous
+			if !account.Active {
+				return nil
+			}
 			item := c.Set(username, AccountToUser(account), ttlcache.DefaultTTL)
 			return item
 		},
@@ -103,6 +130,11 @@ func NewAuthService(logger *zap.SugaredLogger, expiration time.Duration, account
 		ttlcache.WithTTL[string, domain.User](45*time.Second),
 		ttlcache.WithDisableTouchOnHit[string, domain.User](),
 	)
+	sessionsCache := ttlcache.New(
+		ttlcache.WithTTL[string, string](sessionCacheTTL),
+		ttlcache.WithDisableTouchOnHit[string, string](),
+	)
+	go sessionsCache.Start()
 	return &AuthService{
 		logger:         logger,
 		expiration:     expiration,
@@ -110,6 +142,7 @@ func NewAuthService(logger *zap.SugaredLogger, expiration time.Duration, account
 		store:          store,
 		cache:          cache,
 		basicAuthCache: basicAuthCache,
+		sessionsCache:  sessionsCache,
 	}
 }
 
@@ -130,11 +163,27 @@ func (s *AuthService) GetSessionInfo(c echo.Context) (*SessionInfo, error) {
 	data, err := s.store.Get(c.Request().Context(), sessionid)
 	if err != nil {
 		if errors.Is(err, ErrInvalidSession) {
+			s.sessionsCache.Delete(sessionid)
 			s.LogoutUser(c)
 			c.Set("session", nil)
 			return nil, nil
 		}
-		return nil, err
+		if errors.Is(err, ErrSessionStoreUnavailable) {
+			sessionStoreErrors.Inc()
+			if item := s.sessionsCache.Get(sessionid); item != nil {
+				s.logger.Warnw("session store unavailable, using cached session", zap.Error(err))
+				data = item.Value()
+			} else {
+				// fail closed, but keep the session (cookie) for the time when the store is available again
+				s.logger.Errorw("session store unavailable", zap.Error(err))
+				c.Set("session", nil)
+				return nil, nil
+			}
+		} else {
+			return nil, err
+		}
+	} else {
+		s.sessionsCache.Set(sessionid, data, ttlcache.DefaultTTL)
 	}
 	si = SessionInfo{ID: sessionid, Username: data}
 	c.Set("session", si)
@@ -155,13 +204,13 @@ func (s *AuthService) GetUser(c echo.Context) (domain.User, error) {
 			if len(auth) > prefixLen+1 && strings.EqualFold(auth[:prefixLen], basic) {
 				b, err := base64.StdEncoding.DecodeString(auth[prefixLen+1:])
 				if err != nil {
-					return AnonymousUser, err
+					return s.anonymousUser(), err
 				}
 				cred := strings.SplitN(string(b), ":", 2)
 				if len(cred) == 2 {
 					account, err := s.Authenticate(cred[0], cred[1])
 					if err != nil {
-						return AnonymousUser, err
+						return s.anonymousUser(), err
 					}
 					user = AccountToUser(account)
 					s.basicAuthCache.Set(auth, user, ttlcache.DefaultTTL)
@@ -171,14 +220,14 @@ func (s *AuthService) GetUser(c echo.Context) (domain.User, error) {
 	} else {
 		session, err := s.GetSessionInfo(c)
 		if err != nil {
-			return AnonymousUser, fmt.Errorf("auth: get session user: %w", err)
+			return s.anonymousUser(), fmt.Errorf("auth: get session user: %w", err)
 		}
 		if session == nil {
-			return AnonymousUser, nil
+			return s.anonymousUser(), nil
 		}
 		item := s.cache.Get(session.Username)
 		if item == nil {
-			return AnonymousUser, nil
+			return s.anonymousUser(), nil
 		}
 		user = item.Value()
 	}
@@ -203,6 +252,14 @@ func (s *AuthService) Authenticate(login, password string) (domain.Account, erro
 	if !account.CheckPassword(password) {
 		return domain.Account{}, ErrInvalidPassword
 	}
+	// transparently upgrade legacy or weaker password hashes
+	if account.NeedsRehash(s.PasswordHashCost) {
+		if err := account.SetPassword(password, s.PasswordHashCost); err != nil {
+			s.logger.Errorw("rehashing password", "username", account.Username, zap.Error(err))
+		} else if err := s.accounts.Update(account); err != nil {
+			s.logger.Errorw("saving rehashed password", "username", account.Username, zap.Error(err))
+		}
+	}
 	return account, nil
 }
 
@@ -218,6 +275,7 @@ func (s *AuthService) LoginUserWithExpiration(c echo.Context, userAccount domain
 	}
 	oldCookie, err := c.Request().Cookie("gq_session")
 	if err == nil {
+		s.sessionsCache.Delete(oldCookie.Value)
 		if err = s.store.Del(c.Request().Context(), oldCookie.Value); err != nil {
 			s.logger.Errorw("deleting old session on login", zap.Error(err))
 		}
@@ -248,6 +306,7 @@ func (s *AuthService) LoginUser(c echo.Context, userAccount domain.Account) erro
 func (s *AuthService) LogoutUser(c echo.Context) {
 	cookie, err := c.Request().Cookie("gq_session")
 	if err == nil {
+		s.sessionsCache.Delete(cookie.Value)
 		if err = s.store.Del(c.Request().Context(), cookie.Value); err != nil {
 			s.logger.Errorw("deleting session on logout", zap.Error(err))
 		}
@@ -262,6 +321,17 @@ func (s *AuthService) LogoutUser(c echo.Context) {
 	})
 }
 
+// InvalidateUser drops cached user data, so that changes of the account (e.g. deactivation)
+// are applied to existing sessions and basic auth credentials immediately
+func (s *AuthService) InvalidateUser(username string) {
+	s.cache.Delete(username)
+	for auth, item := range s.basicAuthCache.Items() {
+		if item.Value().Username == username {
+			s.basicAuthCache.Delete(auth)
+		}
+	}
+}
+
 func AccountToUser(account domain.Account) domain.User {
 	return domain.User{
 		Username:        account.Username,
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type testSessionStore struct {
+	sessions    map[string]string
+	unavailable bool
+}
+
+func (s *testSessionStore) Set(ctx context.Context, sessionID, data string, expiration time.Duration) error {
+	s.sessions[sessionID] = data
+	return nil
+}
+
+func (s *testSessionStore) Get(ctx context.Context, sessionID string) (string, error) {
+	if s.unavailable {
+		return "", fmt.Errorf("%w: connection refused", ErrSessionStoreUnavailable)
+	}
+	data, ok := s.sessions[sessionID]
+	if !ok {
+		return "", ErrInvalidSession
+	}
+	return data, nil
+}
+
+func (s *testSessionStore) Del(ctx context.Context, sessionID string) error {
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+func sessionRequest(e *echo.Echo, sessionID string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "gq_session", Value: sessionID})
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func TestSessionStoreUnavailable(t *testing.T) {
+	e := echo.New()
+	store := &testSessionStore{sessions: map[string]string{"s1": "user1", "s2": "user2"}}
+	s := NewAuthService(zap.NewNop().Sugar(), time.Hour, nil, store)
+
+	c, _ := sessionRequest(e, "s1")
+	si, err := s.GetSessionInfo(c)
+	if assert.NoError(t, err) && assert.NotNil(t, si) {
+		assert.Equal(t, "user1", si.Username)
+	}
+
+	store.unavailable = true
+	// validated session is served from the cache
+	c, _ = sessionRequest(e, "s1")
+	si, err = s.GetSessionInfo(c)
+	if assert.NoError(t, err) && assert.NotNil(t, si) {
+		assert.Equal(t, "user1", si.Username)
+	}
+
+	// unknown session fails closed, without logging the user out
+	c, rec := sessionRequest(e, "s2")
+	si, err = s.GetSessionInfo(c)
+	assert.NoError(t, err)
+	assert.Nil(t, si)
+	assert.Empty(t, rec.Header().Values("Set-Cookie"))
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RFC 5987 attr-char (besides alphanumeric characters)
+const attrChars = "!#$&+-.^_`|~"
+
+func encodeRFC5987(value string) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte(attrChars, c) != -1 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// asciiFilename returns filename usable as quoted 'filename' parameter for clients without
+// RFC 5987 support (non-ASCII and special characters are replaced)
+func asciiFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '/' || r == '%' {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ContentDisposition returns value of Content-Disposition header with the filename encoded
+// for both legacy clients and RFC 6266 compliant clients
+func ContentDisposition(dispositionType, filename string) string {
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, dispositionType, asciiFilename(filename), encodeRFC5987(filename))
+}
+
+// serveFile sends the file with Content-Disposition header (attachment or inline)
+func serveFile(c echo.Context, file, dispositionType, name string) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, ContentDisposition(dispositionType, name))
+	return c.File(file)
+}
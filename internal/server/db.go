@@ -5,9 +5,11 @@ package server
 import (
 	"strconv"
 	"net/url"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" // Calls init function.
+	"go.uber.org/zap"
 )
 
 // Config is the required properties to use the database.
@@ -46,3 +48,24 @@ func OpenDB(cfg DBConfig) (*sqlx.DB, error) {
 	db.SetMaxOpenConns(cfg.MaxOpenConns)
 	return db, nil
 }
+
+// OpenDBWithRetry opens database connection, when the database is not available yet (e.g. it's
+// still starting), connection is retried with exponential backoff up to maxWait duration
+func OpenDBWithRetry(log *zap.SugaredLogger, cfg DBConfig, maxWait time.Duration) (*sqlx.DB, error) {
+	deadline := time.Now().Add(maxWait)
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		db, err := OpenDB(cfg)
+		if err == nil {
+			return db, nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+		log.Warnw("database is not available, retrying", "attempt", attempt, "delay", delay, zap.Error(err))
+		time.Sleep(delay)
+		if delay *= 2; delay > 5*time.Second {
+			delay = 5 * time.Second
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// APIError is the error representation sent to the clients.
+type APIError struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// detailedError can be implemented by errors which provide additional data for the client
+type detailedError interface {
+	ErrorDetails() interface{}
+}
+
+func errorDetails(err error) interface{} {
+	var de detailedError
+	if err != nil && errors.As(err, &de) {
+		return de.ErrorDetails()
+	}
+	return nil
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("code=%s, message=%s", e.Code, e.Message)
+}
+
+type errorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+type knownError struct {
+	err    error
+	status int
+	code   string
+}
+
+// Mapping of domain errors to stable API error codes
+var knownErrors = []knownError{
+	{domain.ErrProjectNotExists, http.StatusNotFound, "project_not_found"},
+	{domain.ErrFileNotExists, http.StatusNotFound, "file_not_found"},
+	{domain.ErrFileExists, http.StatusConflict, "file_exists"},
+	{domain.ErrProjectAlreadyExists, http.StatusConflict, "project_already_exists"},
+	{domain.ErrProjectLocked, http.StatusLocked, "project_locked"},
+	{domain.ErrFileMismatch, http.StatusBadRequest, "file_mismatch"},
+	{domain.ErrInvalidStateChange, http.StatusBadRequest, "invalid_state_change"},
+	{domain.ErrInvalidQgisMeta, http.StatusBadRequest, "invalid_qgis_meta"},
+	{domain.ErrInvalidProjectName, http.StatusBadRequest, "invalid_project_name"},
+	{domain.ErrAccountExists, http.StatusBadRequest, "account_exists"},
+	{application.ErrEmailNotSupported, http.StatusPreconditionFailed, "email_not_supported"},
+	{domain.ErrAccountNotFound, http.StatusNotFound, "account_not_found"},
+	{domain.ErrAccountActive, http.StatusConflict, "account_active"},
+	{application.ErrAccountProjectsLimit, http.StatusConflict, "account_projects_limit"},
+	{application.ErrAccountStorageLimit, http.StatusRequestEntityTooLarge, "account_storage_limit"},
+	{application.ErrProjectSizeLimit, http.StatusRequestEntityTooLarge, "project_size_limit"},
+	{application.ErrLayerNotExists, http.StatusNotFound, "layer_not_found"},
+	{application.ErrFileTypeNotAllowed, http.StatusUnsupportedMediaType, "file_type_not_allowed"},
+	{application.ErrInvalidSettings, http.StatusBadRequest, "invalid_settings"},
+	{application.ErrInvalidPage, http.StatusBadRequest, "invalid_page"},
+	{application.ErrInvalidToken, http.StatusBadRequest, "invalid_token"},
+	{application.ErrPasswordNotSet, http.StatusPreconditionFailed, "password_not_set"},
+	{application.ErrInvitationNotFound, http.StatusNotFound, "invitation_not_found"},
+	{auth.ErrUserNotFound, http.StatusUnauthorized, "invalid_credentials"},
+	{auth.ErrInvalidPassword, http.StatusUnauthorized, "invalid_credentials"},
+	{auth.ErrInvalidSession, http.StatusUnauthorized, "invalid_session"},
+}
+
+func findKnownError(err error) *knownError {
+	if err == nil {
+		return nil
+	}
+	for i := range knownErrors {
+		if errors.Is(err, knownErrors[i].err) {
+			return &knownErrors[i]
+		}
+	}
+	return nil
+}
+
+// statusCode converts HTTP status into error code, e.g. 404 -> "not_found"
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	text = strings.NewReplacer("'", "", "-", " ").Replace(text)
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if he, ok := err.(*echo.HTTPError); ok {
+		e := &APIError{Status: he.Code, Code: statusCode(he.Code)}
+		if msg, ok := he.Message.(string); ok {
+			e.Message = msg
+		} else {
+			e.Message = fmt.Sprint(he.Message)
+		}
+		// handlers can attach domain error to provide more specific error code
+		if ke := findKnownError(he.Internal); ke != nil {
+			e.Code = ke.code
+		}
+		e.Details = errorDetails(he.Internal)
+		return e
+	}
+	if ke := findKnownError(err); ke != nil {
+		return &APIError{Status: ke.status, Code: ke.code, Message: ke.err.Error(), Details: errorDetails(err)}
+	}
+	return &APIError{
+		Status:  http.StatusInternalServerError,
+		Code:    statusCode(http.StatusInternalServerError),
+		Message: http.StatusText(http.StatusInternalServerError),
+	}
+}
+
+func newHTTPErrorHandler(log *zap.SugaredLogger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		apiErr := toAPIError(err)
+		if apiErr.Status == http.StatusInternalServerError {
+			reqLog := log
+			if l, ok := c.Get("logger").(*zap.SugaredLogger); ok {
+				reqLog = l
+			}
+			reqLog.Error(err)
+		}
+		if c.Response().Committed {
+			return
+		}
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(apiErr.Status)
+		} else {
+			err = c.JSON(apiErr.Status, errorResponse{apiErr})
+		}
+		if err != nil {
+			log.Errorw("sending error response", "request_id", c.Get("request_id"), zap.Error(err))
+		}
+	}
+}
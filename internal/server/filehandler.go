@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -16,7 +17,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/gisquick/gisquick-server/internal/domain"
@@ -34,14 +34,58 @@ func findObjectByID(array []domain.StorageProvider, id string) *domain.StoragePr
 }
 
 type FileHandler interface {
-	SaveImage(io.Reader, int64, string) (MediaFileResult, error)
+	SaveFile(file *multipart.FileHeader, directory string) (MediaFileResult, error)
 
 	LoadSourceImage(src string) (image.Image, error)
 
 	CheckValidSource(parsedUrl url.URL) bool
 	HasRemoteSource() bool
-	GetExistingThumbnail(filePath string) string
-	SaveThumbnail(img image.Image, filePath string, quality int) (string, error)
+	GetExistingThumbnail(filePath string, fit ThumbnailFit) string
+	SaveThumbnail(img image.Image, filePath string, fit ThumbnailFit, quality int) (string, error)
+}
+
+// ThumbnailFit specifies how is the image resized into thumbnail bounds
+type ThumbnailFit string
+
+const (
+	// ThumbnailContain preserves aspect ratio and fits the image within the bounds
+	ThumbnailContain ThumbnailFit = "contain"
+	// ThumbnailCover preserves aspect ratio and crops the image to fill the bounds
+	ThumbnailCover ThumbnailFit = "cover"
+	// ThumbnailFill stretches the image to the bounds
+	ThumbnailFill ThumbnailFit = "fill"
+)
+
+// ParseThumbnailFit parses fit mode from the query parameter value (default is contain)
+func ParseThumbnailFit(value string) (ThumbnailFit, error) {
+	switch fit := ThumbnailFit(strings.ToLower(value)); fit {
+	case "":
+		return ThumbnailContain, nil
+	case ThumbnailContain, ThumbnailCover, ThumbnailFill:
+		return fit, nil
+	}
+	return "", fmt.Errorf("invalid fit mode: %s", value)
+}
+
+// ResizeThumbnail resizes the image into the given bounds with the fit mode
+func ResizeThumbnail(img image.Image, width, height int, fit ThumbnailFit) image.Image {
+	switch fit {
+	case ThumbnailCover:
+		return imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos)
+	case ThumbnailFill:
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	}
+	return imaging.Fit(img, width, height, imaging.Lanczos)
+}
+
+// ThumbnailCachePath returns relative path of the cached thumbnail. Thumbnails with the
+// default fit mode keep the original path, other modes are stored in a subdirectory
+// named by the mode (media files are always in the 'web' directory, so it cannot clash).
+func ThumbnailCachePath(filePath string, fit ThumbnailFit) string {
+	if fit == "" || fit == ThumbnailContain {
+		return filePath
+	}
+	return filepath.Join(string(fit), filePath)
 }
 
 func ProcessPath(directory string, file *multipart.FileHeader) (string, error) {
@@ -58,20 +102,9 @@ func ProcessPath(directory string, file *multipart.FileHeader) (string, error) {
 	return filepath.Join(directory, fileName), nil
 }
 
-// Based on internal/infrastructure/project/disk_storage.go
+// ProcessFileName resolves filename pattern of the uploaded file (same naming as in the project storage)
 func ProcessFileName(file *multipart.FileHeader) (string, error) {
-	pattern := file.Filename
-
-	if strings.Contains(pattern, "<timestamp>") {
-		pattern = strings.Replace(pattern, "<timestamp>", fmt.Sprint(time.Now().Unix()), 1)
-	}
-
-	if strings.Contains(pattern, "<random>") {
-		// https://github.com/joncrlsn/fileutil/blob/5aac37a6ac963fd712b618b024d2eb14aa190958/fileutil.go#L98-L103
-		randBytes := make([]byte, 16)
-		rand.Read(randBytes)
-		pattern = strings.Replace(pattern, "<random>", hex.EncodeToString(randBytes), 1)
-	}
+	pattern := domain.FormatFilename(file.Filename)
 
 	if strings.Contains(pattern, "<hash>") {
 		src, err := file.Open()
@@ -84,9 +117,7 @@ func ProcessFileName(file *multipart.FileHeader) (string, error) {
 		if _, err := io.Copy(h, src); err != nil {
 			return "", err
 		}
-
-		hash := fmt.Sprintf("%x", h.Sum(nil))
-		pattern = strings.Replace(pattern, "<hash>", hash, 1)
+		pattern = domain.FormatFilenameHash(pattern, fmt.Sprintf("%x", h.Sum(nil)))
 	}
 	return pattern, nil
 }
@@ -101,31 +132,147 @@ func GetFileHandler(providersConfig []domain.StorageProvider, providerId string,
 	}
 
 	if provider.Type == "s3" {
-		parsedStoreUrl, _ := url.Parse(provider.StoreUrl)
-		client, err := minio.New(parsedStoreUrl.Host, &minio.Options{
-			Creds:  credentials.NewStaticV4(provider.AccessKey, provider.SecretKey, ""),
-			Secure: parsedStoreUrl.Scheme == "https",
-		})
-
+		parsedStoreUrl, opts, err := S3ClientOptions(*provider)
+		if err != nil {
+			return nil, err
+		}
+		client, err := minio.New(parsedStoreUrl.Host, opts)
 		if err != nil {
 			return nil, fmt.Errorf("minio: %w", err)
 		}
 
-		return S3FileHandler{*provider, *parsedStoreUrl, client}, nil
+		readUrl := *parsedStoreUrl
+		if provider.ReadUrl != "" {
+			parsedReadUrl, err := url.Parse(provider.ReadUrl)
+			if err != nil || parsedReadUrl.Host == "" {
+				return nil, fmt.Errorf("invalid read url of storage provider '%s'", provider.ID)
+			}
+			readUrl = *parsedReadUrl
+		}
+		return S3FileHandler{Provider: *provider, StoreUrl: *parsedStoreUrl, ReadUrl: readUrl, client: client}, nil
 	}
 
-	return LocalFileHandler{*provider, projectPath, thumbnailsPath}, nil
+	return LocalFileHandler{Provider: *provider, ProjectPath: projectPath, ThumbnailsPath: thumbnailsPath}, nil
+}
+
+// S3ClientOptions returns parsed store URL and minio client options of the S3 storage provider
+func S3ClientOptions(provider domain.StorageProvider) (*url.URL, *minio.Options, error) {
+	parsedStoreUrl, err := url.Parse(provider.StoreUrl)
+	if err != nil || parsedStoreUrl.Host == "" {
+		return nil, nil, fmt.Errorf("invalid store url of storage provider '%s'", provider.ID)
+	}
+	bucketLookup := minio.BucketLookupAuto
+	if provider.PathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+	opts := &minio.Options{
+		Creds:        credentials.NewStaticV4(provider.AccessKey, provider.SecretKey, ""),
+		Secure:       parsedStoreUrl.Scheme == "https",
+		Region:       provider.Region,
+		BucketLookup: bucketLookup,
+	}
+	return parsedStoreUrl, opts, nil
+}
+
+// StorageCheckError describes the failed step of the storage provider check
+type StorageCheckError struct {
+	Step string
+	Err  error
+}
+
+func (e *StorageCheckError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Step, e.Err)
+}
+
+func (e *StorageCheckError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StorageCheckError) ErrorDetails() interface{} {
+	return map[string]string{"step": e.Step, "error": e.Err.Error()}
+}
+
+// CheckS3Provider verifies the S3 storage provider configuration - connection, credentials and
+// bucket access (write, read and delete of a small object).
+func CheckS3Provider(ctx context.Context, provider domain.StorageProvider) error {
+	storeUrl, opts, err := S3ClientOptions(provider)
+	if err != nil {
+		return &StorageCheckError{"config", err}
+	}
+	client, err := minio.New(storeUrl.Host, opts)
+	if err != nil {
+		return &StorageCheckError{"config", err}
+	}
+	exists, err := client.BucketExists(ctx, provider.Bucket)
+	if err != nil {
+		return &StorageCheckError{"connect", err}
+	}
+	if !exists {
+		return &StorageCheckError{"bucket", fmt.Errorf("bucket '%s' does not exist", provider.Bucket)}
+	}
+
+	randBytes := make([]byte, 8)
+	rand.Read(randBytes)
+	objectName := fmt.Sprintf(".gisquick-storage-check-%s", hex.EncodeToString(randBytes))
+	content := []byte("gisquick storage check")
+	if _, err := client.PutObject(ctx, provider.Bucket, objectName, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{}); err != nil {
+		return &StorageCheckError{"write", err}
+	}
+
+	obj, err := client.GetObject(ctx, provider.Bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return &StorageCheckError{"read", err}
+	}
+	data, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return &StorageCheckError{"read", err}
+	}
+	if !bytes.Equal(data, content) {
+		return &StorageCheckError{"read", errors.New("content of the test object does not match")}
+	}
+	if err := client.RemoveObject(ctx, provider.Bucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return &StorageCheckError{"delete", err}
+	}
+	return nil
+}
+
+// GetOrCreateThumbnail returns location of the existing thumbnail of the media image, or creates
+// a new one. Returned location is the URL for handlers with remote source, otherwise local path.
+func GetOrCreateThumbnail(handler FileHandler, filePath string, fit ThumbnailFit, width, height, quality int) (string, bool, error) {
+	if source := handler.GetExistingThumbnail(filePath, fit); source != "" {
+		return source, false, nil
+	}
+	img, err := handler.LoadSourceImage(filePath)
+	if err != nil {
+		return "", false, err
+	}
+	source, err := handler.SaveThumbnail(ResizeThumbnail(img, width, height, fit), filePath, fit, quality)
+	if err != nil {
+		return "", false, err
+	}
+	return source, true, nil
 }
 
 type MediaFileResult struct {
 	domain.ProjectFile
+	*ImageInfo
 	Filename string `json:"filename"`
 }
 
 type S3FileHandler struct {
 	Provider domain.StorageProvider
 	StoreUrl url.URL
-	client   *minio.Client
+	// ReadUrl is used for loading of source images and thumbnails (StoreUrl is used when not set)
+	ReadUrl url.URL
+	client  *minio.Client
+}
+
+func (handler S3FileHandler) readUrl() url.URL {
+	if handler.ReadUrl.Host != "" {
+		return handler.ReadUrl
+	}
+	return handler.StoreUrl
 }
 
 func (handler S3FileHandler) calculateEtag(file io.Reader) (string, error) {
@@ -139,7 +286,6 @@ func (handler S3FileHandler) calculateEtag(file io.Reader) (string, error) {
 
 func (handler S3FileHandler) SaveImage(file io.Reader, fileSize int64, filePath string) (MediaFileResult, error) {
 	ctx := context.Background()
-	newPath := filePath
 
 	var buf bytes.Buffer
 	tee := io.TeeReader(file, &buf)
@@ -148,23 +294,34 @@ func (handler S3FileHandler) SaveImage(file io.Reader, fileSize int64, filePath
 		return MediaFileResult{}, err
 	}
 
-	miniStat, err := handler.client.StatObject(ctx, handler.Provider.Bucket, newPath, minio.StatObjectOptions{})
-	if err == nil {
-		// If there is file with the same hash, add hash to the filename
-		if hash != miniStat.ETag {
-			extension := filepath.Ext(newPath)
-			newPath = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(newPath, extension), hash, extension)
-		}
-	}
-
-	miniInfo, err := handler.client.PutObject(ctx, handler.Provider.Bucket, newPath, &buf, fileSize, minio.PutObjectOptions{})
+	// existing object is replaced by the new file (same as in the project storage)
+	imageInfo := readImageInfo(bytes.NewReader(buf.Bytes()))
+	miniInfo, err := handler.client.PutObject(ctx, handler.Provider.Bucket, filePath, &buf, fileSize, minio.PutObjectOptions{})
 	if err != nil {
 		return MediaFileResult{}, err
 	}
 
 	newFilePath := filepath.Join(handler.Provider.Bucket, miniInfo.Key)
 	fileName := filepath.Base(newFilePath)
-	return MediaFileResult{domain.ProjectFile{Path: newFilePath, Size: fileSize, Hash: hash, Mtime: miniInfo.LastModified.Unix()}, fileName}, nil
+	return MediaFileResult{domain.ProjectFile{Path: newFilePath, Size: fileSize, Hash: hash, Mtime: miniInfo.LastModified.Unix()}, imageInfo, fileName}, nil
+}
+
+func (handler S3FileHandler) SaveFile(file *multipart.FileHeader, directory string) (MediaFileResult, error) {
+	src, err := file.Open()
+	if err != nil {
+		return MediaFileResult{}, fmt.Errorf("reading upload file: %w", err)
+	}
+	defer src.Close()
+
+	objectName, err := ProcessPath(directory, file)
+	if err != nil {
+		return MediaFileResult{}, fmt.Errorf("processing path: %w", err)
+	}
+	fileResult, err := handler.SaveImage(src, file.Size, objectName)
+	if err != nil {
+		return MediaFileResult{}, fmt.Errorf("unable to upload: %w", err)
+	}
+	return fileResult, nil
 }
 
 func (handler S3FileHandler) CheckValidSource(parsedUrl url.URL) bool {
@@ -175,16 +332,16 @@ func (handler S3FileHandler) HasRemoteSource() bool {
 	return true
 }
 
-func (handler S3FileHandler) GetThumbnailPath(filePath string) string {
-	return filepath.Join(filepath.Dir(filePath), "thumbs", filepath.Base(filePath))
+func (handler S3FileHandler) GetThumbnailPath(filePath string, fit ThumbnailFit) string {
+	dir := filepath.Join(filepath.Dir(filePath), "thumbs")
+	if fit != "" && fit != ThumbnailContain {
+		dir = filepath.Join(dir, string(fit))
+	}
+	return filepath.Join(dir, filepath.Base(filePath))
 }
 
 func (handler S3FileHandler) LoadSourceImage(filePath string) (image.Image, error) {
-	sourceUrl := handler.StoreUrl
-	// TODO: this can be removed when storeUrl for loading is the same as storeUrl for uploads
-	if !strings.Contains(filePath, "/web/") {
-		sourceUrl.Host = "cyklomapa-media.s3-eu-west-1.amazonaws.com"
-	}
+	sourceUrl := handler.readUrl()
 	sourceUrl.Path = filePath
 
 	var client = http.Client{}
@@ -193,6 +350,12 @@ func (handler S3FileHandler) LoadSourceImage(filePath string) (image.Image, erro
 		return nil, err
 	}
 	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("loading source image: %w", os.ErrNotExist)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("loading source image: %s", res.Status)
+	}
 	img, err := imaging.Decode(res.Body, imaging.AutoOrientation(true))
 	if err != nil {
 		return nil, err
@@ -200,19 +363,23 @@ func (handler S3FileHandler) LoadSourceImage(filePath string) (image.Image, erro
 	return img, err
 }
 
-func (handler S3FileHandler) GetExistingThumbnail(filePath string) string {
-	newSource := handler.StoreUrl
-	newSource.Path = filepath.Join(handler.Provider.Bucket, handler.GetThumbnailPath(filePath))
+func (handler S3FileHandler) GetExistingThumbnail(filePath string, fit ThumbnailFit) string {
+	newSource := handler.readUrl()
+	newSource.Path = filepath.Join(handler.Provider.Bucket, handler.GetThumbnailPath(filePath, fit))
 
 	res, err := http.Head(newSource.String())
-	if err != nil || res.StatusCode != 200 {
+	if err != nil {
+		return ""
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
 		return ""
 	}
 
 	return newSource.String()
 }
 
-func (handler S3FileHandler) SaveThumbnail(img image.Image, filePath string, quality int) (string, error) {
+func (handler S3FileHandler) SaveThumbnail(img image.Image, filePath string, fit ThumbnailFit, quality int) (string, error) {
 	fileName := filepath.Base(filePath)
 	format, err := imaging.FormatFromFilename(fileName)
 	if err != nil {
@@ -230,18 +397,15 @@ func (handler S3FileHandler) SaveThumbnail(img image.Image, filePath string, qua
 		return "", err
 	}
 
-	thumbnailFilePath := handler.GetThumbnailPath(filePath)
+	thumbnailFilePath := handler.GetThumbnailPath(filePath, fit)
 	fileSize := int64(f.Len())
 	miniinfo, err := handler.client.PutObject(ctx, handler.Provider.Bucket, thumbnailFilePath, f, fileSize, minio.PutObjectOptions{})
 	if err != nil {
 		return "", err
 	}
 
-	newSource := handler.StoreUrl
+	newSource := handler.readUrl()
 	newSource.Path = filepath.Join(miniinfo.Bucket, miniinfo.Key)
-
-	fmt.Println(newSource)
-
 	return newSource.String(), nil
 }
 
@@ -249,10 +413,30 @@ type LocalFileHandler struct {
 	Provider       domain.StorageProvider
 	ProjectPath    string
 	ThumbnailsPath string
+	// SaveProjectFile stores the file into the project (filename patterns are resolved by the storage)
+	SaveProjectFile func(directory, pattern string, r io.Reader, size int64) (domain.ProjectFile, error)
 }
 
-func (handler LocalFileHandler) SaveImage(file io.Reader, fileSize int64, filePath string) (MediaFileResult, error) {
-	return MediaFileResult{}, nil
+func (handler LocalFileHandler) SaveFile(file *multipart.FileHeader, directory string) (MediaFileResult, error) {
+	if handler.SaveProjectFile == nil {
+		return MediaFileResult{}, errors.New("project storage is not configured")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return MediaFileResult{}, fmt.Errorf("reading upload file: %w", err)
+	}
+	defer src.Close()
+
+	finfo, err := handler.SaveProjectFile(directory, file.Filename, src, file.Size)
+	if err != nil {
+		return MediaFileResult{}, err
+	}
+	var imageInfo *ImageInfo
+	if f, err := os.Open(filepath.Join(handler.ProjectPath, finfo.Path)); err == nil {
+		imageInfo = readImageInfo(f)
+		f.Close()
+	}
+	return MediaFileResult{finfo, imageInfo, filepath.Base(finfo.Path)}, nil
 }
 
 func (handler LocalFileHandler) CheckValidSource(parsedUrl url.URL) bool {
@@ -269,9 +453,9 @@ func (handler LocalFileHandler) HasRemoteSource() bool {
 	return false
 }
 
-func (handler LocalFileHandler) GetExistingThumbnail(filePath string) string {
+func (handler LocalFileHandler) GetExistingThumbnail(filePath string, fit ThumbnailFit) string {
 	sourceAbsPath := filepath.Join(handler.ProjectPath, filePath)
-	thumbAbsPath := filepath.Join(handler.ThumbnailsPath, filePath)
+	thumbAbsPath := filepath.Join(handler.ThumbnailsPath, ThumbnailCachePath(filePath, fit))
 	srcFinfo, err := os.Stat(sourceAbsPath)
 	if err != nil {
 		return ""
@@ -296,8 +480,8 @@ func (handler LocalFileHandler) LoadSourceImage(src string) (image.Image, error)
 	return img, err
 }
 
-func (handler LocalFileHandler) SaveThumbnail(img image.Image, filePath string, quality int) (string, error) {
-	thumbAbsPath := filepath.Join(handler.ThumbnailsPath, filePath)
+func (handler LocalFileHandler) SaveThumbnail(img image.Image, filePath string, fit ThumbnailFit, quality int) (string, error) {
+	thumbAbsPath := filepath.Join(handler.ThumbnailsPath, ThumbnailCachePath(filePath, fit))
 	err := os.MkdirAll(filepath.Dir(thumbAbsPath), 0777)
 	if err != nil {
 		return "", err
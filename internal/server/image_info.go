@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ImageInfo holds basic metadata of uploaded image files
+type ImageInfo struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+}
+
+// readImageInfo decodes image dimensions and format from the file header.
+// Returns nil when the content is not a supported image.
+func readImageInfo(r io.Reader) *ImageInfo {
+	br := bufio.NewReaderSize(r, 4096)
+	if header, _ := br.Peek(4096); isAvif(header) {
+		return avifImageInfo(header)
+	}
+	cfg, format, err := image.DecodeConfig(br)
+	if err != nil {
+		return nil
+	}
+	return &ImageInfo{Width: cfg.Width, Height: cfg.Height, Format: format}
+}
+
+func isAvif(header []byte) bool {
+	if len(header) < 12 || !bytes.Equal(header[4:8], []byte("ftyp")) {
+		return false
+	}
+	brand := string(header[8:12])
+	return brand == "avif" || brand == "avis"
+}
+
+// avifImageInfo reads image dimensions from the 'ispe' (image spatial extents)
+// property box, which is located in the metadata at the start of the file.
+func avifImageInfo(header []byte) *ImageInfo {
+	info := &ImageInfo{Format: "avif"}
+	i := bytes.Index(header, []byte("ispe"))
+	// box type is followed by version/flags (4 bytes), width and height (4 bytes each)
+	if i >= 0 && len(header) >= i+16 {
+		info.Width = int(binary.BigEndian.Uint32(header[i+8 : i+12]))
+		info.Height = int(binary.BigEndian.Uint32(header[i+12 : i+16]))
+	}
+	return info
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type geojsonFeature struct {
+	Type       string                 `json:"type"`
+	ID         json.RawMessage        `json:"id,omitempty"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// decodeFeatures reads GeoJSON FeatureCollection from the stream and calls fn for each feature,
+// so that features don't have to be loaded into memory at once
+func decodeFeatures(r io.Reader, fn func(f geojsonFeature) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return errors.New("invalid GeoJSON document")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key, _ := t.(string); key != "features" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+			return errors.New("invalid GeoJSON features")
+		}
+		for dec.More() {
+			var f geojsonFeature
+			if err := dec.Decode(&f); err != nil {
+				return err
+			}
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func csvValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+}
+
+func (s *Server) handleExportLayer() func(c echo.Context) error {
+	client := &http.Client{Timeout: 5 * time.Minute, Transport: s.mapserverTransport}
+
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		layerId := c.Param("layerId")
+		format := c.QueryParam("format")
+		if format == "" {
+			format = "geojson"
+		}
+		if format != "csv" && format != "geojson" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unsupported export format")
+		}
+		pInfo, err := s.projects.GetProjectInfo(projectName)
+		if err != nil {
+			return err
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		layer, err := s.projects.GetLayerConfig(projectName, layerId, user)
+		if err != nil {
+			if errors.Is(err, application.ErrLayerNotExists) {
+				return echo.NewHTTPError(http.StatusNotFound, "Unknown layer").SetInternal(err)
+			}
+			return err
+		}
+		// ExportFields are resolved by layer's export flag and user's attributes permissions
+		if layer.Type != "VectorLayer" || !layer.Permissions.View || len(layer.ExportFields) == 0 {
+			return echo.NewHTTPError(http.StatusForbidden, "Layer export is not permitted")
+		}
+		withGeometry := format == "geojson"
+		if format == "csv" && c.QueryParam("geometry") == "true" {
+			settings, err := s.projects.GetSettings(projectName)
+			if err != nil {
+				return fmt.Errorf("getting project settings: %w", err)
+			}
+			if len(settings.Auth.Roles) > 0 && !settings.UserLayerAttrinutesFlags(user, layerId)["geometry"].Has("export") {
+				return echo.NewHTTPError(http.StatusForbidden, "Geometry export is not permitted")
+			}
+			withGeometry = true
+		}
+		fields := layer.ExportFields
+		propertyNames := fields
+		if withGeometry {
+			propertyNames = append(append([]string{}, fields...), "geometry")
+		}
+
+		target, err := url.Parse(s.Config.MapserverURL)
+		if err != nil {
+			return err
+		}
+		target.RawQuery = url.Values{
+			"MAP":          {s.owsProjectPath(projectName, pInfo.QgisFile)},
+			"SERVICE":      {"WFS"},
+			"VERSION":      {"1.1.0"},
+			"REQUEST":      {"GetFeature"},
+			"TYPENAME":     {layer.Name},
+			"OUTPUTFORMAT": {"GeoJSON"},
+			"PROPERTYNAME": {strings.Join(propertyNames, ",")},
+		}.Encode()
+		req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, target.String(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			s.logger(c).Errorw("fetching layer features", "project", projectName, "layer", layerId, zap.Error(err))
+			return echo.NewHTTPError(http.StatusBadGateway, "Failed to get layer features")
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			s.logger(c).Errorw("fetching layer features", "project", projectName, "layer", layerId, "status", resp.StatusCode)
+			return echo.NewHTTPError(http.StatusBadGateway, "Failed to get layer features")
+		}
+
+		res := c.Response()
+		filename := fmt.Sprintf("%s.%s", layer.Name, format)
+		res.Header().Set(echo.HeaderContentDisposition, ContentDisposition("attachment", filename))
+		// response is streamed, errors after this point can be only logged
+		if format == "csv" {
+			res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+			res.WriteHeader(http.StatusOK)
+			w := csv.NewWriter(res)
+			header := fields
+			if withGeometry {
+				header = propertyNames
+			}
+			w.Write(header)
+			row := make([]string, len(header))
+			err = decodeFeatures(resp.Body, func(f geojsonFeature) error {
+				for i, name := range fields {
+					row[i] = csvValue(f.Properties[name])
+				}
+				if withGeometry {
+					row[len(fields)] = string(f.Geometry)
+				}
+				return w.Write(row)
+			})
+			w.Flush()
+		} else {
+			res.Header().Set(echo.HeaderContentType, "application/geo+json")
+			res.WriteHeader(http.StatusOK)
+			enc := json.NewEncoder(res)
+			io.WriteString(res, `{"type":"FeatureCollection","features":[`)
+			first := true
+			err = decodeFeatures(resp.Body, func(f geojsonFeature) error {
+				properties := make(map[string]interface{}, len(fields))
+				for _, name := range fields {
+					if v, ok := f.Properties[name]; ok {
+						properties[name] = v
+					}
+				}
+				f.Properties = properties
+				if !first {
+					io.WriteString(res, ",")
+				}
+				first = false
+				return enc.Encode(f)
+			})
+			io.WriteString(res, "]}")
+		}
+		if err != nil {
+			s.logger(c).Errorw("exporting layer features", "project", projectName, "layer", layerId, zap.Error(err))
+		}
+		return nil
+	}
+}
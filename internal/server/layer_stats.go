@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type LayerStats struct {
+	FeatureCount *int      `json:"feature_count"`
+	Extent       []float64 `json:"extent,omitempty"` // WGS84 extent
+}
+
+type wfsHitsResponse struct {
+	NumberOfFeatures string `xml:"numberOfFeatures,attr"`
+	NumberMatched    string `xml:"numberMatched,attr"`
+}
+
+type wfsCapabilities struct {
+	FeatureTypes []struct {
+		Name        string `xml:"Name"`
+		BoundingBox struct {
+			LowerCorner string `xml:"LowerCorner"`
+			UpperCorner string `xml:"UpperCorner"`
+		} `xml:"WGS84BoundingBox"`
+	} `xml:"FeatureTypeList>FeatureType"`
+}
+
+func parseCorner(value string) ([]float64, error) {
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid bounding box corner: %s", value)
+	}
+	coords := make([]float64, 2)
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bounding box corner: %s", value)
+		}
+		coords[i] = v
+	}
+	return coords, nil
+}
+
+func (s *Server) fetchWfs(ctx context.Context, client *http.Client, params url.Values, data interface{}) error {
+	target, err := url.Parse(s.Config.MapserverURL)
+	if err != nil {
+		return err
+	}
+	target.RawQuery = params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mapserver responded with status: %d", resp.StatusCode)
+	}
+	return xml.NewDecoder(resp.Body).Decode(data)
+}
+
+func (s *Server) fetchLayerStats(ctx context.Context, client *http.Client, owsProject, typeName string) (LayerStats, error) {
+	stats := LayerStats{}
+	params := url.Values{
+		"MAP":        {owsProject},
+		"SERVICE":    {"WFS"},
+		"VERSION":    {"1.1.0"},
+		"REQUEST":    {"GetFeature"},
+		"TYPENAME":   {typeName},
+		"RESULTTYPE": {"hits"},
+	}
+	var hits wfsHitsResponse
+	if err := s.fetchWfs(ctx, client, params, &hits); err != nil {
+		return stats, fmt.Errorf("fetching features count: %w", err)
+	}
+	countValue := hits.NumberOfFeatures
+	if countValue == "" {
+		countValue = hits.NumberMatched
+	}
+	if count, err := strconv.Atoi(countValue); err == nil {
+		stats.FeatureCount = &count
+	}
+
+	params = url.Values{
+		"MAP":     {owsProject},
+		"SERVICE": {"WFS"},
+		"VERSION": {"1.1.0"},
+		"REQUEST": {"GetCapabilities"},
+	}
+	var capabilities wfsCapabilities
+	if err := s.fetchWfs(ctx, client, params, &capabilities); err != nil {
+		return stats, fmt.Errorf("fetching capabilities: %w", err)
+	}
+	for _, ft := range capabilities.FeatureTypes {
+		if ft.Name != typeName && !strings.HasSuffix(ft.Name, ":"+typeName) {
+			continue
+		}
+		lower, err := parseCorner(ft.BoundingBox.LowerCorner)
+		if err != nil {
+			break
+		}
+		upper, err := parseCorner(ft.BoundingBox.UpperCorner)
+		if err != nil {
+			break
+		}
+		stats.Extent = append(lower, upper...)
+		break
+	}
+	return stats, nil
+}
+
+func (s *Server) handleGetLayerStats() func(c echo.Context) error {
+	client := &http.Client{Timeout: s.Config.MapserverTimeout, Transport: s.mapserverTransport}
+	cache := ttlcache.New(
+		ttlcache.WithTTL[string, LayerStats](time.Minute),
+		ttlcache.WithCapacity[string, LayerStats](500),
+	)
+	go cache.Start()
+	s.onShutdown(cache.Stop)
+
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		layerId := c.Param("layerId")
+		pInfo, err := s.projects.GetProjectInfo(projectName)
+		if err != nil {
+			return err
+		}
+		type LayersMetadata struct {
+			Layers map[string]domain.LayerMeta `json:"layers"`
+		}
+		var meta LayersMetadata
+		if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+			return err
+		}
+		lmeta, ok := meta.Layers[layerId]
+		if !ok || lmeta.Type != "VectorLayer" {
+			return echo.NewHTTPError(http.StatusNotFound, "Unknown vector layer")
+		}
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		if settings.Layers[layerId].Flags.Has("excluded") {
+			return echo.NewHTTPError(http.StatusNotFound, "Unknown vector layer")
+		}
+		// same permissions check as in OWS handler (GetFeature requests)
+		if len(settings.Auth.Roles) > 0 {
+			user, err := s.auth.GetUser(c)
+			if err != nil {
+				return err
+			}
+			if !settings.UserLayerPermissionsFlags(user, layerId).Has("query") {
+				return echo.ErrForbidden
+			}
+		}
+
+		key := projectName + "/" + layerId
+		if item := cache.Get(key); item != nil {
+			return c.JSON(http.StatusOK, item.Value())
+		}
+		owsProject := s.owsProjectPath(projectName, pInfo.QgisFile)
+		stats, err := s.fetchLayerStats(c.Request().Context(), client, owsProject, lmeta.Name)
+		if err != nil {
+			s.logger(c).Errorw("fetching layer stats", "project", projectName, "layer", layerId, zap.Error(err))
+			return echo.NewHTTPError(http.StatusBadGateway, "Failed to get layer statistics")
+		}
+		cache.Set(key, stats, ttlcache.DefaultTTL)
+		return c.JSON(http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// GetLegendGraphic parameters which can be set by the client
+var legendParams = []string{"SCALE", "WIDTH", "HEIGHT", "DPI", "TRANSPARENT", "BBOX", "CRS", "SRS", "LAYERTITLE", "RULE", "SYMBOLWIDTH", "SYMBOLHEIGHT", "ITEMFONTCOLOR"}
+
+type legendImage struct {
+	ContentType string
+	Data        []byte
+}
+
+func (s *Server) fetchLegend(client *http.Client, params url.Values) (legendImage, error) {
+	target, err := url.Parse(s.Config.MapserverURL)
+	if err != nil {
+		return legendImage{}, err
+	}
+	target.RawQuery = params.Encode()
+	resp, err := client.Get(target.String())
+	if err != nil {
+		return legendImage{}, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return legendImage{}, err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	// mapserver can report errors as XML document with 200 status
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(contentType, "image/") {
+		return legendImage{}, &upstreamError{status: resp.StatusCode, message: strings.TrimSpace(string(data))}
+	}
+	return legendImage{ContentType: contentType, Data: data}, nil
+}
+
+func (s *Server) handleGetLegend() func(c echo.Context) error {
+	client := &http.Client{Timeout: s.Config.MapserverTimeout, Transport: s.mapserverTransport}
+	cache := ttlcache.New(
+		ttlcache.WithTTL[string, legendImage](time.Hour),
+		ttlcache.WithCapacity[string, legendImage](500),
+	)
+	go cache.Start()
+	s.onShutdown(cache.Stop)
+
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		layerId := c.Param("layerId")
+		pInfo, err := s.projects.GetProjectInfo(projectName)
+		if err != nil {
+			return err
+		}
+		type LayersMetadata struct {
+			Layers map[string]domain.LayerMeta `json:"layers"`
+		}
+		var meta LayersMetadata
+		if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+			return err
+		}
+		lmeta, ok := meta.Layers[layerId]
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "Unknown layer")
+		}
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		lset := settings.Layers[layerId]
+		if lset.Flags.Has("excluded") || lset.LegendDisabled {
+			return echo.NewHTTPError(http.StatusNotFound, "Unknown layer")
+		}
+		// same permissions check as in OWS handler (GetMap requests)
+		if len(settings.Auth.Roles) > 0 {
+			user, err := s.auth.GetUser(c)
+			if err != nil {
+				return err
+			}
+			if !settings.UserLayerPermissionsFlags(user, layerId).Has("view") {
+				return echo.ErrForbidden
+			}
+		}
+
+		params := url.Values{}
+		query := c.QueryParams()
+		for _, name := range legendParams {
+			for param, values := range query {
+				if strings.EqualFold(param, name) && len(values) > 0 {
+					params.Set(name, values[0])
+				}
+			}
+		}
+		params.Set("SERVICE", "WMS")
+		params.Set("VERSION", "1.3.0")
+		params.Set("REQUEST", "GetLegendGraphic")
+		params.Set("FORMAT", "image/png")
+		params.Set("LAYER", lmeta.Name)
+		params.Set("MAP", s.owsProjectPath(projectName, pInfo.QgisFile))
+
+		// cached images are invalidated by any project update (settings, files or metadata)
+		key := fmt.Sprintf("%s/%s/%d?%s", projectName, layerId, pInfo.LastUpdate.UnixNano(), params.Encode())
+		if item := cache.Get(key); item != nil {
+			legend := item.Value()
+			return c.Blob(http.StatusOK, legend.ContentType, legend.Data)
+		}
+		legend, err := s.fetchLegend(client, params)
+		if err != nil {
+			s.logger(c).Errorw("fetching layer legend", "project", projectName, "layer", layerId, zap.Error(err))
+			return mapserverHTTPError(err)
+		}
+		cache.Set(key, legend, ttlcache.DefaultTTL)
+		return c.Blob(http.StatusOK, legend.ContentType, legend.Data)
+	}
+}
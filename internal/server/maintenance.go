@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// how long is the maintenance state cached before it's reloaded from the store (state
+// changed on another server instance is applied with this delay)
+const maintenanceRefreshInterval = 5 * time.Second
+
+// suggested delay (Retry-After header) of the requests rejected in maintenance mode
+const maintenanceRetryAfter = 60 * time.Second
+
+// maintenanceState provides cached maintenance state, so that the store isn't accessed
+// on every request
+type maintenanceState struct {
+	log     *zap.SugaredLogger
+	store   application.MaintenanceStore
+	mu      sync.Mutex
+	state   application.MaintenanceState
+	checked time.Time
+}
+
+func newMaintenanceState(log *zap.SugaredLogger, store application.MaintenanceStore) *maintenanceState {
+	return &maintenanceState{log: log, store: store}
+}
+
+// Get returns current maintenance state. When the store is not available, the last known
+// state is used.
+func (m *maintenanceState) Get(ctx context.Context) application.MaintenanceState {
+	if m == nil || m.store == nil {
+		return application.MaintenanceState{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.checked) < maintenanceRefreshInterval {
+		return m.state
+	}
+	state, err := m.store.Get(ctx)
+	if err != nil {
+		m.log.Warnw("reading maintenance state", zap.Error(err))
+	} else {
+		m.state = state
+	}
+	m.checked = time.Now()
+	return m.state
+}
+
+func (m *maintenanceState) Set(ctx context.Context, state application.MaintenanceState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.store.Set(ctx, state); err != nil {
+		return err
+	}
+	m.state = state
+	m.checked = time.Now()
+	return nil
+}
+
+// maintenanceError is returned to non-superusers while maintenance mode is active
+func maintenanceError(state application.MaintenanceState) *APIError {
+	msg := state.Message
+	if msg == "" {
+		msg = "Server is under maintenance, please try again later"
+	}
+	return &APIError{Status: http.StatusServiceUnavailable, Code: "maintenance", Message: msg, Details: state}
+}
+
+func (s *Server) handleGetMaintenance(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.maintenance.Get(c.Request().Context()))
+}
+
+func (s *Server) handleSetMaintenance() func(echo.Context) error {
+	type Request struct {
+		Mode    string `json:"mode"`
+		Message string `json:"message"`
+	}
+	return func(c echo.Context) error {
+		req := c.Request()
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
+		defer req.Body.Close()
+
+		var data Request
+		if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		var state application.MaintenanceState
+		switch data.Mode {
+		case application.MaintenanceOff, "off":
+		case application.MaintenanceReadOnly, application.MaintenanceBlocked:
+			state = application.MaintenanceState{
+				Mode:    data.Mode,
+				Message: data.Message,
+				Since:   time.Now().UTC(),
+				User:    user.Username,
+			}
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid maintenance mode")
+		}
+		if err := s.maintenance.Set(req.Context(), state); err != nil {
+			return fmt.Errorf("saving maintenance state: %w", err)
+		}
+		s.log.Infow("maintenance mode", "mode", state.Mode, "user", user.Username)
+		if s.sws != nil {
+			s.sws.AppChannel().Broadcast("Maintenance", state)
+		}
+		return c.JSON(http.StatusOK, state)
+	}
+}
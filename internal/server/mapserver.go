@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const reloadRetryBackoff = 500 * time.Millisecond
+
+// newMapserverTransport creates HTTP transport shared by all requests to the mapserver,
+// so that connections are reused instead of opened for every proxied request
+func newMapserverTransport(cfg Config) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.MapserverDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          cfg.MapserverMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MapserverMaxIdleConns,
+		MaxConnsPerHost:       cfg.MapserverMaxConns,
+		IdleConnTimeout:       cfg.MapserverIdleConnTimeout,
+		ResponseHeaderTimeout: cfg.MapserverResponseTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// owsProjectPath returns the path of the project file as seen by the mapserver (MAP parameter)
+func (s *Server) owsProjectPath(projectName, qgisFile string) string {
+	return filepath.Join(s.Config.PublishRoot, projectName, qgisFile)
+}
+
+type upstreamError struct {
+	status  int
+	message string
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("mapserver responded with status %d: %s", e.status, e.message)
+}
+
+// temporary errors worth to retry
+func isTransientUpstreamError(err error) bool {
+	var ue *upstreamError
+	if errors.As(err, &ue) {
+		return ue.status == http.StatusBadGateway || ue.status == http.StatusServiceUnavailable || ue.status == http.StatusGatewayTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+func (s *Server) requestProjectReload(ctx context.Context, client *http.Client, owsProject string) error {
+	req, err := http.NewRequestWithContext(withMapserverRequestType(ctx, "reload"), http.MethodPost, s.Config.MapserverURL, nil)
+	if err != nil {
+		return fmt.Errorf("building request: %w", err)
+	}
+	req.URL.Path = filepath.Join(req.URL.Path, "/reload")
+	req.URL.RawQuery = url.Values{"MAP": {owsProject}}.Encode()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &upstreamError{status: resp.StatusCode, message: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+// reloadMapserverProject asks mapserver to reload project file, transient failures are retried
+// with exponential backoff (up to Config.MapserverRetries times).
+func (s *Server) reloadMapserverProject(ctx context.Context, owsProject string) error {
+	client := &http.Client{Timeout: s.Config.MapserverTimeout, Transport: s.mapserverTransport}
+	var err error
+	for attempt := 0; attempt <= s.Config.MapserverRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(reloadRetryBackoff << (attempt - 1)):
+			}
+		}
+		err = s.requestProjectReload(ctx, client, owsProject)
+		if err == nil || !isTransientUpstreamError(err) {
+			return err
+		}
+		s.log.Warnw("mapserver reload failed", "map", owsProject, "attempt", attempt+1, "error", err)
+	}
+	return err
+}
+
+// owsRequestService returns OWS service of the proxied request (empty for non OWS requests),
+// POST requests with XML body (e.g. WFS transactions) are expected to be WFS requests
+func owsRequestService(r *http.Request) string {
+	for name, values := range r.URL.Query() {
+		if strings.EqualFold(name, "SERVICE") && len(values) > 0 {
+			return strings.ToUpper(values[0])
+		}
+	}
+	if r.Method == http.MethodPost && strings.Contains(r.Header.Get("Content-Type"), "xml") {
+		return "WFS"
+	}
+	return ""
+}
+
+// mapserverProxyErrorHandler writes error response of the mapserver reverse proxy when
+// the mapserver is unreachable, the error document matches the requested service
+// (OGC exception report for OWS requests, JSON otherwise) and contains request ID.
+func (s *Server) mapserverProxyErrorHandler(rw http.ResponseWriter, r *http.Request, err error) {
+	log := requestLogger(r, s.log)
+	if errors.Is(err, context.Canceled) {
+		log.Infow("mapserver proxy request canceled", zap.Error(err))
+		return
+	}
+	log.Errorw("mapserver proxy error", zap.Error(err))
+
+	status := http.StatusBadGateway
+	code := "mapserver_unavailable"
+	msg := "Mapserver is not available"
+	if isTimeoutError(err) {
+		status = http.StatusGatewayTimeout
+		code = "mapserver_timeout"
+		msg = "Mapserver request timed out"
+	}
+	if s.Config.MapserverErrorDetails {
+		msg = fmt.Sprintf("%s: %s", msg, err)
+	}
+	rid := r.Header.Get(echo.HeaderXRequestID)
+
+	var body []byte
+	switch owsRequestService(r) {
+	case "":
+		apiErr := &APIError{Status: status, Code: code, Message: msg, Details: map[string]string{"request_id": rid}}
+		body, _ = json.Marshal(errorResponse{apiErr})
+		rw.Header().Set("Content-Type", echo.MIMEApplicationJSONCharsetUTF8)
+	case "WMS":
+		body = []byte(fmt.Sprintf(
+			`<?xml version="1.0" encoding="UTF-8"?>
+<ServiceExceptionReport version="1.3.0" xmlns="http://www.opengis.net/ogc">
+  <ServiceException code="%s">%s (request ID: %s)</ServiceException>
+</ServiceExceptionReport>
+`, code, html.EscapeString(msg), html.EscapeString(rid)))
+		rw.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	default:
+		body = []byte(fmt.Sprintf(
+			`<?xml version="1.0" encoding="UTF-8"?>
+<ows:ExceptionReport version="2.0.0" xmlns:ows="http://www.opengis.net/ows/1.1">
+  <ows:Exception exceptionCode="NoApplicableCode">
+    <ows:ExceptionText>%s (request ID: %s)</ows:ExceptionText>
+  </ows:Exception>
+</ows:ExceptionReport>
+`, html.EscapeString(msg), html.EscapeString(rid)))
+		rw.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	}
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(status)
+	if _, err := rw.Write(body); err != nil {
+		log.Warnw("writing mapserver proxy error response", zap.Error(err))
+	}
+}
+
+// mapserverHTTPError converts error from mapserver request into HTTP error for the client
+func mapserverHTTPError(err error) error {
+	var ue *upstreamError
+	if errors.As(err, &ue) {
+		msg := ue.message
+		if msg == "" {
+			msg = http.StatusText(ue.status)
+		}
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Mapserver error: %s", msg)).SetInternal(err)
+	}
+	if isTimeoutError(err) {
+		return echo.NewHTTPError(http.StatusGatewayTimeout, "Mapserver request timed out").SetInternal(err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Mapserver request failed: %s", err)).SetInternal(err)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	MapserverRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mapserver_request_duration_seconds",
+		Help:    "Duration of requests to the mapserver (until the response body is consumed).",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"type", "status"})
+
+	MapserverResponseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mapserver_response_size_bytes",
+		Help:    "Size of mapserver response bodies.",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+	}, []string{"type"})
+)
+
+// OWS request types used as metrics labels, other values of the REQUEST parameter are
+// reported as 'other' to keep the labels cardinality bounded
+var owsRequestTypes = []string{
+	"GetMap",
+	"GetFeatureInfo",
+	"GetLegendGraphic",
+	"GetCapabilities",
+	"GetPrint",
+	"GetFeature",
+	"DescribeFeatureType",
+	"Transaction",
+	"GetProjectSettings",
+	"GetStyles",
+}
+
+type mapserverRequestTypeKey struct{}
+
+// withMapserverRequestType tags outgoing mapserver requests made with the context by
+// the given type (used instead of the OWS REQUEST parameter)
+func withMapserverRequestType(ctx context.Context, requestType string) context.Context {
+	return context.WithValue(ctx, mapserverRequestTypeKey{}, requestType)
+}
+
+// MapserverRequestType returns the metrics label of the mapserver request
+func MapserverRequestType(r *http.Request) string {
+	if t, ok := r.Context().Value(mapserverRequestTypeKey{}).(string); ok {
+		return t
+	}
+	for name, values := range r.URL.Query() {
+		if strings.EqualFold(name, "REQUEST") && len(values) > 0 {
+			for _, t := range owsRequestTypes {
+				if strings.EqualFold(values[0], t) {
+					return t
+				}
+			}
+			return "other"
+		}
+	}
+	if owsRequestService(r) == "WFS" {
+		return "Transaction"
+	}
+	return "other"
+}
+
+// mapserverMetricsTransport records latency, status and size of mapserver responses
+type mapserverMetricsTransport struct {
+	next http.RoundTripper
+}
+
+// NewMapserverMetricsTransport wraps transport used for mapserver requests with metrics collection
+func NewMapserverMetricsTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &mapserverMetricsTransport{next: next}
+}
+
+func (t *mapserverMetricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	requestType := MapserverRequestType(r)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		MapserverRequestDuration.WithLabelValues(requestType, "error").Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+	resp.Body = &meteredBody{
+		ReadCloser:  resp.Body,
+		start:       start,
+		requestType: requestType,
+		status:      strconv.Itoa(resp.StatusCode),
+	}
+	return resp, nil
+}
+
+// meteredBody observes the metrics when the response body is closed
+type meteredBody struct {
+	io.ReadCloser
+	start       time.Time
+	requestType string
+	status      string
+	size        int64
+	once        sync.Once
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	return n, err
+}
+
+func (b *meteredBody) Close() error {
+	b.once.Do(func() {
+		MapserverRequestDuration.WithLabelValues(b.requestType, b.status).Observe(time.Since(b.start).Seconds())
+		MapserverResponseSize.WithLabelValues(b.requestType).Observe(float64(b.size))
+	})
+	return b.ReadCloser.Close()
+}
@@ -2,18 +2,236 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
 	"github.com/gisquick/gisquick-server/internal/server/auth"
 	"github.com/go-redis/redis/v8"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
+type loggerContextKey struct{}
+
+func generateRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+const maxRequestIDLength = 64
+
+// validRequestID checks request ID sent by the client, it's written into logs and
+// response headers, so only short IDs with safe characters are accepted
+func validRequestID(rid string) bool {
+	if rid == "" || len(rid) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range rid {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDMiddleware reads X-Request-ID header (or generates a new ID when it's missing
+// or invalid) and attaches a logger with request_id field to the request
+func RequestIDMiddleware(log *zap.SugaredLogger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			rid := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(rid) {
+				rid = generateRequestID()
+				// will be forwarded by reverse proxies
+				req.Header.Set(echo.HeaderXRequestID, rid)
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, rid)
+			reqLog := log.With("request_id", rid)
+			c.Set("request_id", rid)
+			c.Set("logger", reqLog)
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), loggerContextKey{}, reqLog)))
+			return next(c)
+		}
+	}
+}
+
+// requestLogger returns logger of the given request (with request_id field) or
+// the fallback logger
+func requestLogger(r *http.Request, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	if log, ok := r.Context().Value(loggerContextKey{}).(*zap.SugaredLogger); ok {
+		return log
+	}
+	return fallback
+}
+
+func (s *Server) logger(c echo.Context) *zap.SugaredLogger {
+	if log, ok := c.Get("logger").(*zap.SugaredLogger); ok {
+		return log
+	}
+	return s.log
+}
+
+const frameAncestorsKey = "frame_ancestors"
+
+// setFrameAncestors overrides the default iframe embedding policy of the response
+// (e.g. by project settings)
+func setFrameAncestors(c echo.Context, origins []string) {
+	c.Set(frameAncestorsKey, origins)
+}
+
+// withFrameAncestors replaces frame-ancestors directive of the content security policy
+func withFrameAncestors(csp string, origins []string) string {
+	directives := []string{}
+	for _, d := range strings.Split(csp, ";") {
+		d = strings.TrimSpace(d)
+		if d == "" || strings.HasPrefix(strings.ToLower(d), "frame-ancestors") {
+			continue
+		}
+		directives = append(directives, d)
+	}
+	sources := append([]string{"'self'"}, origins...)
+	directives = append(directives, "frame-ancestors "+strings.Join(sources, " "))
+	return strings.Join(directives, "; ")
+}
+
+// ProjectEmbeddingMiddleware allows embedding of the project's map in iframes by origins
+// listed in project settings
+func ProjectEmbeddingMiddleware(projects application.ProjectService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			settings, err := projects.GetSettings(getProjectName(c))
+			if err == nil && len(settings.EmbedAllowedOrigins) > 0 {
+				setFrameAncestors(c, settings.EmbedAllowedOrigins)
+			}
+			return next(c)
+		}
+	}
+}
+
+// SecurityHeadersMiddleware sets security related headers of responses. Headers are set
+// just before the response is written, so handlers can override frame embedding policy
+// with setFrameAncestors.
+func SecurityHeadersMiddleware(cfg Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			res.Before(func() {
+				h := res.Header()
+				h.Set("X-Content-Type-Options", "nosniff")
+				if cfg.ReferrerPolicy != "" {
+					h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+				}
+				csp := cfg.ContentSecurityPolicy
+				origins := cfg.FrameAllowedOrigins
+				if o, ok := c.Get(frameAncestorsKey).([]string); ok {
+					origins = o
+				}
+				if len(origins) > 0 {
+					csp = withFrameAncestors(csp, origins)
+					h.Del("X-Frame-Options")
+				} else if cfg.FrameOptions != "" {
+					h.Set("X-Frame-Options", cfg.FrameOptions)
+				}
+				if csp != "" {
+					h.Set("Content-Security-Policy", csp)
+				}
+			})
+			return next(c)
+		}
+	}
+}
+
+// routes with long running or streamed responses (uploads, downloads, OWS proxy, websockets),
+// which are not limited by the request timeout
+var streamingRoutePrefixes = []string{
+	"/ws/",
+	"/api/map/",
+	"/api/project/ows/",
+	"/api/project/upload/",
+	"/api/project/download/",
+	"/api/project/file/",
+	"/api/project/inline/",
+	"/api/project/media",
+	"/api/project/script/",
+	"/api/project/thumbnail/",
+	"/plugins/download/",
+}
+
+func isStreamingRoute(path string) bool {
+	for _, prefix := range streamingRoutePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestTimeoutMiddleware sets deadline of the request context (except streaming routes and
+// static files). When the deadline is exceeded before the response was written, 503 error
+// is returned.
+func RequestTimeoutMiddleware(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			path := c.Path()
+			if !strings.HasPrefix(path, "/api/") || isStreamingRoute(path) {
+				return next(c)
+			}
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+			err := next(c)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Response().Committed {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Request timeout").SetInternal(err)
+			}
+			return err
+		}
+	}
+}
+
+// MaintenanceMiddleware rejects API requests of non-superusers with 503 error while
+// maintenance mode is active. Reading requests are still allowed in read-only mode.
+// Authentication and app init endpoints are never blocked, so that superusers can log in
+// and UI can show maintenance state.
+func MaintenanceMiddleware(a *auth.AuthService, state func(ctx context.Context) application.MaintenanceState) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			path := c.Request().URL.Path
+			if !strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/api/auth/") || path == "/api/app" {
+				return next(c)
+			}
+			ms := state(c.Request().Context())
+			if !ms.Active() {
+				return next(c)
+			}
+			if ms.Mode == application.MaintenanceReadOnly {
+				switch c.Request().Method {
+				case http.MethodGet, http.MethodHead, http.MethodOptions:
+					return next(c)
+				}
+			}
+			if user, err := a.GetUser(c); err == nil && user.IsSuperuser {
+				return next(c)
+			}
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+			return maintenanceError(ms)
+		}
+	}
+}
+
 func LoginRequiredMiddlewareWithConfig(a *auth.AuthService) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -78,7 +296,20 @@ func MiddlewareErrorHandler(middleware echo.MiddlewareFunc, cb func(e error, c e
 	}
 }
 
-func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService, basicAuthRealm string) echo.MiddlewareFunc {
+// basicAuthChallenge returns value of WWW-Authenticate header, project title is used as
+// the realm, so it's clear for which project are credentials requested (e.g. in QGIS)
+func basicAuthChallenge(pInfo domain.ProjectInfo, projectName string) string {
+	realm := pInfo.Title
+	if realm == "" {
+		realm = projectName
+	}
+	realm = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", " ").Replace(realm)
+	return fmt.Sprintf(`basic realm="%s", charset="UTF-8"`, realm)
+}
+
+// ProjectAccessMiddleware checks user's access to the project. With basicAuth enabled,
+// WWW-Authenticate header is sent when access is denied (intended for OWS clients).
+func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService, basicAuth bool) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			username := c.Param("user")
@@ -88,12 +319,19 @@ func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService,
 			pInfo, err := ps.GetProjectInfo(projectName)
 			if err != nil {
 				if errors.Is(err, domain.ErrProjectNotExists) {
-					return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+					return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
 				}
 				return fmt.Errorf("[ProjectAccessMiddleware] reading project info: %w", err)
 			}
 			access := false
-			if pInfo.Authentication == "public" {
+			if pInfo.State == domain.ProjectStateHidden {
+				// hidden projects are accessible only by the owner
+				user, err := a.GetUser(c)
+				if err != nil {
+					return fmt.Errorf("[ProjectAccessMiddleware] getting user: %w", err)
+				}
+				access = user.IsAuthenticated && (user.Username == username || user.IsSuperuser)
+			} else if pInfo.Authentication == "public" {
 				access = true
 			} else {
 				user, err := a.GetUser(c)
@@ -117,8 +355,8 @@ func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService,
 			}
 			c.Set("project", projectName)
 			if !access {
-				if basicAuthRealm != "" {
-					c.Response().Header().Set(echo.HeaderWWWAuthenticate, basicAuthRealm)
+				if basicAuth {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, basicAuthChallenge(pInfo, projectName))
 				}
 				return echo.ErrUnauthorized
 			}
@@ -127,6 +365,68 @@ func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService,
 	}
 }
 
+// heldProjectLock is the project lock acquired by the server, it does nothing when project
+// locks are not configured
+type heldProjectLock struct {
+	locks       *project.RedisProjectLocks
+	projectName string
+	lock        *project.ProjectLock
+}
+
+func (l heldProjectLock) Extend(ctx context.Context) error {
+	if l.locks == nil {
+		return nil
+	}
+	return l.locks.Extend(ctx, l.projectName, l.lock, projectLockTTL)
+}
+
+func (l heldProjectLock) Release() error {
+	if l.locks == nil {
+		return nil
+	}
+	return l.locks.Release(context.Background(), l.projectName, l.lock)
+}
+
+// acquireProjectLock locks the project for the operation, returns LockedError when the project
+// is already locked
+func acquireProjectLock(ctx context.Context, locks *project.RedisProjectLocks, projectName, owner, operation string) (heldProjectLock, error) {
+	if locks == nil {
+		return heldProjectLock{}, nil
+	}
+	lock, err := locks.Acquire(ctx, projectName, owner, operation, projectLockTTL)
+	if err != nil {
+		return heldProjectLock{}, err
+	}
+	return heldProjectLock{locks, projectName, lock}, nil
+}
+
+// ProjectUnlockedMiddleware rejects requests modifying the project while it's locked
+// (e.g. during files upload), otherwise the project is locked until the request is handled,
+// so concurrent modifications can't interfere. Must be used after middleware which sets
+// "project" value.
+func ProjectUnlockedMiddleware(locks *project.RedisProjectLocks) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			projectName := c.Get("project").(string)
+			user, _ := c.Get("user").(domain.User)
+			operation := strings.ToLower(c.Request().Method) + " " + c.Path()
+			lock, err := acquireProjectLock(c.Request().Context(), locks, projectName, user.Username, operation)
+			if err != nil {
+				if errors.Is(err, domain.ErrProjectLocked) {
+					return echo.NewHTTPError(http.StatusLocked, "Project is locked by another operation").SetInternal(err)
+				}
+				return fmt.Errorf("[ProjectUnlockedMiddleware] %w", err)
+			}
+			defer func() {
+				if err := lock.Release(); err != nil {
+					c.Logger().Errorf("releasing project lock: %v", err)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
 type SessionStore interface {
 	Get(ctx context.Context, sessionid string) (string, error)
 }
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/gisquick/gisquick-server/internal/domain"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -32,17 +33,35 @@ func (s *Server) handleSaveNotification(c echo.Context) error {
 		if errors.Is(err, project.ErrInvalidDuration) {
 			return echo.NewHTTPError(http.StatusBadRequest, "Invalid expiration")
 		}
+		if errors.Is(err, project.ErrInvalidNotification) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		return fmt.Errorf("saving notification: %w", err)
 	}
+	// only notifications of the settings app are sent to the webapp channel
+	if notification.App == "settings" && notification.IsActive(time.Now()) && s.sws != nil {
+		s.sws.AppChannel().Broadcast("Notification", toUserNotification(notification, ""))
+	}
 	return c.JSON(http.StatusOK, notification)
 }
 
+// handleGetNotifications returns all notifications with their status (admin only, users
+// get their active notifications from handleGetUserNotifications)
 func (s *Server) handleGetNotifications(c echo.Context) error {
+	type NotificationStatus struct {
+		project.Notification
+		Status string `json:"status"`
+	}
 	notifications, err := s.notifications.GetNotifications()
 	if err != nil {
 		return err
 	}
-	return c.JSON(http.StatusOK, notifications)
+	now := time.Now()
+	data := make([]NotificationStatus, len(notifications))
+	for i, n := range notifications {
+		data[i] = NotificationStatus{n, n.Status(now)}
+	}
+	return c.JSON(http.StatusOK, data)
 }
 
 func (s *Server) handleDeleteNotification(c echo.Context) error {
@@ -52,3 +71,96 @@ func (s *Server) handleDeleteNotification(c echo.Context) error {
 	}
 	return c.NoContent(http.StatusOK)
 }
+
+type userNotification struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Message  string `json:"msg"`
+	Severity string `json:"severity"`
+	Read     bool   `json:"read"`
+}
+
+func toUserNotification(n project.Notification, state string) userNotification {
+	severity := n.Severity
+	if severity == "" {
+		severity = project.SeverityInfo
+	}
+	return userNotification{
+		ID:       n.ID,
+		Title:    n.Title,
+		Message:  n.Message,
+		Severity: severity,
+		Read:     state == project.NotificationRead,
+	}
+}
+
+// userNotifications converts notifications into the form sent to the user, notifications
+// dismissed by the user are skipped (state is tracked only for authenticated users)
+func (s *Server) userNotifications(c echo.Context, user domain.User, notifications []project.Notification) []userNotification {
+	var states map[string]string
+	if user.IsAuthenticated {
+		var err error
+		states, err = s.notifications.GetUserStates(c.Request().Context(), user.Username)
+		if err != nil {
+			s.logger(c).Errorw("getting user notifications state", "user", user.Identity(), zap.Error(err))
+		}
+	}
+	messages := make([]userNotification, 0, len(notifications))
+	for _, n := range notifications {
+		state := states[n.ID]
+		if state == project.NotificationDismissed {
+			continue
+		}
+		messages = append(messages, toUserNotification(n, state))
+	}
+	return messages
+}
+
+func (s *Server) handleGetUserNotifications(c echo.Context) error {
+	type Resp struct {
+		Notifications []userNotification `json:"notifications"`
+		Unread        int                `json:"unread"`
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	notifications, err := s.notifications.GetSettingsNotifications("", user)
+	if err != nil {
+		return fmt.Errorf("getting notifications: %w", err)
+	}
+	resp := Resp{Notifications: s.userNotifications(c, user, notifications)}
+	for _, n := range resp.Notifications {
+		if !n.Read {
+			resp.Unread++
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) handleNotificationState(state string) func(echo.Context) error {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		exists, err := s.notifications.NotificationExists(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return echo.NewHTTPError(http.StatusNotFound, "Notification not found")
+		}
+		if state == project.NotificationDismissed {
+			err = s.notifications.Dismiss(ctx, user.Username, id)
+		} else {
+			err = s.notifications.MarkRead(ctx, user.Username, id)
+		}
+		if err != nil {
+			return fmt.Errorf("saving notification state: %w", err)
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
@@ -6,11 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"html"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -109,13 +109,89 @@ func replaceQueryParam(query url.Values, name, value string) {
 	query.Set(name, value)
 }
 
+// crsParams are names of parameters with requested CRS (WMS 1.1.1, WMS 1.3.0 and WFS)
+var crsParams = []string{"SRS", "CRS", "SRSNAME"}
+
+// checkAllowedCRS verifies that CRS requested in the query is in the allowed list (empty list allows all)
+func checkAllowedCRS(query url.Values, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for param, values := range query {
+		for _, name := range crsParams {
+			if !strings.EqualFold(param, name) {
+				continue
+			}
+			for _, crs := range values {
+				if crs == "" {
+					continue
+				}
+				isAllowed := false
+				for _, code := range allowed {
+					if strings.EqualFold(code, crs) {
+						isAllowed = true
+						break
+					}
+				}
+				if !isAllowed {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("CRS %s is not allowed for this project", crs))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// FeaturesCount returns number of features affected by the transaction (update and delete
+// operations are counted as a single feature)
+func (t Transaction) FeaturesCount() int {
+	count := len(t.Updates) + len(t.Deletes)
+	for _, i := range t.Inserts {
+		count += len(i.Objects)
+	}
+	return count
+}
+
+// readWfsTransaction reads and parses WFS transaction from the request body (body is
+// restored for proxying). Transactions exceeding configured limits are rejected.
+func (s *Server) readWfsTransaction(req *http.Request) (*Transaction, error) {
+	maxSize := s.Config.WfsTransactionMaxSize
+	tooLarge := echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("WFS transaction exceeds size limit (%d bytes)", maxSize))
+	var body io.Reader = req.Body
+	if maxSize > 0 {
+		if req.ContentLength > maxSize {
+			return nil, tooLarge
+		}
+		body = io.LimitReader(req.Body, maxSize+1)
+	}
+	// read all bytes from content body and create new stream using it.
+	bodyBytes, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("reading WFS transaction: %w", err)
+	}
+	if maxSize > 0 && int64(len(bodyBytes)) > maxSize {
+		return nil, tooLarge
+	}
+	req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+
+	var transaction Transaction
+	if err := xml.Unmarshal(bodyBytes, &transaction); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid WFS transaction").SetInternal(err)
+	}
+	maxFeatures := s.Config.WfsTransactionMaxFeatures
+	if maxFeatures > 0 && transaction.FeaturesCount() > maxFeatures {
+		return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("WFS transaction exceeds features limit (%d)", maxFeatures))
+	}
+	return &transaction, nil
+}
+
 func (s *Server) handleMapOws() func(c echo.Context) error {
 	/*
 		director := func(req *http.Request) {
 			target, _ := url.Parse(s.Config.MapserverURL)
 			query := req.URL.Query()
 			mapParam := req.URL.Query().Get("MAP")
-			query.Set("MAP", filepath.Join("/publish", mapParam))
+			query.Set("MAP", filepath.Join(s.Config.PublishRoot, mapParam))
 			req.URL.RawQuery = query.Encode()
 			req.URL.Path = target.Path
 			req.URL.Scheme = target.Scheme
@@ -129,7 +205,7 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 	*/
 	director := func(req *http.Request) {
 		target, _ := url.Parse(s.Config.MapserverURL)
-		s.log.Infow("Map proxy", "query", req.URL.RawQuery)
+		requestLogger(req, s.log).Infow("Map proxy", "query", req.URL.RawQuery)
 		req.URL.Path = target.Path
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
@@ -178,9 +254,12 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 		resp.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
 		return nil
 	}
-	reverseProxy := &httputil.ReverseProxy{Director: director}
-	capabilitiesProxy := &httputil.ReverseProxy{Director: director}
+	reverseProxy := &httputil.ReverseProxy{Director: director, Transport: s.mapserverTransport}
+	capabilitiesProxy := &httputil.ReverseProxy{Director: director, Transport: s.mapserverTransport}
+	reverseProxy.ErrorHandler = s.mapserverProxyErrorHandler
+	reverseProxy.ModifyResponse = pruneFeaturesResponse
 	capabilitiesProxy.ModifyResponse = rewriteGetCapabilities
+	capabilitiesProxy.ErrorHandler = s.mapserverProxyErrorHandler
 
 	return func(c echo.Context) error {
 		params := new(OwsRequestParams)
@@ -198,8 +277,16 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 		}
 
 		req := c.Request()
+		// print requests are handled by the print endpoint, which checks templates and layers permissions
+		isPrint, err := isGetPrintRequest(req, params)
+		if err != nil {
+			return err
+		}
+		if isPrint {
+			return echo.NewHTTPError(http.StatusBadRequest, "GetPrint requests are not supported, use print endpoint (/api/map/print)")
+		}
 		// Set MAP parameter
-		owsProject := filepath.Join("/publish", projectName, pInfo.QgisFile)
+		owsProject := s.owsProjectPath(projectName, pInfo.QgisFile)
 		query := req.URL.Query()
 		query.Set("MAP", owsProject)
 
@@ -214,6 +301,30 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 		if err != nil {
 			return fmt.Errorf("getting project settings: %w", err)
 		}
+		if len(settings.LayerAliases) > 0 {
+			ResolveLayerAliases(query, settings.LayerAliases)
+			params.Layers = resolveLayersAliases(params.Layers, settings.LayerAliases)
+			if params.Service == "WFS" && req.Method == "POST" {
+				if err := resolveRequestLayerAliases(req, settings.LayerAliases, s.Config.WfsTransactionMaxSize); err != nil {
+					return err
+				}
+			}
+		}
+		if (params.Service == "WMS" && strings.EqualFold(params.Request, "GetMap")) || (params.Service == "WFS" && strings.EqualFold(params.Request, "GetFeature")) {
+			if err := checkAllowedCRS(query, settings.AllowedCRS); err != nil {
+				return err
+			}
+		}
+		var wfsTransaction *Transaction
+		if params.Service == "WFS" && params.Request == "" && req.Method == "POST" {
+			if err := s.checkProjectWritable(c, settings); err != nil {
+				return err
+			}
+			wfsTransaction, err = s.readWfsTransaction(req)
+			if err != nil {
+				return err
+			}
+		}
 		if len(settings.Auth.Roles) > 0 {
 			user, err := s.auth.GetUser(c)
 			layersPermFlags := make(map[string]domain.Flags)
@@ -261,14 +372,7 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 					return attrsFlags
 				}
 
-				if params.Request == "" && req.Method == "POST" { // GetFeature Insert/Update/Delete
-					var wfsTransaction Transaction
-					// read all bytes from content body and create new stream using it.
-					bodyBytes, _ := ioutil.ReadAll(req.Body)
-					req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
-					if err := xml.Unmarshal(bodyBytes, &wfsTransaction); err != nil {
-						return err
-					}
+				if wfsTransaction != nil { // GetFeature Insert/Update/Delete
 					for _, u := range wfsTransaction.Updates {
 						if !getLayerPermissions(u.TypeName).Has("update") {
 							return echo.ErrForbidden
@@ -308,6 +412,11 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 							return err
 						}
 						bodyModified := false
+						defaultTypeName := ""
+						if len(getFeature.Query) == 1 {
+							defaultTypeName = getFeature.Query[0].TypeName
+						}
+						req = withFeaturesPruner(req, defaultTypeName, getLayerAttributesFlags)
 						for i, q := range getFeature.Query {
 							if !getLayerPermissions(q.TypeName).Has("query") {
 								return echo.ErrForbidden
@@ -355,6 +464,8 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 						if err := (&echo.DefaultBinder{}).BindQueryParams(c, getFeatureParams); err != nil {
 							return echo.NewHTTPError(http.StatusBadRequest, "Invalid GetFeature query parameters")
 						}
+						getFeatureParams.TypeName = resolveLayersAliases(getFeatureParams.TypeName, settings.LayerAliases)
+						getFeatureParams.FeatureID = resolveFeatureIDsAliases(getFeatureParams.FeatureID, settings.LayerAliases)
 						layername := getFeatureParams.TypeName
 						if layername == "" && getFeatureParams.FeatureID != "" {
 							layerNames := strings.Split(getFeatureParams.FeatureID, ",")
@@ -366,6 +477,11 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 						if layername == "" {
 							return echo.ErrBadRequest
 						}
+						defaultTypeName := layername
+						if strings.Contains(layername, ",") {
+							defaultTypeName = ""
+						}
+						req = withFeaturesPruner(req, defaultTypeName, getLayerAttributesFlags)
 
 						if getFeatureParams.PropertyName != "" {
 							// note: no support for multiple layers
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// layersParams are names of OWS parameters with (comma separated) layer names
+var layersParams = []string{"LAYERS", "LAYER", "QUERY_LAYERS", "TYPENAME", "TYPENAMES"}
+
+// typeName attribute of WFS XML requests (GetFeature query, transaction Update/Delete)
+var typeNameAttrRegex = regexp.MustCompile(`(typeNames?\s*=\s*)["']([^"']*)["']`)
+
+// resolveLayerAlias returns name of the layer for the alias, other names are returned
+// unchanged. Namespace prefix of WFS type names is preserved.
+func resolveLayerAlias(name string, aliases map[string]string) string {
+	prefix := ""
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		prefix, name = name[:i+1], name[i+1:]
+	}
+	if layer, ok := aliases[name]; ok {
+		return prefix + layer
+	}
+	return prefix + name
+}
+
+func resolveLayersAliases(layers string, aliases map[string]string) string {
+	if layers == "" {
+		return layers
+	}
+	names := strings.Split(layers, ",")
+	for i, name := range names {
+		names[i] = resolveLayerAlias(name, aliases)
+	}
+	return strings.Join(names, ",")
+}
+
+// resolveFeatureIDsAliases replaces layer aliases in the list of feature IDs (<layer name>.<fid>)
+func resolveFeatureIDsAliases(featureIDs string, aliases map[string]string) string {
+	if featureIDs == "" {
+		return featureIDs
+	}
+	ids := strings.Split(featureIDs, ",")
+	for i, id := range ids {
+		if j := strings.LastIndex(id, "."); j > 0 {
+			ids[i] = resolveLayerAlias(id[:j], aliases) + id[j:]
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+// ResolveLayerAliases replaces layer aliases in the layers parameters and feature IDs
+// of the OWS query
+func ResolveLayerAliases(query url.Values, aliases map[string]string) {
+	for param, values := range query {
+		for _, name := range layersParams {
+			if strings.EqualFold(param, name) {
+				for i, v := range values {
+					values[i] = resolveLayersAliases(v, aliases)
+				}
+			}
+		}
+		if strings.EqualFold(param, "FEATUREID") {
+			for i, v := range values {
+				values[i] = resolveFeatureIDsAliases(v, aliases)
+			}
+		}
+	}
+}
+
+// ResolveXMLLayerAliases replaces layer aliases in typeName attributes of WFS XML request
+// (features inserted by transactions must use the layer names)
+func ResolveXMLLayerAliases(data []byte, aliases map[string]string) []byte {
+	return typeNameAttrRegex.ReplaceAllFunc(data, func(match []byte) []byte {
+		parts := typeNameAttrRegex.FindSubmatch(match)
+		layers := resolveLayersAliases(string(parts[2]), aliases)
+		return []byte(fmt.Sprintf(`%s"%s"`, parts[1], layers))
+	})
+}
+
+// resolveRequestLayerAliases replaces layer aliases in the body of WFS POST request. Requests
+// exceeding max size are left unchanged (rejected later).
+func resolveRequestLayerAliases(req *http.Request, aliases map[string]string, maxSize int64) error {
+	var body io.Reader = req.Body
+	if maxSize > 0 {
+		body = io.LimitReader(req.Body, maxSize+1)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("reading WFS request: %w", err)
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(data), req.Body))
+		return nil
+	}
+	data = ResolveXMLLayerAliases(data, aliases)
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	return nil
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// seconds sent in Retry-After header of rejected requests
+const owsRetryAfter = 5
+
+type projectSlots struct {
+	sem      chan struct{}
+	inFlight int
+	refs     int
+}
+
+// projectsLimiter limits number of concurrent requests per project, slots of
+// the project are created on demand and released when not used anymore.
+type projectsLimiter struct {
+	limit    int
+	mu       sync.Mutex
+	projects map[string]*projectSlots
+}
+
+func newProjectsLimiter(limit int) *projectsLimiter {
+	return &projectsLimiter{limit: limit, projects: make(map[string]*projectSlots)}
+}
+
+func (l *projectsLimiter) unref(key string, p *projectSlots) {
+	p.refs--
+	if p.refs == 0 {
+		delete(l.projects, key)
+	}
+}
+
+// Acquire waits (at most given time) for free slot of the project. Returns function
+// to release the slot, or false when no slot was freed in time.
+func (l *projectsLimiter) Acquire(ctx context.Context, projectName string, wait time.Duration) (func(), bool) {
+	l.mu.Lock()
+	p, exists := l.projects[projectName]
+	if !exists {
+		p = &projectSlots{sem: make(chan struct{}, l.limit)}
+		l.projects[projectName] = p
+	}
+	p.refs++
+	l.mu.Unlock()
+
+	acquired := false
+	select {
+	case p.sem <- struct{}{}:
+		acquired = true
+	default:
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case p.sem <- struct{}{}:
+				acquired = true
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+			timer.Stop()
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !acquired {
+		l.unref(projectName, p)
+		return nil, false
+	}
+	p.inFlight++
+	return func() {
+		<-p.sem
+		l.mu.Lock()
+		p.inFlight--
+		l.unref(projectName, p)
+		l.mu.Unlock()
+	}, true
+}
+
+// InFlight returns number of currently processed requests of the project
+func (l *projectsLimiter) InFlight(projectName string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p, ok := l.projects[projectName]; ok {
+		return p.inFlight
+	}
+	return 0
+}
+
+// OwsConcurrencyMiddleware limits number of concurrent OWS requests of a single project
+// (Config.MapserverProjectConcurrency), so one project cannot starve the shared mapserver.
+// Requests above the limit are queued for Config.MapserverQueueTimeout, then rejected.
+func (s *Server) OwsConcurrencyMiddleware() echo.MiddlewareFunc {
+	if s.Config.MapserverProjectConcurrency <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+	limiter := newProjectsLimiter(s.Config.MapserverProjectConcurrency)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			projectName := getProjectName(c)
+			release, ok := limiter.Acquire(c.Request().Context(), projectName, s.Config.MapserverQueueTimeout)
+			if !ok {
+				if err := c.Request().Context().Err(); err != nil {
+					return err
+				}
+				s.logger(c).Warnw("too many concurrent OWS requests", "project", projectName, "in_flight", limiter.InFlight(projectName))
+				c.Response().Header().Set("Retry-After", strconv.Itoa(owsRetryAfter))
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Too many concurrent map requests, try again later")
+			}
+			defer release()
+			return next(c)
+		}
+	}
+}
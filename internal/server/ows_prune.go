@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+type featuresPrunerKey struct{}
+
+// PruneFeatureCollection copies GeoJSON FeatureCollection from r to w and removes properties
+// of features which are not allowed. Allowed properties are resolved by the feature ID
+// (nil result means that all properties are allowed). Features are processed one by one,
+// so that large responses are never loaded into memory at once.
+func PruneFeatureCollection(r io.Reader, w io.Writer, allowed func(featureID string) map[string]bool) error {
+	dec := json.NewDecoder(r)
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return errors.New("invalid GeoJSON document")
+	}
+	write := func(data []byte) error {
+		_, err := w.Write(data)
+		return err
+	}
+	if err := write([]byte("{")); err != nil {
+		return err
+	}
+	for first := true; dec.More(); first = false {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := t.(string)
+		keyData, _ := json.Marshal(key)
+		if !first {
+			keyData = append([]byte(","), keyData...)
+		}
+		if err := write(append(keyData, ':')); err != nil {
+			return err
+		}
+		if key != "features" {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return err
+			}
+			if err := write(value); err != nil {
+				return err
+			}
+			continue
+		}
+		if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+			return errors.New("invalid GeoJSON features")
+		}
+		if err := write([]byte("[")); err != nil {
+			return err
+		}
+		for i := 0; dec.More(); i++ {
+			var feature map[string]json.RawMessage
+			if err := dec.Decode(&feature); err != nil {
+				return err
+			}
+			if err := pruneFeature(feature, allowed); err != nil {
+				return err
+			}
+			data, err := json.Marshal(feature)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				data = append([]byte(","), data...)
+			}
+			if err := write(data); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		if err := write([]byte("]")); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	return write([]byte("}"))
+}
+
+func pruneFeature(feature map[string]json.RawMessage, allowed func(featureID string) map[string]bool) error {
+	var id string
+	// feature ID can be a number
+	if err := json.Unmarshal(feature["id"], &id); err != nil {
+		id = string(feature["id"])
+	}
+	allowedProperties := allowed(id)
+	if allowedProperties == nil || feature["properties"] == nil {
+		return nil
+	}
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(feature["properties"], &properties); err != nil || properties == nil {
+		return err
+	}
+	for name := range properties {
+		if !allowedProperties[name] {
+			delete(properties, name)
+		}
+	}
+	data, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	feature["properties"] = data
+	return nil
+}
+
+// withFeaturesPruner marks the request, so that properties of the features in GeoJSON response
+// are filtered by attributes permissions. Default type name is used for features without
+// layer name in the ID.
+func withFeaturesPruner(req *http.Request, defaultTypeName string, attrsFlags func(typeName string) map[string]domain.Flags) *http.Request {
+	layersProperties := make(map[string]map[string]bool)
+	allowed := func(featureID string) map[string]bool {
+		// feature ID has format <layer name>.<fid>
+		typeName := defaultTypeName
+		if i := strings.LastIndex(featureID, "."); i > 0 {
+			typeName = featureID[:i]
+		}
+		properties, ok := layersProperties[typeName]
+		if !ok {
+			properties = make(map[string]bool)
+			for name, flags := range attrsFlags(typeName) {
+				if flags.Has("view") {
+					properties[name] = true
+				}
+			}
+			layersProperties[typeName] = properties
+		}
+		return properties
+	}
+	return req.WithContext(context.WithValue(req.Context(), featuresPrunerKey{}, allowed))
+}
+
+// pruneFeaturesResponse streams GeoJSON responses of the requests marked by withFeaturesPruner
+// through PruneFeatureCollection, other responses are passed unchanged
+func pruneFeaturesResponse(resp *http.Response) error {
+	allowed, ok := resp.Request.Context().Value(featuresPrunerKey{}).(func(string) map[string]bool)
+	if !ok || resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return nil
+	}
+	body := resp.Body
+	pr, pw := io.Pipe()
+	go func() {
+		err := PruneFeatureCollection(body, pw, allowed)
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+	resp.Body = pr
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	return nil
+}
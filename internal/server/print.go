@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// isPrintLayersParam matches LAYERS parameters of GetPrint request, including
+// per map item parameters (e.g. "map0:LAYERS")
+func isPrintLayersParam(name string) bool {
+	name = strings.ToUpper(name)
+	return name == "LAYERS" || strings.HasSuffix(name, ":LAYERS")
+}
+
+// isGetPrintRequest checks REQUEST parameter of the OWS request, including parameters
+// sent in the form encoded body (body is restored for proxying)
+func isGetPrintRequest(req *http.Request, params *OwsRequestParams) (bool, error) {
+	if strings.EqualFold(params.Request, "GetPrint") {
+		return true, nil
+	}
+	if req.Method != http.MethodPost || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return false, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, MaxJSONSize+1))
+	if err != nil {
+		return false, fmt.Errorf("reading request body: %w", err)
+	}
+	if int64(len(body)) > MaxJSONSize {
+		return false, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body is too large")
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return false, echo.NewHTTPError(http.StatusBadRequest, "Invalid form data")
+	}
+	for name, values := range form {
+		if strings.EqualFold(name, "REQUEST") && len(values) > 0 && strings.EqualFold(values[0], "GetPrint") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Server) handlePrint() func(c echo.Context) error {
+	client := &http.Client{Timeout: s.Config.MapserverTimeout, Transport: s.mapserverTransport}
+
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		pInfo, err := s.projects.GetProjectInfo(projectName)
+		if err != nil {
+			return err
+		}
+		params, err := c.FormParams()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid print parameters")
+		}
+		var template string
+		for name := range params {
+			if strings.EqualFold(name, "TEMPLATE") {
+				template = params.Get(name)
+			}
+		}
+		if template == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing print template")
+		}
+
+		var meta domain.QgisMeta
+		if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+			return err
+		}
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		rolesPerms := domain.NewUserRolesPermissions(user, settings.Auth)
+		templateFound := false
+		for _, t := range application.UserComposerTemplates(meta.ComposerTemplates, rolesPerms) {
+			if application.ComposerTemplateName(t) == template {
+				templateFound = true
+				break
+			}
+		}
+		if !templateFound {
+			return echo.NewHTTPError(http.StatusForbidden, "Print template is not available")
+		}
+
+		// without layers parameter, mapserver would print all layers
+		hasLayers := false
+		for name, values := range params {
+			if isPrintLayersParam(name) && strings.Join(values, "") != "" {
+				hasLayers = true
+			}
+		}
+		if !hasLayers {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing print layers")
+		}
+
+		// same layers permissions check as in OWS handler (GetMap requests)
+		if rolesPerms != nil {
+			layersData, err := s.projects.GetLayersData(projectName)
+			if err != nil {
+				return fmt.Errorf("getting layer data: %w", err)
+			}
+			for name, values := range params {
+				if !isPrintLayersParam(name) {
+					continue
+				}
+				for _, value := range values {
+					for _, lname := range strings.Split(value, ",") {
+						if lname == "" {
+							continue
+						}
+						id := layersData.LayerNameToID[lname]
+						if !rolesPerms.LayerFlags(id).Has("view") || settings.Layers[id].Flags.Has("excluded") {
+							return echo.ErrForbidden
+						}
+					}
+				}
+			}
+		}
+
+		query := url.Values{}
+		for name, values := range params {
+			if strings.EqualFold(name, "MAP") || strings.EqualFold(name, "REQUEST") || strings.EqualFold(name, "SERVICE") {
+				continue
+			}
+			query[name] = values
+		}
+		query.Set("SERVICE", "WMS")
+		query.Set("REQUEST", "GetPrint")
+		query.Set("MAP", s.owsProjectPath(projectName, pInfo.QgisFile))
+
+		req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodPost, s.Config.MapserverURL, strings.NewReader(query.Encode()))
+		if err != nil {
+			return fmt.Errorf("building print request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		s.logger(c).Infow("Print proxy", "project", projectName, "template", template)
+		resp, err := client.Do(req)
+		if err != nil {
+			return mapserverHTTPError(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := ioutil.ReadAll(resp.Body)
+			return mapserverHTTPError(&upstreamError{status: resp.StatusCode, message: strings.TrimSpace(string(msg))})
+		}
+		if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+			c.Response().Header().Set("Content-Disposition", cd)
+		}
+		return c.Stream(http.StatusOK, resp.Header.Get("Content-Type"), resp.Body)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
@@ -19,12 +20,25 @@ func getProjectName(c echo.Context) string {
 	return filepath.Join(user, name)
 }
 
-func (s *Server) handleGetProject() func(c echo.Context) error {
-	type Notification struct {
-		ID      string `json:"id"`
-		Title   string `json:"title"`
-		Message string `json:"msg"`
+// checkProjectWritable rejects modifications of read-only project, the owner or superuser
+// can bypass it with "force" query parameter (e.g. during maintenance).
+func (s *Server) checkProjectWritable(c echo.Context, settings domain.ProjectSettings) error {
+	if !settings.ReadOnly {
+		return nil
 	}
+	if force, _ := strconv.ParseBool(c.QueryParam("force")); force {
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		if user.IsAuthenticated && (user.IsSuperuser || user.Username == c.Param("user")) {
+			return nil
+		}
+	}
+	return echo.NewHTTPError(http.StatusForbidden, "Project is in read-only mode")
+}
+
+func (s *Server) handleGetProject() func(c echo.Context) error {
 	return func(c echo.Context) error {
 		projectName := getProjectName(c)
 		info, err := s.projects.GetProjectInfo(projectName)
@@ -36,7 +50,7 @@ func (s *Server) handleGetProject() func(c echo.Context) error {
 			}
 			return err
 		}
-		if info.State != "published" {
+		if !info.IsMapAvailable() {
 			return echo.NewHTTPError(http.StatusBadRequest, "Project not valid")
 		}
 
@@ -61,13 +75,7 @@ func (s *Server) handleGetProject() func(c echo.Context) error {
 		if err != nil {
 			s.log.Errorw("getting app notifications", zap.Error(err))
 		} else if len(notifications) > 0 {
-			messages := make([]Notification, len(notifications))
-			for i, n := range notifications {
-				messages[i] = Notification{
-					ID:      n.ID,
-					Title:   n.Title,
-					Message: n.Message,
-				}
+			if messages := s.userNotifications(c, user, notifications); len(messages) > 0 {
 				data["notifications"] = messages
 			}
 		}
@@ -77,6 +85,14 @@ func (s *Server) handleGetProject() func(c echo.Context) error {
 		}
 
 		data["status"] = 200
+		// map config of public projects without roles is the same for all users (unless there are
+		// user's notifications) and can be cached also by the browsers and proxies
+		_, hasNotifications := data["notifications"]
+		if s.Config.MapConfigMaxAge > 0 && info.Authentication == "public" && !hasNotifications && s.projects.IsMapConfigShared(projectName) {
+			c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.Config.MapConfigMaxAge.Seconds())))
+		} else {
+			c.Response().Header().Set("Cache-Control", "private, no-store")
+		}
 		// delete(data, "layers")
 		// return c.JSON(http.StatusOK, data["layers"])
 		return c.JSON(http.StatusOK, data)
@@ -85,7 +101,8 @@ func (s *Server) handleGetProject() func(c echo.Context) error {
 
 func (s *Server) handleGetLayerCapabilities() func(c echo.Context) error {
 	director := func(req *http.Request) {}
-	reverseProxy := &httputil.ReverseProxy{Director: director}
+	reverseProxy := &httputil.ReverseProxy{Director: director, Transport: s.mapserverTransport}
+	reverseProxy.ErrorHandler = s.mapserverProxyErrorHandler
 
 	return func(c echo.Context) error {
 		projectName := c.Get("project").(string)
@@ -129,3 +146,23 @@ func (s *Server) handleGetLayerCapabilities() func(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Unknown LAYER name")
 	}
 }
+
+func (s *Server) handleGetLayer(c echo.Context) error {
+	projectName := getProjectName(c)
+	info, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	if !info.IsMapAvailable() {
+		return echo.NewHTTPError(http.StatusBadRequest, "Project not valid")
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	layer, err := s.projects.GetLayerConfig(projectName, c.Param("layerId"), user)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, layer)
+}
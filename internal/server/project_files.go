@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// ResolveProjectPath returns absolute path of the project file with all symlinks resolved.
+// Files whose resolved path escapes the project directory (e.g. symlinks pointing outside
+// of the project) are reported as not existing.
+func ResolveProjectPath(projectsRoot, projectName, path string) (string, error) {
+	root, err := filepath.EvalSymlinks(filepath.Join(projectsRoot, projectName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", domain.ErrProjectNotExists
+		}
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", domain.ErrFileNotExists
+		}
+		return "", err
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", domain.ErrFileNotExists
+	}
+	return resolved, nil
+}
+
+func (s *Server) projectFilePath(projectName, path string) (string, error) {
+	return ResolveProjectPath(s.Config.ProjectsRoot, projectName, path)
+}
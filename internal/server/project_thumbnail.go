@@ -0,0 +1,137 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	projectThumbnailWidth     = 600
+	projectThumbnailMaxHeight = 600
+)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// ProjectThumbnailParams returns parameters of WMS GetMap request (without MAP parameter) for
+// rendering of the project thumbnail. Thumbnail is rendered in the initial extent with visible
+// overlay layers. Thumbnails are public, so only layers visible to anonymous users are used
+// in projects with roles.
+func ProjectThumbnailParams(meta domain.QgisMeta, settings domain.ProjectSettings) (url.Values, error) {
+	extent := settings.InitialExtent
+	if len(extent) != 4 {
+		extent = settings.Extent
+	}
+	if len(extent) != 4 {
+		extent = meta.Extent
+	}
+	if len(extent) != 4 || extent[2] <= extent[0] || extent[3] <= extent[1] {
+		return nil, errors.New("invalid project extent")
+	}
+	projection := meta.Projection
+	if projection == "" {
+		projection = settings.Projection
+	}
+
+	baseLayers := make(map[string]bool, len(settings.BaseLayers))
+	for _, id := range settings.BaseLayers {
+		baseLayers[id] = true
+	}
+	// layers order is from top to bottom, WMS layers are listed from bottom to top
+	var layers []string
+	for i := len(meta.LayersOrder) - 1; i >= 0; i-- {
+		id := meta.LayersOrder[i]
+		lmeta, ok := meta.Layers[id]
+		lflags := settings.Layers[id].Flags
+		if !ok || !lmeta.Visible || baseLayers[id] || lflags.Has("excluded") || lflags.Has("render_off") {
+			continue
+		}
+		if len(settings.Auth.Roles) > 0 && !settings.UserLayerPermissionsFlags(auth.AnonymousUser, id).Has("view") {
+			continue
+		}
+		layers = append(layers, lmeta.Name)
+	}
+	if len(layers) == 0 {
+		return nil, errors.New("no visible layers")
+	}
+
+	ratio := (extent[3] - extent[1]) / (extent[2] - extent[0])
+	height := int(math.Round(projectThumbnailWidth * ratio))
+	if height < 1 {
+		height = 1
+	} else if height > projectThumbnailMaxHeight {
+		height = projectThumbnailMaxHeight
+	}
+	bbox := make([]string, 4)
+	for i, v := range extent {
+		bbox[i] = formatFloat(v)
+	}
+	return url.Values{
+		"SERVICE":     {"WMS"},
+		"VERSION":     {"1.1.1"},
+		"REQUEST":     {"GetMap"},
+		"LAYERS":      {strings.Join(layers, ",")},
+		"STYLES":      {""},
+		"SRS":         {projection},
+		"BBOX":        {strings.Join(bbox, ",")},
+		"WIDTH":       {strconv.Itoa(projectThumbnailWidth)},
+		"HEIGHT":      {strconv.Itoa(height)},
+		"FORMAT":      {"image/png"},
+		"TRANSPARENT": {"false"},
+	}, nil
+}
+
+// handleRegenerateThumbnail renders a new project thumbnail with the mapserver
+func (s *Server) handleRegenerateThumbnail(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return fmt.Errorf("reading qgis metadata: %w", err)
+	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	params, err := ProjectThumbnailParams(meta, settings)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Cannot render thumbnail: %s", err)).SetInternal(err)
+	}
+	params.Set("MAP", s.owsProjectPath(projectName, pInfo.QgisFile))
+
+	req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, s.Config.MapserverURL, nil)
+	if err != nil {
+		return fmt.Errorf("building thumbnail request: %w", err)
+	}
+	req.URL.RawQuery = params.Encode()
+	client := &http.Client{Timeout: s.Config.MapserverTimeout, Transport: s.mapserverTransport}
+	resp, err := client.Do(req)
+	if err != nil {
+		s.logger(c).Errorw("rendering project thumbnail", "project", projectName, zap.Error(err))
+		return mapserverHTTPError(err)
+	}
+	defer resp.Body.Close()
+	// mapserver reports errors as XML documents (also with status 200)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		s.logger(c).Errorw("rendering project thumbnail", "project", projectName, "status", resp.StatusCode, "content_type", resp.Header.Get("Content-Type"))
+		return echo.NewHTTPError(http.StatusBadGateway, "Failed to render project thumbnail")
+	}
+	if err := s.projects.SaveThumbnail(projectName, resp.Body); err != nil {
+		return fmt.Errorf("saving thumbnail: %w", err)
+	}
+	return c.NoContent(http.StatusOK)
+}
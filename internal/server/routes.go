@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
@@ -15,8 +16,11 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	LoginRequired := LoginRequiredMiddlewareWithConfig(s.auth)
 	SuperuserRequired := SuperuserAccessMiddleware(s.auth)
 	ProjectAdminAccess := ProjectAdminAccessMiddleware(s.auth)
-	ProjectAccess := ProjectAccessMiddleware(s.auth, s.projects, "")
-	ProjectAccessOWS := ProjectAccessMiddleware(s.auth, s.projects, "basic realm=Restricted")
+	ProjectAccess := ProjectAccessMiddleware(s.auth, s.projects, false)
+	ProjectAccessOWS := ProjectAccessMiddleware(s.auth, s.projects, true)
+	ProjectUnlocked := ProjectUnlockedMiddleware(s.projectLocks)
+	OwsConcurrency := s.OwsConcurrencyMiddleware()
+	ProjectEmbedding := ProjectEmbeddingMiddleware(s.projects)
 
 	e.POST("/api/auth/login", s.handleLogin())
 	e.POST("/api/auth/logout", s.handleLogout)
@@ -29,17 +33,29 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	e.GET("/api/admin/users/:user", s.handleGetUser, SuperuserRequired)
 	e.PUT("/api/admin/users/:user", s.handleUpdateUser(), SuperuserRequired)
 	e.DELETE("/api/admin/users/:user", s.handleDeleteUser, SuperuserRequired)
+	e.POST("/api/admin/users/:user/deactivate", s.handleDeactivateUser, SuperuserRequired)
+	e.GET("/api/admin/users/:user/limits", s.handleGetUserLimits, SuperuserRequired)
+	e.PUT("/api/admin/users/:user/limits", s.handleUpdateUserLimits, SuperuserRequired)
 	e.POST("/api/admin/user", s.handleCreateUser(), SuperuserRequired)
+	e.POST("/api/admin/users/import", s.handleImportUsers(), SuperuserRequired)
+	e.GET("/api/admin/projects/recent", s.handleGetRecentProjects(), SuperuserRequired)
+	e.POST("/api/admin/projects/:user/:name/transfer", s.handleTransferProject(), SuperuserRequired, ProjectAdminAccess, ProjectUnlocked)
+	e.DELETE("/api/admin/projects/:user", s.handleDeleteUserProjects(), SuperuserRequired)
 	e.POST("/api/admin/email_preview", s.handleGetEmailPreview(), SuperuserRequired)
 	e.POST("/api/admin/email", s.handleSendEmail(), SuperuserRequired)
 	e.POST("/api/admin/send_activation_email", s.handleSendActivationEmail(), SuperuserRequired)
 	e.GET("/api/admin/notifications", s.handleGetNotifications, SuperuserRequired)
 	e.POST("/api/admin/notification", s.handleSaveNotification, SuperuserRequired)
 	e.DELETE("/api/admin/notification/:id", s.handleDeleteNotification, SuperuserRequired)
+	e.GET("/api/admin/maintenance", s.handleGetMaintenance, SuperuserRequired)
+	e.POST("/api/admin/maintenance", s.handleSetMaintenance(), SuperuserRequired)
 
 	if s.Config.SignupAPI {
 		e.POST("/api/accounts/signup", s.handleSignUp())
 		e.POST("/api/accounts/invite", s.handleInvitation(), SuperuserRequired)
+		e.GET("/api/accounts/invitations", s.handleGetInvitations, SuperuserRequired)
+		e.POST("/api/accounts/invitations/:id/resend", s.handleResendInvitation, SuperuserRequired)
+		e.DELETE("/api/accounts/invitations/:id", s.handleRevokeInvitation, SuperuserRequired)
 		e.POST("/api/accounts/activate", s.handleActivateAccount())
 	}
 	e.GET("/api/accounts/check", s.handleCheckAvailability())
@@ -47,6 +63,9 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	e.POST("/api/accounts/new_password", s.handleNewPassword())
 	e.POST("/api/accounts/change_password", s.handleChangePassword(), LoginRequired)
 	e.GET("/api/account", s.handleGetAccountInfo(), LoginRequired)
+	e.GET("/api/notifications", s.handleGetUserNotifications, LoginRequired)
+	e.POST("/api/notifications/:id/read", s.handleNotificationState(project.NotificationRead), LoginRequired)
+	e.POST("/api/notifications/:id/dismiss", s.handleNotificationState(project.NotificationDismissed), LoginRequired)
 	e.GET("/api/auth/user", s.handleGetSessionUser)
 	e.GET("/api/auth/is_authenticated", s.handleGetSessionUser, LoginRequired)
 	e.GET("/api/auth/is_superuser", s.handleGetSessionUser, SuperuserRequired)
@@ -56,45 +75,66 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	// e.POST("/api/map/project/*", s.handleUpdateProject)
 
 	e.POST("/api/project/:user/:name", s.handleCreateProject(), LoginRequired)
-	e.DELETE("/api/project/:user/:name", s.handleDeleteProject, ProjectAdminAccess)
+	e.DELETE("/api/project/:user/:name", s.handleDeleteProject, ProjectAdminAccess, ProjectUnlocked)
 	e.GET("/api/projects", s.handleGetProjects())
+	e.GET("/api/projects/search", s.handleSearchProjects(), LoginRequired)
 	e.GET("/api/projects/:user", s.handleGetUserProjects, SuperuserRequired)
 	e.POST("/api/project/upload/:user/:name", s.handleUpload(), ProjectAdminAccess)
 
 	e.GET("/api/project/ows/:user/:name", s.handleProjectOws(), ProjectAdminAccess)
 	e.POST("/api/project/ows/:user/:name", s.handleProjectOws(), ProjectAdminAccess)
 	e.GET("/api/project/files/:user/:name", s.handleGetProjectFiles(), ProjectAdminAccess)
-	e.DELETE("/api/project/files/:user/:name", s.handleDeleteProjectFiles(), ProjectAdminAccess)
+	e.GET("/api/project/file-info/:user/:name/*", s.handleGetProjectFileInfo, ProjectAdminAccess)
+	e.POST("/api/project/files-info/:user/:name", s.handleGetProjectFilesInfo(), ProjectAdminAccess)
+	e.POST("/api/project/upload-plan/:user/:name", s.handleUploadPlan(), ProjectAdminAccess)
+	e.GET("/api/project/size-breakdown/:user/:name", s.handleGetProjectSizeBreakdown(), ProjectAdminAccess)
+	e.DELETE("/api/project/files/:user/:name", s.handleDeleteProjectFiles(), ProjectAdminAccess, ProjectUnlocked)
+	e.DELETE("/api/project/temp-files/:user/:name", s.handleRemoveTemporaryFiles, ProjectAdminAccess, ProjectUnlocked)
 	e.GET("/api/project/info/:user/:name", s.handleGetProjectInfo, ProjectAdminAccess)
+	e.POST("/api/project/state/:user/:name", s.handleChangeProjectState(), ProjectAdminAccess, ProjectUnlocked)
 	e.GET("/api/project/full-info/:user/:name", s.handleGetProjectFullInfo(), ProjectAdminAccess)
+	e.GET("/api/project/qgis-meta/:user/:name", s.handleGetQgisMeta, ProjectAdminAccess)
+	e.POST("/api/project/validate-proj4", s.handleValidateProj4(), LoginRequired)
 
-	e.GET("/api/project/media/:user/:name/*", s.mediaFileHandler(s.Config.ThumbnailsRoot), ProjectAccess)
+	mediaHandler := s.mediaFileHandler(s.Config.ThumbnailsRoot)
+	e.GET("/api/project/media/:user/:name/*", mediaHandler, ProjectAccess)
+	e.HEAD("/api/project/media/:user/:name/*", mediaHandler, ProjectAccess)
 	e.GET("/api/project/media/:user/:name/web/app/*", s.appMediaFileHandler)
+	e.HEAD("/api/project/media/:user/:name/web/app/*", s.appMediaFileHandler)
 	e.DELETE("/api/project/media/:user/:name/*", s.handleDeleteMediaFile, ProjectAccess)
+	e.POST("/api/project/media/:user/:name/mkdir", s.handleCreateMediaDirectory(), ProjectAccess)
 	e.POST("/api/project/script/:user/:name", s.handleScriptUpload(), ProjectAdminAccess)
 	e.DELETE("/api/project/script/:user/:name", s.handleDeleteScript(), ProjectAdminAccess)
 
 	e.GET("/api/project/media_file/:user/:name", s.mediaFileHandlerService(), ProjectAccess)
 	e.POST("/api/project/media_file/:user/:name", s.handleUploadMediaFileService, ProjectAccess)
+	e.POST("/api/project/storage/test", s.handleCheckStorageProvider(), SuperuserRequired)
+	e.POST("/api/project/storage/test/:user/:name", s.handleCheckProjectStorageProvider(), ProjectAdminAccess)
 
 	e.GET("/api/project/file/:user/:name/*", s.handleProjectFile, ProjectAdminAccess)
+	e.HEAD("/api/project/file/:user/:name/*", s.handleProjectFile, ProjectAdminAccess)
 	e.GET("/api/project/download/:user/:name", s.handleDownloadProjectFiles, ProjectAdminAccess)
 	e.GET("/api/project/download/:user/:name/*", s.handleDownloadProjectFiles, ProjectAdminAccess)
 	e.GET("/api/project/inline/:user/:name/*", s.handleInlineProjectFile, ProjectAdminAccess)
 
 	e.POST("/api/project/meta/:user/:name", s.handleUpdateProjectMeta(), ProjectAdminAccess)
 
-	e.POST("/api/project/settings/:user/:name", s.handleSaveProjectSettings, ProjectAdminAccess)
+	e.POST("/api/project/settings/:user/:name", s.handleSaveProjectSettings, ProjectAdminAccess, ProjectUnlocked)
+	e.PATCH("/api/project/settings/:user/:name", s.handlePatchProjectSettings, ProjectAdminAccess, ProjectUnlocked)
+	e.GET("/api/project/bookmarks/:user/:name", s.handleGetBookmarksSettings, ProjectAdminAccess)
+	e.PUT("/api/project/bookmarks/:user/:name", s.handleUpdateBookmarksSettings, ProjectAdminAccess, ProjectUnlocked)
 	e.POST("/api/project/thumbnail/:user/:name", s.handleUploadThumbnail, ProjectAdminAccess)
+	e.POST("/api/project/thumbnail/:user/:name/regenerate", s.handleRegenerateThumbnail, ProjectAdminAccess)
 	e.GET("/api/project/thumbnail/:user/:name", s.handleGetThumbnail)
-	e.GET("/api/map/project/:user/:name", s.handleGetProject(), MiddlewareErrorHandler(ProjectAccess, func(e error, c echo.Context) error {
+	e.HEAD("/api/project/thumbnail/:user/:name", s.handleGetThumbnail)
+	e.GET("/api/map/project/:user/:name", s.handleGetProject(), ProjectEmbedding, MiddlewareErrorHandler(ProjectAccess, func(e error, c echo.Context) error {
 		if he, ok := e.(*echo.HTTPError); ok {
 			if he.Code == 401 {
 				projectName := c.Get("project").(string)
 				pInfo, err := s.projects.GetProjectInfo(projectName)
 				if err != nil {
 					if errors.Is(err, domain.ErrProjectNotExists) {
-						return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+						return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
 					}
 					s.log.Errorw("reading project info", zap.Error(err))
 				}
@@ -122,16 +162,22 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 		}
 		return e
 	}))
+	e.GET("/api/map/layer/:user/:name/:layerId", s.handleGetLayer, ProjectAccess)
+	e.GET("/api/map/layer-stats/:user/:name/:layerId", s.handleGetLayerStats(), ProjectAccess)
+	e.GET("/api/map/legend/:user/:name/:layerId", s.handleGetLegend(), ProjectAccess)
+	e.GET("/api/map/export/:user/:name/:layerId", s.handleExportLayer(), ProjectAccess, OwsConcurrency)
 
 	owsHandler := s.handleMapOws()
-	e.GET("/api/map/ows/:user/:name", owsHandler, ProjectAccessOWS)
-	e.POST("/api/map/ows/:user/:name", owsHandler, ProjectAccessOWS)
+	e.GET("/api/map/ows/:user/:name", owsHandler, ProjectEmbedding, ProjectAccessOWS, OwsConcurrency)
+	e.POST("/api/map/ows/:user/:name", owsHandler, ProjectEmbedding, ProjectAccessOWS, OwsConcurrency)
 	e.GET("/api/map/capabilities/:user/:name", s.handleGetLayerCapabilities(), ProjectAccess)
+	e.POST("/api/map/print/:user/:name", s.handlePrint(), ProjectAccess, OwsConcurrency)
 
 	e.POST("/api/project/reload/:user/:name", s.handleProjectReload, ProjectAdminAccess)
 
-	e.GET("/ws/app", s.handleWebAppWS, LoginRequired)
-	e.GET("/ws/plugin", s.handlePluginWS, LoginRequired)
+	// websocket handlers authenticate requests (session or basic auth) before the upgrade
+	e.GET("/ws/app", s.handleWebAppWS)
+	e.GET("/ws/plugin", s.handlePluginWS)
 
 	if s.Config.PluginsURL != "" {
 		// e.GET("/plugins/", s.pythonPluginRepoHandler("/qgis-plugins-repo"))
@@ -149,7 +195,13 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 
 	if s.Config.MapCacheRoot != "" {
 		cachedOwsHandler := s.handleMapCachedOws()
-		e.GET("/api/map/cached_ows/:user/:name", cachedOwsHandler, ProjectAccessOWS)
+		e.GET("/api/map/cached_ows/:user/:name", cachedOwsHandler, ProjectEmbedding, ProjectAccessOWS, OwsConcurrency)
 		e.DELETE("/api/map/cached_ows/:user/:name", s.removeMapCache, ProjectAccessOWS)
 	}
+
+	if s.Config.WebAppRoot != "" {
+		webAppHandler := s.handleWebApp(s.Config.WebAppRoot)
+		e.GET("/", webAppHandler)
+		e.GET("/*", webAppHandler)
+	}
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/ws"
 	"github.com/gisquick/gisquick-server/internal/server/auth"
 	_ "github.com/jackc/pgx/v4/stdlib"
@@ -21,20 +22,45 @@ import (
 )
 
 type Config struct {
-	Debug                bool
-	Language             string
-	LandingProject       string
-	MapserverURL         string
-	MapCacheRoot         string
-	ThumbnailsRoot       string
-	ProjectsRoot         string
-	SiteURL              string
-	SecretKey            string
-	SessionExpiration    time.Duration
-	SignupAPI            bool
-	PluginsURL           string
-	MaxProjectSize       int64
-	ProjectCustomization bool
+	Debug                       bool
+	Language                    string
+	LandingProject              string
+	MapserverURL                string
+	MapserverTimeout            time.Duration
+	MapserverRetries            int
+	MapserverProjectConcurrency int
+	MapserverQueueTimeout       time.Duration
+	MapserverMaxIdleConns       int
+	MapserverMaxConns           int
+	MapserverIdleConnTimeout    time.Duration
+	MapserverDialTimeout        time.Duration
+	MapserverResponseTimeout    time.Duration
+	MapserverErrorDetails       bool
+	PublishRoot                 string
+	MapCacheRoot                string
+	MapCacheImageFormat         string
+	ThumbnailsRoot              string
+	ThumbnailsCacheSize         int64
+	ProjectsRoot                string
+	WebAppRoot                  string
+	TemplatesRoot               string
+	AdminConfigPath             string
+	SiteURL                     string
+	ContentSecurityPolicy       string
+	ReferrerPolicy              string
+	FrameOptions                string
+	FrameAllowedOrigins         []string
+	RequestTimeout              time.Duration
+	MapConfigMaxAge             time.Duration
+	SecretKey                   string
+	SessionExpiration           time.Duration
+	SignupAPI                   bool
+	PluginsURL                  string
+	MaxProjectSize              int64
+	WfsTransactionMaxSize       int64
+	WfsTransactionMaxFeatures   int
+	ActivationEmailInterval     time.Duration
+	ProjectCustomization        bool
 }
 
 var extensions = make(map[string]func(s *Server) error, 0)
@@ -48,8 +74,16 @@ type Server struct {
 	accountsService *application.AccountsService
 	projects        application.ProjectService
 	notifications   *project.RedisNotificationStore
+	projectLocks    *project.RedisProjectLocks
+	emailThrottle   *security.RedisThrottle
+	maintenance     *maintenanceState
 	sws             *ws.SettingsWS
 	limiter         application.AccountsLimiter
+	// shared transport of all mapserver requests
+	mapserverTransport http.RoundTripper
+	thumbnails         *thumbnailsCache
+	// functions called on server shutdown (e.g. stopping of handlers caches)
+	shutdownHooks []func()
 }
 
 type JSONSerializer struct{}
@@ -81,7 +115,9 @@ func (d JSONSerializer) Deserialize(c echo.Context, i interface{}) error {
 
 func NewServer(log *zap.SugaredLogger, cfg Config,
 	as *auth.AuthService, signUpService *application.AccountsService, projects application.ProjectService,
-	sws *ws.SettingsWS, limiter application.AccountsLimiter, notifications *project.RedisNotificationStore) *Server {
+	sws *ws.SettingsWS, limiter application.AccountsLimiter, notifications *project.RedisNotificationStore,
+	projectLocks *project.RedisProjectLocks, emailThrottle *security.RedisThrottle,
+	maintenance application.MaintenanceStore) *Server {
 	e := echo.New()
 	e.HideBanner = true
 
@@ -89,19 +125,12 @@ func NewServer(log *zap.SugaredLogger, cfg Config,
 	p.Use(e)
 
 	// e.JSONSerializer = &JSONSerializer{}
-	e.HTTPErrorHandler = func(err error, c echo.Context) {
-		e.DefaultHTTPErrorHandler(err, c)
-		code := http.StatusInternalServerError
-		if he, ok := err.(*echo.HTTPError); ok {
-			code = he.Code
-		}
-		if code == http.StatusInternalServerError {
-			log.Error(err)
-		}
-	}
+	e.HTTPErrorHandler = newHTTPErrorHandler(log)
 
 	e.Pre(middleware.RemoveTrailingSlash())
 	e.Use(
+		RequestIDMiddleware(log),
+		SecurityHeadersMiddleware(cfg),
 		middleware.Recover(),
 		// middleware.Logger(),
 		middleware.CSRFWithConfig(middleware.CSRFConfig{
@@ -119,16 +148,27 @@ func NewServer(log *zap.SugaredLogger, cfg Config,
 		}),
 		// SessionMiddlewareWithConfig(as.rdb),
 	)
+	if cfg.RequestTimeout > 0 {
+		e.Use(RequestTimeoutMiddleware(cfg.RequestTimeout))
+	}
 	s := &Server{
-		Config:          cfg,
-		log:             log,
-		echo:            e,
-		auth:            as,
-		accountsService: signUpService,
-		projects:        projects,
-		sws:             sws,
-		limiter:         limiter,
-		notifications:   notifications,
+		Config:             cfg,
+		log:                log,
+		echo:               e,
+		auth:               as,
+		accountsService:    signUpService,
+		projects:           projects,
+		sws:                sws,
+		limiter:            limiter,
+		notifications:      notifications,
+		projectLocks:       projectLocks,
+		emailThrottle:      emailThrottle,
+		maintenance:        newMaintenanceState(log, maintenance),
+		mapserverTransport: NewMapserverMetricsTransport(newMapserverTransport(cfg)),
+	}
+	e.Use(MaintenanceMiddleware(as, s.maintenance.Get))
+	if cfg.ThumbnailsRoot != "" && cfg.ThumbnailsCacheSize > 0 {
+		s.thumbnails = newThumbnailsCache(log, cfg.ThumbnailsRoot, cfg.ThumbnailsCacheSize)
 	}
 
 	// e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
@@ -145,8 +185,23 @@ func (s *Server) ListenAndServe(addr string) error {
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.echo.Shutdown(ctx)
+	if wsErr := s.sws.Shutdown(ctx); wsErr != nil {
+		s.log.Warnw("closing websocket connections", zap.Error(wsErr))
+	}
+	for _, fn := range s.shutdownHooks {
+		fn()
+	}
 	s.projects.Close()
-	return s.echo.Shutdown(ctx)
+	if s.thumbnails != nil {
+		s.thumbnails.Close()
+	}
+	return err
+}
+
+// onShutdown registers function to be called on server shutdown
+func (s *Server) onShutdown(fn func()) {
+	s.shutdownHooks = append(s.shutdownHooks, fn)
 }
 
 func (s *Server) AddExtension(name string) error {
@@ -2,13 +2,14 @@ package server
 
 import (
 	"archive/zip"
+	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
@@ -16,12 +17,15 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/jellydator/ttlcache/v3"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 	"golang.org/x/sync/singleflight"
@@ -32,6 +36,9 @@ const MB int64 = 1024 * 1024
 var MaxJSONSize int64 = 1 * MB
 var MaxScriptSize int64 = 5 * MB
 
+// Expiration of the project lock held during files upload (extended while upload is in progress)
+const projectLockTTL = 5 * time.Minute
+
 func (s *Server) handleGetProjectFiles() func(echo.Context) error {
 	type ProjectFiles struct {
 		Files          []domain.ProjectFile `json:"files"`
@@ -42,7 +49,7 @@ func (s *Server) handleGetProjectFiles() func(echo.Context) error {
 		files, tmpFiles, err := s.projects.ListProjectFiles(projectName, true)
 		if err != nil {
 			if errors.Is(err, domain.ErrProjectNotExists) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
 			}
 			return fmt.Errorf("handleGetProjectFiles: %w", err)
 		}
@@ -50,12 +57,35 @@ func (s *Server) handleGetProjectFiles() func(echo.Context) error {
 	}
 }
 
+func (s *Server) handleRemoveTemporaryFiles(c echo.Context) error {
+	type RemovedFiles struct {
+		Removed   []domain.ProjectFile `json:"removed"`
+		Reclaimed int64                `json:"reclaimed"`
+	}
+	projectName := c.Get("project").(string)
+	if !strings.EqualFold(c.QueryParam("confirm"), "true") {
+		return echo.NewHTTPError(http.StatusBadRequest, "Removal of temporary files must be confirmed (confirm=true)")
+	}
+	removed, err := s.projects.RemoveTemporaryFiles(projectName)
+	if err != nil {
+		return err
+	}
+	var reclaimed int64
+	for _, f := range removed {
+		reclaimed += f.Size
+	}
+	s.log.Infow("removed temporary files", "project", projectName, "count", len(removed), "size", reclaimed)
+	return c.JSON(http.StatusOK, RemovedFiles{removed, reclaimed})
+}
+
 type UserDashboard struct {
 	Projects []string `json:"projects"`
 }
 
 func (s *Server) handleGetProjects() func(echo.Context) error {
 	type QueryParams struct {
+		application.ProjectsFilter
+		application.ProjectsPage
 		Projects string `query:"projects"`
 		Filter   string `query:"filter"`
 	}
@@ -66,6 +96,12 @@ func (s *Server) handleGetProjects() func(echo.Context) error {
 		if err := (&echo.DefaultBinder{}).BindQueryParams(c, queryParams); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameters")
 		}
+		if err := queryParams.ProjectsPage.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+		}
+		sendProjects := func(projects []domain.ProjectInfo) error {
+			return s.sendProjectsPage(c, queryParams.ProjectsFilter.Apply(projects), queryParams.ProjectsPage)
+		}
 		if queryParams.Projects != "" {
 			projectsNames = strings.Split(queryParams.Projects, ",")
 		} else {
@@ -82,12 +118,12 @@ func (s *Server) handleGetProjects() func(echo.Context) error {
 			if err == nil {
 				var data UserDashboard
 				if err = json.Unmarshal(content, &data); err != nil {
-					s.log.Warnw("reading user dashboard file", "user", user.Username, zap.Error(err))
+					s.log.Warnw("reading user dashboard file", "user", user.Identity(), zap.Error(err))
 				} else {
 					projectsNames = data.Projects
 				}
 			} else if !errors.Is(err, os.ErrNotExist) {
-				s.log.Warnw("reading user dashboard file", "user", user.Username, zap.Error(err))
+				s.log.Warnw("reading user dashboard file", "user", user.Identity(), zap.Error(err))
 			}
 		}
 		if len(projectsNames) > 0 {
@@ -98,37 +134,116 @@ func (s *Server) handleGetProjects() func(echo.Context) error {
 					data = append(data, p)
 				}
 			}
-			return c.JSON(http.StatusOK, data)
+			return sendProjects(data)
 		}
 		if strings.EqualFold(queryParams.Filter, "accessible") {
 			data, err := s.projects.AccessibleProjects(user.Username, true)
 			if err != nil {
 				return fmt.Errorf("getting list of user accessible projects: %w", err)
 			}
-			return c.JSON(http.StatusOK, data)
+			return sendProjects(data)
 		}
 		data, err := s.projects.GetUserProjects(user.Username)
 		if err != nil {
 			return err
 		}
-		return c.JSON(http.StatusOK, data)
+		return sendProjects(data)
+	}
+}
+
+// sendProjectsPage sends requested page of projects list, with total count in X-Total-Count header
+func (s *Server) sendProjectsPage(c echo.Context, projects []domain.ProjectInfo, page application.ProjectsPage) error {
+	c.Response().Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
+	return c.JSON(http.StatusOK, page.Apply(projects))
+}
+
+func (s *Server) handleSearchProjects() func(echo.Context) error {
+	type QueryParams struct {
+		Query string `query:"q"`
+		Meta  bool   `query:"meta"`
+	}
+	const maxResults = 50
+	cache := ttlcache.New(
+		ttlcache.WithTTL[string, []domain.ProjectInfo](30*time.Second),
+		ttlcache.WithCapacity[string, []domain.ProjectInfo](1000),
+	)
+	go cache.Start()
+	s.onShutdown(cache.Stop)
+
+	return func(c echo.Context) error {
+		var params QueryParams
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, &params); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameters")
+		}
+		params.Query = strings.TrimSpace(params.Query)
+		if len(params.Query) < 2 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Search query is too short")
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s:%t:%s", user.Username, params.Meta, strings.ToLower(params.Query))
+		if item := cache.Get(key); item != nil {
+			return c.JSON(http.StatusOK, item.Value())
+		}
+		projects, err := s.projects.SearchProjects(user.Username, params.Query, params.Meta, maxResults)
+		if err != nil {
+			return fmt.Errorf("searching projects: %w", err)
+		}
+		cache.Set(key, projects, ttlcache.DefaultTTL)
+		return c.JSON(http.StatusOK, projects)
 	}
 }
 
 func (s *Server) handleGetUserProjects(c echo.Context) error {
+	var params struct {
+		application.ProjectsFilter
+		application.ProjectsPage
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameters")
+	}
+	if err := params.ProjectsPage.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
 	username := c.Param("user")
 	data, err := s.projects.GetUserProjects(username)
 	if err != nil {
 		return err
 	}
-	return c.JSON(http.StatusOK, data)
+	return s.sendProjectsPage(c, params.ProjectsFilter.Apply(data), params.ProjectsPage)
+}
+
+func (s *Server) handleChangeProjectState() func(echo.Context) error {
+	type Data struct {
+		State string `json:"state"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		var data Data
+		if err := (&echo.DefaultBinder{}).BindBody(c, &data); err != nil {
+			return err
+		}
+		if data.State != domain.ProjectStatePublished && data.State != domain.ProjectStateHidden {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid state value")
+		}
+		info, err := s.projects.ChangeState(projectName, data.State)
+		if err != nil {
+			if errors.Is(err, domain.ErrInvalidStateChange) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+			}
+			return err
+		}
+		return c.JSON(http.StatusOK, info)
+	}
 }
 
 func (s *Server) handleDeleteProject(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	if err := s.projects.Delete(projectName); err != nil {
 		if errors.Is(err, domain.ErrProjectNotExists) {
-			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
 		}
 		return err
 	}
@@ -159,6 +274,35 @@ func (r *ProgressReader) Close() error {
 	return r.Reader.Close()
 }
 
+// ProgressWriter reports number of written bytes, the writing counterpart of ProgressReader
+type ProgressWriter struct {
+	Writer   io.Writer
+	Callback func(int, int)
+	Step     int
+	Progress int
+	lastVal  int
+}
+
+func (w *ProgressWriter) Write(p []byte) (n int, err error) {
+	n, err = w.Writer.Write(p)
+	w.Progress += n
+	delta := w.Progress - w.lastVal
+	if delta >= w.Step {
+		w.Callback(w.Progress, delta)
+		w.lastVal = w.Progress
+	}
+	return
+}
+
+// Flush reports bytes written after the last reported step, must be called when all data
+// were written (unlike the reader, writer can't detect the end of data)
+func (w *ProgressWriter) Flush() {
+	if delta := w.Progress - w.lastVal; delta > 0 {
+		w.Callback(w.Progress, delta)
+		w.lastVal = w.Progress
+	}
+}
+
 func percProgress(size, total int) int {
 	if total == 0 {
 		return 100
@@ -166,6 +310,21 @@ func percProgress(size, total int) int {
 	return int(100 * (float64(size) / float64(total)))
 }
 
+// uploadPartReader returns reader of the uploaded file content. Files can be sent
+// gzip compressed (with .gz suffix in the filename but not in the form name), such
+// files are transparently decompressed, so declared hash and size are verified
+// against the original file.
+func uploadPartReader(part *multipart.Part) (io.ReadCloser, error) {
+	if strings.HasSuffix(part.FileName(), ".gz") && !strings.HasSuffix(part.FormName(), ".gz") {
+		gr, err := gzip.NewReader(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		return gr, nil
+	}
+	return part, nil
+}
+
 func (s *Server) handleUpload() func(echo.Context) error {
 	type fileUploadProgress struct {
 		Files         map[string]int `json:"files"`
@@ -176,6 +335,7 @@ func (s *Server) handleUpload() func(echo.Context) error {
 	}
 
 	return func(c echo.Context) error {
+		log := s.logger(c)
 		req := c.Request()
 		ctype, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
 		if err != nil || ctype != "multipart/form-data" {
@@ -194,17 +354,40 @@ func (s *Server) handleUpload() func(echo.Context) error {
 		}
 		reader := multipart.NewReader(req.Body, boundary)
 		projectName := c.Get("project").(string)
+		// client which started the upload can choose where to receive progress notifications
+		progressChannels := s.sws.Channels(c.QueryParam("progress_channel"))
+		sendProgress := func(progress fileUploadProgress) {
+			for _, ch := range progressChannels {
+				if err := ch.Send(user.Username, "UploadProgress", progress); err != nil {
+					log.Warnw("sending upload progress", "project", projectName, zap.Error(err))
+				}
+			}
+		}
+
+		lock, err := acquireProjectLock(req.Context(), s.projectLocks, projectName, user.Username, "upload")
+		if err != nil {
+			if errors.Is(err, domain.ErrProjectLocked) {
+				return echo.NewHTTPError(http.StatusLocked, "Project is locked by another operation").SetInternal(err)
+			}
+			return err
+		}
+		defer func() {
+			if err := lock.Release(); err != nil {
+				log.Errorw("releasing project lock", "project", projectName, zap.Error(err))
+			}
+		}()
+		lastLockExtend := time.Now()
 
 		// first part should contain upload info
 		var info uploadInfo
 		part, err := reader.NextPart()
 		if err != nil {
-			s.log.Errorw("uploading files", "project", projectName, zap.Error(err))
+			log.Errorw("uploading files", "project", projectName, zap.Error(err))
 			return err
 		}
 		err = json.NewDecoder(part).Decode(&info)
 		if err != nil {
-			s.log.Errorw("decoding upload metadata", "project", projectName, zap.Error(err))
+			log.Errorw("decoding upload metadata", "project", projectName, zap.Error(err))
 			return err
 		}
 
@@ -223,9 +406,9 @@ func (s *Server) handleUpload() func(echo.Context) error {
 			if err != nil {
 				return "", nil, err
 			}
-			var partReader io.ReadCloser = part
-			if strings.HasSuffix(part.FileName(), ".gz") && !strings.HasSuffix(part.FormName(), ".gz") {
-				partReader, _ = gzip.NewReader(part)
+			partReader, err := uploadPartReader(part)
+			if err != nil {
+				return "", nil, fmt.Errorf("reading file %s: %w", part.FormName(), err)
 			}
 			pr := &ProgressReader{Reader: partReader, Step: 32 * 1024, Callback: func(uploaded, last int) {
 				uploadProgress[part.FormName()] = percProgress(uploaded, uploadSizeMap[part.FormName()])
@@ -234,12 +417,18 @@ func (s *Server) handleUpload() func(echo.Context) error {
 				if now.Sub(lastNotification).Seconds() > 0.5 {
 
 					totalProgress := percProgress(uploadedSize, int(totalSize))
-					s.log.Infow("upload progress", "file", part.FormName(), "uploaded", uploaded, "delta", last, "totalUploaded", uploadedSize, "totalSize", totalSize, "totalProgress", totalProgress)
-					s.sws.AppChannel().Send(user.Username, "UploadProgress", fileUploadProgress{uploadProgress, totalProgress})
+					log.Infow("upload progress", "file", part.FormName(), "uploaded", uploaded, "delta", last, "totalUploaded", uploadedSize, "totalSize", totalSize, "totalProgress", totalProgress)
+					sendProgress(fileUploadProgress{uploadProgress, totalProgress})
 
 					lastNotification = now
 					uploadProgress = make(map[string]int)
 				}
+				if now.Sub(lastLockExtend) > projectLockTTL/3 {
+					if err := lock.Extend(req.Context()); err != nil {
+						log.Warnw("extending project lock", "project", projectName, zap.Error(err))
+					}
+					lastLockExtend = now
+				}
 			}}
 			return part.FormName(), pr, nil
 		}
@@ -247,19 +436,22 @@ func (s *Server) handleUpload() func(echo.Context) error {
 		if _, err := s.projects.UpdateFiles(projectName, changes, nextFile); err != nil {
 			// better check in future release https://github.com/golang/go/issues/30715
 			if errors.Is(err, application.ErrAccountStorageLimit) {
-				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached account storage limit")
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached account storage limit").SetInternal(err)
 			}
 			if errors.Is(err, application.ErrProjectSizeLimit) || err.Error() == "http: request body too large" {
 				// s.log.Warn("uploading files: max limit reached")
-				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.").SetInternal(err)
+			}
+			if errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid compressed file data").SetInternal(err)
 			}
 			return err
 		}
 		// finish reading from stream
 		if _, err := reader.NextPart(); err != io.EOF {
-			s.log.Warnf("expected end of stream", "project", projectName)
+			log.Warnf("expected end of stream", "project", projectName)
 		}
-		s.sws.AppChannel().Send(user.Username, "UploadProgress", fileUploadProgress{uploadProgress, 100})
+		sendProgress(fileUploadProgress{uploadProgress, 100})
 
 		// Ver. 2
 		/*
@@ -301,6 +493,85 @@ func (s *Server) handleUpload() func(echo.Context) error {
 	}
 }
 
+func (s *Server) handleGetProjectFileInfo(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	path := c.Param("*")
+	info, err := s.projects.GetFileInfo(projectName, path)
+	if err != nil {
+		if errors.Is(err, domain.ErrFileNotExists) {
+			return echo.NewHTTPError(http.StatusNotFound, "File does not exists").SetInternal(err)
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+func (s *Server) handleGetProjectFilesInfo() func(echo.Context) error {
+	type Query struct {
+		Paths []string `json:"paths"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		req := c.Request()
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
+		var query Query
+		if err := json.NewDecoder(req.Body).Decode(&query); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		// files not present in the index are omitted
+		files, err := s.projects.GetFilesInfo(projectName, query.Paths...)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, files)
+	}
+}
+
+func (s *Server) handleGetProjectSizeBreakdown() func(echo.Context) error {
+	type Query struct {
+		Depth   int `query:"depth"`
+		Largest int `query:"largest"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		query := Query{Depth: 2, Largest: 20}
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, &query); err != nil {
+			return err
+		}
+		if query.Depth < 1 || query.Largest < 0 || query.Largest > 1000 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid depth or largest parameter")
+		}
+		breakdown, err := s.projects.SizeBreakdown(projectName, query.Depth, query.Largest)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, breakdown)
+	}
+}
+
+func (s *Server) handleUploadPlan() func(echo.Context) error {
+	type Query struct {
+		Files []domain.ProjectFile `json:"files"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		req := c.Request()
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
+		var query Query
+		if err := json.NewDecoder(req.Body).Decode(&query); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		plan, err := s.projects.UploadPlan(projectName, query.Files)
+		if err != nil {
+			if errors.Is(err, domain.ErrProjectNotExists) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
+			}
+			return fmt.Errorf("creating upload plan: %w", err)
+		}
+		return c.JSON(http.StatusOK, plan)
+	}
+}
+
 func (s *Server) handleDeleteProjectFiles() func(echo.Context) error {
 	type FilesInfo struct {
 		Files []string `json:"files"`
@@ -336,7 +607,7 @@ func (s *Server) handleProjectOws() func(echo.Context) error {
 		// query := req.URL.Query()
 		// project := req.URL.Query().Get("MAP")
 		// req.URL.RawQuery = query.Encode()
-		s.log.Infow("Map proxy", "query", req.URL.RawQuery)
+		requestLogger(req, s.log).Infow("Map proxy", "query", req.URL.RawQuery)
 		req.URL.Path = target.Path
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
@@ -346,10 +617,8 @@ func (s *Server) handleProjectOws() func(echo.Context) error {
 			req.Header.Set("User-Agent", "")
 		}
 	}
-	reverseProxy := &httputil.ReverseProxy{Director: director}
-	reverseProxy.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, e error) {
-		s.log.Errorw("mapserver proxy error", zap.Error(e))
-	}
+	reverseProxy := &httputil.ReverseProxy{Director: director, Transport: s.mapserverTransport}
+	reverseProxy.ErrorHandler = s.mapserverProxyErrorHandler
 	// reverseProxy.ErrorLog.SetOutput(os.Stdout)
 	return func(c echo.Context) error {
 		// params := new(RequestParams)
@@ -368,13 +637,12 @@ func (s *Server) handleProjectOws() func(echo.Context) error {
 		p, err := s.projects.GetProjectInfo(projectName)
 		if err != nil {
 			if errors.Is(err, domain.ErrProjectNotExists) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
 			}
 			return err
 		}
-		// TODO: hardcoded /publish/ directory!
-		owsProject := filepath.Join("/publish/", projectName, p.QgisFile)
-		s.log.Infow("GetMap", "ows_project", owsProject)
+		owsProject := s.owsProjectPath(projectName, p.QgisFile)
+		s.logger(c).Infow("GetMap", "ows_project", owsProject)
 		query := c.Request().URL.Query()
 		query.Set("MAP", owsProject)
 		c.Request().URL.RawQuery = query.Encode()
@@ -386,7 +654,6 @@ func (s *Server) handleProjectOws() func(echo.Context) error {
 
 func (s *Server) handleCreateProject() func(echo.Context) error {
 	return func(c echo.Context) error {
-		// TODO: check project folder/index file doesn't exists
 		req := c.Request()
 		req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
 		defer req.Body.Close()
@@ -402,10 +669,13 @@ func (s *Server) handleCreateProject() func(echo.Context) error {
 		info, err := s.projects.Create(projName, data)
 		if err != nil {
 			if errors.Is(err, domain.ErrProjectAlreadyExists) {
-				return echo.NewHTTPError(http.StatusConflict, "Project already exists")
+				return echo.NewHTTPError(http.StatusConflict, "Project already exists").SetInternal(err)
 			}
 			if errors.Is(err, application.ErrAccountProjectsLimit) {
-				return echo.NewHTTPError(http.StatusConflict, "Projects limit was reached")
+				return echo.NewHTTPError(http.StatusConflict, "Projects limit was reached").SetInternal(err)
+			}
+			if errors.Is(err, domain.ErrInvalidProjectName) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid project name, allowed characters are letters, digits, '_', '-' and '.'").SetInternal(err)
 			}
 			return err
 		}
@@ -424,17 +694,19 @@ func (s *Server) handleGetProjectFullInfo() func(echo.Context) error {
 		State      string          `json:"state"`
 		Size       int64           `json:"size"`
 		Thumbnail  bool            `json:"thumbnail"`
+		Tags       []string        `json:"tags,omitempty"`
 		Meta       domain.QgisMeta `json:"meta"`
 		// Meta     json.RawMessage         `json:"meta"`
 		Settings *domain.ProjectSettings `json:"settings"`
 		Scripts  domain.Scripts          `json:"scripts"`
+		Lock     *project.ProjectLock    `json:"lock"`
 	}
 	return func(c echo.Context) error {
 		projectName := c.Get("project").(string)
 		info, err := s.projects.GetProjectInfo(projectName)
 		if err != nil {
 			if errors.Is(err, domain.ErrProjectNotExists) {
-				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
 			}
 			return fmt.Errorf("[handleGetProjectInfo] loading project info: %w", err)
 		}
@@ -456,9 +728,10 @@ func (s *Server) handleGetProjectFullInfo() func(echo.Context) error {
 			State:      info.State,
 			Size:       info.Size,
 			Thumbnail:  info.Thumbnail,
+			Tags:       info.Tags,
 			Meta:       meta,
 		}
-		if info.State != "empty" {
+		if info.State != domain.ProjectStateEmpty {
 			settings, err := s.projects.GetSettings(projectName)
 			if err == nil {
 				data.Settings = &settings
@@ -472,6 +745,14 @@ func (s *Server) handleGetProjectFullInfo() func(echo.Context) error {
 		} else {
 			data.Scripts = scripts
 		}
+		if s.projectLocks != nil {
+			lock, err := s.projectLocks.Get(c.Request().Context(), projectName)
+			if err != nil {
+				s.log.Errorw("[handleGetProjectInfo] reading project lock", "project", projectName, zap.Error(err))
+			} else {
+				data.Lock = lock
+			}
+		}
 		return c.JSON(http.StatusOK, data)
 	}
 }
@@ -481,13 +762,70 @@ func (s *Server) handleGetProjectInfo(c echo.Context) error {
 	info, err := s.projects.GetProjectInfo(projectName)
 	if err != nil {
 		if errors.Is(err, domain.ErrProjectNotExists) {
-			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
 		}
 		return fmt.Errorf("handleGetProjectInfo: %w", err)
 	}
 	return c.JSON(http.StatusOK, info)
 }
 
+func (s *Server) handleValidateProj4() func(echo.Context) error {
+	type Params struct {
+		Proj4 string `json:"proj4" form:"proj4"`
+	}
+	type Resp struct {
+		Valid bool   `json:"valid"`
+		Error string `json:"error,omitempty"`
+	}
+	return func(c echo.Context) error {
+		params := new(Params)
+		if err := c.Bind(params); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := application.ValidateProj4(params.Proj4); err != nil {
+			return c.JSON(http.StatusOK, Resp{Valid: false, Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Resp{Valid: true})
+	}
+}
+
+func (s *Server) handleGetQgisMeta(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	metaPath := s.projects.GetQgisMetaPath(projectName)
+	fields := c.QueryParam("fields")
+	if fields == "" {
+		return c.File(metaPath)
+	}
+	fInfo, err := os.Stat(metaPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return echo.ErrNotFound
+		}
+		return fmt.Errorf("reading qgis meta file: %w", err)
+	}
+	content, err := os.ReadFile(metaPath)
+	if err != nil {
+		return fmt.Errorf("reading qgis meta file: %w", err)
+	}
+	var meta map[string]json.RawMessage
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return fmt.Errorf("parsing qgis meta file: %w", err)
+	}
+	data := make(map[string]json.RawMessage)
+	for _, key := range strings.Split(fields, ",") {
+		if value, ok := meta[strings.TrimSpace(key)]; ok {
+			data[strings.TrimSpace(key)] = value
+		}
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// handles conditional requests (If-Modified-Since) as c.File does
+	http.ServeContent(c.Response(), c.Request(), filepath.Base(metaPath), fInfo.ModTime(), bytes.NewReader(encoded))
+	return nil
+}
+
 func (s *Server) handleUpdateProjectMeta() func(echo.Context) error {
 	return func(c echo.Context) error {
 		projectName := c.Get("project").(string)
@@ -504,7 +842,7 @@ func (s *Server) handleUpdateProjectMeta() func(echo.Context) error {
 		err := s.projects.UpdateMeta(projectName, data)
 		if err != nil {
 			if errors.Is(err, domain.ErrProjectNotExists) {
-				return echo.NewHTTPError(http.StatusConflict, "Project does not exists")
+				return echo.NewHTTPError(http.StatusConflict, "Project does not exists").SetInternal(err)
 			}
 			return err
 		}
@@ -526,7 +864,66 @@ func (s *Server) handleSaveProjectSettings(c echo.Context) error {
 	if err := d.Decode(&data); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
 	}
-	return s.projects.UpdateSettings(projectName, data)
+	if strings.EqualFold(c.QueryParam("validate_only"), "true") {
+		report, err := s.projects.ValidateSettings(projectName, data)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, report)
+	}
+	if err := s.projects.UpdateSettings(projectName, data); err != nil {
+		return err
+	}
+	// cached tiles could reflect old permissions, filters or extent
+	s.invalidateProjectMapCache(projectName)
+	s.notifyProjectReloaded(c, projectName)
+	return c.NoContent(http.StatusOK)
+}
+
+func (s *Server) handlePatchProjectSettings(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
+	var patch json.RawMessage
+	if err := json.NewDecoder(req.Body).Decode(&patch); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	if err := s.projects.PatchSettings(projectName, patch); err != nil {
+		if errors.Is(err, application.ErrInvalidSettings) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+		}
+		return err
+	}
+	s.invalidateProjectMapCache(projectName)
+	s.notifyProjectReloaded(c, projectName)
+	return c.NoContent(http.StatusOK)
+}
+
+func (s *Server) handleGetBookmarksSettings(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	data, err := s.projects.GetBookmarksSettings(projectName)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+func (s *Server) handleUpdateBookmarksSettings(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
+	var data application.BookmarksSettings
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	if err := s.projects.UpdateBookmarksSettings(projectName, data); err != nil {
+		if errors.Is(err, application.ErrInvalidSettings) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+		}
+		return err
+	}
+	s.notifyProjectReloaded(c, projectName)
+	return c.NoContent(http.StatusOK)
 }
 
 func (s *Server) handleUploadThumbnail(c echo.Context) error {
@@ -608,8 +1005,11 @@ func (s *Server) handleScriptUpload() func(echo.Context) error {
 			return path, file, nil
 		}
 		if _, err := s.projects.UpdateFiles(projectName, changes, nextFile); err != nil {
+			if errors.Is(err, application.ErrAccountStorageLimit) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached account storage limit").SetInternal(err)
+			}
 			if errors.Is(err, application.ErrProjectSizeLimit) {
-				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.").SetInternal(err)
 			}
 			return fmt.Errorf("[handleScriptUpload] saving script file: %w", err)
 		}
@@ -653,7 +1053,11 @@ func (s *Server) handleDeleteScript() func(echo.Context) error {
 func (s *Server) handleProjectFile(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	filePath := c.Param("*")
-	return c.File(filepath.Join(s.Config.ProjectsRoot, projectName, filePath))
+	absPath, err := s.projectFilePath(projectName, filePath)
+	if err != nil {
+		return err
+	}
+	return c.File(absPath)
 }
 
 func CopyFile(dest io.Writer, path string) error {
@@ -666,87 +1070,144 @@ func CopyFile(dest io.Writer, path string) error {
 	return err
 }
 
+type downloadProgress struct {
+	Project string `json:"project"`
+	Path    string `json:"path"`
+	Total   int    `json:"total"`
+}
+
 func (s *Server) handleDownloadProjectFiles(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	filePath := c.Param("*")
-	fullPath := filepath.Join(s.Config.ProjectsRoot, projectName, filePath)
-
-	name := filepath.Base(fullPath)
+	name := filepath.Base(filepath.Join(s.Config.ProjectsRoot, projectName, filePath))
+	fullPath, err := s.projectFilePath(projectName, filePath)
+	if err != nil {
+		return err
+	}
 
-	info, err := os.Lstat(fullPath)
+	info, err := os.Stat(fullPath)
 	if err != nil {
 		return fmt.Errorf("getting file info: %w", err)
 	}
 	if info.IsDir() {
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		totalSize := 0
+		err = filepath.WalkDir(fullPath, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.Type().IsRegular() {
+				finfo, err := entry.Info()
+				if err != nil {
+					return err
+				}
+				totalSize += int(finfo.Size())
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("downloading project directory: %w", err)
+		}
+
 		c.Response().Header().Set("Content-Type", "application/octet-stream")
-		c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", name))
+		c.Response().Header().Set(echo.HeaderContentDisposition, ContentDisposition("attachment", name+".zip"))
 		writer := zip.NewWriter(c.Response())
 		defer writer.Close()
 		rootPath := filepath.Dir(fullPath)
-		err := filepath.WalkDir(fullPath, func(path string, entry fs.DirEntry, err error) error {
+		downloadedSize := 0
+		lastNotification := time.Now()
+		notify := func(progress int) {
+			s.sws.AppChannel().Send(user.Username, "DownloadProgress", downloadProgress{Project: projectName, Path: filePath, Total: progress})
+		}
+		err = filepath.WalkDir(fullPath, func(path string, entry fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
-			if !entry.IsDir() {
+			// symlinks are skipped, they could point outside of the project directory
+			if entry.Type().IsRegular() {
 				// relPath2 := path[len(rootPath)+1:]
 				relPath, _ := filepath.Rel(rootPath, path)
 				part, err := writer.Create(relPath)
 				if err != nil {
 					return err
 				}
-				return CopyFile(part, path)
+				pw := &ProgressWriter{Writer: part, Step: 32 * 1024, Callback: func(written, last int) {
+					downloadedSize += last
+					now := time.Now()
+					if now.Sub(lastNotification).Seconds() > 0.5 {
+						notify(percProgress(downloadedSize, totalSize))
+						lastNotification = now
+					}
+				}}
+				if err := CopyFile(pw, path); err != nil {
+					return err
+				}
+				pw.Flush()
 			}
 			return nil
 		})
 		if err != nil {
 			return fmt.Errorf("downloading project directory: %w", err)
 		}
+		notify(100)
 		return nil
 	}
-	return c.Attachment(fullPath, name)
+	return serveFile(c, fullPath, "attachment", name)
 }
 
 func (s *Server) handleInlineProjectFile(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	filePath := c.Param("*")
 	name := filepath.Base(filePath)
-	return c.Inline(filepath.Join(s.Config.ProjectsRoot, projectName, filePath), name)
+	absPath, err := s.projectFilePath(projectName, filePath)
+	if err != nil {
+		return err
+	}
+	return serveFile(c, absPath, "inline", name)
 }
 
 func (s *Server) handleProjectReload(c echo.Context) error {
-	client := &http.Client{}
 	projectName := c.Get("project").(string)
 	p, err := s.projects.GetProjectInfo(projectName)
 	if err != nil {
 		if errors.Is(err, domain.ErrProjectNotExists) {
-			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists").SetInternal(err)
 		}
 		return err
 	}
-	// TODO: hardcoded /publish/ directory!
-	owsProject := filepath.Join("/publish/", projectName, p.QgisFile)
-	params := url.Values{"MAP": {owsProject}}
+	owsProject := s.owsProjectPath(projectName, p.QgisFile)
+	if err := s.reloadMapserverProject(c.Request().Context(), owsProject); err != nil {
+		s.logger(c).Errorw("[handleProjectReload]", "project", projectName, zap.Error(err))
+		return mapserverHTTPError(err)
+	}
+	s.projects.InvalidateMapConfig(projectName)
+	s.InvalidateMapCache(projectName)
+	s.notifyProjectReloaded(c, projectName)
+	return c.NoContent(http.StatusOK)
+}
 
-	req, err := http.NewRequest(http.MethodPost, s.Config.MapserverURL, nil)
+// notifyProjectReloaded informs connected web app of the current user that the project was changed
+func (s *Server) notifyProjectReloaded(c echo.Context, projectName string) {
+	type projectReloaded struct {
+		Project    string    `json:"project"`
+		LastUpdate time.Time `json:"last_update"`
+	}
+	user, err := s.auth.GetUser(c)
 	if err != nil {
-		return fmt.Errorf("[handleProjectReload] building request: %w", err)
+		s.logger(c).Errorw("[notifyProjectReloaded] getting user", zap.Error(err))
+		return
 	}
-	req.URL.Path = filepath.Join(req.URL.Path, "/reload")
-	req.URL.RawQuery = params.Encode()
-	// s.log.Infow("[handleProjectReload]", "project", projectName, "url", req.URL.String())
-
-	resp, err := client.Do(req)
+	info, err := s.projects.GetProjectInfo(projectName)
 	if err != nil {
-		return fmt.Errorf("mapserver request: %w", err)
+		s.logger(c).Errorw("[notifyProjectReloaded] reading project info", "project", projectName, zap.Error(err))
+		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		msg, _ := ioutil.ReadAll(resp.Body)
-		s.log.Errorw("[handleProjectReload]", "project", projectName, "status", resp.StatusCode, "msg", string(msg))
-		return fmt.Errorf("reloading project on qgis server: %s", string(msg))
+	if err := s.sws.AppChannel().Send(user.Username, "ProjectReloaded", projectReloaded{projectName, info.LastUpdate}); err != nil {
+		s.logger(c).Warnw("[notifyProjectReloaded] sending message", "project", projectName, zap.Error(err))
 	}
-	s.InvalidateMapCache(projectName)
-	return c.NoContent(http.StatusOK)
 }
 
 /*
@@ -805,20 +1266,36 @@ func (s *Server) mediaFileHandler(cacheDir string) func(echo.Context) error {
 	return func(c echo.Context) error {
 		projectName := c.Get("project").(string)
 		filePath := c.Param("*")
+		if strings.EqualFold(c.QueryParam("list"), "true") {
+			return s.listMediaDirectory(c, projectName, filePath)
+		}
 		folder := filepath.Dir(filePath)
 		if folder != "web" && !strings.HasPrefix(folder, "web/") {
 			return echo.ErrNotFound
 		}
 
-		absPath := filepath.Join(s.Config.ProjectsRoot, projectName, filePath)
+		absPath, err := s.projectFilePath(projectName, filePath)
+		if err != nil {
+			return err
+		}
 		if cacheDir != "" && strings.EqualFold(c.Request().URL.Query().Get("thumbnail"), "true") {
-			key := filepath.Join(projectName, filePath)
+			fit, err := ParseThumbnailFit(c.QueryParam("fit"))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			key := filepath.Join(projectName, ThumbnailCachePath(filePath, fit))
+			refresh := strings.EqualFold(c.QueryParam("refresh"), "true")
 			val, err, _ := lock.Do(key, func() (interface{}, error) {
 				srcFinfo, err := os.Stat(absPath)
 				if err != nil {
 					return "", err
 				}
 				thumbAbsPath := filepath.Join(cacheDir, key)
+				if refresh {
+					if err := os.Remove(thumbAbsPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+						return "", fmt.Errorf("removing cached thumbnail: %w", err)
+					}
+				}
 				finfo, err := os.Stat(thumbAbsPath)
 				if err == nil {
 					if finfo.ModTime().Unix() > srcFinfo.ModTime().Unix() {
@@ -837,7 +1314,7 @@ func (s *Server) mediaFileHandler(cacheDir string) func(echo.Context) error {
 					return "", fmt.Errorf("reading media image file: %w", err)
 				}
 
-				dstImageFit := imaging.Fit(srcImage, 500, 500, imaging.Lanczos)
+				dstImageFit := ResizeThumbnail(srcImage, 500, 500, fit)
 				format, err := imaging.FormatFromFilename(absPath)
 				if err != nil {
 					format = imaging.JPEG
@@ -848,8 +1325,11 @@ func (s *Server) mediaFileHandler(cacheDir string) func(echo.Context) error {
 					return "", err
 				}
 				defer f.Close()
-				err = imaging.Encode(f, dstImageFit, format, imaging.JPEGQuality(75))
-				return thumbAbsPath, err
+				if err = imaging.Encode(f, dstImageFit, format, imaging.JPEGQuality(75)); err != nil {
+					return "", err
+				}
+				s.thumbnailCreated(thumbAbsPath)
+				return thumbAbsPath, nil
 			})
 			if err != nil {
 				if errors.Is(err, os.ErrNotExist) {
@@ -858,19 +1338,81 @@ func (s *Server) mediaFileHandler(cacheDir string) func(echo.Context) error {
 				return err
 			}
 			absPath = val.(string)
+			s.thumbnailAccessed(absPath)
 		}
 		// maybe when media folders permissions will be implemented
 		// c.Response().Header().Set("Cache-Control", "private, must-revalidate")
+		if strings.EqualFold(c.QueryParam("download"), "true") {
+			return serveFile(c, absPath, "attachment", filepath.Base(filePath))
+		}
 		return c.File(absPath)
 	}
 }
 
+func isMediaPath(path string) bool {
+	path = filepath.Clean(path)
+	return path == "web" || strings.HasPrefix(path, "web/")
+}
+
+// listMediaDirectory returns content of the media directory (directory listing mode of the media handler)
+func (s *Server) listMediaDirectory(c echo.Context, projectName, path string) error {
+	if !isMediaPath(path) {
+		return echo.ErrNotFound
+	}
+	listing, err := s.projects.ListDirectory(projectName, path)
+	if err != nil {
+		if errors.Is(err, domain.ErrFileNotExists) && filepath.Clean(path) == "web" {
+			// media directory is created with the first uploaded file
+			return c.JSON(http.StatusOK, domain.DirectoryListing{Path: "web", Directories: []string{}, Files: []domain.ProjectFile{}})
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, listing)
+}
+
+// handleCreateMediaDirectory creates empty directory in the media (web/) folder. Directories
+// are not part of the files index (no marker file is created), empty directory is kept on
+// the disk until it's deleted with the DELETE media endpoint.
+func (s *Server) handleCreateMediaDirectory() func(echo.Context) error {
+	type Request struct {
+		Path string `json:"path"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		var req Request
+		if err := (&echo.DefaultBinder{}).BindBody(c, &req); err != nil {
+			return err
+		}
+		path := filepath.Clean(req.Path)
+		if !strings.HasPrefix(path, "web/") {
+			return echo.NewHTTPError(http.StatusForbidden, "Directory must be located in the web/ folder")
+		}
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		if err := s.checkProjectWritable(c, settings); err != nil {
+			return err
+		}
+		if err := s.checkMediaPermission(c, settings); err != nil {
+			return err
+		}
+		if err := s.projects.CreateDirectory(projectName, path); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusCreated)
+	}
+}
+
 func (s *Server) appMediaFileHandler(c echo.Context) error {
 	username := c.Param("user")
 	name := c.Param("name")
 	projectName := filepath.Join(username, name)
 	filePath := c.Param("*")
-	absPath := filepath.Join(s.Config.ProjectsRoot, projectName, "web", "app", filePath)
+	absPath, err := s.projectFilePath(projectName, filepath.Join("web", "app", filePath))
+	if err != nil {
+		return err
+	}
 	return c.File(absPath)
 }
 
@@ -897,11 +1439,9 @@ func (s *Server) mediaFileHandlerService() func(echo.Context) error {
 		}
 
 		filePath := filepath.Clean(parsedUrl.Path)
-
-		switch fileHandler := fileHandler.(type) {
-		case S3FileHandler:
-			parsedStoreUrl, _ := url.Parse(fileHandler.Provider.StoreUrl)
-			fileHandler.StoreUrl = *parsedStoreUrl
+		fit, err := ParseThumbnailFit(c.QueryParam("fit"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
 
 		if !fileHandler.CheckValidSource(*parsedUrl) {
@@ -912,89 +1452,46 @@ func (s *Server) mediaFileHandlerService() func(echo.Context) error {
 		redirect := fileHandler.HasRemoteSource()
 
 		if strings.EqualFold(thumbnail, "true") {
-			val, err, _ := lock.Do(filePath, func() (interface{}, error) {
-				source := fileHandler.GetExistingThumbnail(filePath)
-				if source != "" {
-					return source, nil
-				}
-
-				img, err := fileHandler.LoadSourceImage(filePath)
+			val, err, _ := lock.Do(ThumbnailCachePath(filePath, fit), func() (interface{}, error) {
+				source, created, err := GetOrCreateThumbnail(fileHandler, filePath, fit, width, height, quality)
 				if err != nil {
 					return "", err
 				}
-
-				dstImageFit := imaging.Fit(img, width, height, imaging.Lanczos)
-
-				newSrc, err := fileHandler.SaveThumbnail(dstImageFit, filePath, quality)
-				if err != nil {
-					return "", err
+				if created && !redirect {
+					s.thumbnailCreated(source)
 				}
-				return newSrc, nil
+				return source, nil
 			})
-
 			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return echo.NewHTTPError(http.StatusNotFound, "Image not found")
+				}
+				s.log.Errorw("media thumbnail", "project", projectName, "path", filePath, zap.Error(err))
 				return echo.NewHTTPError(http.StatusInternalServerError, "Cannot get thumbnail")
 			}
-
+			// serve (or redirect to) the thumbnail instead of the original image
 			resultPath = val.(string)
-		}
-
-		if resultPath != "" && err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				return echo.NewHTTPError(http.StatusNotFound, "Image not found")
+			if !redirect {
+				s.thumbnailAccessed(resultPath)
 			}
-			return err
 		}
 
 		if redirect {
-			return c.Redirect(308, resultPath)
+			return c.Redirect(http.StatusPermanentRedirect, resultPath)
 		}
 		return c.File(resultPath)
 	}
 }
 
-type MediaFile struct {
-	domain.ProjectFile
-	Filename string `json:"filename"`
-}
-
-// Original way of uploading
-func (s *Server) handleUploadMediaFile(c echo.Context) error {
-	directory := c.Param("*")
-	return s.handleUploadMediaFileLocal(c, directory)
-}
-
-func (s *Server) handleUploadMediaFileLocal(c echo.Context, directory string) error {
-	projectName := c.Get("project").(string)
-
-	file, err := c.FormFile("file")
-	if err != nil {
-		return fmt.Errorf("reading file: %w", err)
-	}
-	if !strings.HasPrefix(directory, "web/") {
-		return echo.ErrForbidden
+func (s *Server) localFileHandler(projectName string, provider domain.StorageProvider) LocalFileHandler {
+	return LocalFileHandler{
+		Provider:       provider,
+		ProjectPath:    filepath.Join(s.Config.ProjectsRoot, projectName),
+		ThumbnailsPath: filepath.Join(s.Config.ThumbnailsRoot, projectName),
+		SaveProjectFile: func(directory, pattern string, r io.Reader, size int64) (domain.ProjectFile, error) {
+			return s.projects.SaveFile(projectName, directory, pattern, r, size)
+		},
 	}
-
-	// user, err := s.auth.GetUser(c)
-	// if err != nil {
-	// 	return err
-	// }
-
-	// TODO: check directory access
-	// s.projects.GetDirectoryPerms(user)
-	src, err := file.Open()
-	if err != nil {
-		return fmt.Errorf("reading upload file: %w", err)
-	}
-
-	finfo, err := s.projects.SaveFile(projectName, directory, file.Filename, src, file.Size)
-	if err != nil {
-		if errors.Is(err, application.ErrProjectSizeLimit) {
-			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
-		}
-		return err
-	}
-	return c.JSON(http.StatusOK, MediaFile{finfo, filepath.Base(finfo.Path)})
 }
 
 func (s *Server) getFileHandler(projectName string, providerId string) (FileHandler, error) {
@@ -1011,7 +1508,14 @@ func (s *Server) getFileHandler(projectName string, providerId string) (FileHand
 	projectPath := filepath.Join(s.Config.ProjectsRoot, projectName)
 	thumbnailsPath := filepath.Join(s.Config.ThumbnailsRoot, projectName)
 
-	return GetFileHandler(info.Storage, providerId, projectPath, thumbnailsPath)
+	fileHandler, err := GetFileHandler(info.Storage, providerId, projectPath, thumbnailsPath)
+	if err != nil {
+		return nil, err
+	}
+	if local, ok := fileHandler.(LocalFileHandler); ok {
+		return s.localFileHandler(projectName, local.Provider), nil
+	}
+	return fileHandler, nil
 }
 
 func (s *Server) handleUploadMediaFileService(c echo.Context) error {
@@ -1024,56 +1528,114 @@ func (s *Server) handleUploadMediaFileService(c echo.Context) error {
 		return err
 	}
 
-	user, err := s.auth.GetUser(c)
 	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	if err := s.checkProjectWritable(c, settings); err != nil {
+		return err
+	}
+	if err := s.checkMediaPermission(c, settings); err != nil {
+		return err
+	}
+	return s.uploadMediaFile(c, fileHandler, directory)
+}
 
+// checkMediaPermission rejects modifications of media files when the user's roles
+// don't allow it (when the project has no roles, access to the project is sufficient)
+func (s *Server) checkMediaPermission(c echo.Context, settings domain.ProjectSettings) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
 	roles := domain.FilterUserRoles(user, settings.Auth.Roles)
-	if len(roles) > 0 {
-		fileUploadAllowed := false
-		for _, role := range roles {
-			if role.Permissions.Media {
-				fileUploadAllowed = true
-				break
-			}
-		}
-
-		if !fileUploadAllowed {
-			return echo.ErrForbidden
-		}
+	if len(roles) == 0 {
+		return nil
 	}
-
-	switch fileHandler := fileHandler.(type) {
-	case S3FileHandler:
-		return s.handleUploadMediaFileS3(c, directory, fileHandler)
+	for _, role := range roles {
+		if role.Permissions.Media {
+			return nil
+		}
 	}
-	return s.handleUploadMediaFileLocal(c, directory)
+	return echo.ErrForbidden
 }
 
-func (s *Server) handleUploadMediaFileS3(c echo.Context, directory string, fileHandler S3FileHandler) error {
-	// TODO: Handle 403
+// uploadMediaFile saves uploaded media file with the given file handler (storage provider)
+func (s *Server) uploadMediaFile(c echo.Context, fileHandler FileHandler, directory string) error {
 	file, err := c.FormFile("file")
 	if err != nil {
 		return fmt.Errorf("reading file: %w", err)
 	}
+	if !strings.HasPrefix(directory, "web/") {
+		return echo.ErrForbidden
+	}
 
-	src, err := file.Open()
+	// TODO: check directory access
+	fileResult, err := fileHandler.SaveFile(file, directory)
 	if err != nil {
-		return fmt.Errorf("reading upload file: %w", err)
+		if errors.Is(err, application.ErrAccountStorageLimit) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached account storage limit").SetInternal(err)
+		}
+		if errors.Is(err, application.ErrProjectSizeLimit) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.").SetInternal(err)
+		}
+		return err
 	}
+	return c.JSON(http.StatusOK, fileResult)
+}
 
-	defer src.Close()
-
-	objectName, err := ProcessPath(directory, file)
-	if err != nil {
-		return fmt.Errorf("processing path: %w", err)
+// checkStorageProvider tests connection to the storage provider and its configuration
+func (s *Server) checkStorageProvider(c echo.Context, provider domain.StorageProvider) error {
+	if provider.Type != "s3" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Unsupported storage provider type")
 	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 15*time.Second)
+	defer cancel()
+	if err := CheckS3Provider(ctx, provider); err != nil {
+		s.log.Infow("storage provider check", "provider", provider.ID, zap.Error(err))
+		var ce *StorageCheckError
+		if errors.As(err, &ce) {
+			return &APIError{Status: http.StatusBadRequest, Code: "storage_check_failed", Message: ce.Error(), Details: ce.ErrorDetails()}
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]bool{"ok": true})
+}
 
-	fileResult, err := fileHandler.SaveImage(src, file.Size, objectName)
-	if err != nil {
-		return fmt.Errorf("unable to upload: %w", err)
+// handleCheckStorageProvider tests storage provider configuration from the request (superusers only,
+// server connects to any given host)
+func (s *Server) handleCheckStorageProvider() func(echo.Context) error {
+	return func(c echo.Context) error {
+		var provider domain.StorageProvider
+		if err := (&echo.DefaultBinder{}).BindBody(c, &provider); err != nil {
+			return err
+		}
+		return s.checkStorageProvider(c, provider)
 	}
+}
 
-	return c.JSON(http.StatusOK, fileResult)
+// handleCheckProjectStorageProvider tests storage provider already configured in the project settings
+func (s *Server) handleCheckProjectStorageProvider() func(echo.Context) error {
+	type Params struct {
+		ProviderID string `json:"provider_id"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		var params Params
+		if err := (&echo.DefaultBinder{}).BindBody(c, &params); err != nil {
+			return err
+		}
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		for _, provider := range settings.Storage {
+			if provider.ID == params.ProviderID {
+				return s.checkStorageProvider(c, provider)
+			}
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "Storage provider is not configured in the project")
+	}
 }
 
 func (s *Server) handleDeleteMediaFile(c echo.Context) error {
@@ -1082,5 +1644,12 @@ func (s *Server) handleDeleteMediaFile(c echo.Context) error {
 	if !strings.HasPrefix(path, "web/") {
 		return echo.ErrForbidden
 	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	if err := s.checkProjectWritable(c, settings); err != nil {
+		return err
+	}
 	return s.projects.DeleteFile(projectName, path)
 }
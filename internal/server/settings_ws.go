@@ -1,30 +1,50 @@
 package server
 
 import (
+	"net/http"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
 
-func (s *Server) handleWebAppWS(c echo.Context) error {
+// wsUser returns user of the websocket upgrade request. User is derived only from the
+// authenticated session (cookie) or basic auth credentials (QGIS plugin may not have
+// a session cookie), so that connections can't be registered under another user's name.
+func (s *Server) wsUser(c echo.Context) (domain.User, error) {
 	user, err := s.auth.GetUser(c)
+	if err != nil {
+		if c.Request().Header.Get("Authorization") != "" {
+			return user, echo.NewHTTPError(http.StatusUnauthorized).SetInternal(err)
+		}
+		return user, err
+	}
+	if !user.IsAuthenticated || user.Username == "" {
+		return user, echo.ErrUnauthorized
+	}
+	return user, nil
+}
+
+func (s *Server) handleWebAppWS(c echo.Context) error {
+	user, err := s.wsUser(c)
 	if err != nil {
 		return err
 	}
 	err = s.sws.WebAppHandler(user.Username, c.Response(), c.Request())
 	if err != nil {
-		s.log.Errorw("websocket handler", "channel", "webapp", "user", user.Username, zap.Error(err))
+		s.log.Errorw("websocket handler", "channel", "webapp", "user", user.Identity(), zap.Error(err))
 	}
 	return nil
 }
 
 func (s *Server) handlePluginWS(c echo.Context) error {
-	user, err := s.auth.GetUser(c)
+	user, err := s.wsUser(c)
 	if err != nil {
 		return err
 	}
 	err = s.sws.PluginHandler(user.Username, c.Response(), c.Request())
 	if err != nil {
-		s.log.Errorw("websocket handler", "channel", "plugin", "user", user.Username, zap.Error(err))
+		s.log.Errorw("websocket handler", "channel", "plugin", "user", user.Identity(), zap.Error(err))
 	}
 	return nil
 }
@@ -0,0 +1,77 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookmarksSettings(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.CreateProjectWithMeta("user1/project", `{
+		"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers": {}, "layers_tree": [],
+		"bookmarks": {
+			"Cities": {
+				"b1": {"id": "b1", "name": "Prague", "extent": [0, 0, 1, 1], "group": "Cities"},
+				"b2": {"id": "b2", "name": "Brno", "extent": [0, 0, 1, 1], "group": "Cities"}
+			},
+			"Rivers": {
+				"b3": {"id": "b3", "name": "Vltava", "extent": [0, 0, 1, 1], "group": "Rivers"}
+			}
+		}
+	}`)
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(`{"title": "Project", "auth": {"type": "public"}, "custom": {"key": "value"}}`)))
+
+	get := func() application.BookmarksSettings {
+		var data application.BookmarksSettings
+		rec := ts.Request(http.MethodGet, "/api/project/bookmarks/user1/project", nil, "user1")
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &data))
+		}
+		return data
+	}
+	update := func(data string) int {
+		return ts.Request(http.MethodPut, "/api/project/bookmarks/user1/project", strings.NewReader(data), "user1").Code
+	}
+	data := get()
+	assert.Empty(t, data.Bookmarks)
+	assert.Empty(t, data.Groups)
+
+	assert.Equal(t, http.StatusOK, update(`{
+		"bookmarks": {"Cities": {"b2": {"id": "b2", "content": "<p>Brno</p>"}}},
+		"groups": [{"name": "Rivers", "title": "Water"}, {"name": "Cities", "order": ["b2", "b1"]}]
+	}`))
+	data = get()
+	assert.Equal(t, "<p>Brno</p>", data.Bookmarks["Cities"]["b2"].Content)
+	if assert.Len(t, data.Groups, 2) {
+		assert.Equal(t, "Water", data.Groups[0].Title)
+		assert.Equal(t, []string{"b2", "b1"}, data.Groups[1].Order)
+	}
+	// other settings are preserved
+	settings, err := ts.Projects.GetSettings("user1/project")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Project", settings.Title)
+		assert.JSONEq(t, `{"key": "value"}`, string(settings.CustomProperties))
+	}
+
+	// references to bookmarks and groups which don't exist in the project
+	assert.Equal(t, http.StatusBadRequest, update(`{"bookmarks": {"Lakes": {}}}`))
+	assert.Equal(t, http.StatusBadRequest, update(`{"bookmarks": {"Cities": {"b3": {"id": "b3"}}}}`))
+	assert.Equal(t, http.StatusBadRequest, update(`{"groups": [{"name": "Lakes"}]}`))
+	assert.Equal(t, http.StatusBadRequest, update(`{"groups": [{"name": "Cities"}, {"name": "Cities"}]}`))
+	assert.Equal(t, http.StatusBadRequest, update(`{"groups": [{"name": "Cities", "order": ["b1", "b1"]}]}`))
+	assert.Equal(t, http.StatusBadRequest, update(`{"groups": [{"name": "Rivers", "order": ["b1"]}]}`))
+	assert.Equal(t, "Water", get().Groups[0].Title)
+
+	// groups settings are removed with empty list
+	assert.Equal(t, http.StatusOK, update(`{"bookmarks": {}, "groups": []}`))
+	data = get()
+	assert.Empty(t, data.Bookmarks)
+	assert.Empty(t, data.Groups)
+}
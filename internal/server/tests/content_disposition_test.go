@@ -0,0 +1,24 @@
+package server_tests
+
+import (
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		dispositionType string
+		filename        string
+		expected        string
+	}{
+		{"attachment", "project.zip", `attachment; filename="project.zip"; filename*=UTF-8''project.zip`},
+		{"attachment", "my project.zip", `attachment; filename="my project.zip"; filename*=UTF-8''my%20project.zip`},
+		{"inline", "mapa Česko.pdf", `inline; filename="mapa _esko.pdf"; filename*=UTF-8''mapa%20%C4%8Cesko.pdf`},
+		{"attachment", `say "hi"; x.txt`, `attachment; filename="say _hi_; x.txt"; filename*=UTF-8''say%20%22hi%22%3B%20x.txt`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, server.ContentDisposition(tt.dispositionType, tt.filename))
+	}
+}
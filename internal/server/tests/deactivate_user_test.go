@@ -0,0 +1,40 @@
+package server_tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeactivateUser(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project")
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(`{"title": "Test", "auth": {"type": "authenticated"}}`)))
+
+	basicAuthRequest := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/project/media/user1/project/missing.png", nil)
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("user1:password")))
+		rec := httptest.NewRecorder()
+		ts.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// authenticated requests (basic auth credentials are cached now)
+	assert.Equal(t, http.StatusNotFound, basicAuthRequest())
+	rec := ts.Request(http.MethodGet, "/api/project/media/user1/project/missing.png", nil, "user1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = ts.Request(http.MethodPost, "/api/admin/users/user1/deactivate", nil, "admin")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// neither session nor cached basic auth credentials are valid anymore
+	rec = ts.Request(http.MethodGet, "/api/project/media/user1/project/missing.png", nil, "user1")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, basicAuthRequest())
+}
@@ -0,0 +1,39 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteUserProjects(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project1")
+	ts.CreateProject("user1/project2")
+
+	rec := ts.Request(http.MethodDelete, "/api/admin/projects/user1", nil, "user1")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = ts.Request(http.MethodDelete, "/api/admin/projects/user1?confirm=user2", nil, "admin")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = ts.Request(http.MethodDelete, "/api/admin/projects/user1?confirm=user1", nil, "admin")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var results []struct {
+		Project string `json:"project"`
+		Deleted bool   `json:"deleted"`
+	}
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results)) {
+		assert.Len(t, results, 2)
+		for _, r := range results {
+			assert.True(t, r.Deleted, r.Project)
+		}
+	}
+	projects, err := ts.Projects.UserProjects("user1")
+	assert.NoError(t, err)
+	assert.Empty(t, projects)
+}
@@ -0,0 +1,46 @@
+package server_tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteUserWithProjects(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	ts.AddUser("user1", false)
+	ts.AddUser("user2", false)
+	ts.CreateProject("user1/project1")
+	ts.CreateProject("user2/project2")
+
+	rec := ts.Request(http.MethodDelete, "/api/admin/users/user1?projects=delete", nil, "admin")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	exists, _ := ts.Accounts.UsernameExists("user1")
+	assert.False(t, exists)
+	assert.False(t, ts.Storage.CheckProjectExists("user1/project1"))
+
+	rec = ts.Request(http.MethodDelete, "/api/admin/users/user2?projects=keep", nil, "admin")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	exists, _ = ts.Accounts.UsernameExists("user2")
+	assert.False(t, exists)
+	assert.True(t, ts.Storage.CheckProjectExists("user2/project2"))
+}
+
+func TestDeleteUserTransferConflict(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	ts.AddUser("user1", false)
+	ts.AddUser("user2", false)
+	ts.CreateProject("user1/project")
+	ts.CreateProject("user2/project")
+
+	rec := ts.Request(http.MethodDelete, "/api/admin/users/user1?projects=transfer&to=user2", nil, "admin")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	// nothing is changed when some of the projects can't be transferred
+	exists, _ := ts.Accounts.UsernameExists("user1")
+	assert.True(t, exists)
+	assert.True(t, ts.Storage.CheckProjectExists("user1/project"))
+}
@@ -0,0 +1,43 @@
+package server_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestGuestUsername(t *testing.T) {
+	accounts := &memoryAccounts{accounts: make(map[string]domain.Account)}
+	sessions := &memorySessions{sessions: make(map[string]string)}
+	as := auth.NewAuthService(zap.NewNop().Sugar(), time.Hour, accounts, sessions)
+	as.GuestUsername = "guest"
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	user, err := as.GetUser(c)
+	if assert.NoError(t, err) {
+		assert.True(t, user.IsGuest)
+		assert.False(t, user.IsAuthenticated)
+		assert.Empty(t, user.Username)
+		assert.Equal(t, "guest", user.Identity())
+	}
+	assert.Equal(t, domain.DefaultGuestUsername, domain.User{IsGuest: true}.Identity())
+
+	service := application.NewAccountsService(nil, accounts, nil, nil)
+	service.GuestUsername = "guest"
+	assert.Error(t, service.CheckUsername("Guest"))
+	assert.NoError(t, service.CheckUsername("user1"))
+	// only the configured guest username is reserved
+	assert.NoError(t, service.CheckUsername("anonymous"))
+	_, err = domain.NewAccount("anonymous", "anonymous@localhost", "", "", "password", bcrypt.MinCost)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,52 @@
+package server_tests
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadRoutes(t *testing.T) {
+	image, err := os.ReadFile("../../../mocks/files/gisquick_logo.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project")
+	_, err = ts.Storage.CreateFile("user1/project", "web", "logo.png", bytes.NewReader(image))
+	assert.NoError(t, err)
+	_, err = ts.Storage.CreateFile("user1/project", "data", "notes.txt", strings.NewReader("notes"))
+	assert.NoError(t, err)
+	assert.NoError(t, ts.Projects.SaveThumbnail("user1/project", bytes.NewReader(image)))
+
+	tests := []struct {
+		url         string
+		size        int
+		contentType string
+	}{
+		{"/api/project/media/user1/project/web/logo.png", len(image), "image/png"},
+		{"/api/project/file/user1/project/data/notes.txt", 5, "text/plain; charset=utf-8"},
+		{"/api/project/thumbnail/user1/project", len(image), "image/png"},
+	}
+	for _, tt := range tests {
+		get := ts.Request(http.MethodGet, tt.url, nil, "user1")
+		head := ts.Request(http.MethodHead, tt.url, nil, "user1")
+		if assert.Equal(t, http.StatusOK, head.Code, tt.url) {
+			assert.Equal(t, strconv.Itoa(tt.size), head.Header().Get("Content-Length"), tt.url)
+			assert.Equal(t, tt.contentType, head.Header().Get("Content-Type"), tt.url)
+			assert.NotEmpty(t, head.Header().Get("Last-Modified"), tt.url)
+			assert.Equal(t, get.Header().Get("Content-Length"), head.Header().Get("Content-Length"), tt.url)
+			assert.Zero(t, head.Body.Len(), tt.url)
+		}
+	}
+
+	rec := ts.Request(http.MethodHead, "/api/project/media/user1/project/web/missing.png", nil, "user1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
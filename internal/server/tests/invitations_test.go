@@ -0,0 +1,115 @@
+package server_tests
+
+import (
+	"errors"
+	htmltemplate "html/template"
+	"sync"
+	"testing"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopEmailService struct{}
+
+func (nopEmailService) SendActivationEmail(account domain.Account, uid, token string, data map[string]interface{}) error {
+	return nil
+}
+
+func (nopEmailService) SendPasswordResetEmail(account domain.Account, uid, token string) error {
+	return nil
+}
+
+func (nopEmailService) SendBulkEmail(accounts []domain.Account, subject string, htmlTemplate *htmltemplate.Template, textTemplate *texttemplate.Template, data map[string]interface{}) error {
+	return nil
+}
+
+type memoryInvitations struct {
+	mu          sync.Mutex
+	invitations map[string]application.Invitation
+	saveErr     error
+}
+
+func (s *memoryInvitations) Save(invitation application.Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.invitations[invitation.ID] = invitation
+	return nil
+}
+
+func (s *memoryInvitations) Get(id string) (application.Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invitations[id]
+	if !ok {
+		return inv, application.ErrInvitationNotFound
+	}
+	return inv, nil
+}
+
+func (s *memoryInvitations) List() ([]application.Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]application.Invitation, 0, len(s.invitations))
+	for _, inv := range s.invitations {
+		list = append(list, inv)
+	}
+	return list, nil
+}
+
+func (s *memoryInvitations) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.invitations, id)
+	return nil
+}
+
+func newInvitationsTestService() (*application.AccountsService, *memoryAccounts, *memoryInvitations) {
+	accounts := &memoryAccounts{accounts: make(map[string]domain.Account)}
+	invitations := &memoryInvitations{invitations: make(map[string]application.Invitation)}
+	tokenGen := security.NewTokenGenerator("secret", "activation", time.Hour)
+	return application.NewAccountsService(nopEmailService{}, accounts, tokenGen, invitations), accounts, invitations
+}
+
+func TestInviteSaveFailure(t *testing.T) {
+	service, accounts, invitations := newInvitationsTestService()
+	invitations.saveErr = errors.New("store unavailable")
+
+	_, err := service.Invite("user1", "user1@localhost", "", "", nil)
+	assert.Error(t, err)
+	exists, _ := accounts.UsernameExists("user1")
+	assert.False(t, exists, "account must be removed when the invitation is not saved")
+}
+
+func TestPendingInvitations(t *testing.T) {
+	service, accounts, invitations := newInvitationsTestService()
+	inv1, err := service.Invite("user1", "user1@localhost", "", "", nil)
+	assert.NoError(t, err)
+	inv2, err := service.Invite("user2", "user2@localhost", "", "", nil)
+	assert.NoError(t, err)
+
+	account, _ := accounts.GetByUsername("user1")
+	account.Active = true
+	assert.NoError(t, accounts.Update(account))
+
+	pending, err := service.PendingInvitations()
+	if assert.NoError(t, err) && assert.Len(t, pending, 1) {
+		assert.Equal(t, inv2.ID, pending[0].ID)
+	}
+	// listing doesn't modify the store
+	_, err = invitations.Get(inv1.ID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, service.CleanupInvitations())
+	_, err = invitations.Get(inv1.ID)
+	assert.ErrorIs(t, err, application.ErrInvitationNotFound)
+	_, err = invitations.Get(inv2.ID)
+	assert.NoError(t, err)
+}
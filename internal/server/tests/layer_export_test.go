@@ -0,0 +1,114 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportLayer(t *testing.T) {
+	var propertyNames string
+	mapserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		assert.Equal(t, "GetFeature", query.Get("REQUEST"))
+		assert.Equal(t, "parcels", query.Get("TYPENAME"))
+		propertyNames = query.Get("PROPERTYNAME")
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Write([]byte(`{"type": "FeatureCollection", "bbox": [0, 0, 1, 1], "features": [
+			{"type": "Feature", "id": "parcels.1", "geometry": {"type": "Point", "coordinates": [1, 2]}, "properties": {"code": "A1", "owner": "Smith", "area": 120.5}},
+			{"type": "Feature", "id": "parcels.2", "geometry": null, "properties": {"code": "A,2", "owner": "Doe", "area": null}}
+		]}`))
+	}))
+	defer mapserver.Close()
+
+	ts := newTestServer(t, server.Config{MapserverURL: mapserver.URL})
+	ts.AddUser("user1", false)
+	ts.AddUser("viewer", false)
+	ts.AddUser("exporter", false)
+	ts.CreateProjectWithMeta("user1/project", `{
+		"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers_tree": ["parcels_id", "roads_id"],
+		"layers": {
+			"parcels_id": {"id": "parcels_id", "name": "parcels", "type": "VectorLayer", "flags": ["query"],
+				"attributes": [{"name": "code"}, {"name": "owner"}, {"name": "area"}]},
+			"roads_id": {"id": "roads_id", "name": "roads", "type": "VectorLayer", "flags": ["query"],
+				"attributes": [{"name": "name"}]}
+		}
+	}`)
+	settings := `{
+		"title": "Test",
+		"layers": {
+			"parcels_id": {"flags": ["query", "export"], "export_fields": ["code", "owner", "area"]},
+			"roads_id": {"flags": ["query"], "export_fields": ["name"]}
+		},
+		"auth": {
+			"type": "authenticated",
+			"roles": [{
+				"name": "viewers", "type": "users", "users": ["viewer"],
+				"permissions": {
+					"layers": {"parcels_id": ["view", "query"], "roads_id": ["view", "query"]},
+					"attributes": {"parcels_id": {"code": ["view", "export"], "owner": ["view"], "area": ["view", "export"]}}
+				}
+			}, {
+				"name": "exporters", "type": "users", "users": ["exporter"],
+				"permissions": {
+					"layers": {"parcels_id": ["view", "query"]},
+					"attributes": {"parcels_id": {"code": ["view", "export"], "geometry": ["export"]}}
+				}
+			}]
+		}
+	}`
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(settings)))
+
+	export := func(layer, query, username string) *httptest.ResponseRecorder {
+		return ts.Request(http.MethodGet, "/api/map/export/user1/project/"+layer+query, nil, username)
+	}
+
+	// only fields with export permission
+	rec := export("parcels_id", "?format=csv", "viewer")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Equal(t, "code,area", propertyNames)
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Header().Get("Content-Disposition"), "parcels.csv")
+		assert.Equal(t, "code,area\nA1,120.5\n\"A,2\",\n", rec.Body.String())
+	}
+
+	rec = export("parcels_id", "", "viewer")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Equal(t, "code,area,geometry", propertyNames)
+		var collection struct {
+			Type     string `json:"type"`
+			Features []struct {
+				ID         string                 `json:"id"`
+				Geometry   json.RawMessage        `json:"geometry"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"features"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &collection))
+		assert.Equal(t, "FeatureCollection", collection.Type)
+		if assert.Len(t, collection.Features, 2) {
+			assert.Equal(t, "parcels.1", collection.Features[0].ID)
+			assert.JSONEq(t, `{"type": "Point", "coordinates": [1, 2]}`, string(collection.Features[0].Geometry))
+			assert.Equal(t, map[string]interface{}{"code": "A1", "area": 120.5}, collection.Features[0].Properties)
+		}
+	}
+
+	// geometry in CSV requires geometry export permission
+	rec = export("parcels_id", "?format=csv&geometry=true", "viewer")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = export("parcels_id", "?format=csv&geometry=true", "exporter")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Equal(t, "code,geometry", propertyNames)
+		assert.True(t, strings.HasPrefix(rec.Body.String(), "code,geometry\nA1,"))
+	}
+
+	// layer without export flag
+	assert.Equal(t, http.StatusForbidden, export("roads_id", "", "viewer").Code)
+	// layer without view permission
+	assert.Equal(t, http.StatusNotFound, export("roads_id", "", "exporter").Code)
+	assert.Equal(t, http.StatusBadRequest, export("parcels_id", "?format=xlsx", "viewer").Code)
+}
@@ -0,0 +1,67 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayerRelations(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.AddUser("viewer", false)
+	ts.CreateProjectWithMeta("user1/project", `{
+		"title": "Test", "file": "test.qgs", "projection": "EPSG:3857",
+		"layers_tree": ["parcels_id", "owners_id", "secret_id", "excluded_id"],
+		"layers": {
+			"parcels_id": {"id": "parcels_id", "name": "parcels", "type": "VectorLayer", "relations": [
+				{"name": "owners", "referencing_layer": "owners_id", "referenced_layer": "parcels_id"},
+				{"name": "secret", "referencing_layer": "secret_id", "referenced_layer": "parcels_id"},
+				{"name": "excluded", "referencing_layer": "excluded_id", "referenced_layer": "parcels_id"},
+				{"name": "missing", "referencing_layer": "missing_id", "referenced_layer": "parcels_id"}
+			]},
+			"owners_id": {"id": "owners_id", "name": "owners", "type": "VectorLayer"},
+			"secret_id": {"id": "secret_id", "name": "secret", "type": "VectorLayer"},
+			"excluded_id": {"id": "excluded_id", "name": "excluded", "type": "VectorLayer"}
+		}
+	}`)
+	settings := `{
+		"title": "Test",
+		"layers": {"excluded_id": {"flags": ["excluded"]}},
+		"auth": {
+			"type": "authenticated",
+			"roles": [{
+				"name": "viewers", "type": "users", "users": ["viewer"],
+				"permissions": {"layers": {"parcels_id": ["view", "query"], "owners_id": ["view"], "secret_id": ["query"]}}
+			}]
+		}
+	}`
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(settings)))
+
+	type Relation struct {
+		Name        string `json:"name"`
+		Referencing string `json:"referencing_layer"`
+		Referenced  string `json:"referenced_layer"`
+	}
+	relations := func(username string) []Relation {
+		layer, err := ts.Projects.GetLayerConfig("user1/project", "parcels_id", domain.User{Username: username, IsAuthenticated: true})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		var list []Relation
+		if len(layer.Relations) > 0 {
+			assert.NoError(t, json.Unmarshal(layer.Relations, &list))
+		}
+		return list
+	}
+	// relations to layers without view permission (or excluded) are hidden, IDs are replaced by names
+	assert.Equal(t, []Relation{{"owners", "owners", "parcels"}}, relations("viewer"))
+
+	// without roles, only excluded layers (and unknown layers) are filtered
+	settings = `{"title": "Test", "auth": {"type": "public"}, "layers": {"excluded_id": {"flags": ["excluded"]}}}`
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(settings)))
+	assert.Equal(t, []Relation{{"owners", "owners", "parcels"}, {"secret", "secret", "parcels"}}, relations("user1"))
+}
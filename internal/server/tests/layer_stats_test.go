@@ -0,0 +1,66 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayerStats(t *testing.T) {
+	var mapserverRequests int32
+	mapserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&mapserverRequests, 1)
+		w.Header().Set("Content-Type", "text/xml")
+		switch r.URL.Query().Get("REQUEST") {
+		case "GetFeature":
+			assert.Equal(t, "hits", r.URL.Query().Get("RESULTTYPE"))
+			assert.Equal(t, "roads", r.URL.Query().Get("TYPENAME"))
+			w.Write([]byte(`<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs" numberOfFeatures="42"/>`))
+		case "GetCapabilities":
+			w.Write([]byte(`<WFS_Capabilities><FeatureTypeList>
+				<FeatureType><Name>water</Name><WGS84BoundingBox><LowerCorner>0 0</LowerCorner><UpperCorner>1 1</UpperCorner></WGS84BoundingBox></FeatureType>
+				<FeatureType><Name>roads</Name><WGS84BoundingBox><LowerCorner>14.1 49.9</LowerCorner><UpperCorner>14.7 50.2</UpperCorner></WGS84BoundingBox></FeatureType>
+			</FeatureTypeList></WFS_Capabilities>`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer mapserver.Close()
+
+	ts := newTestServer(t, server.Config{MapserverURL: mapserver.URL})
+	ts.AddUser("user1", false)
+	ts.CreateProjectWithMeta("user1/project", `{
+		"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers_tree": [],
+		"layers": {
+			"roads_id": {"id": "roads_id", "name": "roads", "type": "VectorLayer"},
+			"ortho_id": {"id": "ortho_id", "name": "ortho", "type": "RasterLayer"}
+		}
+	}`)
+
+	rec := ts.Request(http.MethodGet, "/api/map/layer-stats/user1/project/roads_id", nil, "user1")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var stats server.LayerStats
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		if assert.NotNil(t, stats.FeatureCount) {
+			assert.Equal(t, 42, *stats.FeatureCount)
+		}
+		assert.Equal(t, []float64{14.1, 49.9, 14.7, 50.2}, stats.Extent)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&mapserverRequests))
+
+	// cached result
+	rec = ts.Request(http.MethodGet, "/api/map/layer-stats/user1/project/roads_id", nil, "user1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&mapserverRequests))
+
+	rec = ts.Request(http.MethodGet, "/api/map/layer-stats/user1/project/ortho_id", nil, "user1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = ts.Request(http.MethodGet, "/api/map/layer-stats/user1/project/unknown", nil, "user1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&mapserverRequests))
+}
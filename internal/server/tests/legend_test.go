@@ -0,0 +1,73 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayerLegend(t *testing.T) {
+	var mapserverRequests int32
+	mapserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&mapserverRequests, 1)
+		query := r.URL.Query()
+		assert.Equal(t, "GetLegendGraphic", query.Get("REQUEST"))
+		assert.Equal(t, "roads", query.Get("LAYER"))
+		assert.Empty(t, query.Get("STYLE"))
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png:" + query.Get("SCALE")))
+	}))
+	defer mapserver.Close()
+
+	ts := newTestServer(t, server.Config{MapserverURL: mapserver.URL})
+	ts.AddUser("user1", false)
+	ts.CreateProjectWithMeta("user1/project", `{
+		"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers_tree": ["roads_id", "water_id", "osm_id"],
+		"layers": {
+			"roads_id": {"id": "roads_id", "name": "roads", "type": "VectorLayer", "legend_url": "http://qgis/?REQUEST=GetLegendGraphic"},
+			"water_id": {"id": "water_id", "name": "water", "type": "VectorLayer"},
+			"osm_id": {"id": "osm_id", "name": "osm", "type": "RasterLayer", "provider_type": "wms", "legend_url": "http://osm/legend.png"}
+		}
+	}`)
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(`{
+		"title": "Test", "auth": {"type": "public"},
+		"layers": {"water_id": {"flags": ["excluded"]}}
+	}`)))
+
+	rec := ts.Request(http.MethodGet, "/api/map/legend/user1/project/roads_id?scale=5000&style=custom", nil, "user1")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "png:5000", rec.Body.String())
+	}
+	// cached image
+	rec = ts.Request(http.MethodGet, "/api/map/legend/user1/project/roads_id?scale=5000", nil, "user1")
+	assert.Equal(t, "png:5000", rec.Body.String())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&mapserverRequests))
+
+	rec = ts.Request(http.MethodGet, "/api/map/legend/user1/project/roads_id?scale=1000", nil, "user1")
+	assert.Equal(t, "png:1000", rec.Body.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&mapserverRequests))
+
+	rec = ts.Request(http.MethodGet, "/api/map/legend/user1/project/water_id", nil, "user1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = ts.Request(http.MethodGet, "/api/map/legend/user1/project/unknown", nil, "user1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&mapserverRequests))
+
+	// map config points to the API, except of external WMS layers
+	user := domain.User{Username: "user1", IsAuthenticated: true}
+	layer, err := ts.Projects.GetLayerConfig("user1/project", "roads_id", user)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/api/map/legend/user1/project/roads_id", layer.LegendURL)
+	}
+	layer, err = ts.Projects.GetLayerConfig("user1/project", "osm_id", user)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://osm/legend.png", layer.LegendURL)
+	}
+}
@@ -0,0 +1,79 @@
+package server_tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	state := application.MaintenanceState{}
+	as := auth.NewAuthService(zap.NewNop().Sugar(), time.Hour, nil, nil)
+
+	e := echo.New()
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		var apiErr *server.APIError
+		if errors.As(err, &apiErr) {
+			c.NoContent(apiErr.Status)
+		} else {
+			e.DefaultHTTPErrorHandler(err, c)
+		}
+	}
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := auth.AnonymousUser
+			if c.Request().Header.Get("X-Superuser") != "" {
+				user = domain.User{Username: "admin", IsAuthenticated: true, IsSuperuser: true}
+			}
+			c.Set("user", user)
+			return next(c)
+		}
+	})
+	e.Use(server.MaintenanceMiddleware(as, func(ctx context.Context) application.MaintenanceState {
+		return state
+	}))
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+	e.GET("/api/projects", ok)
+	e.POST("/api/project/:user/:name", ok)
+	e.POST("/api/auth/login", ok)
+	e.GET("/index.html", ok)
+
+	request := func(method, path string, superuser bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if superuser {
+			req.Header.Set("X-Superuser", "1")
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/project/user1/p1", false).Code)
+
+	state = application.MaintenanceState{Mode: application.MaintenanceReadOnly}
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/projects", false).Code)
+	rec := request(http.MethodPost, "/api/project/user1/p1", false)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/project/user1/p1", true).Code)
+
+	state = application.MaintenanceState{Mode: application.MaintenanceBlocked}
+	assert.Equal(t, http.StatusServiceUnavailable, request(http.MethodGet, "/api/projects", false).Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/projects", true).Code)
+	// login and static files are not blocked
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/auth/login", false).Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/index.html", false).Code)
+}
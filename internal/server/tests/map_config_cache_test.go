@@ -0,0 +1,44 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMapConfigCache(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	storage := project.NewDiskStorage(log, t.TempDir())
+	meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers": {}, "layers_tree": []}`)
+	_, err := storage.Create("test/project", meta)
+	assert.NoError(t, err)
+	service := application.NewProjectsService(log, storage, nil, application.ProjectsServiceConfig{MapConfigCacheTTL: time.Minute})
+	defer service.Close()
+	assert.NoError(t, service.UpdateSettings("test/project", json.RawMessage(`{"auth": {"type": "public"}}`)))
+
+	user := domain.User{Username: "user1", IsAuthenticated: true}
+	data, err := service.GetMapConfig("test/project", user)
+	if assert.NoError(t, err) {
+		assert.True(t, service.IsMapConfigShared("test/project"))
+		// returned config can be modified without affecting the cached one
+		data["notifications"] = []string{"message"}
+	}
+	data, err = service.GetMapConfig("test/project", domain.User{IsGuest: true})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, data, "notifications")
+	}
+
+	roles := `{"auth": {"type": "public", "roles": [{"type": "authenticated", "name": "users", "permissions": {}}]}}`
+	assert.NoError(t, service.UpdateSettings("test/project", json.RawMessage(roles)))
+	assert.False(t, service.IsMapConfigShared("test/project"))
+	_, err = service.GetMapConfig("test/project", user)
+	if assert.NoError(t, err) {
+		assert.False(t, service.IsMapConfigShared("test/project"))
+	}
+}
@@ -0,0 +1,43 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMapProjectionFallback(t *testing.T) {
+	tests := []struct {
+		cfg        application.ProjectsServiceConfig
+		settings   string
+		projection string
+		units      string
+	}{
+		{application.ProjectsServiceConfig{}, `{"auth": {"type": "public"}}`, "EPSG:3857", "meters"},
+		{application.ProjectsServiceConfig{DefaultProjection: "EPSG:4326"}, `{"auth": {"type": "public"}}`, "EPSG:4326", "degrees"},
+		{application.ProjectsServiceConfig{DefaultUnits: "degrees"}, `{"auth": {"type": "public"}}`, "EPSG:3857", "degrees"},
+		{application.ProjectsServiceConfig{DefaultProjection: "EPSG:4326"}, `{"auth": {"type": "public"}, "projection": "EPSG:3857", "units": "meters"}`, "EPSG:3857", "meters"},
+	}
+	log := zap.NewNop().Sugar()
+	for _, tt := range tests {
+		storage := project.NewDiskStorage(log, t.TempDir())
+		meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "", "layers": {}, "layers_tree": []}`)
+		_, err := storage.Create("test/project", meta)
+		assert.NoError(t, err)
+		service := application.NewProjectsService(log, storage, nil, tt.cfg)
+		assert.NoError(t, service.UpdateSettings("test/project", json.RawMessage(tt.settings)))
+
+		data, err := service.GetMapConfig("test/project", domain.User{IsGuest: true})
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.projection, data["projection"], tt.settings)
+			units := data["units"].(map[string]interface{})
+			assert.Equal(t, tt.units, units["map"], tt.settings)
+		}
+		service.Close()
+	}
+}
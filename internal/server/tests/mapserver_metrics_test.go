@@ -0,0 +1,71 @@
+package server_tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapserverRequestType(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"http://qgis/ows?SERVICE=WMS&REQUEST=GetMap", "GetMap"},
+		{"http://qgis/ows?service=wms&request=getfeatureinfo", "GetFeatureInfo"},
+		{"http://qgis/ows?REQUEST=Unknown", "other"},
+		{"http://qgis/reload?MAP=/srv/p.qgs", "other"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		assert.Equal(t, tt.expected, server.MapserverRequestType(req), tt.url)
+	}
+}
+
+func TestMapserverMetricsTransport(t *testing.T) {
+	mapserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer mapserver.Close()
+
+	client := &http.Client{Transport: server.NewMapserverMetricsTransport(nil)}
+	// metrics are global, clear observations of mapserver requests made by other tests
+	server.MapserverRequestDuration.Reset()
+	server.MapserverResponseSize.Reset()
+	before := testutil.CollectAndCount(server.MapserverRequestDuration)
+
+	resp, err := client.Get(mapserver.URL + "/ows?SERVICE=WMS&REQUEST=GetLegendGraphic")
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Len(t, body, 1000)
+	assert.Equal(t, before+1, testutil.CollectAndCount(server.MapserverRequestDuration))
+
+	expected := `
+		# HELP mapserver_response_size_bytes Size of mapserver response bodies.
+		# TYPE mapserver_response_size_bytes histogram
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="256"} 0
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="1024"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="4096"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="16384"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="65536"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="262144"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="1.048576e+06"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="4.194304e+06"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="1.6777216e+07"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="6.7108864e+07"} 1
+		mapserver_response_size_bytes_bucket{type="GetLegendGraphic",le="+Inf"} 1
+		mapserver_response_size_bytes_sum{type="GetLegendGraphic"} 1000
+		mapserver_response_size_bytes_count{type="GetLegendGraphic"} 1
+	`
+	assert.NoError(t, testutil.CollectAndCompare(server.MapserverResponseSize, strings.NewReader(expected)))
+}
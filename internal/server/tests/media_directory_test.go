@@ -0,0 +1,48 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMediaDirectory(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.AddUser("editor", false)
+	ts.AddUser("viewer", false)
+	ts.CreateProject("user1/project")
+	settings := `{
+		"title": "Test",
+		"auth": {
+			"type": "authenticated",
+			"roles": [
+				{"name": "editors", "type": "users", "users": ["editor"], "permissions": {"custom_media_upload": true}},
+				{"name": "viewers", "type": "users", "users": ["viewer"], "permissions": {"custom_media_upload": false}}
+			]
+		}
+	}`
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(settings)))
+
+	mkdir := func(path, username string) int {
+		body := strings.NewReader(`{"path": "` + path + `"}`)
+		return ts.Request(http.MethodPost, "/api/project/media/user1/project/mkdir", body, username).Code
+	}
+	assert.Equal(t, http.StatusForbidden, mkdir("web/viewer", "viewer"))
+	assert.Equal(t, http.StatusForbidden, mkdir("data", "editor"))
+	assert.Equal(t, http.StatusCreated, mkdir("web/images/2024", "editor"))
+
+	stat, err := os.Stat(filepath.Join(ts.Storage.ProjectsRoot, "user1/project/web/images/2024"))
+	if assert.NoError(t, err) {
+		assert.True(t, stat.IsDir())
+		assert.Zero(t, stat.Mode().Perm()&0002, "directory must not be world writable")
+	}
+	_, err = os.Stat(filepath.Join(ts.Storage.ProjectsRoot, "user1/project/web/viewer"))
+	assert.True(t, os.IsNotExist(err))
+}
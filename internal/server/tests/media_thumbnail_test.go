@@ -0,0 +1,56 @@
+package server_tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3ThumbnailRedirectTarget(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/media/gisquick/web/photos/thumbs/a.jpg" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	storeUrl, _ := url.Parse(ts.URL)
+	handler := server.S3FileHandler{
+		Provider: domain.StorageProvider{ID: "s3", Type: "s3", Bucket: "media", StoreUrl: ts.URL},
+		StoreUrl: *storeUrl,
+	}
+
+	source, created, err := server.GetOrCreateThumbnail(handler, "gisquick/web/photos/a.jpg", server.ThumbnailContain, 400, 400, 85)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, ts.URL+"/media/gisquick/web/photos/thumbs/a.jpg", source)
+
+	_, _, err = server.GetOrCreateThumbnail(handler, "gisquick/web/photos/missing.jpg", server.ThumbnailContain, 400, 400, 85)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestS3ThumbnailReadUrl(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	storeUrl, _ := url.Parse("http://minio.internal:9000")
+	readUrl, _ := url.Parse(ts.URL)
+	handler := server.S3FileHandler{
+		Provider: domain.StorageProvider{ID: "s3", Type: "s3", Bucket: "media"},
+		StoreUrl: *storeUrl,
+		ReadUrl:  *readUrl,
+	}
+	source := handler.GetExistingThumbnail("gisquick/web/photos/a.jpg", server.ThumbnailContain)
+	assert.Equal(t, ts.URL+"/media/gisquick/web/photos/thumbs/a.jpg", source)
+}
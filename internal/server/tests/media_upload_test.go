@@ -0,0 +1,131 @@
+package server_tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func uploadedFormFile(t *testing.T, mockPath, fileName string) *multipart.FileHeader {
+	body := new(bytes.Buffer)
+	writer, err := CreateFormFile(body, mockPath, fileName)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if !assert.NoError(t, req.ParseMultipartForm(1<<20)) {
+		t.FailNow()
+	}
+	return req.MultipartForm.File["file"][0]
+}
+
+func TestLocalFileHandlerSaveFile(t *testing.T) {
+	mockPath := "../../../mocks/files/gisquick_logo.png"
+	projectPath := t.TempDir()
+
+	var savedDir, savedPattern string
+	handler := server.LocalFileHandler{
+		ProjectPath: projectPath,
+		SaveProjectFile: func(directory, pattern string, r io.Reader, size int64) (domain.ProjectFile, error) {
+			savedDir, savedPattern = directory, pattern
+			relPath := filepath.Join(directory, "logo_1234.png")
+			if err := os.MkdirAll(filepath.Join(projectPath, directory), 0775); err != nil {
+				return domain.ProjectFile{}, err
+			}
+			f, err := os.Create(filepath.Join(projectPath, relPath))
+			if err != nil {
+				return domain.ProjectFile{}, err
+			}
+			defer f.Close()
+			n, err := io.Copy(f, r)
+			return domain.ProjectFile{Path: relPath, Size: n}, err
+		},
+	}
+	result, err := handler.SaveFile(uploadedFormFile(t, mockPath, "logo_<hash>.png"), "web/photos")
+	if assert.NoError(t, err) {
+		// filename patterns are resolved by the project storage
+		assert.Equal(t, "web/photos", savedDir)
+		assert.Equal(t, "logo_<hash>.png", savedPattern)
+		assert.Equal(t, "web/photos/logo_1234.png", result.Path)
+		assert.Equal(t, int64(24150), result.Size)
+		assert.Equal(t, "logo_1234.png", result.Filename)
+		assert.NotNil(t, result.ImageInfo)
+	}
+}
+
+func TestProcessFileName(t *testing.T) {
+	mockPath := "../../../mocks/files/gisquick_logo.png"
+	data, err := os.ReadFile(mockPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	hash := fmt.Sprintf("%x", sha1.Sum(data))
+
+	// same naming as in the project storage (see DiskStorage.CreateFile)
+	name, err := server.ProcessFileName(uploadedFormFile(t, mockPath, "logo_<hash>.png"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "logo_"+hash[:domain.FilenameHashLength]+".png", name)
+	}
+
+	name, err = server.ProcessFileName(uploadedFormFile(t, mockPath, "logo_<random>.png"))
+	if assert.NoError(t, err) {
+		assert.Regexp(t, `^logo_[0-9a-f]{32}\.png$`, name)
+	}
+}
+
+func TestS3ClientOptions(t *testing.T) {
+	provider := domain.StorageProvider{ID: "minio", Type: "s3", StoreUrl: "https://s3.example.com", Region: "eu-central-1", PathStyle: true}
+	storeUrl, opts, err := server.S3ClientOptions(provider)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "s3.example.com", storeUrl.Host)
+		assert.True(t, opts.Secure)
+		assert.Equal(t, "eu-central-1", opts.Region)
+		assert.Equal(t, minio.BucketLookupPath, opts.BucketLookup)
+	}
+
+	provider.PathStyle = false
+	_, opts, err = server.S3ClientOptions(provider)
+	if assert.NoError(t, err) {
+		assert.Equal(t, minio.BucketLookupAuto, opts.BucketLookup)
+	}
+
+	provider.StoreUrl = ""
+	_, _, err = server.S3ClientOptions(provider)
+	assert.Error(t, err)
+}
+
+func TestCheckS3Provider(t *testing.T) {
+	var ce *server.StorageCheckError
+
+	err := server.CheckS3Provider(context.Background(), domain.StorageProvider{ID: "s3", Type: "s3"})
+	if assert.ErrorAs(t, err, &ce) {
+		assert.Equal(t, "config", ce.Step)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	provider := domain.StorageProvider{ID: "s3", Type: "s3", StoreUrl: ts.URL, Bucket: "media", Region: "us-east-1", PathStyle: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = server.CheckS3Provider(ctx, provider)
+	if assert.ErrorAs(t, err, &ce) {
+		assert.Equal(t, "bucket", ce.Step)
+	}
+}
@@ -0,0 +1,49 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLayerAliases(t *testing.T) {
+	aliases := map[string]string{"roads": "Roads 2022", "parcels": "cadastre_parcels"}
+
+	query := url.Values{
+		"LAYERS":       {"roads,rivers"},
+		"query_layers": {"parcels"},
+		"TYPENAME":     {"feature:roads"},
+		"FEATUREID":    {"parcels.12,rivers.3"},
+		"STYLES":       {"roads"},
+	}
+	server.ResolveLayerAliases(query, aliases)
+	assert.Equal(t, "Roads 2022,rivers", query.Get("LAYERS"))
+	assert.Equal(t, "cadastre_parcels", query.Get("query_layers"))
+	assert.Equal(t, "feature:Roads 2022", query.Get("TYPENAME"))
+	assert.Equal(t, "cadastre_parcels.12,rivers.3", query.Get("FEATUREID"))
+	// other parameters are not changed
+	assert.Equal(t, "roads", query.Get("STYLES"))
+
+	body := `<wfs:GetFeature service="WFS"><wfs:Query typeName="feature:parcels"><ogc:PropertyName>roads</ogc:PropertyName></wfs:Query><wfs:Query typeName='rivers'/></wfs:GetFeature>`
+	expected := `<wfs:GetFeature service="WFS"><wfs:Query typeName="feature:cadastre_parcels"><ogc:PropertyName>roads</ogc:PropertyName></wfs:Query><wfs:Query typeName="rivers"/></wfs:GetFeature>`
+	assert.Equal(t, expected, string(server.ResolveXMLLayerAliases([]byte(body), aliases)))
+}
+
+func TestSaveLayerAliases(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	meta := `{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers": {"roads_id": {"name": "roads", "type": "VectorLayer"}}, "layers_tree": []}`
+	ts.CreateProjectWithMeta("user1/project", meta)
+
+	err := ts.Projects.UpdateSettings("user1/project", json.RawMessage(`{"auth": {"type": "public"}, "layer_aliases": {"roads": "roads"}}`))
+	assert.ErrorIs(t, err, application.ErrInvalidSettings)
+	err = ts.Projects.PatchSettings("user1/project", json.RawMessage(`{"layer_aliases": {"a,b": "roads"}}`))
+	assert.ErrorIs(t, err, application.ErrInvalidSettings)
+
+	assert.NoError(t, ts.Projects.PatchSettings("user1/project", json.RawMessage(`{"layer_aliases": {"streets": "roads"}}`)))
+	err = ts.Projects.PatchSettings("user1/project", json.RawMessage(`{"layer_aliases": {"roads": "roads"}}`))
+	assert.ErrorIs(t, err, application.ErrInvalidSettings)
+}
@@ -0,0 +1,42 @@
+package server_tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneFeatureCollection(t *testing.T) {
+	input := `{
+		"type": "FeatureCollection",
+		"bbox": [0, 0, 1, 1],
+		"features": [
+			{"type": "Feature", "id": "roads.1", "geometry": null, "properties": {"name": "A", "owner": "X"}},
+			{"type": "Feature", "id": "parcels.2", "geometry": {"type": "Point", "coordinates": [1, 1]}, "properties": {"name": "B", "owner": "Y"}}
+		]
+	}`
+	allowed := func(featureID string) map[string]bool {
+		if strings.HasPrefix(featureID, "roads.") {
+			return map[string]bool{"name": true}
+		}
+		return nil
+	}
+	var out bytes.Buffer
+	err := server.PruneFeatureCollection(strings.NewReader(input), &out, allowed)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{
+			"type": "FeatureCollection",
+			"bbox": [0, 0, 1, 1],
+			"features": [
+				{"type": "Feature", "id": "roads.1", "geometry": null, "properties": {"name": "A"}},
+				{"type": "Feature", "id": "parcels.2", "geometry": {"type": "Point", "coordinates": [1, 1]}, "properties": {"name": "B", "owner": "Y"}}
+			]
+		}`, out.String())
+	}
+
+	err = server.PruneFeatureCollection(strings.NewReader(`[1, 2]`), &out, allowed)
+	assert.Error(t, err)
+}
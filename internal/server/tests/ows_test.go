@@ -0,0 +1,26 @@
+package server_tests
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionFeaturesCount(t *testing.T) {
+	data := `<Transaction xmlns="http://www.opengis.net/wfs" service="WFS" version="1.0.0">
+	<Insert>
+		<parks><name>A</name></parks>
+		<parks><name>B</name></parks>
+	</Insert>
+	<Update typeName="parks">
+		<Property><Name>name</Name><Value>C</Value></Property>
+	</Update>
+	<Delete typeName="parks"/>
+</Transaction>`
+	var transaction server.Transaction
+	if assert.NoError(t, xml.Unmarshal([]byte(data), &transaction)) {
+		assert.Equal(t, 4, transaction.FeaturesCount())
+	}
+}
@@ -0,0 +1,44 @@
+package server_tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	account, err := domain.NewAccount("user1", "user1@localhost", "", "", "password", bcrypt.MinCost)
+	assert.NoError(t, err)
+	assert.False(t, account.NeedsRehash(bcrypt.MinCost))
+	assert.True(t, account.NeedsRehash(bcrypt.MinCost+1))
+	// zero cost means default cost
+	assert.True(t, account.NeedsRehash(0))
+
+	legacy := domain.Account{Password: []byte("pbkdf2_sha256$260000$salt$hash")}
+	assert.True(t, legacy.NeedsRehash(bcrypt.MinCost))
+}
+
+func TestAuthenticateRehashesPassword(t *testing.T) {
+	accounts := &memoryAccounts{accounts: make(map[string]domain.Account)}
+	sessions := &memorySessions{sessions: make(map[string]string)}
+	account, err := domain.NewAccount("user1", "user1@localhost", "", "", "password", bcrypt.MinCost)
+	assert.NoError(t, err)
+	account.Active = true
+	assert.NoError(t, accounts.Create(account))
+
+	as := auth.NewAuthService(zap.NewNop().Sugar(), time.Hour, accounts, sessions)
+	as.PasswordHashCost = bcrypt.MinCost + 1
+	_, err = as.Authenticate("user1", "password")
+	assert.NoError(t, err)
+
+	stored, _ := accounts.GetByUsername("user1")
+	cost, err := bcrypt.Cost(stored.Password)
+	assert.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, cost)
+	assert.True(t, stored.CheckPassword("password"))
+}
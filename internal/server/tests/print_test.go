@@ -0,0 +1,57 @@
+package server_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintRequests(t *testing.T) {
+	var mapserverRequests int32
+	mapserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&mapserverRequests, 1)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF"))
+	}))
+	defer mapserver.Close()
+
+	ts := newTestServer(t, server.Config{MapserverURL: mapserver.URL})
+	ts.AddUser("user1", false)
+	ts.CreateProjectWithMeta("user1/project", `{
+		"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers": {}, "layers_tree": [],
+		"composer_templates": [{"name": "A4"}]
+	}`)
+
+	// GetPrint is not proxied by OWS endpoint (neither in the query nor in the form data)
+	rec := ts.Request(http.MethodGet, "/api/map/ows/user1/project?SERVICE=WMS&REQUEST=GetPrint&TEMPLATE=A4", nil, "user1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	req := httptest.NewRequest(http.MethodPost, "/api/map/ows/user1/project", strings.NewReader("SERVICE=WMS&request=getprint&TEMPLATE=A4"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "gq_session", Value: "user1"})
+	rec = httptest.NewRecorder()
+	ts.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	print := func(params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/map/print/user1/project", strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "gq_session", Value: "user1"})
+		rec := httptest.NewRecorder()
+		ts.ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusForbidden, print(url.Values{"TEMPLATE": {"A3"}, "map0:LAYERS": {"roads"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, print(url.Values{"TEMPLATE": {"A4"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, print(url.Values{"TEMPLATE": {"A4"}, "map0:LAYERS": {""}}).Code)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&mapserverRequests))
+
+	rec = print(url.Values{"TEMPLATE": {"A4"}, "map0:LAYERS": {"roads"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&mapserverRequests))
+}
@@ -0,0 +1,34 @@
+package server_tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressWriter(t *testing.T) {
+	var buf bytes.Buffer
+	reported := 0
+	calls := 0
+	pw := &server.ProgressWriter{Writer: &buf, Step: 100, Callback: func(written, last int) {
+		reported += last
+		calls++
+	}}
+	chunk := []byte(strings.Repeat("x", 50))
+	for i := 0; i < 5; i++ {
+		_, err := pw.Write(chunk)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 200, reported)
+
+	pw.Flush()
+	assert.Equal(t, 250, reported)
+	assert.Equal(t, 3, calls)
+	// nothing new to report
+	pw.Flush()
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 250, buf.Len())
+}
@@ -0,0 +1,29 @@
+package server_tests
+
+import (
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateProj4(t *testing.T) {
+	valid := []string{
+		"+proj=longlat +datum=WGS84 +no_defs",
+		"+proj=krovak +lat_0=49.5 +lon_0=24.83333333333333 +alpha=30.28813972222222 +k=0.9999 +x_0=0 +y_0=0 +ellps=bessel +towgs84=589,76,480,0,0,0,0 +units=m +no_defs",
+		"+proj=merc +a=6378137 +b=6378137 +nadgrids=@null +wktext +no_defs",
+	}
+	for _, def := range valid {
+		assert.NoError(t, application.ValidateProj4(def), def)
+	}
+	invalid := []string{
+		"",
+		"+datum=WGS84 +no_defs",
+		"+proj=longlat datum=WGS84",
+		"+proj= +datum=WGS84",
+		"+proj=utm +zone =33",
+	}
+	for _, def := range invalid {
+		assert.Error(t, application.ValidateProj4(def), def)
+	}
+}
@@ -0,0 +1,53 @@
+package server_tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveProjectPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	projDir := filepath.Join(root, "test", "project")
+	assert.NoError(t, os.MkdirAll(filepath.Join(projDir, "web"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(projDir, "web", "a.txt"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(projDir, "web", "secret.txt")))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(projDir, "outside")))
+	assert.NoError(t, os.Symlink(filepath.Join(projDir, "web", "a.txt"), filepath.Join(projDir, "link.txt")))
+
+	path, err := server.ResolveProjectPath(root, "test/project", "web/a.txt")
+	if assert.NoError(t, err) {
+		assert.FileExists(t, path)
+	}
+	// symlink inside of the project is allowed
+	path, err = server.ResolveProjectPath(root, "test/project", "link.txt")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a.txt", filepath.Base(path))
+	}
+
+	_, err = server.ResolveProjectPath(root, "test/project", "web/secret.txt")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+	_, err = server.ResolveProjectPath(root, "test/project", "outside/secret.txt")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+	_, err = server.ResolveProjectPath(root, "test/project", "../../../etc/passwd")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+	_, err = server.ResolveProjectPath(root, "test/project", "web/missing.txt")
+	assert.ErrorIs(t, err, domain.ErrFileNotExists)
+	_, err = server.ResolveProjectPath(root, "test/missing", "web/a.txt")
+	assert.ErrorIs(t, err, domain.ErrProjectNotExists)
+}
+
+func TestValidateProjectName(t *testing.T) {
+	for _, name := range []string{"user/project", "user/my_project-2.1"} {
+		assert.NoError(t, domain.ValidateProjectName(name), name)
+	}
+	for _, name := range []string{"user/..", "user/.hidden", "user/a/b", "user/my project", "user/", "/project", "user", `user/a\b`} {
+		assert.ErrorIs(t, domain.ValidateProjectName(name), domain.ErrInvalidProjectName, name)
+	}
+}
@@ -0,0 +1,28 @@
+package server_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectUnlockedMiddlewareWithoutLocks(t *testing.T) {
+	e := echo.New()
+	setProject := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("project", c.Param("user")+"/"+c.Param("name"))
+			return next(c)
+		}
+	}
+	e.DELETE("/api/project/:user/:name", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, setProject, server.ProjectUnlockedMiddleware(nil))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/project/user1/p1", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,30 @@
+package server_tests
+
+import (
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectTags(t *testing.T) {
+	assert.Equal(t, []string{"roads", "city plan"}, domain.NormalizeTags([]string{" Roads", "", "City Plan", "roads "}))
+	assert.Nil(t, domain.NormalizeTags(nil))
+
+	projects := []domain.ProjectInfo{
+		{Name: "u/a", Tags: []string{"roads", "city"}},
+		{Name: "u/b", Tags: []string{"water"}},
+		{Name: "u/c"},
+	}
+	names := func(projects []domain.ProjectInfo) []string {
+		var list []string
+		for _, p := range projects {
+			list = append(list, p.Name)
+		}
+		return list
+	}
+	assert.Equal(t, []string{"u/a"}, names(application.ProjectsFilter{Tag: "Roads"}.Apply(projects)))
+	assert.Equal(t, []string{"u/a", "u/b"}, names(application.ProjectsFilter{Tag: "city, water"}.Apply(projects)))
+	assert.Len(t, application.ProjectsFilter{}.Apply(projects), 3)
+}
@@ -0,0 +1,47 @@
+package server_tests
+
+import (
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectThumbnailParams(t *testing.T) {
+	meta := domain.QgisMeta{
+		Extent:      []float64{0, 0, 2000, 1000},
+		Projection:  "EPSG:3857",
+		LayersOrder: []string{"roads_1", "hidden_1", "parcels_1", "osm_1"},
+		Layers: map[string]domain.LayerMeta{
+			"roads_1":   {Name: "roads", Visible: true},
+			"hidden_1":  {Name: "hidden", Visible: false},
+			"parcels_1": {Name: "parcels", Visible: true},
+			"osm_1":     {Name: "osm", Visible: true},
+		},
+	}
+	settings := domain.ProjectSettings{
+		BaseLayers: []string{"osm_1"},
+		Layers:     map[string]domain.LayerSettings{},
+	}
+	params, err := server.ProjectThumbnailParams(meta, settings)
+	assert.NoError(t, err)
+	assert.Equal(t, "parcels,roads", params.Get("LAYERS"))
+	assert.Equal(t, "0,0,2000,1000", params.Get("BBOX"))
+	assert.Equal(t, "EPSG:3857", params.Get("SRS"))
+	assert.Equal(t, "600", params.Get("WIDTH"))
+	assert.Equal(t, "300", params.Get("HEIGHT"))
+
+	// initial extent has priority, excluded layers are skipped
+	settings.InitialExtent = []float64{0, 0, 100, 200}
+	settings.Layers["parcels_1"] = domain.LayerSettings{Flags: domain.Flags{"excluded"}}
+	params, err = server.ProjectThumbnailParams(meta, settings)
+	assert.NoError(t, err)
+	assert.Equal(t, "roads", params.Get("LAYERS"))
+	assert.Equal(t, "0,0,100,200", params.Get("BBOX"))
+	assert.Equal(t, "600", params.Get("HEIGHT"))
+
+	settings.Layers["roads_1"] = domain.LayerSettings{Flags: domain.Flags{"render_off"}}
+	_, err = server.ProjectThumbnailParams(meta, settings)
+	assert.Error(t, err)
+}
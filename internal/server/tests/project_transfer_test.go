@@ -0,0 +1,60 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferProject(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	ts.AddUser("user1", false)
+	ts.AddUser("user2", false)
+	ts.CreateProject("user1/project")
+	settings := `{
+		"title": "Test",
+		"custom": {"key": "value"},
+		"auth": {
+			"type": "users",
+			"users": ["user1", "user3"],
+			"roles": [{"name": "editors", "type": "users", "users": ["user1"]}]
+		}
+	}`
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(settings)))
+	assert.NoError(t, ts.Storage.UpdateState("user1/project", domain.ProjectStateHidden))
+	before, err := ts.Storage.GetProjectInfo("user1/project")
+	assert.NoError(t, err)
+
+	rec := ts.Request(http.MethodPost, "/api/admin/projects/user1/project/transfer", strings.NewReader(`{"to": "user2"}`), "admin")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, ts.Storage.CheckProjectExists("user1/project"))
+
+	info, err := ts.Storage.GetProjectInfo("user2/project")
+	if assert.NoError(t, err) {
+		// transfer must not change project's state nor last update time
+		assert.Equal(t, domain.ProjectStateHidden, info.State)
+		assert.Equal(t, before.LastUpdate, info.LastUpdate)
+	}
+	data, err := ts.Storage.GetRawSettings("user2/project")
+	if assert.NoError(t, err) {
+		var s struct {
+			Custom map[string]string `json:"custom"`
+			Auth   struct {
+				Users []string `json:"users"`
+				Roles []struct {
+					Users []string `json:"users"`
+				} `json:"roles"`
+			} `json:"auth"`
+		}
+		assert.NoError(t, json.Unmarshal(data, &s))
+		assert.Equal(t, []string{"user2", "user3"}, s.Auth.Users)
+		assert.Equal(t, []string{"user2"}, s.Auth.Roles[0].Users)
+		assert.Equal(t, "value", s.Custom["key"])
+	}
+}
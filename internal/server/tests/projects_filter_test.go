@@ -0,0 +1,87 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func projectNames(t *testing.T, data []byte) []string {
+	var projects []domain.ProjectInfo
+	assert.NoError(t, json.Unmarshal(data, &projects))
+	names := make([]string, len(projects))
+	for i, p := range projects {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func TestProjectsFilter(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	// test projects are published with public access
+	ts.CreateProject("user1/public")
+	ts.CreateProject("user1/private")
+	ts.CreateProject("user1/hidden")
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/private", json.RawMessage(`{"auth": {"type": "private"}}`)))
+	_, err := ts.Projects.ChangeState("user1/hidden", domain.ProjectStateHidden)
+	assert.NoError(t, err)
+
+	list := func(query string) []string {
+		rec := ts.Request(http.MethodGet, "/api/projects/user1"+query, nil, "admin")
+		if !assert.Equal(t, http.StatusOK, rec.Code) {
+			return nil
+		}
+		return projectNames(t, rec.Body.Bytes())
+	}
+	assert.Len(t, list(""), 3)
+	assert.ElementsMatch(t, []string{"user1/public", "user1/private"}, list("?state=published"))
+	assert.ElementsMatch(t, []string{"user1/public", "user1/hidden"}, list("?auth=Public"))
+	assert.ElementsMatch(t, []string{"user1/public"}, list("?state=published&auth=public"))
+	assert.Len(t, list("?state=hidden,published&auth=private,%20public"), 3)
+	assert.ElementsMatch(t, []string{"user1/hidden"}, list("?state=hidden&auth=public,private"))
+	assert.Empty(t, list("?state=staged"))
+}
+
+func TestProjectsPage(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	for name, title := range map[string]string{"user1/p1": "Bravo", "user1/p2": "alpha", "user1/p3": "Delta", "user1/p4": "charlie"} {
+		ts.CreateProject(name)
+		settings := fmt.Sprintf(`{"title": %q, "auth": {"type": "public"}}`, title)
+		assert.NoError(t, ts.Projects.UpdateSettings(name, json.RawMessage(settings)))
+	}
+
+	list := func(query string) ([]string, string) {
+		rec := ts.Request(http.MethodGet, "/api/projects/user1"+query, nil, "admin")
+		if !assert.Equal(t, http.StatusOK, rec.Code) {
+			return nil, ""
+		}
+		return projectNames(t, rec.Body.Bytes()), rec.Header().Get("X-Total-Count")
+	}
+	names, total := list("?sort=title")
+	assert.Equal(t, []string{"user1/p2", "user1/p1", "user1/p4", "user1/p3"}, names)
+	assert.Equal(t, "4", total)
+
+	names, total = list("?sort=title&order=desc&limit=2&offset=1")
+	assert.Equal(t, []string{"user1/p4", "user1/p1"}, names)
+	assert.Equal(t, "4", total)
+
+	// total count of filtered projects
+	names, total = list("?sort=title&auth=private")
+	assert.Empty(t, names)
+	assert.Equal(t, "0", total)
+
+	names, _ = list("?offset=10")
+	assert.Empty(t, names)
+
+	for _, query := range []string{"?sort=name", "?order=up", "?limit=-1", "?offset=-1"} {
+		rec := ts.Request(http.MethodGet, "/api/projects/user1"+query, nil, "admin")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
@@ -0,0 +1,52 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchProjects(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.CreateProject("user2/roads")
+	ts.CreateProject("user2/secret")
+	ts.CreateProject("user2/shared")
+	ts.CreateProjectWithMeta("user2/water", `{
+		"title": "Rivers and lakes", "abstract": "Hydrology of the region",
+		"file": "test.qgs", "projection": "EPSG:3857", "layers": {}, "layers_tree": []
+	}`)
+	settings := map[string]string{
+		"user2/roads":  `{"title": "City Roads", "auth": {"type": "public"}}`,
+		"user2/secret": `{"title": "Secret roads", "auth": {"type": "private"}}`,
+		"user2/shared": `{"title": "Shared roads", "auth": {"type": "users", "users": ["user1"]}}`,
+		"user2/water":  `{"title": "Water", "auth": {"type": "public"}}`,
+	}
+	for name, data := range settings {
+		assert.NoError(t, ts.Projects.UpdateSettings(name, json.RawMessage(data)))
+	}
+
+	search := func(query string) []string {
+		rec := ts.Request(http.MethodGet, "/api/projects/search?"+query, nil, "user1")
+		if !assert.Equal(t, http.StatusOK, rec.Code) {
+			return nil
+		}
+		return projectNames(t, rec.Body.Bytes())
+	}
+	// only accessible projects
+	assert.ElementsMatch(t, []string{"user2/roads", "user2/shared"}, search("q=ROADS"))
+	assert.ElementsMatch(t, []string{"user2/shared"}, search("q=roads+shared"))
+	// project name is searched as well
+	assert.ElementsMatch(t, []string{"user2/water"}, search("q=user2/water"))
+	// QGIS project title and abstract only on request
+	assert.Empty(t, search("q=hydrology"))
+	assert.ElementsMatch(t, []string{"user2/water"}, search("q=hydrology&meta=true"))
+
+	rec := ts.Request(http.MethodGet, "/api/projects/search?q=r", nil, "user1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = ts.Request(http.MethodGet, "/api/projects/search?q=roads", nil, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,65 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyProject(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.AddUser("editor", false)
+	ts.CreateProject("user1/project")
+	settings := `{
+		"title": "Test",
+		"read_only": true,
+		"auth": {
+			"type": "authenticated",
+			"roles": [
+				{"name": "editors", "type": "users", "users": ["editor"], "permissions": {"custom_media_upload": true}}
+			]
+		}
+	}`
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(settings)))
+	_, err := ts.Storage.CreateFile("user1/project", "web", "photo.jpg", strings.NewReader("jpg"))
+	assert.NoError(t, err)
+
+	mkdir := func(query, username string) int {
+		body := strings.NewReader(`{"path": "web/images"}`)
+		return ts.Request(http.MethodPost, "/api/project/media/user1/project/mkdir"+query, body, username).Code
+	}
+	assert.Equal(t, http.StatusForbidden, mkdir("", "editor"))
+	assert.Equal(t, http.StatusForbidden, mkdir("", "user1"))
+	// only owner or superuser can force modifications
+	assert.Equal(t, http.StatusForbidden, mkdir("?force=true", "editor"))
+	assert.Equal(t, http.StatusCreated, mkdir("?force=true", "user1"))
+
+	rec := ts.Request(http.MethodDelete, "/api/project/media/user1/project/web/photo.jpg", nil, "editor")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.FileExists(t, filepath.Join(ts.Storage.ProjectsRoot, "user1/project/web/photo.jpg"))
+	rec = ts.Request(http.MethodDelete, "/api/project/media/user1/project/web/photo.jpg?force=1", nil, "user1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, err = os.Stat(filepath.Join(ts.Storage.ProjectsRoot, "user1/project/web/photo.jpg"))
+	assert.True(t, os.IsNotExist(err))
+
+	// WFS transactions are rejected before reaching the mapserver (project without roles,
+	// so transactions are not limited by layers permissions)
+	ts.CreateProject("user1/public")
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/public", json.RawMessage(`{"title": "Test", "read_only": true, "auth": {"type": "public"}}`)))
+	transaction := strings.NewReader(`<Transaction service="WFS" version="1.0.0"><Delete typeName="roads"/></Transaction>`)
+	rec = ts.Request(http.MethodPost, "/api/map/ows/user1/public?SERVICE=WFS", transaction, "editor")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	config, err := ts.Projects.GetMapConfig("user1/project", domain.User{Username: "editor", IsAuthenticated: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, true, config["read_only"])
+	}
+}
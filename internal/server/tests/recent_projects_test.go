@@ -0,0 +1,87 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// setLastUpdate rewrites project info file with the given time of the last update
+func setLastUpdate(t *testing.T, storage *project.DiskStorage, name string, lastUpdate time.Time) {
+	path := filepath.Join(storage.ProjectsRoot, name, ".gisquick", "project.json")
+	data, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var info domain.ProjectInfo
+	assert.NoError(t, json.Unmarshal(data, &info))
+	info.LastUpdate = lastUpdate
+	data, err = json.Marshal(info)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func TestRecentProjects(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	storage := project.NewDiskStorage(log, t.TempDir())
+	meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers": {}, "layers_tree": []}`)
+	now := time.Now().UTC()
+	for i, name := range []string{"user1/a", "user2/b", "user1/c"} {
+		_, err := storage.Create(name, meta)
+		assert.NoError(t, err)
+		setLastUpdate(t, storage, name, now.Add(time.Duration(i-10)*time.Minute))
+	}
+	service := application.NewProjectsService(log, storage, nil, application.ProjectsServiceConfig{})
+	defer service.Close()
+	assert.NoError(t, service.UpdateSettings("user1/a", json.RawMessage(`{"auth": {"type": "public"}}`)))
+
+	projects, err := service.RecentProjects(2)
+	if assert.NoError(t, err) && assert.Len(t, projects, 2) {
+		assert.Equal(t, "user1/a", projects[0].Name)
+		assert.Equal(t, "user1/c", projects[1].Name)
+	}
+}
+
+func TestRecentProjectsHandler(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	for _, name := range []string{"user1/a", "user2/b", "user1/c"} {
+		ts.CreateProject(name)
+	}
+	now := time.Now().UTC()
+	setLastUpdate(t, ts.Storage, "user2/b", now)
+	setLastUpdate(t, ts.Storage, "user1/a", now.Add(-time.Minute))
+	setLastUpdate(t, ts.Storage, "user1/c", now.Add(-2*time.Minute))
+
+	type RecentProject struct {
+		Name  string `json:"name"`
+		Owner string `json:"owner"`
+	}
+	list := func(limit string) []RecentProject {
+		rec := ts.Request(http.MethodGet, "/api/admin/projects/recent?limit="+limit, nil, "admin")
+		if !assert.Equal(t, http.StatusOK, rec.Code) {
+			return nil
+		}
+		var data []RecentProject
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &data))
+		return data
+	}
+	assert.Equal(t, []RecentProject{{"user2/b", "user2"}, {"user1/a", "user1"}}, list("2"))
+	// different limit is served from the same cached list
+	setLastUpdate(t, ts.Storage, "user1/c", now.Add(time.Minute))
+	assert.Equal(t, []RecentProject{{"user2/b", "user2"}, {"user1/a", "user1"}, {"user1/c", "user1"}}, list("3"))
+	assert.Equal(t, []RecentProject{{"user2/b", "user2"}}, list("1"))
+
+	rec := ts.Request(http.MethodGet, "/api/admin/projects/recent?limit=0", nil, "admin")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
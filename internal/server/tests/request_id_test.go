@@ -0,0 +1,49 @@
+package server_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(server.RequestIDMiddleware(zap.NewNop().Sugar()))
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Get("request_id").(string))
+	})
+
+	tests := []struct {
+		header string
+		valid  bool
+	}{
+		{"", false},
+		{"abc-123_DEF.4", true},
+		{"id with spaces", false},
+		{"id\"injected", false},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set(echo.HeaderXRequestID, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		rid := rec.Header().Get(echo.HeaderXRequestID)
+		assert.Equal(t, rid, rec.Body.String())
+		if tt.valid {
+			assert.Equal(t, tt.header, rid)
+		} else {
+			assert.NotEqual(t, tt.header, rid)
+			assert.Len(t, rid, 32, tt.header)
+		}
+	}
+}
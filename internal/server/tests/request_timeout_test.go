@@ -0,0 +1,36 @@
+package server_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	e := echo.New()
+	e.Use(server.RequestTimeoutMiddleware(20 * time.Millisecond))
+	slow := func(c echo.Context) error {
+		select {
+		case <-c.Request().Context().Done():
+			return c.Request().Context().Err()
+		case <-time.After(100 * time.Millisecond):
+			return c.NoContent(http.StatusOK)
+		}
+	}
+	e.GET("/api/admin/users", slow)
+	e.GET("/api/project/download/:user/:name", slow)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/users", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	// streaming routes are not limited
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/project/download/user/project", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
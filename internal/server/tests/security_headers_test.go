@@ -0,0 +1,35 @@
+package server_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	cfg := server.Config{
+		ContentSecurityPolicy: "default-src 'self'; frame-ancestors 'none'",
+		ReferrerPolicy:        "same-origin",
+		FrameOptions:          "DENY",
+	}
+	s := server.NewServer(zap.NewNop().Sugar(), cfg, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/unknown", nil))
+
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "same-origin", rec.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "default-src 'self'; frame-ancestors 'none'", rec.Header().Get("Content-Security-Policy"))
+
+	cfg.FrameAllowedOrigins = []string{"https://example.com"}
+	s = server.NewServer(zap.NewNop().Sugar(), cfg, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/unknown", nil))
+
+	assert.Empty(t, rec.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "default-src 'self'; frame-ancestors 'self' https://example.com", rec.Header().Get("Content-Security-Policy"))
+}
@@ -0,0 +1,42 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentSettingsPatches(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.CreateProject("user1/project1")
+	ts.CreateProject("user1/project2")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for _, name := range []string{"user1/project1", "user1/project2"} {
+			wg.Add(1)
+			go func(name string, i int) {
+				defer wg.Done()
+				patch := fmt.Sprintf(`{"custom_%d": %d}`, i, i)
+				assert.NoError(t, ts.Projects.PatchSettings(name, json.RawMessage(patch)))
+			}(name, i)
+		}
+	}
+	wg.Wait()
+
+	// no patch may be lost
+	for _, name := range []string{"user1/project1", "user1/project2"} {
+		data, err := ts.Storage.GetRawSettings(name)
+		if assert.NoError(t, err) {
+			var settings map[string]interface{}
+			assert.NoError(t, json.Unmarshal(data, &settings))
+			for i := 0; i < 20; i++ {
+				assert.Contains(t, settings, fmt.Sprintf("custom_%d", i), name)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package server_tests
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsChangeRemovesCachedTiles(t *testing.T) {
+	cacheRoot := t.TempDir()
+	ts := newTestServer(t, server.Config{MapCacheRoot: cacheRoot})
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project1")
+	ts.CreateProject("user1/project2")
+
+	cacheTile := func(projectName string) string {
+		projectHash := fmt.Sprintf("%x", md5.Sum([]byte(projectName)))
+		path := filepath.Join(cacheRoot, projectHash, "layers", "tile.png")
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0775))
+		assert.NoError(t, os.WriteFile(path, []byte("png"), 0644))
+		return path
+	}
+
+	tile := cacheTile("user1/project1")
+	otherTile := cacheTile("user1/project2")
+	body := strings.NewReader(`{"title": "Project 1", "auth": {"type": "private"}}`)
+	rec := ts.Request(http.MethodPost, "/api/project/settings/user1/project1", body, "user1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoFileExists(t, tile)
+	// tiles of other projects are kept
+	assert.FileExists(t, otherTile)
+
+	tile = cacheTile("user1/project1")
+	rec = ts.Request(http.MethodPatch, "/api/project/settings/user1/project1", strings.NewReader(`{"title": "Project"}`), "user1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoFileExists(t, tile)
+	assert.FileExists(t, otherTile)
+}
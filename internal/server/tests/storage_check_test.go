@@ -0,0 +1,31 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckProjectStorageProvider(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project")
+	settings := `{"title": "Test", "auth": {"type": "public"}, "storage": [{"id": "local", "type": "local"}]}`
+	assert.NoError(t, ts.Projects.UpdateSettings("user1/project", json.RawMessage(settings)))
+
+	provider := `{"id": "s3", "type": "s3", "store_url": "http://127.0.0.1:9000", "bucket": "media"}`
+	// arbitrary provider can be tested only by superuser
+	rec := ts.Request(http.MethodPost, "/api/project/storage/test", strings.NewReader(provider), "user1")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = ts.Request(http.MethodPost, "/api/project/storage/test/user1/project", strings.NewReader(provider), "user1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = ts.Request(http.MethodPost, "/api/project/storage/test/user1/project", strings.NewReader(`{"provider_id": "unknown"}`), "user1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = ts.Request(http.MethodPost, "/api/project/storage/test/user1/project", strings.NewReader(`{"provider_id": "local"}`), "user1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,34 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveTemporaryFilesHandler(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project")
+	walPath := filepath.Join(ts.Storage.ProjectsRoot, "user1/project", "old.gpkg-wal")
+	assert.NoError(t, os.WriteFile(walPath, []byte("wal data"), 0644))
+
+	rec := ts.Request(http.MethodDelete, "/api/project/temp-files/user1/project", nil, "user1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.FileExists(t, walPath)
+
+	rec = ts.Request(http.MethodDelete, "/api/project/temp-files/user1/project?confirm=true", nil, "user1")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var data struct {
+			Reclaimed int64 `json:"reclaimed"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &data))
+		assert.Equal(t, int64(8), data.Reclaimed)
+	}
+	assert.NoFileExists(t, walPath)
+}
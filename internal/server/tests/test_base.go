@@ -90,7 +90,7 @@ func prepareDB() error {
 		dbConn.Close()
 	}()
 
-	account, err := domain.NewAccount("admin", "admin@localhost", "admin", "admin", "admin")
+	account, err := domain.NewAccount("admin", "admin@localhost", "admin", "admin", "admin", 0)
 	if err != nil {
 		return fmt.Errorf("new account: %w", err)
 	}
@@ -0,0 +1,208 @@
+package server_tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/ws"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memorySessions is in-memory session store used instead of redis
+type memorySessions struct {
+	mu       sync.Mutex
+	sessions map[string]string
+}
+
+func (s *memorySessions) Set(ctx context.Context, sessionID, data string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sessionID] = data
+	return nil
+}
+
+func (s *memorySessions) Get(ctx context.Context, sessionID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.sessions[sessionID]
+	if !ok {
+		return "", auth.ErrInvalidSession
+	}
+	return data, nil
+}
+
+func (s *memorySessions) Del(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+// memoryAccounts is in-memory accounts repository used instead of postgres
+type memoryAccounts struct {
+	mu       sync.Mutex
+	accounts map[string]domain.Account
+}
+
+func (r *memoryAccounts) Create(account domain.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.accounts[account.Username]; exists {
+		return domain.ErrAccountExists
+	}
+	r.accounts[account.Username] = account
+	return nil
+}
+
+func (r *memoryAccounts) Update(account domain.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.accounts[account.Username]; !exists {
+		return domain.ErrAccountNotFound
+	}
+	r.accounts[account.Username] = account
+	return nil
+}
+
+func (r *memoryAccounts) Delete(username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.accounts, username)
+	return nil
+}
+
+func (r *memoryAccounts) GetByUsername(username string) (domain.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	account, exists := r.accounts[username]
+	if !exists {
+		return domain.Account{}, domain.ErrAccountNotFound
+	}
+	return account, nil
+}
+
+func (r *memoryAccounts) GetByEmail(email string) (domain.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, account := range r.accounts {
+		if account.Email == email {
+			return account, nil
+		}
+	}
+	return domain.Account{}, domain.ErrAccountNotFound
+}
+
+func (r *memoryAccounts) EmailExists(email string) (bool, error) {
+	_, err := r.GetByEmail(email)
+	return err == nil, nil
+}
+
+func (r *memoryAccounts) UsernameExists(username string) (bool, error) {
+	_, err := r.GetByUsername(username)
+	return err == nil, nil
+}
+
+func (r *memoryAccounts) GetAllAccounts() ([]domain.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	accounts := make([]domain.Account, 0, len(r.accounts))
+	for _, account := range r.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (r *memoryAccounts) GetActiveAccounts() ([]domain.Account, error) {
+	all, _ := r.GetAllAccounts()
+	var accounts []domain.Account
+	for _, account := range all {
+		if account.Active {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+// testServer is a server with in-memory accounts and sessions and projects stored in
+// a temporary directory, it doesn't require postgres nor redis
+type testServer struct {
+	*server.Server
+	t        *testing.T
+	Storage  *project.DiskStorage
+	Projects application.ProjectService
+	Accounts *memoryAccounts
+	sessions *memorySessions
+}
+
+func newTestServer(t *testing.T, cfg server.Config) *testServer {
+	log := zap.NewNop().Sugar()
+	if cfg.ProjectsRoot == "" {
+		cfg.ProjectsRoot = t.TempDir()
+	}
+	storage := project.NewDiskStorage(log, cfg.ProjectsRoot)
+	limiter := project.NewSimpleProjectsLimiter(domain.AccountConfig{ProjectsCountLimit: -1, ProjectSizeLimit: -1, StorageLimit: -1})
+	projects := application.NewProjectsService(log, storage, limiter, application.ProjectsServiceConfig{})
+	accounts := &memoryAccounts{accounts: make(map[string]domain.Account)}
+	sessions := &memorySessions{sessions: make(map[string]string)}
+	as := auth.NewAuthService(log, time.Hour, accounts, sessions)
+	accountsService := application.NewAccountsService(nil, accounts, nil, nil)
+	s := server.NewServer(log, cfg, as, accountsService, projects, ws.NewSettingsWS(log, nil), nil, nil, nil, nil, nil)
+	// closes the storage too
+	t.Cleanup(projects.Close)
+	return &testServer{Server: s, t: t, Storage: storage, Projects: projects, Accounts: accounts, sessions: sessions}
+}
+
+// AddUser creates active account with a session (session ID is the username)
+func (ts *testServer) AddUser(username string, superuser bool) {
+	account, err := domain.NewAccount(username, username+"@localhost", "", "", "password", bcrypt.MinCost)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	account.Active = true
+	account.Superuser = superuser
+	if err := ts.Accounts.Create(account); err != nil {
+		ts.t.Fatal(err)
+	}
+	ts.sessions.Set(context.Background(), username, username, time.Hour)
+}
+
+// CreateProject creates project with minimal metadata
+func (ts *testServer) CreateProject(projectName string) {
+	ts.CreateProjectWithMeta(projectName, `{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers": {}, "layers_tree": []}`)
+}
+
+// CreateProjectWithMeta creates project with the given metadata and public access settings
+func (ts *testServer) CreateProjectWithMeta(projectName, meta string) {
+	if _, err := ts.Storage.Create(projectName, json.RawMessage(meta)); err != nil {
+		ts.t.Fatal(err)
+	}
+	if err := ts.Projects.UpdateSettings(projectName, json.RawMessage(`{"title": "Test", "auth": {"type": "public"}}`)); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+// Request sends the request as the given user (anonymous when empty)
+func (ts *testServer) Request(method, target string, body io.Reader, username string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if username != "" {
+		req.AddCookie(&http.Cookie{Name: "gq_session", Value: username})
+	}
+	rec := httptest.NewRecorder()
+	ts.ServeHTTP(rec, req)
+	return rec
+}
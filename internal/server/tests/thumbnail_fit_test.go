@@ -0,0 +1,39 @@
+package server_tests
+
+import (
+	"image"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThumbnailFit(t *testing.T) {
+	fit, err := server.ParseThumbnailFit("")
+	assert.NoError(t, err)
+	assert.Equal(t, server.ThumbnailContain, fit)
+
+	fit, err = server.ParseThumbnailFit("Cover")
+	assert.NoError(t, err)
+	assert.Equal(t, server.ThumbnailCover, fit)
+
+	_, err = server.ParseThumbnailFit("stretch")
+	assert.Error(t, err)
+}
+
+func TestResizeThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+
+	assert.Equal(t, image.Rect(0, 0, 200, 100), server.ResizeThumbnail(img, 200, 200, server.ThumbnailContain).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 200, 200), server.ResizeThumbnail(img, 200, 200, server.ThumbnailCover).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 200, 150), server.ResizeThumbnail(img, 200, 150, server.ThumbnailFill).Bounds())
+}
+
+func TestThumbnailCachePath(t *testing.T) {
+	assert.Equal(t, "web/photos/a.jpg", server.ThumbnailCachePath("web/photos/a.jpg", server.ThumbnailContain))
+	assert.Equal(t, "cover/web/photos/a.jpg", server.ThumbnailCachePath("web/photos/a.jpg", server.ThumbnailCover))
+
+	handler := server.S3FileHandler{}
+	assert.Equal(t, "web/photos/thumbs/a.jpg", handler.GetThumbnailPath("web/photos/a.jpg", server.ThumbnailContain))
+	assert.Equal(t, "web/photos/thumbs/fill/a.jpg", handler.GetThumbnailPath("web/photos/a.jpg", server.ThumbnailFill))
+}
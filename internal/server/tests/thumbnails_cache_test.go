@@ -0,0 +1,75 @@
+package server_tests
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnailsCacheEviction(t *testing.T) {
+	image, err := os.ReadFile("../../../mocks/files/gisquick_logo.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+	createImage := func(ts *testServer, name string) {
+		_, err := ts.Storage.CreateFile("user1/project", "web", name, bytes.NewReader(image))
+		assert.NoError(t, err)
+	}
+	thumbnail := func(ts *testServer, name string) {
+		rec := ts.Request(http.MethodGet, "/api/project/media/user1/project/web/"+name+"?thumbnail=true", nil, "user1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// size of the generated thumbnail
+	root := t.TempDir()
+	ts := newTestServer(t, server.Config{ThumbnailsRoot: root})
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project")
+	createImage(ts, "new.png")
+	thumbnail(ts, "new.png")
+	finfo, err := os.Stat(filepath.Join(root, "user1/project/web/new.png"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	thumbSize := finfo.Size()
+
+	// existing thumbnails (access time is initialized from modification time)
+	root = t.TempDir()
+	thumbsDir := filepath.Join(root, "user1/project/web")
+	assert.NoError(t, os.MkdirAll(thumbsDir, 0775))
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"old.png": 3 * time.Hour, "b.png": 2 * time.Hour, "recent.png": time.Hour} {
+		path := filepath.Join(thumbsDir, name)
+		assert.NoError(t, os.WriteFile(path, make([]byte, thumbSize/2), 0644))
+		mtime := now.Add(-age)
+		assert.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+
+	ts = newTestServer(t, server.Config{ThumbnailsRoot: root, ThumbnailsCacheSize: 2 * thumbSize})
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project")
+	createImage(ts, "b.png")
+	createImage(ts, "new.png")
+	// source image of the cached b.png thumbnail is older than the thumbnail
+	srcTime := now.Add(-5 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(ts.Storage.ProjectsRoot, "user1/project/web/b.png"), srcTime, srcTime))
+
+	// access of the cached thumbnail updates its access time
+	thumbnail(ts, "b.png")
+	// new thumbnail exceeds the size limit, least recently used thumbnails are removed
+	thumbnail(ts, "new.png")
+
+	assert.Eventually(t, func() bool {
+		_, errOld := os.Stat(filepath.Join(thumbsDir, "old.png"))
+		_, errRecent := os.Stat(filepath.Join(thumbsDir, "recent.png"))
+		return os.IsNotExist(errOld) && os.IsNotExist(errRecent)
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.FileExists(t, filepath.Join(thumbsDir, "b.png"))
+	assert.FileExists(t, filepath.Join(thumbsDir, "new.png"))
+}
@@ -0,0 +1,27 @@
+package server_tests
+
+import (
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFileExtension(t *testing.T) {
+	config := domain.AccountConfig{}
+	assert.True(t, config.CheckFileExtension("data/roads.shp"))
+	assert.True(t, config.CheckFileExtension("README"))
+
+	config = domain.AccountConfig{DeniedExtensions: []string{".exe", "BAT"}}
+	assert.False(t, config.CheckFileExtension("tools/setup.EXE"))
+	assert.False(t, config.CheckFileExtension("run.bat"))
+	assert.True(t, config.CheckFileExtension("project.qgs"))
+
+	config = domain.AccountConfig{AllowedExtensions: []string{".qgs", "gpkg", ".exe"}, DeniedExtensions: []string{".exe"}}
+	assert.True(t, config.CheckFileExtension("project.qgs"))
+	assert.True(t, config.CheckFileExtension("data/db.GPKG"))
+	assert.False(t, config.CheckFileExtension("data/roads.shp"))
+	assert.False(t, config.CheckFileExtension("README"))
+	// denylist has precedence
+	assert.False(t, config.CheckFileExtension("setup.exe"))
+}
@@ -0,0 +1,52 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadPlan(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+	ts.CreateProject("user1/project")
+	serverFiles := map[string]string{
+		"data/a.txt":    "hello",
+		"data/b.txt":    "world",
+		"data/old.txt":  "old",
+		"web/photo.jpg": "jpg",
+	}
+	for path, content := range serverFiles {
+		_, err := ts.Storage.CreateFile("user1/project", filepath.Dir(path), filepath.Base(path), strings.NewReader(content))
+		assert.NoError(t, err)
+	}
+
+	body := `{"files": [
+		{"path": "data/a.txt", "size": 5, "hash": "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{"path": "data/b.txt", "size": 5, "hash": "0000000000000000000000000000000000000000"},
+		{"path": "data/c.txt", "size": 3, "hash": "1111111111111111111111111111111111111111"},
+		{"path": "test.qgs", "size": 10}
+	]}`
+	rec := ts.Request(http.MethodPost, "/api/project/upload-plan/user1/project", strings.NewReader(body), "user1")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var plan application.UploadPlan
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &plan))
+		uploads := make([]string, len(plan.Upload))
+		for i, f := range plan.Upload {
+			uploads[i] = f.Path
+		}
+		// unchanged files are skipped
+		assert.ElementsMatch(t, []string{"data/b.txt", "data/c.txt", "test.qgs"}, uploads)
+		// media files uploaded from the web app are never removed
+		assert.Equal(t, []string{"data/old.txt"}, plan.Remove)
+	}
+
+	rec = ts.Request(http.MethodPost, "/api/project/upload-plan/user1/project", strings.NewReader(`{"files": `), "user1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,72 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportUsers(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("admin", true)
+	ts.AddUser("user1", false)
+
+	users := `[
+		{"username": " alice ", "email": "Alice@example.com", "is_active": true},
+		{"username": "bob smith", "email": "bob@example.com"},
+		{"username": "alice", "email": "alice2@example.com"},
+		{"username": "admin"},
+		{"username": "carol", "email": "alice@example.com"},
+		{"username": "dave", "email": "dave@"},
+		{"username": "erin"}
+	]`
+	type Response struct {
+		Created int                               `json:"created"`
+		Failed  int                               `json:"failed"`
+		Results []application.AccountImportResult `json:"results"`
+	}
+	importUsers := func(query string) Response {
+		rec := ts.Request(http.MethodPost, "/api/admin/users/import"+query, strings.NewReader(users), "admin")
+		var resp Response
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return resp
+	}
+	statuses := func(resp Response) []string {
+		list := make([]string, len(resp.Results))
+		for i, r := range resp.Results {
+			list[i] = r.Status
+		}
+		return list
+	}
+
+	resp := importUsers("?dry_run=true")
+	assert.Equal(t, 0, resp.Created)
+	assert.Equal(t, 5, resp.Failed)
+	assert.Equal(t, []string{"valid", "error", "error", "error", "error", "error", "valid"}, statuses(resp))
+	exists, err := ts.Accounts.UsernameExists("alice")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	resp = importUsers("")
+	assert.Equal(t, 2, resp.Created)
+	assert.Equal(t, 5, resp.Failed)
+	assert.Equal(t, []string{"created", "error", "error", "error", "error", "error", "created"}, statuses(resp))
+	assert.Contains(t, resp.Results[2].Error, "duplicate username")
+	assert.Contains(t, resp.Results[3].Error, "already exists")
+	assert.Contains(t, resp.Results[4].Error, "duplicate email")
+	account, err := ts.Accounts.GetByUsername("alice")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice@example.com", account.Email)
+		assert.True(t, account.Active)
+	}
+
+	rec := ts.Request(http.MethodPost, "/api/admin/users/import", strings.NewReader(users), "user1")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
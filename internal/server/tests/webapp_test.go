@@ -0,0 +1,41 @@
+package server_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestWebAppFallback(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "index.html"), []byte("<html>app</html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "app.js"), []byte("console.log(1)"), 0644))
+
+	cfg := server.Config{WebAppRoot: root}
+	s := server.NewServer(zap.NewNop().Sugar(), cfg, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	rec := get("/app.js")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "console.log(1)", rec.Body.String())
+
+	for _, path := range []string{"/", "/maps/user/project", "/login"} {
+		rec = get(path)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, "<html>app</html>", rec.Body.String(), path)
+	}
+	for _, path := range []string{"/missing.js", "/api/unknown", "/ws/unknown", "/plugins/unknown", "/../../etc/passwd.txt"} {
+		rec = get(path)
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+}
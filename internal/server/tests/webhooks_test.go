@@ -0,0 +1,125 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProjectWebhooks(t *testing.T) {
+	events := make(chan application.WebhookEvent, 10)
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// first delivery fails and must be retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var e application.WebhookEvent
+		json.Unmarshal(body, &e)
+		assert.Equal(t, application.WebhookSignature("secret", body), r.Header.Get("X-Gisquick-Signature"))
+		events <- e
+	}))
+	defer ts.Close()
+
+	log := zap.NewNop().Sugar()
+	storage := project.NewDiskStorage(log, t.TempDir())
+	meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers": {}, "layers_tree": []}`)
+	_, err := storage.Create("test/project", meta)
+	assert.NoError(t, err)
+	// test server listens on loopback
+	cfg := application.ProjectsServiceConfig{
+		Webhooks: application.WebhooksConfig{RetryDelay: 10 * time.Millisecond, AllowPrivateNetworks: true},
+	}
+	service := application.NewProjectsService(log, storage, nil, cfg)
+	defer service.Close()
+
+	settings := `{"auth": {"type": "public"}, "webhooks": [{"url": "` + ts.URL + `", "secret": "secret", "events": ["settings_updated"]}]}`
+	assert.NoError(t, service.UpdateSettings("test/project", json.RawMessage(settings)))
+	select {
+	case e := <-events:
+		assert.Equal(t, application.WebhookEventSettingsUpdated, e.Event)
+		assert.Equal(t, "test/project", e.Project)
+	case <-time.After(3 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	invalid := `{"auth": {"type": "public"}, "webhooks": [{"url": "ftp://example.com"}]}`
+	assert.ErrorIs(t, service.UpdateSettings("test/project", json.RawMessage(invalid)), application.ErrInvalidSettings)
+}
+
+func TestWebhooksInternalAddresses(t *testing.T) {
+	var requests int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer internal.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Redirect(w, r, internal.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	// redirects are not followed even when private networks are allowed
+	client := application.NewWebhookClient(application.WebhooksConfig{Timeout: time.Second, AllowPrivateNetworks: true})
+	resp, err := client.Post(redirect.URL, "application/json", nil)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	client = application.NewWebhookClient(application.WebhooksConfig{Timeout: time.Second})
+	for _, u := range []string{internal.URL, "http://169.254.169.254/latest/meta-data/", "http://10.0.0.1/", "http://[::1]:80/"} {
+		_, err := client.Post(u, "application/json", nil)
+		assert.ErrorIs(t, err, application.ErrWebhookAddressNotAllowed, u)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestBookmarksSettingsWebhook(t *testing.T) {
+	events := make(chan application.WebhookEvent, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e application.WebhookEvent
+		json.NewDecoder(r.Body).Decode(&e)
+		events <- e
+	}))
+	defer ts.Close()
+
+	log := zap.NewNop().Sugar()
+	storage := project.NewDiskStorage(log, t.TempDir())
+	meta := json.RawMessage(`{"title": "Test", "file": "test.qgs", "projection": "EPSG:3857", "layers": {}, "layers_tree": []}`)
+	_, err := storage.Create("test/project", meta)
+	assert.NoError(t, err)
+	cfg := application.ProjectsServiceConfig{
+		Webhooks: application.WebhooksConfig{RetryDelay: 10 * time.Millisecond, AllowPrivateNetworks: true},
+	}
+	service := application.NewProjectsService(log, storage, nil, cfg)
+	defer service.Close()
+
+	settings := `{"auth": {"type": "public"}, "webhooks": [{"url": "` + ts.URL + `", "events": ["settings_updated"]}]}`
+	assert.NoError(t, service.UpdateSettings("test/project", json.RawMessage(settings)))
+	<-events
+
+	data := application.BookmarksSettings{Bookmarks: map[string]map[string]domain.Bookmark{}}
+	assert.NoError(t, service.UpdateBookmarksSettings("test/project", data))
+	select {
+	case e := <-events:
+		assert.Equal(t, application.WebhookEventSettingsUpdated, e.Event)
+		assert.Equal(t, "test/project", e.Project)
+	case <-time.After(3 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
@@ -0,0 +1,62 @@
+package server_tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebsocketRequiresAuthentication(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+
+	for _, path := range []string{"/ws/app", "/ws/plugin"} {
+		// anonymous upgrade requests are rejected before the upgrade
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		rec := httptest.NewRecorder()
+		ts.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+
+		// invalid basic auth credentials
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("user1:wrong")))
+		rec = httptest.NewRecorder()
+		ts.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+
+		// username in query parameter is not used for authentication
+		rec = ts.Request(http.MethodGet, path+"?user=user1", nil, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+	}
+}
+
+func TestWebsocketAuthErrorIsNotShared(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	ts.AddUser("user1", false)
+
+	req := httptest.NewRequest(http.MethodGet, "/ws/app", nil)
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("user1:wrong")))
+	rec := httptest.NewRecorder()
+	ts.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Nil(t, echo.ErrUnauthorized.Internal)
+
+	// unrelated 401 response must not carry credentials error of the websocket request
+	rec = ts.Request(http.MethodGet, "/api/account", nil, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	var resp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "unauthorized", resp.Error.Code)
+}
@@ -0,0 +1,131 @@
+package server_tests
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTileUrlUsesPublishRoot(t *testing.T) {
+	cfg := server.Config{
+		MapserverURL: "http://qgisserver/wms",
+		PublishRoot:  "/srv/projects",
+	}
+	s := server.NewServer(zap.NewNop().Sugar(), cfg, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	tile := server.Tile{
+		ProjectFullName: "test/project",
+		Version:         "1.1.1",
+		Layers:          "roads",
+		BoundingBox:     "0,0,100,100",
+		Width:           256,
+		Height:          256,
+		Projection:      "EPSG:3857",
+		Format:          "image/png",
+	}
+	u := s.GetTileUrl(tile, domain.ProjectInfo{QgisFile: "project.qgs"})
+
+	assert.Equal(t, "/srv/projects/test/project/project.qgs", u.Query().Get("MAP"))
+	assert.Equal(t, "qgisserver", u.Host)
+}
+
+func TestParseTileFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+		mime     string
+	}{
+		{"image/png", "png", "image/png"},
+		{"image/png; mode=8bit", "png", "image/png"},
+		{"image/jpeg", "jpeg", "image/jpeg"},
+		{"JPG", "jpeg", "image/jpeg"},
+		{"", "jpeg", "image/jpeg"},
+	}
+	for _, tt := range tests {
+		format, mime, err := server.ParseTileFormat(tt.format, "jpeg")
+		if assert.NoError(t, err, tt.format) {
+			assert.Equal(t, tt.expected, format, tt.format)
+			assert.Equal(t, tt.mime, mime, tt.format)
+		}
+	}
+	_, _, err := server.ParseTileFormat("image/gif", "png")
+	assert.Error(t, err)
+}
+
+func TestEncodeTile(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+
+	var buf bytes.Buffer
+	assert.NoError(t, server.EncodeTile(&buf, img, "png"))
+	decoded, err := png.Decode(&buf)
+	if assert.NoError(t, err) {
+		_, _, _, a := decoded.At(3, 3).RGBA()
+		assert.Equal(t, uint32(0), a)
+	}
+
+	buf.Reset()
+	assert.NoError(t, server.EncodeTile(&buf, img, "jpeg"))
+	decoded, err = jpeg.Decode(&buf)
+	if assert.NoError(t, err) {
+		// transparent areas are white
+		r, g, b, _ := decoded.At(3, 3).RGBA()
+		assert.True(t, r > 0xf000 && g > 0xf000 && b > 0xf000)
+	}
+}
+
+func TestTileUrlTransparency(t *testing.T) {
+	s := server.NewServer(zap.NewNop().Sugar(), server.Config{MapserverURL: "http://qgisserver/wms"}, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	tile := server.Tile{ProjectFullName: "test/project", Format: "image/jpeg", ImageFormat: "jpeg"}
+	u := s.GetTileUrl(tile, domain.ProjectInfo{QgisFile: "project.qgs"})
+	assert.Equal(t, "false", u.Query().Get("TRANSPARENT"))
+
+	tile.Format, tile.ImageFormat = "image/png", "png"
+	u = s.GetTileUrl(tile, domain.ProjectInfo{QgisFile: "project.qgs"})
+	assert.Equal(t, "true", u.Query().Get("TRANSPARENT"))
+}
+
+func TestTileUrlDPI(t *testing.T) {
+	s := server.NewServer(zap.NewNop().Sugar(), server.Config{MapserverURL: "http://qgisserver/wms"}, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	tile := server.Tile{ProjectFullName: "test/project", Width: 512, Height: 512, Format: "image/png", ImageFormat: "png"}
+
+	u := s.GetTileUrl(tile, domain.ProjectInfo{QgisFile: "project.qgs"})
+	assert.Empty(t, u.Query().Get("DPI"))
+
+	tile.DPI = 192
+	u = s.GetTileUrl(tile, domain.ProjectInfo{QgisFile: "project.qgs"})
+	assert.Equal(t, "192", u.Query().Get("DPI"))
+	assert.Equal(t, "192", u.Query().Get("MAP_RESOLUTION"))
+}
+
+func TestParseTileDPI(t *testing.T) {
+	dpi, err := server.ParseTileDPI(url.Values{}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, dpi)
+
+	dpi, err = server.ParseTileDPI(url.Values{}, 144)
+	assert.NoError(t, err)
+	assert.Equal(t, 144, dpi)
+
+	dpi, err = server.ParseTileDPI(url.Values{"DPI": {"192"}}, 96)
+	assert.NoError(t, err)
+	assert.Equal(t, 192, dpi)
+
+	dpi, err = server.ParseTileDPI(url.Values{"MAP_RESOLUTION": {"288"}}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 288, dpi)
+
+	for _, value := range []string{"100", "abc", "-96"} {
+		_, err = server.ParseTileDPI(url.Values{"DPI": {value}}, 96)
+		assert.Error(t, err, value)
+	}
+}
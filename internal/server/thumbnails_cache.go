@@ -0,0 +1,168 @@
+package server
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type thumbnailEntry struct {
+	size       int64
+	lastAccess time.Time
+}
+
+// thumbnailsCache tracks size and access times of the cached thumbnail images and removes
+// least recently used images in background when the total size exceeds the limit
+type thumbnailsCache struct {
+	log     *zap.SugaredLogger
+	root    string
+	maxSize int64
+	mu      sync.Mutex
+	entries map[string]*thumbnailEntry
+	size    int64
+	evict   chan struct{}
+	done    chan struct{}
+}
+
+func newThumbnailsCache(log *zap.SugaredLogger, root string, maxSize int64) *thumbnailsCache {
+	c := &thumbnailsCache{
+		log:     log,
+		root:    root,
+		maxSize: maxSize,
+		entries: make(map[string]*thumbnailEntry),
+		evict:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// scan registers already existing thumbnails (modification time is used as the last access time)
+func (c *thumbnailsCache) scan() {
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		c.mu.Lock()
+		if _, ok := c.entries[path]; !ok {
+			c.entries[path] = &thumbnailEntry{size: info.Size(), lastAccess: info.ModTime()}
+			c.size += info.Size()
+		}
+		c.mu.Unlock()
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		c.log.Errorw("scanning thumbnails cache", "path", c.root, zap.Error(err))
+	}
+	c.notify()
+}
+
+func (c *thumbnailsCache) run() {
+	c.scan()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.evict:
+			c.evictLRU()
+		}
+	}
+}
+
+func (c *thumbnailsCache) notify() {
+	select {
+	case c.evict <- struct{}{}:
+	default:
+	}
+}
+
+// Add registers a new (or updated) thumbnail file
+func (c *thumbnailsCache) Add(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	if e, ok := c.entries[path]; ok {
+		c.size -= e.size
+	}
+	c.entries[path] = &thumbnailEntry{size: info.Size(), lastAccess: time.Now()}
+	c.size += info.Size()
+	exceeded := c.size > c.maxSize
+	c.mu.Unlock()
+	if exceeded {
+		c.notify()
+	}
+}
+
+// Touch updates last access time of the thumbnail
+func (c *thumbnailsCache) Touch(path string) {
+	c.mu.Lock()
+	e, ok := c.entries[path]
+	if ok {
+		e.lastAccess = time.Now()
+	}
+	c.mu.Unlock()
+	if !ok {
+		c.Add(path)
+	}
+}
+
+// evictLRU removes least recently used thumbnails until the cache size drops below 90% of the limit
+func (c *thumbnailsCache) evictLRU() {
+	c.mu.Lock()
+	if c.size <= c.maxSize {
+		c.mu.Unlock()
+		return
+	}
+	paths := make([]string, 0, len(c.entries))
+	for p := range c.entries {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return c.entries[paths[i]].lastAccess.Before(c.entries[paths[j]].lastAccess)
+	})
+	target := c.maxSize * 9 / 10
+	var removed []string
+	for _, p := range paths {
+		if c.size <= target {
+			break
+		}
+		c.size -= c.entries[p].size
+		delete(c.entries, p)
+		removed = append(removed, p)
+	}
+	c.mu.Unlock()
+
+	for _, p := range removed {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			c.log.Warnw("removing cached thumbnail", "path", p, zap.Error(err))
+		}
+	}
+	c.log.Infow("thumbnails cache cleanup", "removed", len(removed))
+}
+
+func (c *thumbnailsCache) Close() {
+	close(c.done)
+}
+
+func (s *Server) thumbnailCreated(path string) {
+	if s.thumbnails != nil {
+		s.thumbnails.Add(path)
+	}
+}
+
+func (s *Server) thumbnailAccessed(path string) {
+	if s.thumbnails != nil {
+		s.thumbnails.Touch(path)
+	}
+}
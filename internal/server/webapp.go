@@ -0,0 +1,44 @@
+package server
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// path prefixes handled by the server, never served by the web client handler
+var reservedPathPrefixes = []string{"/api", "/ws", "/plugins"}
+
+func isReservedPath(p string) bool {
+	for _, prefix := range reservedPathPrefixes {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWebApp serves static files of the web client (SPA), unknown paths fall back
+// to index.html, so that client side routes (deep links) work
+func (s *Server) handleWebApp(root string) func(echo.Context) error {
+	index := filepath.Join(root, "index.html")
+	return func(c echo.Context) error {
+		p := path.Clean("/" + c.Request().URL.Path)
+		if isReservedPath(p) {
+			return echo.ErrNotFound
+		}
+		fpath := filepath.Join(root, filepath.FromSlash(p))
+		if info, err := os.Stat(fpath); err == nil && !info.IsDir() {
+			return c.File(fpath)
+		}
+		// missing assets (scripts, images, ...) shouldn't be replaced by html page
+		if path.Ext(p) != "" {
+			return echo.ErrNotFound
+		}
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		return c.File(index)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"image/png"
 	"io"
@@ -16,9 +18,11 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
 func (s *Server) checkAccess(c echo.Context) error {
@@ -44,6 +48,42 @@ type Tile struct {
 	Version string
 	Width   int
 	Height  int
+	// rendering resolution, mapserver default is used when zero
+	DPI int
+}
+
+// ParseTileDPI returns requested tile resolution (DPI or MAP_RESOLUTION parameter), default
+// value is used when not specified. Only values from domain.TileDPIs are accepted.
+func ParseTileDPI(query url.Values, defaultDPI int) (int, error) {
+	value := query.Get("DPI")
+	if value == "" {
+		value = query.Get("MAP_RESOLUTION")
+	}
+	if value == "" {
+		return defaultDPI, nil
+	}
+	dpi, err := strconv.Atoi(value)
+	if err != nil || !domain.IsValidTileDPI(dpi) {
+		return 0, fmt.Errorf("unsupported tile DPI: %s", value)
+	}
+	return dpi, nil
+}
+
+// ParseTileFormat returns image format (file extension) and mime type of the requested
+// tile format (e.g. image/jpeg or png). Default format is used for empty value.
+func ParseTileFormat(format, defaultFormat string) (string, string, error) {
+	if format == "" {
+		format = defaultFormat
+	}
+	// ignore format options, e.g. "image/png; mode=8bit"
+	format = strings.ToLower(strings.TrimSpace(strings.SplitN(format, ";", 2)[0]))
+	switch strings.TrimPrefix(format, "image/") {
+	case "", "png":
+		return "png", "image/png", nil
+	case "jpeg", "jpg":
+		return "jpeg", "image/jpeg", nil
+	}
+	return "", "", fmt.Errorf("unsupported tile format: %s", format)
 }
 
 func (s *Server) InvalidateMapCache(ProjectFullName string) error {
@@ -55,6 +95,17 @@ func (s *Server) InvalidateMapCache(ProjectFullName string) error {
 	return os.RemoveAll(dir)
 }
 
+// invalidateProjectMapCache removes cached map tiles of the project (if map cache is enabled),
+// errors are only logged
+func (s *Server) invalidateProjectMapCache(projectName string) {
+	if s.Config.MapCacheRoot == "" {
+		return
+	}
+	if err := s.InvalidateMapCache(projectName); err != nil {
+		s.log.Errorw("clearing project mapcache", "project", projectName, zap.Error(err))
+	}
+}
+
 func (s *Server) removeMapCache(c echo.Context) error {
 	projectName := getProjectName(c)
 	return s.InvalidateMapCache(projectName)
@@ -67,7 +118,11 @@ func (s *Server) getTilePath(tile Tile) string {
 	layersHash := fmt.Sprintf("%x", md5.Sum([]byte(tile.Layers)))
 	bboxHash := fmt.Sprintf("%x", md5.Sum([]byte(tile.BoundingBox)))
 
-	return filepath.Join(baseDir, projectHash, layersHash, bboxHash+"."+tile.ImageFormat)
+	name := bboxHash
+	if tile.DPI > 0 {
+		name = fmt.Sprintf("%s@%d", bboxHash, tile.DPI)
+	}
+	return filepath.Join(baseDir, projectHash, layersHash, name+"."+tile.ImageFormat)
 }
 
 func (s *Server) GetTileCache(c echo.Context, tilePath string) (io.ReadCloser, error) {
@@ -82,7 +137,7 @@ func (s *Server) GetTileCache(c echo.Context, tilePath string) (io.ReadCloser, e
 }
 
 func (s *Server) GetTileUrl(tile Tile, projectInfo domain.ProjectInfo) *url.URL {
-	owsProject := filepath.Join("/publish", tile.ProjectFullName, projectInfo.QgisFile)
+	owsProject := s.owsProjectPath(tile.ProjectFullName, projectInfo.QgisFile)
 
 	params := map[string]string{
 		"VERSION":     tile.Version,
@@ -95,9 +150,13 @@ func (s *Server) GetTileUrl(tile Tile, projectInfo domain.ProjectInfo) *url.URL
 		"SRS":         tile.Projection,
 		"FORMAT":      tile.Format,
 		"LAYERS":      tile.Layers,
-		"TRANSPARENT": "true",
+		"TRANSPARENT": strconv.FormatBool(tile.ImageFormat != "jpeg"),
 		"TILED":       "true",
 	}
+	if tile.DPI > 0 {
+		params["DPI"] = strconv.Itoa(tile.DPI)
+		params["MAP_RESOLUTION"] = strconv.Itoa(tile.DPI)
+	}
 	u, _ := url.Parse(s.Config.MapserverURL)
 	urlParams := u.Query()
 	for name, val := range params {
@@ -107,20 +166,24 @@ func (s *Server) GetTileUrl(tile Tile, projectInfo domain.ProjectInfo) *url.URL
 	return u
 }
 
-func (s *Server) SaveTile(tilePath string, data io.Reader) error {
-
-	img, format, err := image.Decode(data)
-	if err != nil {
-		return err
+// EncodeTile writes the image in the given format (png or jpeg), transparent areas are
+// filled with white color in jpeg images
+func EncodeTile(out io.Writer, img image.Image, format string) error {
+	if format == "jpeg" {
+		bg := image.NewRGBA(img.Bounds())
+		draw.Draw(bg, bg.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+		draw.Draw(bg, bg.Bounds(), img, img.Bounds().Min, draw.Over)
+		return jpeg.Encode(out, bg, nil)
 	}
+	return png.Encode(out, img)
+}
 
-	var encodeImage func(io.Writer, image.Image) error
-	if format == "png" {
-		encodeImage = png.Encode
-	} else if format == "jpeg" {
-		encodeImage = func(out io.Writer, i image.Image) error {
-			return jpeg.Encode(out, i, nil)
-		}
+// SaveTile stores the tile image in the given format, image is converted when the mapserver
+// responded with a different format than requested
+func (s *Server) SaveTile(tilePath, format string, data io.Reader) error {
+	img, _, err := image.Decode(data)
+	if err != nil {
+		return fmt.Errorf("decoding tile image: %w", err)
 	}
 
 	log.Println("saving tile to:", tilePath)
@@ -131,7 +194,8 @@ func (s *Server) SaveTile(tilePath string, data io.Reader) error {
 	if err != nil {
 		return fmt.Errorf("creating tile file: %v", err)
 	}
-	if err := encodeImage(f, img); err != nil {
+	defer f.Close()
+	if err := EncodeTile(f, img, format); err != nil {
 		return fmt.Errorf("encoding tile image: %v", err)
 	}
 	return nil
@@ -153,7 +217,7 @@ func closeIfNotNil(closer io.Closer) {
 }
 
 func (s *Server) handleMapCachedOws() func(c echo.Context) error {
-	client := &http.Client{}
+	client := &http.Client{Transport: s.mapserverTransport}
 
 	return func(c echo.Context) error {
 		// Check access to service resource (project, layers, user, etc.)
@@ -170,6 +234,22 @@ func (s *Server) handleMapCachedOws() func(c echo.Context) error {
 			return fmt.Errorf("reading project info: %w", err)
 		}
 
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		defaultFormat := settings.TileFormat
+		if defaultFormat == "" {
+			defaultFormat = s.Config.MapCacheImageFormat
+		}
+		imageFormat, mimeType, err := ParseTileFormat(c.QueryParam("FORMAT"), defaultFormat)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unsupported image format").SetInternal(err)
+		}
+		dpi, err := ParseTileDPI(c.QueryParams(), settings.TileDPI)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unsupported DPI").SetInternal(err)
+		}
 		tile := Tile{
 			Project:         pInfo,
 			ProjectFullName: projectName,
@@ -179,8 +259,9 @@ func (s *Server) handleMapCachedOws() func(c echo.Context) error {
 			Width:           ParseIntOr(c.QueryParam("WIDTH"), 256),
 			Height:          ParseIntOr(c.QueryParam("HEIGHT"), 256),
 			Version:         c.QueryParam("VERSION"),
-			Format:          c.QueryParam("FORMAT"),
-			ImageFormat:     "png",
+			Format:          mimeType,
+			ImageFormat:     imageFormat,
+			DPI:             dpi,
 		}
 
 		// Find out if the requested tileFile is cached
@@ -197,7 +278,7 @@ func (s *Server) handleMapCachedOws() func(c echo.Context) error {
 		if finalTileFile == nil {
 			// If not, request it from the WMS and save it to the cache
 			tileUrl := s.GetTileUrl(tile, pInfo)
-			req, _ := http.NewRequest(http.MethodGet, tileUrl.String(), nil)
+			req, _ := http.NewRequestWithContext(withMapserverRequestType(c.Request().Context(), "tile"), http.MethodGet, tileUrl.String(), nil)
 			resp, err := client.Do(req)
 			if err != nil {
 				return err
@@ -208,7 +289,9 @@ func (s *Server) handleMapCachedOws() func(c echo.Context) error {
 				return fmt.Errorf(string(msg))
 			}
 
-			if err := s.SaveTile(tilePath, resp.Body); err != nil {
+			err = s.SaveTile(tilePath, tile.ImageFormat, resp.Body)
+			resp.Body.Close()
+			if err != nil {
 				closeIfNotNil(finalTileFile)
 				return err
 			}
@@ -0,0 +1,6 @@
+CREATE TABLE account_limits (
+	"username" varchar(30) PRIMARY KEY REFERENCES users (username) ON DELETE CASCADE ON UPDATE CASCADE,
+	"projects_limit" integer NULL,
+	"project_size_limit" bigint NULL,
+	"storage_limit" bigint NULL
+);